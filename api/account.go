@@ -1,15 +1,12 @@
 package api
 
 import (
-	"database/sql"
 	"errors"
-	"fmt"
 	"net/http"
 
 	db "github.com/dpsigor/cheatsheet-golang-postgres/db/sqlc"
 	"github.com/dpsigor/cheatsheet-golang-postgres/token"
 	"github.com/gin-gonic/gin"
-	"github.com/lib/pq"
 )
 
 type createAccountReq struct {
@@ -20,11 +17,15 @@ type createAccountReq struct {
 func (s *Server) createAccount(ctx *gin.Context) {
 	var req createAccountReq
 	if err := ctx.ShouldBindJSON(&req); err != nil {
-		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		abortWithError(ctx, invalidRequest(err))
 		return
 	}
 
 	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	if err := s.authenticator.RequireVerifiedEmail(ctx, authPayload.Username); err != nil {
+		abortWithError(ctx, err)
+		return
+	}
 	arg := db.CreateAccountParams{
 		Owner:    authPayload.Username,
 		Currency: req.Currency,
@@ -32,17 +33,15 @@ func (s *Server) createAccount(ctx *gin.Context) {
 
 	account, err := s.store.CreateAccount(ctx, arg)
 	if err != nil {
-		if pgErr, ok := err.(*pq.Error); ok {
-			switch pgErr.Code.Name() {
-			case "foreign_key_violation":
-				ctx.JSON(http.StatusForbidden, errorResponse(fmt.Errorf("invalid owner")))
-				return
-			case "unique_violation":
-				ctx.JSON(http.StatusForbidden, errorResponse(fmt.Errorf("owner and currency not unique")))
-				return
-			}
+		switch {
+		case errors.Is(err, db.ErrForeignKey):
+			abortWithError(ctx, newError(http.StatusForbidden, CodeInvalidReference, "invalid owner"))
+			return
+		case errors.Is(err, db.ErrOwnerCurrencyExists):
+			abortWithError(ctx, newError(http.StatusConflict, CodeAccountExists, "owner already has a %s account", req.Currency))
+			return
 		}
-		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		abortWithError(ctx, err)
 		return
 	}
 
@@ -56,37 +55,38 @@ type getAccountReq struct {
 func (s *Server) getAccount(ctx *gin.Context) {
 	var req getAccountReq
 	if err := ctx.ShouldBindUri(&req); err != nil {
-		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		abortWithError(ctx, invalidRequest(err))
 		return
 	}
 
 	account, err := s.store.GetAccount(ctx, req.ID)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			ctx.JSON(http.StatusNotFound, errorResponse(err))
+		if errors.Is(err, db.ErrRecordNotFound) {
+			abortWithError(ctx, newError(http.StatusNotFound, CodeAccountNotFound, "account %d not found", req.ID))
 			return
 		}
-		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		abortWithError(ctx, err)
 		return
 	}
 
 	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
 	if account.Owner != authPayload.Username {
-		err := errors.New("account doesn't belong to the authenticated user")
-		ctx.JSON(http.StatusUnauthorized, errorResponse(err))
+		abortWithError(ctx, newError(http.StatusForbidden, CodeForbidden, "account doesn't belong to the authenticated user"))
+		return
 	}
 
 	ctx.JSON(http.StatusOK, account)
 }
 
+type listAccountReq struct {
+	PageID   int32 `form:"page_id" binding:"required,min=1"`
+	PageSize int32 `form:"page_size" binding:"required,min=5,max=10"`
+}
+
 func (s *Server) listAccount(ctx *gin.Context) {
-	type listAccountReq struct {
-		PageID   int32 `form:"page_id" binding:"required,min=1"`
-		PageSize int32 `form:"page_size" binding:"required,min=5,max=10"`
-	}
 	var req listAccountReq
 	if err := ctx.ShouldBindQuery(&req); err != nil {
-		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		abortWithError(ctx, invalidRequest(err))
 		return
 	}
 
@@ -97,7 +97,7 @@ func (s *Server) listAccount(ctx *gin.Context) {
 		Offset: (req.PageID - 1) * req.PageSize,
 	})
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		abortWithError(ctx, err)
 		return
 	}
 
@@ -61,7 +61,8 @@ func TestGetAccountAPI(t *testing.T) {
 					Return(account, nil)
 			},
 			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
-				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+				requireBodyMatchErrorCode(t, recorder.Body, CodeForbidden)
 			},
 		},
 		{
@@ -92,6 +93,7 @@ func TestGetAccountAPI(t *testing.T) {
 			},
 			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusNotFound, recorder.Code)
+				requireBodyMatchErrorCode(t, recorder.Body, CodeAccountNotFound)
 			},
 		},
 		{
@@ -131,7 +133,7 @@ func TestGetAccountAPI(t *testing.T) {
 		tc := testCases[i]
 		t.Run(tc.name, func(t *testing.T) {
 			ctrl := gomock.NewController(t)
-			store := mockdb.NewMockStore(ctrl)
+			store := newMockStore(ctrl)
 			tc.buildStubs(store)
 
 			// start test server and send request
@@ -249,7 +251,7 @@ func TestCreateAccount(t *testing.T) {
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			ctrl := gomock.NewController(t)
-			store := mockdb.NewMockStore(ctrl)
+			store := newMockStore(ctrl)
 			user, account := tc.buildStubs(store)
 			bs, err := json.Marshal(account)
 			require.NoError(t, err)
@@ -405,7 +407,7 @@ func TestListAccount(t *testing.T) {
 	for _, tc := range testCases {
 		t.Run(tc.desc, func(t *testing.T) {
 			ctrl := gomock.NewController(t)
-			store := mockdb.NewMockStore(ctrl)
+			store := newMockStore(ctrl)
 			tc.buildStubs(store)
 
 			// start test server and send request
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/dpsigor/cheatsheet-golang-postgres/auth"
+	db "github.com/dpsigor/cheatsheet-golang-postgres/db/sqlc"
+	"github.com/dpsigor/cheatsheet-golang-postgres/token"
+	"github.com/gin-gonic/gin"
+)
+
+type createAPIKeyReq struct {
+	Name      string     `json:"name" binding:"required,max=64"`
+	Scopes    []string   `json:"scopes" binding:"omitempty,dive,scope"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type apiKeyRes struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type createAPIKeyRes struct {
+	APIKey apiKeyRes `json:"api_key"`
+	// Key is only answered on creation
+	Key string `json:"key"`
+}
+
+// newAPIKeyResponse leaves out the zero expiry of the keys that never
+// expire, and the zero last use of the keys never used
+func newAPIKeyResponse(apiKey db.APIKey) apiKeyRes {
+	rsp := apiKeyRes{
+		ID:        apiKey.ID,
+		Name:      apiKey.Name,
+		Prefix:    apiKey.Prefix,
+		Scopes:    apiKey.Scopes,
+		CreatedAt: apiKey.CreatedAt,
+	}
+	if !apiKey.ExpiresAt.IsZero() {
+		rsp.ExpiresAt = &apiKey.ExpiresAt
+	}
+	if !apiKey.LastUsedAt.IsZero() {
+		rsp.LastUsedAt = &apiKey.LastUsedAt
+	}
+	return rsp
+}
+
+// createAPIKey creates an API key for the authenticated user, restricted to
+// the scopes of the request, if any
+func (server *Server) createAPIKey(ctx *gin.Context) {
+	var req createAPIKeyReq
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		abortWithError(ctx, invalidRequest(err))
+		return
+	}
+	arg := auth.CreateAPIKeyParams{Name: req.Name, Scopes: req.Scopes}
+	if req.ExpiresAt != nil {
+		if !req.ExpiresAt.After(time.Now()) {
+			abortWithError(ctx, newError(http.StatusBadRequest, CodeInvalidRequest, "expires_at must be in the future"))
+			return
+		}
+		arg.ExpiresAt = *req.ExpiresAt
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	// a scoped token creates keys with some of its scopes only, and its own
+	// scopes by default
+	if len(arg.Scopes) == 0 {
+		arg.Scopes = authPayload.Scopes
+	}
+	for _, scope := range arg.Scopes {
+		if !authPayload.HasScope(scope) {
+			abortWithError(ctx, newError(http.StatusForbidden, CodeInsufficientScope, "cannot grant the %s scope, which the access token lacks", scope))
+			return
+		}
+	}
+	arg.Username = authPayload.Username
+	created, err := server.authenticator.CreateAPIKey(ctx, arg)
+	if err != nil {
+		abortWithError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, createAPIKeyRes{APIKey: newAPIKeyResponse(created.APIKey), Key: created.Key})
+}
+
+// listAPIKeys lists the API keys of the authenticated user, without their
+// secrets
+func (server *Server) listAPIKeys(ctx *gin.Context) {
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	apiKeys, err := server.store.ListAPIKeys(ctx, authPayload.Username)
+	if err != nil {
+		abortWithError(ctx, err)
+		return
+	}
+	rsp := make([]apiKeyRes, len(apiKeys))
+	for i, apiKey := range apiKeys {
+		rsp[i] = newAPIKeyResponse(apiKey)
+	}
+	ctx.JSON(http.StatusOK, rsp)
+}
+
+type deleteAPIKeyReq struct {
+	ID int64 `uri:"id" binding:"required,min=1"`
+}
+
+// deleteAPIKey revokes an API key of the authenticated user
+func (server *Server) deleteAPIKey(ctx *gin.Context) {
+	var req deleteAPIKeyReq
+	if err := ctx.ShouldBindUri(&req); err != nil {
+		abortWithError(ctx, invalidRequest(err))
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	apiKey, err := server.store.DeleteAPIKey(ctx, db.DeleteAPIKeyParams{ID: req.ID, Username: authPayload.Username})
+	if err != nil {
+		if errors.Is(err, db.ErrRecordNotFound) {
+			abortWithError(ctx, newError(http.StatusNotFound, CodeAPIKeyNotFound, "API key %d not found", req.ID))
+			return
+		}
+		abortWithError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, newAPIKeyResponse(apiKey))
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	memdb "github.com/dpsigor/cheatsheet-golang-postgres/db/memory"
+	db "github.com/dpsigor/cheatsheet-golang-postgres/db/sqlc"
+	"github.com/dpsigor/cheatsheet-golang-postgres/util"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIKeysAPI(t *testing.T) {
+	server := newTestServer(t, memdb.NewStore())
+	alice := signUp(t, server)
+
+	recorder := alice.do(http.MethodPost, "/users/me/api_keys", gin.H{"name": "batch", "scopes": []string{"accounts:delete"}}, nil)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	apiErr := requireBodyMatchErrorCode(t, recorder.Body, CodeInvalidRequest)
+	require.Equal(t, "scope", apiErr.Details[0].Rule)
+	recorder = alice.do(http.MethodPost, "/users/me/api_keys", gin.H{"name": "batch", "expires_at": time.Now().Add(-time.Minute)}, nil)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	requireBodyMatchErrorCode(t, recorder.Body, CodeInvalidRequest)
+
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	recorder = alice.do(http.MethodPost, "/users/me/api_keys", gin.H{
+		"name":       "batch",
+		"scopes":     []string{util.AccountsReadScope},
+		"expires_at": expiresAt,
+	}, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	created := decode[createAPIKeyRes](t, recorder)
+	require.NotEmpty(t, created.Key)
+	require.Equal(t, "batch", created.APIKey.Name)
+	require.Equal(t, []string{util.AccountsReadScope}, created.APIKey.Scopes)
+	require.True(t, expiresAt.Equal(*created.APIKey.ExpiresAt))
+	require.Nil(t, created.APIKey.LastUsedAt)
+
+	// the key authenticates as alice, without a login, within its scopes
+	recorder = alice.do(http.MethodPost, "/accounts", gin.H{"owner": "ignored", "currency": util.USD}, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	batch := &apiClient{t: t, server: server}
+	header := http.Header{"Authorization": {"ApiKey " + created.Key}}
+	recorder = batch.do(http.MethodGet, "/accounts?page_id=1&page_size=5", nil, header)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	accounts := decode[[]db.Account](t, recorder)
+	require.Len(t, accounts, 1)
+	require.Equal(t, alice.username, accounts[0].Owner)
+	recorder = batch.do(http.MethodGet, "/users/me", nil, header)
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+	requireBodyMatchErrorCode(t, recorder.Body, CodeInsufficientScope)
+
+	// but cannot manage the keys
+	recorder = batch.do(http.MethodPost, "/users/me/api_keys", gin.H{"name": "escalated"}, header)
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+	requireBodyMatchErrorCode(t, recorder.Body, CodeForbidden)
+
+	// nor, even with users:write, the second factor, email or password
+	recorder = alice.do(http.MethodPost, "/users/me/api_keys", gin.H{"name": "full"}, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	fullHeader := http.Header{"Authorization": {"ApiKey " + decode[createAPIKeyRes](t, recorder).Key}}
+	for _, request := range []struct {
+		method, path string
+		body         gin.H
+	}{
+		{http.MethodPost, "/users/totp", nil},
+		{http.MethodPost, "/users/totp/confirm", gin.H{"code": "123456"}},
+		{http.MethodPatch, "/users/me", gin.H{"email": util.RandomEmail(), "current_password": alice.password}},
+		{http.MethodPut, "/users/me/password", gin.H{"current_password": alice.password, "new_password": util.RandomString(10)}},
+	} {
+		recorder = batch.do(request.method, request.path, request.body, fullHeader)
+		require.Equal(t, http.StatusForbidden, recorder.Code, request.path)
+		requireBodyMatchErrorCode(t, recorder.Body, CodeForbidden)
+	}
+
+	recorder = alice.do(http.MethodGet, "/users/me/api_keys", nil, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	apiKeys := decode[[]apiKeyRes](t, recorder)
+	require.Len(t, apiKeys, 2)
+	require.Equal(t, created.APIKey.ID, apiKeys[0].ID)
+	require.NotNil(t, apiKeys[0].LastUsedAt)
+
+	// the keys of other users are not found
+	bob := signUp(t, server)
+	path := fmt.Sprintf("/users/me/api_keys/%d", created.APIKey.ID)
+	recorder = bob.do(http.MethodDelete, path, nil, nil)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+	requireBodyMatchErrorCode(t, recorder.Body, CodeAPIKeyNotFound)
+
+	recorder = alice.do(http.MethodDelete, path, nil, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	recorder = batch.do(http.MethodGet, "/accounts?page_id=1&page_size=5", nil, header)
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+	requireBodyMatchErrorCode(t, recorder.Body, CodeAPIKeyInvalid)
+}
+
+func TestCreateAPIKeyScopedToken(t *testing.T) {
+	server := newTestServer(t, memdb.NewStore())
+	alice := signUp(t, server)
+	recorder := alice.do(http.MethodPost, "/users/login", gin.H{
+		"username": alice.username,
+		"password": alice.password,
+		"scopes":   []string{util.UsersReadScope, util.UsersWriteScope, util.AccountsReadScope},
+	}, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	scoped := &apiClient{t: t, server: server, username: alice.username, accessToken: decode[loginUserRes](t, recorder).AccessToken}
+
+	// the key cannot have more scopes than the token creating it
+	recorder = scoped.do(http.MethodPost, "/users/me/api_keys", gin.H{"name": "batch", "scopes": []string{util.TransfersWriteScope}}, nil)
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+	requireBodyMatchErrorCode(t, recorder.Body, CodeInsufficientScope)
+
+	// and has the scopes of the token by default
+	recorder = scoped.do(http.MethodPost, "/users/me/api_keys", gin.H{"name": "batch"}, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	created := decode[createAPIKeyRes](t, recorder)
+	require.Equal(t, []string{util.UsersReadScope, util.UsersWriteScope, util.AccountsReadScope}, created.APIKey.Scopes)
+}
@@ -0,0 +1,37 @@
+package api
+
+import (
+	_ "embed"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	swaggerFiles "github.com/swaggo/files"
+)
+
+//go:embed docs/index.html
+var docsIndex []byte
+
+// serveOpenAPISpec returns the OpenAPI document of the API
+func (server *Server) serveOpenAPISpec(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, server.spec)
+}
+
+// serveDocs serves a Swagger UI pointing at /openapi.json. The UI assets
+// are embedded in the binary so the docs work without internet access.
+func (server *Server) serveDocs(ctx *gin.Context) {
+	file := strings.TrimPrefix(ctx.Param("any"), "/")
+	if file == "" || file == "index.html" {
+		ctx.Data(http.StatusOK, "text/html; charset=utf-8", docsIndex)
+		return
+	}
+
+	data, err := swaggerFiles.ReadFile(file)
+	if err != nil {
+		ctx.Status(http.StatusNotFound)
+		return
+	}
+	ctx.Data(http.StatusOK, mime.TypeByExtension(path.Ext(file)), data)
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/dpsigor/cheatsheet-golang-postgres/auth"
+	db "github.com/dpsigor/cheatsheet-golang-postgres/db/sqlc"
+	"github.com/dpsigor/cheatsheet-golang-postgres/mail"
+	"github.com/dpsigor/cheatsheet-golang-postgres/token"
+	"github.com/gin-gonic/gin"
+)
+
+type verifyEmailReq struct {
+	Token string `form:"token" binding:"required"`
+}
+
+// verifyEmail marks the email of a user as verified. It is the link of the
+// email sent by queueVerificationEmail, so the token comes in the query.
+func (server *Server) verifyEmail(ctx *gin.Context) {
+	var req verifyEmailReq
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		abortWithError(ctx, invalidRequest(err))
+		return
+	}
+
+	user, err := server.authenticator.VerifyEmail(ctx, req.Token)
+	if err != nil {
+		abortWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, newUserResponse(user))
+}
+
+type sendVerificationEmailRes struct {
+	Email     string    `json:"email"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// sendVerificationEmail sends another verification link to the
+// authenticated user, e.g. once the one sent on signup expired
+func (server *Server) sendVerificationEmail(ctx *gin.Context) {
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	user, err := server.store.GetUser(ctx, authPayload.Username)
+	if err != nil {
+		abortWithError(ctx, err)
+		return
+	}
+
+	verification, err := server.queueVerificationEmail(ctx, user)
+	if err != nil {
+		abortWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, sendVerificationEmailRes{
+		Email:     user.Email,
+		ExpiresAt: verification.ExpiresAt,
+	})
+}
+
+// queueVerificationEmail creates a verification token for the email of the
+// user and queues the email with its link, which is sent after the request
+// returns
+func (server *Server) queueVerificationEmail(ctx context.Context, user db.User) (auth.EmailVerification, error) {
+	verification, err := server.authenticator.CreateEmailVerification(ctx, user)
+	if err != nil {
+		return auth.EmailVerification{}, err
+	}
+	if err := server.mailer.Send(ctx, mail.VerificationMessage(
+		server.config.MailFrom, user.Email, user.FullName,
+		mail.Link(server.config.EmailVerificationURL, verification.Token),
+	)); err != nil {
+		return auth.EmailVerification{}, fmt.Errorf("cannot queue verification email: %w", err)
+	}
+	return verification, nil
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	memdb "github.com/dpsigor/cheatsheet-golang-postgres/db/memory"
+	"github.com/dpsigor/cheatsheet-golang-postgres/util"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyEmailAPI(t *testing.T) {
+	server := newTestServerWithConfig(t, memdb.NewStore(), func(config *util.Config) {
+		config.MailFrom = "no-reply@example.com"
+		config.EmailVerificationURL = "http://localhost/users/verify_email"
+	})
+	alice := signUpUnverified(t, server)
+
+	// the signup sent the verification link
+	require.Equal(t, 1, sentMessages(server))
+	msg, first := lastMessage(t, server)
+	require.Equal(t, "no-reply@example.com", msg.From)
+	require.Contains(t, msg.Body, "http://localhost/users/verify_email?token=")
+
+	// accounts and transfers need a verified email
+	recorder := alice.do(http.MethodPost, "/accounts", gin.H{"owner": "ignored", "currency": util.USD}, nil)
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+	requireBodyMatchErrorCode(t, recorder.Body, CodeEmailNotVerified)
+	recorder = alice.do(http.MethodPost, "/transfers", gin.H{"from_account_id": 1, "to_account_id": 2, "amount": 10, "currency": util.USD}, nil)
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+	requireBodyMatchErrorCode(t, recorder.Body, CodeEmailNotVerified)
+
+	// another link can be sent, and the first one stays valid
+	recorder = alice.do(http.MethodPost, "/users/verify_email", nil, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, 2, sentMessages(server))
+	_, second := lastMessage(t, server)
+	require.NotEqual(t, first, second)
+
+	recorder = alice.do(http.MethodGet, "/users/verify_email", nil, nil)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	requireBodyMatchErrorCode(t, recorder.Body, CodeInvalidRequest)
+	recorder = alice.do(http.MethodGet, "/users/verify_email?token=wrong", nil, nil)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	requireBodyMatchErrorCode(t, recorder.Body, CodeInvalidVerificationToken)
+
+	recorder = alice.do(http.MethodGet, "/users/verify_email?token="+first, nil, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	user := decode[userRes](t, recorder)
+	require.Equal(t, alice.username, user.Username)
+	require.True(t, user.IsEmailVerified)
+
+	// a link is used once
+	recorder = alice.do(http.MethodGet, "/users/verify_email?token="+first, nil, nil)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	requireBodyMatchErrorCode(t, recorder.Body, CodeInvalidVerificationToken)
+	recorder = alice.do(http.MethodPost, "/users/verify_email", nil, nil)
+	require.Equal(t, http.StatusConflict, recorder.Code)
+	requireBodyMatchErrorCode(t, recorder.Body, CodeEmailAlreadyVerified)
+
+	recorder = alice.do(http.MethodPost, "/accounts", gin.H{"owner": "ignored", "currency": util.USD}, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+}
@@ -0,0 +1,196 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/dpsigor/cheatsheet-golang-postgres/errcode"
+	"github.com/dpsigor/cheatsheet-golang-postgres/util"
+	"github.com/dpsigor/cheatsheet-golang-postgres/val"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+// ErrorCode is a stable, machine-readable identifier of an error. Clients
+// should branch on it instead of matching messages.
+type ErrorCode = errcode.Code
+
+// Error codes returned by the API
+const (
+	CodeInvalidRequest           = errcode.InvalidRequest
+	CodeAuthorizationMissing     = errcode.AuthorizationMissing
+	CodeAuthorizationInvalid     = errcode.AuthorizationInvalid
+	CodeTokenExpired             = errcode.TokenExpired
+	CodeTokenInvalid             = errcode.TokenInvalid
+	CodeTokenRevoked             = errcode.TokenRevoked
+	CodeInvalidCredentials       = errcode.InvalidCredentials
+	CodeForbidden                = errcode.Forbidden
+	CodeInsufficientScope        = errcode.InsufficientScope
+	CodeNotFound                 = errcode.NotFound
+	CodeUserNotFound             = errcode.UserNotFound
+	CodeAccountNotFound          = errcode.AccountNotFound
+	CodeAlreadyExists            = errcode.AlreadyExists
+	CodeUsernameTaken            = errcode.UsernameTaken
+	CodeEmailTaken               = errcode.EmailTaken
+	CodeAccountExists            = errcode.AccountExists
+	CodeInvalidReference         = errcode.InvalidReference
+	CodeCurrencyMismatch         = errcode.CurrencyMismatch
+	CodeAccountFrozen            = errcode.AccountFrozen
+	CodeAmountOutOfRange         = errcode.AmountOutOfRange
+	CodeIdempotencyKeyReused     = errcode.IdempotencyKeyReused
+	CodeIdempotencyKeyInProgress = errcode.IdempotencyKeyInProgress
+	CodeRateLimited              = errcode.RateLimited
+	CodeTOTPRequired             = errcode.TOTPRequired
+	CodeTOTPNotEnabled           = errcode.TOTPNotEnabled
+	CodeInvalidTOTPCode          = errcode.InvalidTOTPCode
+	CodeTOTPAlreadyEnabled       = errcode.TOTPAlreadyEnabled
+	CodeTOTPNotEnrolled          = errcode.TOTPNotEnrolled
+	CodeInvalidResetToken        = errcode.InvalidResetToken
+	CodeEmailNotVerified         = errcode.EmailNotVerified
+	CodeEmailAlreadyVerified     = errcode.EmailAlreadyVerified
+	CodeInvalidVerificationToken = errcode.InvalidVerificationToken
+	CodeAPIKeyInvalid            = errcode.APIKeyInvalid
+	CodeAPIKeyNotFound           = errcode.APIKeyNotFound
+	CodeInvalidOAuthClient       = errcode.InvalidOAuthClient
+	CodeInvalidRedirectURI       = errcode.InvalidRedirectURI
+	CodeInvalidOAuthScope        = errcode.InvalidOAuthScope
+	CodeInvalidCodeChallenge     = errcode.InvalidCodeChallenge
+	CodeInternal                 = errcode.Internal
+)
+
+// Error is the body of every error response of the API
+type Error struct {
+	status    int
+	Code      ErrorCode    `json:"code"`
+	Message   string       `json:"message"`
+	Details   []FieldError `json:"details,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+	TraceID   string       `json:"trace_id,omitempty"`
+}
+
+// FieldError describes why a field of the request failed validation
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// newError creates an Error answered with the given HTTP status
+func newError(status int, code ErrorCode, format string, args ...interface{}) *Error {
+	return &Error{
+		status:  status,
+		Code:    code,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+// abortWithError writes err as an Error response and aborts the request.
+// Errors that are not an *Error are mapped by toError, so raw driver and
+// validator messages never reach the client.
+func abortWithError(ctx *gin.Context, err error) {
+	apiErr := toError(err)
+	if apiErr.status == http.StatusInternalServerError {
+		// keep the original error for the logs
+		ctx.Error(err)
+	}
+	rsp := *apiErr
+	rsp.RequestID = ctx.GetString(requestIDKey)
+	rsp.TraceID = util.TraceIDFromContext(ctx)
+	ctx.AbortWithStatusJSON(rsp.status, rsp)
+}
+
+// toError maps known errors to the Error answered to clients, with the
+// mapping the gRPC server shares
+func toError(err error) *Error {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	e, _ := errcode.Lookup(err)
+	return &Error{status: e.Status, Code: e.Code, Message: e.Message}
+}
+
+// invalidRequest maps errors returned by gin's binding to an Error with a
+// detail for every field that failed validation
+func invalidRequest(err error) *Error {
+	apiErr := newError(http.StatusBadRequest, CodeInvalidRequest, "invalid request")
+
+	var verrs validator.ValidationErrors
+	if !errors.As(err, &verrs) {
+		apiErr.Message = "malformed request"
+		return apiErr
+	}
+	for _, fe := range verrs {
+		apiErr.Details = append(apiErr.Details, FieldError{
+			Field:   fe.Field(),
+			Rule:    fe.Tag(),
+			Message: fieldErrorMessage(fe),
+		})
+	}
+	return apiErr
+}
+
+func fieldErrorMessage(fe validator.FieldError) string {
+	isString := fe.Kind() == reflect.String
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "min", "gte":
+		if fe.Kind() == reflect.Slice {
+			return fmt.Sprintf("must contain at least %s items", fe.Param())
+		}
+		if isString {
+			return fmt.Sprintf("must contain at least %s characters", fe.Param())
+		}
+		return fmt.Sprintf("must be at least %s", fe.Param())
+	case "max", "lte":
+		if fe.Kind() == reflect.Slice {
+			return fmt.Sprintf("must contain at most %s items", fe.Param())
+		}
+		if isString {
+			return fmt.Sprintf("must contain at most %s characters", fe.Param())
+		}
+		return fmt.Sprintf("must be at most %s", fe.Param())
+	case "gt":
+		return fmt.Sprintf("must be greater than %s", fe.Param())
+	case "email":
+		return "must be a valid email address"
+	case "username", "alphanum":
+		return "must contain only letters or digits"
+	case "totp_code":
+		return fmt.Sprintf("must contain exactly %d digits", val.TOTPCodeLength)
+	case "password":
+		return fmt.Sprintf("must contain at least %d characters", val.MinPasswordLength)
+	case val.PasswordLengthRule, val.PasswordMaxLengthRule, val.PasswordCharacterClassesRule, val.PasswordUserInputRule, val.PasswordCommonRule:
+		return val.PasswordViolation{Rule: fe.Tag(), Param: fe.Param()}.Error()
+	case "currency":
+		return fmt.Sprintf("must be one of %s", strings.Join(util.SupportedCurrencies(), ", "))
+	case "scope":
+		return fmt.Sprintf("must be one of %s", strings.Join(util.SupportedScopes(), ", "))
+	case "oauth_scope":
+		return fmt.Sprintf("must be one of %s", strings.Join(util.OAuthScopes(), ", "))
+	case "redirect_uri":
+		return "must be an https URL, or an http URL of the loopback interface, without a fragment"
+	case "eq":
+		return fmt.Sprintf("must be %s", fe.Param())
+	}
+	return fmt.Sprintf("failed on the '%s' rule", fe.Tag())
+}
+
+// fieldName makes validation errors report the name of the field as the
+// client sent it, rather than the name of the Go struct field
+func fieldName(f reflect.StructField) string {
+	for _, key := range []string{"json", "uri", "form"} {
+		if name, ok := tagName(f, key); ok {
+			return name
+		}
+	}
+	return f.Name
+}
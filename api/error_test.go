@@ -0,0 +1,125 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dpsigor/cheatsheet-golang-postgres/auth"
+	db "github.com/dpsigor/cheatsheet-golang-postgres/db/sqlc"
+	"github.com/dpsigor/cheatsheet-golang-postgres/token"
+	"github.com/dpsigor/cheatsheet-golang-postgres/util"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+func requireBodyMatchErrorCode(t *testing.T, body *bytes.Buffer, code ErrorCode) Error {
+	data, err := io.ReadAll(body)
+	require.NoError(t, err)
+
+	var gotErr Error
+	err = json.Unmarshal(data, &gotErr)
+	require.NoError(t, err)
+	require.Equal(t, code, gotErr.Code)
+	require.NotEmpty(t, gotErr.Message)
+	require.NotEmpty(t, gotErr.RequestID)
+	return gotErr
+}
+
+func TestToError(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   ErrorCode
+	}{
+		{"NotFound", sql.ErrNoRows, http.StatusNotFound, CodeNotFound},
+		{"UniqueViolation", db.ErrDuplicateEmail, http.StatusConflict, CodeAlreadyExists},
+		{"ForeignKeyViolation", db.ErrForeignKey, http.StatusUnprocessableEntity, CodeInvalidReference},
+		{"OutOfRange", db.ErrOutOfRange, http.StatusUnprocessableEntity, CodeAmountOutOfRange},
+		{"InvalidAmount", db.ErrInvalidAmount, http.StatusBadRequest, CodeInvalidRequest},
+		{"ExpiredToken", token.ErrExpiredToken, http.StatusUnauthorized, CodeTokenExpired},
+		{"InvalidToken", token.ErrInvalidToken, http.StatusUnauthorized, CodeTokenInvalid},
+		{"OAuthScope", fmt.Errorf("%w: %s", auth.ErrInvalidOAuthScope, util.UsersWriteScope), http.StatusBadRequest, CodeInvalidOAuthScope},
+		{"Internal", sql.ErrConnDone, http.StatusInternalServerError, CodeInternal},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			apiErr := toError(tc.err)
+			require.Equal(t, tc.status, apiErr.status)
+			require.Equal(t, tc.code, apiErr.Code)
+			if tc.code == CodeInternal {
+				// driver messages must not leak to clients
+				require.NotContains(t, apiErr.Message, tc.err.Error())
+			}
+		})
+	}
+}
+
+func TestErrorResponse(t *testing.T) {
+	server := newTestServer(t, nil)
+	server.router.POST("/validate", func(ctx *gin.Context) {
+		var req transferReq
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			abortWithError(ctx, invalidRequest(err))
+			return
+		}
+		ctx.JSON(http.StatusOK, req)
+	})
+
+	t.Run("ValidationDetails", func(t *testing.T) {
+		body := bytes.NewBufferString(`{"from_account_id": 1, "amount": -1, "currency": "BRL"}`)
+		request, err := http.NewRequest(http.MethodPost, "/validate", body)
+		require.NoError(t, err)
+		request.Header.Set(requestIDHeaderKey, "my-request-id")
+
+		recorder := httptest.NewRecorder()
+		server.router.ServeHTTP(recorder, request)
+		require.Equal(t, http.StatusBadRequest, recorder.Code)
+		require.Equal(t, "my-request-id", recorder.Header().Get(requestIDHeaderKey))
+
+		gotErr := requireBodyMatchErrorCode(t, recorder.Body, CodeInvalidRequest)
+		require.Equal(t, "my-request-id", gotErr.RequestID)
+		require.ElementsMatch(t, []FieldError{
+			{Field: "to_account_id", Rule: "required", Message: "is required"},
+			{Field: "amount", Rule: "gt", Message: "must be greater than 0"},
+			{Field: "currency", Rule: "currency", Message: "must be one of USD, EUR, CAD"},
+		}, gotErr.Details)
+	})
+
+	t.Run("TraceID", func(t *testing.T) {
+		otel.SetTextMapPropagator(propagation.TraceContext{})
+		t.Cleanup(func() { otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator()) })
+
+		request, err := http.NewRequest(http.MethodPost, "/validate", bytes.NewBufferString(`{}`))
+		require.NoError(t, err)
+		request.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+		recorder := httptest.NewRecorder()
+		server.router.ServeHTTP(recorder, request)
+		require.Equal(t, http.StatusBadRequest, recorder.Code)
+
+		gotErr := requireBodyMatchErrorCode(t, recorder.Body, CodeInvalidRequest)
+		require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", gotErr.TraceID)
+	})
+
+	t.Run("MalformedBody", func(t *testing.T) {
+		request, err := http.NewRequest(http.MethodPost, "/validate", bytes.NewBufferString(`{`))
+		require.NoError(t, err)
+
+		recorder := httptest.NewRecorder()
+		server.router.ServeHTTP(recorder, request)
+		require.Equal(t, http.StatusBadRequest, recorder.Code)
+
+		gotErr := requireBodyMatchErrorCode(t, recorder.Body, CodeInvalidRequest)
+		require.Empty(t, gotErr.Details)
+	})
+}
@@ -0,0 +1,29 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/dpsigor/cheatsheet-golang-postgres/health"
+	"github.com/gin-gonic/gin"
+)
+
+type healthRes struct {
+	Status string `json:"status"`
+}
+
+// healthz reports that the process is alive and serving requests. It checks
+// no dependency, so a failing database doesn't get the process restarted.
+func (server *Server) healthz(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, healthRes{Status: health.StatusOK})
+}
+
+// readyz reports whether the server can handle traffic, with the result of
+// every readiness check
+func (server *Server) readyz(ctx *gin.Context) {
+	report := server.health.Run(ctx)
+	status := http.StatusOK
+	if report.Status != health.StatusOK {
+		status = http.StatusServiceUnavailable
+	}
+	ctx.JSON(status, report)
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dpsigor/cheatsheet-golang-postgres/health"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealthz(t *testing.T) {
+	server := newTestServer(t, nil)
+	server.health.Add("database", func(ctx context.Context) error { return errors.New("down") })
+
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest(http.MethodGet, "/healthz", nil)
+	require.NoError(t, err)
+	server.router.ServeHTTP(recorder, request)
+
+	// liveness does not depend on the database
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.JSONEq(t, `{"status":"ok"}`, recorder.Body.String())
+}
+
+func TestReadyz(t *testing.T) {
+	tests := []struct {
+		name       string
+		dbErr      error
+		wantStatus int
+	}{
+		{name: "Ready", wantStatus: http.StatusOK},
+		{name: "DatabaseDown", dbErr: errors.New("connection refused"), wantStatus: http.StatusServiceUnavailable},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			server := newTestServer(t, nil)
+			server.health.Add("database", func(ctx context.Context) error { return tc.dbErr })
+			server.health.Add("schema", func(ctx context.Context) error { return nil })
+
+			recorder := httptest.NewRecorder()
+			request, err := http.NewRequest(http.MethodGet, "/readyz", nil)
+			require.NoError(t, err)
+			server.router.ServeHTTP(recorder, request)
+			require.Equal(t, tc.wantStatus, recorder.Code)
+
+			var report health.Report
+			err = json.NewDecoder(recorder.Body).Decode(&report)
+			require.NoError(t, err)
+			require.Len(t, report.Checks, 2)
+			require.Equal(t, health.StatusOK, report.Checks["schema"].Status)
+			if tc.dbErr != nil {
+				require.Equal(t, health.StatusFail, report.Status)
+				require.Equal(t, tc.dbErr.Error(), report.Checks["database"].Error)
+			} else {
+				require.Equal(t, health.StatusOK, report.Status)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"time"
+
+	db "github.com/dpsigor/cheatsheet-golang-postgres/db/sqlc"
+	"github.com/dpsigor/cheatsheet-golang-postgres/token"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	idempotencyKeyHeaderKey     = "Idempotency-Key"
+	idempotentReplayedHeaderKey = "Idempotent-Replayed"
+	idempotencyKeyStoreTimeout  = 5 * time.Second
+	idempotentReplayContentType = "application/json; charset=utf-8"
+)
+
+const isValidIdempotencyKeyPattern = `^[a-zA-Z0-9._:-]{1,255}$`
+
+var isValidIdempotencyKey = regexp.MustCompile(isValidIdempotencyKeyPattern).MatchString
+
+// idempotencyMiddleware makes a POST safe to retry. The first request with a
+// given Idempotency-Key header claims the key, and the response it gets is
+// stored and replayed to every retry with the same key and body. Keys are
+// scoped to the authenticated user, so the middleware must come after
+// authMiddleware on protected routes. Requests without the header are served
+// as usual.
+func (server *Server) idempotencyMiddleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		key := ctx.GetHeader(idempotencyKeyHeaderKey)
+		if key == "" {
+			ctx.Next()
+			return
+		}
+		if !isValidIdempotencyKey(key) {
+			abortWithError(ctx, newError(http.StatusBadRequest, CodeInvalidRequest, "invalid %s header", idempotencyKeyHeaderKey))
+			return
+		}
+
+		body, err := io.ReadAll(ctx.Request.Body)
+		if err != nil {
+			abortWithError(ctx, newError(http.StatusBadRequest, CodeInvalidRequest, "cannot read request body"))
+			return
+		}
+		ctx.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		scope := ""
+		if payload, ok := ctx.Get(authorizationPayloadKey); ok {
+			scope = payload.(*token.Payload).Username
+		}
+		hash := requestHash(ctx.Request.Method, ctx.FullPath(), body)
+
+		_, err = server.store.CreateIdempotencyKey(ctx, db.CreateIdempotencyKeyParams{
+			Scope:       scope,
+			Key:         key,
+			RequestHash: hash,
+		})
+		if errors.Is(err, db.ErrRecordNotFound) {
+			server.replayIdempotentResponse(ctx, scope, key, hash)
+			return
+		}
+		if err != nil {
+			abortWithError(ctx, err)
+			return
+		}
+
+		writer := &bodyCaptureWriter{ResponseWriter: ctx.Writer}
+		ctx.Writer = writer
+		defer func() {
+			// a panic of the handler is answered 500 by gin.Recovery, so the
+			// key is released as for any other 500, or it would stay in
+			// progress forever
+			if r := recover(); r != nil {
+				server.releaseIdempotencyKey(ctx, scope, key)
+				panic(r)
+			}
+		}()
+		ctx.Next()
+
+		status := writer.Status()
+		if status >= http.StatusInternalServerError {
+			// the request may not have been applied, so let the client retry it
+			server.releaseIdempotencyKey(ctx, scope, key)
+			return
+		}
+		// the response is stored even if the client went away, so that its
+		// retry gets the outcome of this request
+		storeCtx, cancel := context.WithTimeout(context.Background(), idempotencyKeyStoreTimeout)
+		defer cancel()
+		err = server.store.SetIdempotencyKeyResponse(storeCtx, db.SetIdempotencyKeyResponseParams{
+			Scope:          scope,
+			Key:            key,
+			ResponseStatus: int32(status),
+			ResponseBody:   writer.body.Bytes(),
+		})
+		if err != nil {
+			ctx.Error(fmt.Errorf("cannot save idempotency key: %w", err))
+		}
+	}
+}
+
+// releaseIdempotencyKey deletes a key claimed by a request which failed, so
+// that the client may retry it. Like the response, it is released even if
+// the client went away.
+func (server *Server) releaseIdempotencyKey(ctx *gin.Context, scope, key string) {
+	storeCtx, cancel := context.WithTimeout(context.Background(), idempotencyKeyStoreTimeout)
+	defer cancel()
+	err := server.store.DeleteIdempotencyKey(storeCtx, db.DeleteIdempotencyKeyParams{Scope: scope, Key: key})
+	if err != nil {
+		ctx.Error(fmt.Errorf("cannot release idempotency key: %w", err))
+	}
+}
+
+// replayIdempotentResponse answers a request whose key was already claimed
+// with the stored response of the first request
+func (server *Server) replayIdempotentResponse(ctx *gin.Context, scope, key, hash string) {
+	idempotencyKey, err := server.store.GetIdempotencyKey(ctx, db.GetIdempotencyKeyParams{Scope: scope, Key: key})
+	if errors.Is(err, db.ErrRecordNotFound) {
+		// the first request failed and released the key in the meantime
+		abortWithError(ctx, newError(http.StatusConflict, CodeIdempotencyKeyInProgress, "a request with this idempotency key is in progress"))
+		return
+	}
+	if err != nil {
+		abortWithError(ctx, err)
+		return
+	}
+
+	if idempotencyKey.RequestHash != hash {
+		abortWithError(ctx, newError(http.StatusUnprocessableEntity, CodeIdempotencyKeyReused, "idempotency key was used for a different request"))
+		return
+	}
+	if idempotencyKey.ResponseStatus == 0 {
+		abortWithError(ctx, newError(http.StatusConflict, CodeIdempotencyKeyInProgress, "a request with this idempotency key is in progress"))
+		return
+	}
+
+	ctx.Header(idempotentReplayedHeaderKey, "true")
+	ctx.Data(int(idempotencyKey.ResponseStatus), idempotentReplayContentType, idempotencyKey.ResponseBody)
+	ctx.Abort()
+}
+
+// requestHash identifies a request, so that a key reused for a different
+// request is detected
+func requestHash(method, path string, body []byte) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %s\n", method, path)
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// bodyCaptureWriter keeps a copy of the response body
+type bodyCaptureWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *bodyCaptureWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *bodyCaptureWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
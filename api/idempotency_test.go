@@ -0,0 +1,251 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	mockdb "github.com/dpsigor/cheatsheet-golang-postgres/db/mock"
+	db "github.com/dpsigor/cheatsheet-golang-postgres/db/sqlc"
+	"github.com/dpsigor/cheatsheet-golang-postgres/util"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdempotencyMiddleware(t *testing.T) {
+	user, _ := randomUser(t)
+	account := randomAccount(user.Username)
+	body, err := json.Marshal(gin.H{"owner": account.Owner, "currency": account.Currency})
+	require.NoError(t, err)
+	hash := requestHash(http.MethodPost, "/accounts", body)
+	accountBody, err := json.Marshal(account)
+	require.NoError(t, err)
+	keyParams := db.GetIdempotencyKeyParams{Scope: user.Username, Key: "key-1"}
+
+	testCases := []struct {
+		name          string
+		key           string
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "FirstRequest",
+			key:  "key-1",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					CreateIdempotencyKey(gomock.Any(), db.CreateIdempotencyKeyParams{
+						Scope:       user.Username,
+						Key:         "key-1",
+						RequestHash: hash,
+					}).
+					Times(1).
+					Return(db.IdempotencyKey{}, nil)
+				store.EXPECT().
+					CreateAccount(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(account, nil)
+				store.EXPECT().
+					SetIdempotencyKeyResponse(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ interface{}, arg db.SetIdempotencyKeyResponseParams) error {
+						require.Equal(t, user.Username, arg.Scope)
+						require.Equal(t, "key-1", arg.Key)
+						require.Equal(t, int32(http.StatusOK), arg.ResponseStatus)
+						require.JSONEq(t, string(accountBody), string(arg.ResponseBody))
+						return nil
+					})
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Empty(t, recorder.Header().Get(idempotentReplayedHeaderKey))
+				requireBodyMatchAccount(t, recorder.Body, account)
+			},
+		},
+		{
+			name: "Replayed",
+			key:  "key-1",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					CreateIdempotencyKey(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.IdempotencyKey{}, db.ErrRecordNotFound)
+				store.EXPECT().
+					GetIdempotencyKey(gomock.Any(), keyParams).
+					Times(1).
+					Return(db.IdempotencyKey{
+						Scope:          user.Username,
+						Key:            "key-1",
+						RequestHash:    hash,
+						ResponseStatus: http.StatusOK,
+						ResponseBody:   accountBody,
+					}, nil)
+				store.EXPECT().
+					CreateAccount(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Equal(t, "true", recorder.Header().Get(idempotentReplayedHeaderKey))
+				requireBodyMatchAccount(t, recorder.Body, account)
+			},
+		},
+		{
+			name: "ReusedForDifferentRequest",
+			key:  "key-1",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					CreateIdempotencyKey(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.IdempotencyKey{}, db.ErrRecordNotFound)
+				store.EXPECT().
+					GetIdempotencyKey(gomock.Any(), keyParams).
+					Times(1).
+					Return(db.IdempotencyKey{RequestHash: "other", ResponseStatus: http.StatusOK}, nil)
+				store.EXPECT().
+					CreateAccount(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+				requireBodyMatchErrorCode(t, recorder.Body, CodeIdempotencyKeyReused)
+			},
+		},
+		{
+			name: "InProgress",
+			key:  "key-1",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					CreateIdempotencyKey(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.IdempotencyKey{}, db.ErrRecordNotFound)
+				store.EXPECT().
+					GetIdempotencyKey(gomock.Any(), keyParams).
+					Times(1).
+					Return(db.IdempotencyKey{RequestHash: hash}, nil)
+				store.EXPECT().
+					CreateAccount(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusConflict, recorder.Code)
+				requireBodyMatchErrorCode(t, recorder.Body, CodeIdempotencyKeyInProgress)
+			},
+		},
+		{
+			name: "InternalErrorReleasesKey",
+			key:  "key-1",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					CreateIdempotencyKey(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.IdempotencyKey{}, nil)
+				store.EXPECT().
+					CreateAccount(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.Account{}, errors.New("connection reset"))
+				store.EXPECT().
+					DeleteIdempotencyKey(gomock.Any(), db.DeleteIdempotencyKeyParams{Scope: user.Username, Key: "key-1"}).
+					Times(1).
+					Return(nil)
+				store.EXPECT().
+					SetIdempotencyKeyResponse(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+		{
+			name: "PanicReleasesKey",
+			key:  "key-1",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					CreateIdempotencyKey(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.IdempotencyKey{}, nil)
+				store.EXPECT().
+					CreateAccount(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ interface{}, _ db.CreateAccountParams) (db.Account, error) {
+						panic("nil map")
+					})
+				store.EXPECT().
+					DeleteIdempotencyKey(gomock.Any(), db.DeleteIdempotencyKeyParams{Scope: user.Username, Key: "key-1"}).
+					Times(1).
+					Return(nil)
+				store.EXPECT().
+					SetIdempotencyKeyResponse(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+		{
+			name: "InvalidKey",
+			key:  "not a valid key",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					CreateIdempotencyKey(gomock.Any(), gomock.Any()).
+					Times(0)
+				store.EXPECT().
+					CreateAccount(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				requireBodyMatchErrorCode(t, recorder.Body, CodeInvalidRequest)
+			},
+		},
+		{
+			name: "NoKey",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					CreateIdempotencyKey(gomock.Any(), gomock.Any()).
+					Times(0)
+				store.EXPECT().
+					CreateAccount(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(account, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				requireBodyMatchAccount(t, recorder.Body, account)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			store := newMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			request, err := http.NewRequest(http.MethodPost, "/accounts", bytes.NewReader(body))
+			require.NoError(t, err)
+			if tc.key != "" {
+				request.Header.Set(idempotencyKeyHeaderKey, tc.key)
+			}
+			addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, user.Username, time.Minute)
+
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
+func TestRequestHash(t *testing.T) {
+	body := []byte(util.RandomString(16))
+	require.Equal(t, requestHash(http.MethodPost, "/accounts", body), requestHash(http.MethodPost, "/accounts", body))
+	require.NotEqual(t, requestHash(http.MethodPost, "/accounts", body), requestHash(http.MethodPost, "/transfers", body))
+	require.NotEqual(t, requestHash(http.MethodPost, "/accounts", body), requestHash(http.MethodPost, "/accounts", append(body, '!')))
+}
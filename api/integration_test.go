@@ -0,0 +1,141 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	memdb "github.com/dpsigor/cheatsheet-golang-postgres/db/memory"
+	db "github.com/dpsigor/cheatsheet-golang-postgres/db/sqlc"
+	"github.com/dpsigor/cheatsheet-golang-postgres/util"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+// apiClient sends requests to a server as a logged in user
+type apiClient struct {
+	t           *testing.T
+	server      *Server
+	username    string
+	password    string
+	accessToken string
+}
+
+func (c *apiClient) do(method, path string, body gin.H, header http.Header) *httptest.ResponseRecorder {
+	var payload bytes.Buffer
+	if body != nil {
+		require.NoError(c.t, json.NewEncoder(&payload).Encode(body))
+	}
+	request, err := http.NewRequest(method, path, &payload)
+	require.NoError(c.t, err)
+	for key, values := range header {
+		request.Header[key] = values
+	}
+	if c.accessToken != "" {
+		request.Header.Set(authorizationHeaderKey, authorizationTypeBearer+" "+c.accessToken)
+	}
+	recorder := httptest.NewRecorder()
+	c.server.router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+// signUp creates a user, verifies their email and logs in as them
+func signUp(t *testing.T, server *Server) *apiClient {
+	c := signUpUnverified(t, server)
+	_, verificationToken := lastMessage(t, server)
+	recorder := c.do(http.MethodGet, "/users/verify_email?token="+verificationToken, nil, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	return c
+}
+
+// signUpUnverified creates a user and logs in as them, without verifying
+// their email
+func signUpUnverified(t *testing.T, server *Server) *apiClient {
+	c := &apiClient{
+		t:        t,
+		server:   server,
+		username: util.RandomOwner() + util.RandomString(4),
+		password: util.RandomString(10),
+	}
+	username, password := c.username, c.password
+	recorder := c.do(http.MethodPost, "/users", gin.H{
+		"username":  username,
+		"password":  password,
+		"full_name": util.RandomOwner(),
+		"email":     util.RandomEmail(),
+	}, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	recorder = c.do(http.MethodPost, "/users/login", gin.H{"username": username, "password": password}, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var rsp loginUserRes
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&rsp))
+	c.accessToken = rsp.AccessToken
+	return c
+}
+
+func decode[T any](t *testing.T, recorder *httptest.ResponseRecorder) T {
+	var v T
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&v))
+	return v
+}
+
+// TestBankingFlow runs the API against the in-memory store
+func TestBankingFlow(t *testing.T) {
+	store := memdb.NewStore()
+	server := newTestServer(t, store)
+	alice := signUp(t, server)
+	bob := signUp(t, server)
+
+	recorder := alice.do(http.MethodPost, "/accounts", gin.H{"owner": "ignored", "currency": util.USD}, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	from := decode[db.Account](t, recorder)
+	require.Zero(t, from.Balance)
+	recorder = alice.do(http.MethodPost, "/accounts", gin.H{"owner": "ignored", "currency": util.USD}, nil)
+	require.Equal(t, http.StatusConflict, recorder.Code)
+	requireBodyMatchErrorCode(t, recorder.Body, CodeAccountExists)
+
+	recorder = bob.do(http.MethodPost, "/accounts", gin.H{"owner": "ignored", "currency": util.USD}, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	to := decode[db.Account](t, recorder)
+
+	_, err := store.AddAccountBalance(context.Background(), db.AddAccountBalanceParams{ID: from.ID, Amount: 100})
+	require.NoError(t, err)
+
+	transfer := gin.H{"from_account_id": from.ID, "to_account_id": to.ID, "amount": 30, "currency": util.USD}
+	header := http.Header{idempotencyKeyHeaderKey: {"transfer-1"}}
+	recorder = alice.do(http.MethodPost, "/transfers", transfer, header)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	result := decode[db.TransferTxResult](t, recorder)
+	require.Equal(t, int64(70), result.FromAccount.Balance)
+	require.Equal(t, int64(30), result.ToAccount.Balance)
+
+	// the retry is answered with the first response
+	recorder = alice.do(http.MethodPost, "/transfers", transfer, header)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "true", recorder.Header().Get(idempotentReplayedHeaderKey))
+	require.Equal(t, result, decode[db.TransferTxResult](t, recorder))
+
+	// bob cannot move alice's money
+	recorder = bob.do(http.MethodPost, "/transfers", gin.H{"from_account_id": from.ID, "to_account_id": to.ID, "amount": 10, "currency": util.USD}, nil)
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+
+	recorder = bob.do(http.MethodGet, fmt.Sprintf("/accounts/%d", to.ID), nil, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, int64(30), decode[db.Account](t, recorder).Balance)
+
+	recorder = alice.do(http.MethodGet, "/accounts?page_id=1&page_size=5", nil, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	accounts := decode[[]db.Account](t, recorder)
+	require.Len(t, accounts, 1)
+	require.Equal(t, int64(70), accounts[0].Balance)
+
+	entries, err := store.ListEntries(context.Background(), db.ListEntriesParams{AccountID: from.ID, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, int64(-30), entries[0].Amount)
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/dpsigor/cheatsheet-golang-postgres/token"
+	"github.com/dpsigor/cheatsheet-golang-postgres/util"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+)
+
+// sensitiveParams are redacted from the logged query strings
+var sensitiveParams = []string{"password", "token", "secret", "key", "code"}
+
+// loggerMiddleware writes a structured access log entry per request
+func loggerMiddleware(logger zerolog.Logger) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		start := time.Now()
+		ctx.Next()
+
+		status := ctx.Writer.Status()
+		event := logger.Info()
+		if status >= 500 {
+			event = logger.Error()
+		}
+		if len(ctx.Errors) > 0 {
+			event = event.Str("error", ctx.Errors.String())
+		}
+		if traceID := util.TraceIDFromContext(ctx); traceID != "" {
+			event = event.Str("trace_id", traceID)
+		}
+		if payload, ok := ctx.Get(authorizationPayloadKey); ok {
+			event = event.Str("user", payload.(*token.Payload).Username)
+		}
+		event.
+			Str("request_id", ctx.GetString(requestIDKey)).
+			Str("method", ctx.Request.Method).
+			Str("route", ctx.FullPath()).
+			Str("path", redactedPath(ctx.Request.URL)).
+			Int("status", status).
+			Dur("latency", time.Since(start)).
+			Str("client_ip", ctx.ClientIP()).
+			Msg("request")
+	}
+}
+
+// redactedPath returns the path and query of u with the values of sensitive
+// parameters replaced
+func redactedPath(u *url.URL) string {
+	if u.RawQuery == "" {
+		return u.Path
+	}
+	query := u.Query()
+	for name := range query {
+		if isSensitive(name) {
+			query.Set(name, "REDACTED")
+		}
+	}
+	return u.Path + "?" + query.Encode()
+}
+
+func isSensitive(name string) bool {
+	name = strings.ToLower(name)
+	for _, param := range sensitiveParams {
+		if strings.Contains(name, param) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/dpsigor/cheatsheet-golang-postgres/util"
+	"github.com/golang/mock/gomock"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoggerMiddleware(t *testing.T) {
+	user, _ := randomUser(t)
+	account := randomAccount(user.Username)
+
+	ctrl := gomock.NewController(t)
+	store := newMockStore(ctrl)
+	store.EXPECT().
+		GetAccount(gomock.Any(), gomock.Eq(account.ID)).
+		Times(1).
+		DoAndReturn(func(ctx context.Context, id int64) (interface{}, error) {
+			// the request ID must reach the store through the context
+			require.Equal(t, "my-request-id", util.RequestIDFromContext(ctx))
+			return account, nil
+		})
+
+	server := newTestServer(t, store)
+	var logs bytes.Buffer
+	server.logger = zerolog.New(&logs)
+	server.setupRouter()
+
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest(http.MethodGet, fmt.Sprintf("/accounts/%d?access_token=secret", account.ID), nil)
+	require.NoError(t, err)
+	request.Header.Set(requestIDHeaderKey, "my-request-id")
+	addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, user.Username, time.Minute)
+
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal(logs.Bytes(), &entry))
+	require.Equal(t, "my-request-id", entry["request_id"])
+	require.Equal(t, "/accounts/:id", entry["route"])
+	require.Equal(t, float64(http.StatusOK), entry["status"])
+	require.Equal(t, user.Username, entry["user"])
+	require.Contains(t, entry, "latency")
+	require.NotContains(t, logs.String(), "secret")
+	require.NotContains(t, logs.String(), request.Header.Get(authorizationHeaderKey))
+}
+
+func TestRedactedPath(t *testing.T) {
+	u, err := url.Parse("/users/verify?token=abc&password=123&page_id=1")
+	require.NoError(t, err)
+	require.Equal(t, "/users/verify?page_id=1&password=REDACTED&token=REDACTED", redactedPath(u))
+}
@@ -1,26 +1,99 @@
 package api
 
 import (
+	"context"
 	"os"
+	"regexp"
+	"sync"
 	"testing"
 	"time"
 
+	mockdb "github.com/dpsigor/cheatsheet-golang-postgres/db/mock"
 	db "github.com/dpsigor/cheatsheet-golang-postgres/db/sqlc"
+	"github.com/dpsigor/cheatsheet-golang-postgres/health"
+	"github.com/dpsigor/cheatsheet-golang-postgres/mail"
+	"github.com/dpsigor/cheatsheet-golang-postgres/metrics"
+	"github.com/dpsigor/cheatsheet-golang-postgres/password"
+	"github.com/dpsigor/cheatsheet-golang-postgres/token"
 	"github.com/dpsigor/cheatsheet-golang-postgres/util"
 	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/require"
 )
 
-func newTestServer(t *testing.T, store db.Store) *Server {
+var testHasher = password.NewTestHasher()
+
+func newTestServer(t testing.TB, store db.Store) *Server {
+	return newTestServerWithConfig(t, store, func(config *util.Config) {})
+}
+
+// newTestServerWithConfig creates a server with the config of newTestServer
+// changed by configure
+func newTestServerWithConfig(t testing.TB, store db.Store, configure func(config *util.Config)) *Server {
 	config := util.Config{
 		TokenSymmetricKey:   util.RandomString(32),
 		AccessTokenDuration: time.Minute,
 	}
-	server, err := NewServer(config, store)
+	configure(&config)
+	tokenMaker, err := token.NewPasetoMaker(config.TokenSymmetricKey)
+	require.NoError(t, err)
+	server, err := NewServer(config, store, tokenMaker, zerolog.Nop(), metrics.New(), health.NewChecker(time.Second))
 	require.NoError(t, err)
+	// the emails are kept for the tests to read, rather than written to disk
+	server.mailer = &recordingMailer{}
+	t.Cleanup(func() {
+		require.NoError(t, server.mailQueue.Close(context.Background()))
+	})
 	return server
 }
 
+// recordingMailer keeps the messages sent instead of delivering them
+type recordingMailer struct {
+	mu       sync.Mutex
+	messages []mail.Message
+}
+
+func (m *recordingMailer) Send(ctx context.Context, msg mail.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+var linkTokenRegexp = regexp.MustCompile(`\?token=([A-Za-z0-9_-]+)`)
+
+// lastMessage returns the last message sent by server, and the token of the
+// link it carries
+func lastMessage(t testing.TB, server *Server) (mail.Message, string) {
+	m := server.mailer.(*recordingMailer)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	require.NotEmpty(t, m.messages)
+	msg := m.messages[len(m.messages)-1]
+	match := linkTokenRegexp.FindStringSubmatch(msg.Body)
+	require.NotNil(t, match, "no link in %q", msg.Body)
+	return msg, match[1]
+}
+
+// sentMessages returns the number of messages sent by server
+func sentMessages(server *Server) int {
+	m := server.mailer.(*recordingMailer)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.messages)
+}
+
+// newMockStore creates a mock store whose users never changed their password
+// and verified their email, since the auth middleware and the handlers
+// check it on most requests
+func newMockStore(ctrl *gomock.Controller) *mockdb.MockStore {
+	store := mockdb.NewMockStore(ctrl)
+	store.EXPECT().GetPasswordChangedAt(gomock.Any(), gomock.Any()).AnyTimes()
+	store.EXPECT().IsEmailVerified(gomock.Any(), gomock.Any()).AnyTimes().Return(true, nil)
+	return store
+}
+
 func TestMain(m *testing.M) {
 	gin.SetMode(gin.TestMode)
 	os.Exit(m.Run())
@@ -0,0 +1,28 @@
+package api
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/dpsigor/cheatsheet-golang-postgres/metrics"
+	"github.com/gin-gonic/gin"
+)
+
+// unmatchedRoute labels the requests that match no route, so arbitrary paths
+// don't create new series
+const unmatchedRoute = "unmatched"
+
+// metricsMiddleware records the duration of every request by route
+// template, method and status
+func metricsMiddleware(m *metrics.Metrics) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		start := time.Now()
+		ctx.Next()
+
+		route := ctx.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		m.ObserveHTTPRequest(route, ctx.Request.Method, strconv.Itoa(ctx.Writer.Status()), time.Since(start))
+	}
+}
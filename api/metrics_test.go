@@ -0,0 +1,31 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	server := newTestServer(t, nil)
+
+	for _, path := range []string{"/accounts/1", "/no-such-route"} {
+		recorder := httptest.NewRecorder()
+		request, err := http.NewRequest(http.MethodGet, path, nil)
+		require.NoError(t, err)
+		server.router.ServeHTTP(recorder, request)
+	}
+
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest(http.MethodGet, "/metrics", nil)
+	require.NoError(t, err)
+	server.router.ServeHTTP(recorder, request)
+
+	require.Equal(t, http.StatusOK, recorder.Code)
+	body := recorder.Body.String()
+	require.Contains(t, body, `simple_bank_http_request_duration_seconds_count{method="GET",route="/accounts/:id",status="401"} 1`)
+	require.Contains(t, body, `route="unmatched",status="404"`)
+	require.NotContains(t, body, "/no-such-route")
+}
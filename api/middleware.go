@@ -1,53 +1,120 @@
 package api
 
 import (
-	"errors"
-	"fmt"
 	"net/http"
+	"regexp"
 	"strings"
 
+	"github.com/dpsigor/cheatsheet-golang-postgres/auth"
 	"github.com/dpsigor/cheatsheet-golang-postgres/token"
+	"github.com/dpsigor/cheatsheet-golang-postgres/util"
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
 const (
 	authorizationHeaderKey  = "authorization"
 	authorizationTypeBearer = "bearer"
+	authorizationTypeAPIKey = "apikey"
 	authorizationPayloadKey = "authorization_payload"
+	authorizationTypeKey    = "authorization_type"
 )
 
-func authMiddleware(tokenMaker token.Maker) gin.HandlerFunc {
+const (
+	requestIDHeaderKey = "X-Request-ID"
+	requestIDKey       = "request_id"
+)
+
+var isValidRequestID = regexp.MustCompile(`^[a-zA-Z0-9._-]{1,64}$`).MatchString
+
+// requestIDMiddleware identifies every request, reusing the ID sent by the
+// client or a proxy in the X-Request-ID header when it is well formed
+func requestIDMiddleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		requestID := ctx.GetHeader(requestIDHeaderKey)
+		if !isValidRequestID(requestID) {
+			requestID = uuid.NewString()
+		}
+		ctx.Set(requestIDKey, requestID)
+		ctx.Header(requestIDHeaderKey, requestID)
+		// the store receives the request context, so its logs carry the ID too
+		ctx.Request = ctx.Request.WithContext(util.ContextWithRequestID(ctx.Request.Context(), requestID))
+		ctx.Next()
+	}
+}
+
+// authMiddleware authenticates the request with an access token, in an
+// "Authorization: Bearer <token>" header, or an API key, in an
+// "Authorization: ApiKey <key>" header. Both set the same payload.
+func authMiddleware(tokenMaker token.Maker, authenticator *auth.Authenticator) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		authHeader := ctx.GetHeader(authorizationHeaderKey)
 		if len(authHeader) == 0 {
-			err := errors.New("authorization header is not provided")
-			ctx.AbortWithStatusJSON(http.StatusUnauthorized, errorResponse(err))
+			abortWithError(ctx, newError(http.StatusUnauthorized, CodeAuthorizationMissing, "authorization header is not provided"))
 			return
 		}
 
 		fields := strings.Fields(authHeader)
 
 		if len(fields) < 2 {
-			err := errors.New("invalid authorization header provided")
-			ctx.AbortWithStatusJSON(http.StatusUnauthorized, errorResponse(err))
+			abortWithError(ctx, newError(http.StatusUnauthorized, CodeAuthorizationInvalid, "invalid authorization header provided"))
 			return
 		}
 
 		authType := strings.ToLower(fields[0])
-		if authType != authorizationTypeBearer {
-			err := fmt.Errorf("unsupported authorization type %s", authType)
-			ctx.AbortWithStatusJSON(http.StatusUnauthorized, errorResponse(err))
+		var payload *token.Payload
+		switch authType {
+		case authorizationTypeBearer:
+			var err error
+			payload, err = tokenMaker.VerifyToken(fields[1])
+			if err != nil {
+				abortWithError(ctx, err)
+				return
+			}
+			if err := authenticator.CheckToken(ctx, payload); err != nil {
+				abortWithError(ctx, err)
+				return
+			}
+		case authorizationTypeAPIKey:
+			var err error
+			payload, err = authenticator.CheckAPIKey(ctx, fields[1])
+			if err != nil {
+				abortWithError(ctx, err)
+				return
+			}
+		default:
+			abortWithError(ctx, newError(http.StatusUnauthorized, CodeAuthorizationInvalid, "unsupported authorization type %s", authType))
 			return
 		}
 
-		accessToken := fields[1]
-		payload, err := tokenMaker.VerifyToken(accessToken)
-		if err != nil {
-			ctx.AbortWithStatusJSON(http.StatusUnauthorized, errorResponse(err))
+		ctx.Set(authorizationPayloadKey, payload)
+		ctx.Set(authorizationTypeKey, authType)
+		ctx.Next()
+	}
+}
+
+// bearerOnlyMiddleware refuses the requests authenticated with an API key,
+// for the routes managing the credentials of the user: a key must not mint
+// other keys, possibly with more scopes than its own
+func bearerOnlyMiddleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if ctx.GetString(authorizationTypeKey) != authorizationTypeBearer {
+			abortWithError(ctx, newError(http.StatusForbidden, CodeForbidden, "this route requires an access token, not an API key"))
 			return
 		}
+		ctx.Next()
+	}
+}
 
-		ctx.Set(authorizationPayloadKey, payload)
+// requireScope refuses the requests whose token or API key lacks the scope.
+// It must come after authMiddleware.
+func requireScope(scope string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+		if !authPayload.HasScope(scope) {
+			abortWithError(ctx, newError(http.StatusForbidden, CodeInsufficientScope, "this route requires the %s scope", scope))
+			return
+		}
 		ctx.Next()
 	}
 }
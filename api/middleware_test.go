@@ -1,12 +1,16 @@
 package api
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
+	memdb "github.com/dpsigor/cheatsheet-golang-postgres/db/memory"
+	db "github.com/dpsigor/cheatsheet-golang-postgres/db/sqlc"
 	"github.com/dpsigor/cheatsheet-golang-postgres/token"
 	"github.com/dpsigor/cheatsheet-golang-postgres/util"
 	"github.com/gin-gonic/gin"
@@ -21,7 +25,7 @@ func addAuthorization(
 	username string,
 	duration time.Duration,
 ) {
-	token, err := tokenMaker.CreateToken(username, duration)
+	token, err := tokenMaker.CreateToken(username, nil, duration)
 	require.NoError(t, err)
 
 	authorizationHeader := fmt.Sprintf("%s %s", authorizationType, token)
@@ -31,13 +35,13 @@ func addAuthorization(
 func TestAuthMiddleware(t *testing.T) {
 	var tests = []struct {
 		name      string
-		setupAuth func(t *testing.T, req *http.Request, tokenMaker token.Maker)
+		setupAuth func(t *testing.T, req *http.Request, tokenMaker token.Maker, username string)
 		checkRes  func(t *testing.T, recorder *httptest.ResponseRecorder)
 	}{
 		{
 			name: "OK",
-			setupAuth: func(t *testing.T, req *http.Request, tokenMaker token.Maker) {
-				addAuthorization(t, req, tokenMaker, authorizationTypeBearer, util.RandomOwner(), time.Minute)
+			setupAuth: func(t *testing.T, req *http.Request, tokenMaker token.Maker, username string) {
+				addAuthorization(t, req, tokenMaker, authorizationTypeBearer, username, time.Minute)
 			},
 			checkRes: func(t *testing.T, recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusOK, recorder.Code)
@@ -45,15 +49,15 @@ func TestAuthMiddleware(t *testing.T) {
 		},
 		{
 			name:      "NoAuthorization",
-			setupAuth: func(t *testing.T, req *http.Request, tokenMaker token.Maker) {},
+			setupAuth: func(t *testing.T, req *http.Request, tokenMaker token.Maker, username string) {},
 			checkRes: func(t *testing.T, recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusUnauthorized, recorder.Code)
 			},
 		},
 		{
 			name: "UnsupportedAuthorization",
-			setupAuth: func(t *testing.T, req *http.Request, tokenMaker token.Maker) {
-				addAuthorization(t, req, tokenMaker, "unsupported", util.RandomOwner(), time.Minute)
+			setupAuth: func(t *testing.T, req *http.Request, tokenMaker token.Maker, username string) {
+				addAuthorization(t, req, tokenMaker, "unsupported", username, time.Minute)
 			},
 			checkRes: func(t *testing.T, recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusUnauthorized, recorder.Code)
@@ -61,8 +65,8 @@ func TestAuthMiddleware(t *testing.T) {
 		},
 		{
 			name: "InvalidAuthorizationFormat",
-			setupAuth: func(t *testing.T, req *http.Request, tokenMaker token.Maker) {
-				addAuthorization(t, req, tokenMaker, "", util.RandomOwner(), time.Minute)
+			setupAuth: func(t *testing.T, req *http.Request, tokenMaker token.Maker, username string) {
+				addAuthorization(t, req, tokenMaker, "", username, time.Minute)
 			},
 			checkRes: func(t *testing.T, recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusUnauthorized, recorder.Code)
@@ -70,22 +74,40 @@ func TestAuthMiddleware(t *testing.T) {
 		},
 		{
 			name: "ExpiredToken",
-			setupAuth: func(t *testing.T, req *http.Request, tokenMaker token.Maker) {
-				addAuthorization(t, req, tokenMaker, authorizationTypeBearer, util.RandomOwner(), -time.Minute)
+			setupAuth: func(t *testing.T, req *http.Request, tokenMaker token.Maker, username string) {
+				addAuthorization(t, req, tokenMaker, authorizationTypeBearer, username, -time.Minute)
 			},
 			checkRes: func(t *testing.T, recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusUnauthorized, recorder.Code)
 			},
 		},
+		{
+			name: "UnknownUser",
+			setupAuth: func(t *testing.T, req *http.Request, tokenMaker token.Maker, username string) {
+				addAuthorization(t, req, tokenMaker, authorizationTypeBearer, "missing"+username, time.Minute)
+			},
+			checkRes: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+				requireBodyMatchErrorCode(t, recorder.Body, CodeTokenRevoked)
+			},
+		},
 	}
 	for _, tt := range tests {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
-			server := newTestServer(t, nil)
+			store := memdb.NewStore()
+			user, err := store.CreateUser(context.Background(), db.CreateUserParams{
+				Username:       util.RandomOwner() + util.RandomString(6),
+				HashedPassword: "hashed",
+				FullName:       util.RandomOwner(),
+				Email:          util.RandomEmail(),
+			})
+			require.NoError(t, err)
+			server := newTestServer(t, store)
 			authPath := "/auth"
 			server.router.GET(
 				authPath,
-				authMiddleware(server.tokenMaker),
+				authMiddleware(server.tokenMaker, server.authenticator),
 				func(ctx *gin.Context) {
 					ctx.JSON(http.StatusOK, gin.H{})
 				},
@@ -95,9 +117,75 @@ func TestAuthMiddleware(t *testing.T) {
 			req, err := http.NewRequest(http.MethodGet, authPath, nil)
 			require.NoError(t, err)
 
-			tt.setupAuth(t, req, server.tokenMaker)
+			tt.setupAuth(t, req, server.tokenMaker, user.Username)
 			server.router.ServeHTTP(recorder, req)
 			tt.checkRes(t, recorder)
 		})
 	}
 }
+
+func TestRequireScope(t *testing.T) {
+	server := newTestServer(t, memdb.NewStore())
+	c := signUp(t, server)
+	recorder := c.do(http.MethodPost, "/accounts", gin.H{"owner": "ignored", "currency": util.USD}, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	account := decode[db.Account](t, recorder)
+
+	recorder = c.do(http.MethodPost, "/users/login", gin.H{
+		"username": c.username,
+		"password": c.password,
+		"scopes":   []string{util.AccountsReadScope},
+	}, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	rsp := decode[loginUserRes](t, recorder)
+	require.Equal(t, []string{util.AccountsReadScope}, rsp.Scopes)
+	dashboard := &apiClient{t: t, server: server, username: c.username, accessToken: rsp.AccessToken}
+
+	recorder = dashboard.do(http.MethodGet, fmt.Sprintf("/accounts/%d", account.ID), nil, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	recorder = dashboard.do(http.MethodPost, "/transfers", gin.H{
+		"from_account_id": account.ID,
+		"to_account_id":   account.ID + 1,
+		"amount":          1,
+		"currency":        util.USD,
+	}, nil)
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+	requireBodyMatchErrorCode(t, recorder.Body, CodeInsufficientScope)
+	recorder = dashboard.do(http.MethodGet, "/users/me", nil, nil)
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+	requireBodyMatchErrorCode(t, recorder.Body, CodeInsufficientScope)
+
+	recorder = c.do(http.MethodPost, "/users/login", gin.H{
+		"username": c.username,
+		"password": c.password,
+		"scopes":   []string{"accounts:admin"},
+	}, nil)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	requireBodyMatchErrorCode(t, recorder.Body, CodeInvalidRequest)
+}
+
+// TestOperationScopes fails when the scope required by a route differs from
+// the one of its operations entry
+func TestOperationScopes(t *testing.T) {
+	server := newTestServer(t, memdb.NewStore())
+	c := signUp(t, server)
+	for _, op := range operations {
+		if !op.auth {
+			continue
+		}
+		require.NotEmpty(t, op.scope, "route %s %s has no scope", op.method, op.path)
+		var others []string
+		for _, scope := range util.SupportedScopes() {
+			if scope != op.scope {
+				others = append(others, scope)
+			}
+		}
+		accessToken, err := server.tokenMaker.CreateToken(c.username, others, time.Minute)
+		require.NoError(t, err)
+
+		scoped := &apiClient{t: t, server: server, username: c.username, accessToken: accessToken}
+		recorder := scoped.do(op.method, strings.ReplaceAll(op.path, ":id", "1"), nil, nil)
+		require.Equal(t, http.StatusForbidden, recorder.Code, "route %s %s", op.method, op.path)
+		requireBodyMatchErrorCode(t, recorder.Body, CodeInsufficientScope)
+	}
+}
@@ -0,0 +1,294 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/dpsigor/cheatsheet-golang-postgres/auth"
+	"github.com/dpsigor/cheatsheet-golang-postgres/token"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// Grant types of the token endpoint
+const (
+	grantTypeAuthorizationCode = "authorization_code"
+	grantTypeRefreshToken      = "refresh_token"
+)
+
+type registerOAuthClientReq struct {
+	Name         string   `json:"name" binding:"required,max=64"`
+	RedirectURIs []string `json:"redirect_uris" binding:"required,min=1,max=10,dive,redirect_uri"`
+	Scopes       []string `json:"scopes" binding:"required,min=1,dive,oauth_scope"`
+}
+
+type oauthClientRes struct {
+	ClientID     string    `json:"client_id"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	Scopes       []string  `json:"scopes"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type registerOAuthClientRes struct {
+	Client oauthClientRes `json:"client"`
+	// ClientSecret is only answered on registration
+	ClientSecret string `json:"client_secret"`
+}
+
+// registerOAuthClient registers a third-party application owned by the
+// authenticated user
+func (server *Server) registerOAuthClient(ctx *gin.Context) {
+	var req registerOAuthClientReq
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		abortWithError(ctx, invalidRequest(err))
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	created, err := server.authenticator.RegisterOAuthClient(ctx, auth.RegisterOAuthClientParams{
+		Owner:        authPayload.Username,
+		Name:         req.Name,
+		RedirectURIs: req.RedirectURIs,
+		Scopes:       req.Scopes,
+	})
+	if err != nil {
+		abortWithError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, registerOAuthClientRes{
+		Client: oauthClientRes{
+			ClientID:     created.Client.ID,
+			Name:         created.Client.Name,
+			RedirectURIs: created.Client.RedirectURIs,
+			Scopes:       created.Client.Scopes,
+			CreatedAt:    created.Client.CreatedAt,
+		},
+		ClientSecret: created.Secret,
+	})
+}
+
+type oauthAuthorizationReq struct {
+	ResponseType        string `form:"response_type" binding:"required,eq=code"`
+	ClientID            string `form:"client_id" binding:"required"`
+	RedirectURI         string `form:"redirect_uri"`
+	Scope               string `form:"scope"`
+	State               string `form:"state"`
+	CodeChallenge       string `form:"code_challenge" binding:"required"`
+	CodeChallengeMethod string `form:"code_challenge_method" binding:"required,eq=S256"`
+}
+
+type oauthAuthorizationRes struct {
+	ClientID    string   `json:"client_id"`
+	ClientName  string   `json:"client_name"`
+	RedirectURI string   `json:"redirect_uri"`
+	Scopes      []string `json:"scopes"`
+}
+
+// getOAuthAuthorization checks an authorization request and answers what
+// the user is asked to consent to
+func (server *Server) getOAuthAuthorization(ctx *gin.Context) {
+	var req oauthAuthorizationReq
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		abortWithError(ctx, invalidRequest(err))
+		return
+	}
+	authz, err := server.authenticator.CheckOAuthAuthorization(ctx, auth.OAuthAuthorizationRequest{
+		ClientID:            req.ClientID,
+		RedirectURI:         req.RedirectURI,
+		Scope:               req.Scope,
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: req.CodeChallengeMethod,
+	})
+	if err != nil {
+		abortWithError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, oauthAuthorizationRes{
+		ClientID:    authz.Client.ID,
+		ClientName:  authz.Client.Name,
+		RedirectURI: authz.RedirectURI,
+		Scopes:      authz.Scopes,
+	})
+}
+
+type approveOAuthAuthorizationReq struct {
+	ResponseType        string `json:"response_type" binding:"required,eq=code"`
+	ClientID            string `json:"client_id" binding:"required"`
+	RedirectURI         string `json:"redirect_uri"`
+	Scope               string `json:"scope"`
+	State               string `json:"state"`
+	CodeChallenge       string `json:"code_challenge" binding:"required"`
+	CodeChallengeMethod string `json:"code_challenge_method" binding:"required,eq=S256"`
+	// Approve is the answer of the user; a denial is also sent back to the
+	// client
+	Approve bool `json:"approve"`
+}
+
+type approveOAuthAuthorizationRes struct {
+	RedirectTo string `json:"redirect_to"`
+}
+
+// approveOAuthAuthorization records the answer of the authenticated user to
+// an authorization request, and answers where to send the browser back to
+// the client
+func (server *Server) approveOAuthAuthorization(ctx *gin.Context) {
+	var req approveOAuthAuthorizationReq
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		abortWithError(ctx, invalidRequest(err))
+		return
+	}
+	authz, err := server.authenticator.CheckOAuthAuthorization(ctx, auth.OAuthAuthorizationRequest{
+		ClientID:            req.ClientID,
+		RedirectURI:         req.RedirectURI,
+		Scope:               req.Scope,
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: req.CodeChallengeMethod,
+	})
+	if err != nil {
+		abortWithError(ctx, err)
+		return
+	}
+
+	params := url.Values{}
+	if req.Approve {
+		authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+		code, err := server.authenticator.CreateOAuthCode(ctx, authPayload.Username, authz)
+		if err != nil {
+			abortWithError(ctx, err)
+			return
+		}
+		params.Set("code", code)
+	} else {
+		params.Set("error", "access_denied")
+	}
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+	redirectTo, err := url.Parse(authz.RedirectURI)
+	if err != nil {
+		abortWithError(ctx, err)
+		return
+	}
+	query := redirectTo.Query()
+	for key := range params {
+		query.Set(key, params.Get(key))
+	}
+	redirectTo.RawQuery = query.Encode()
+	ctx.JSON(http.StatusOK, approveOAuthAuthorizationRes{RedirectTo: redirectTo.String()})
+}
+
+type oauthTokenReq struct {
+	GrantType    string `form:"grant_type" binding:"required"`
+	Code         string `form:"code"`
+	RedirectURI  string `form:"redirect_uri"`
+	CodeVerifier string `form:"code_verifier"`
+	RefreshToken string `form:"refresh_token"`
+	// ClientID and ClientSecret may be sent instead of HTTP basic
+	// authentication
+	ClientID     string `form:"client_id"`
+	ClientSecret string `form:"client_secret"`
+}
+
+// oauthTokenRes is the token response of RFC 6749
+type oauthTokenRes struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+}
+
+// oauthErrorRes is the error response of the token endpoint, which follows
+// RFC 6749 rather than Error so that OAuth client libraries understand it
+type oauthErrorRes struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// createOAuthToken is the token endpoint, exchanging an authorization code or
+// a refresh token for an access token and a new refresh token
+func (server *Server) createOAuthToken(ctx *gin.Context) {
+	// tokens must not be cached by the client or a proxy
+	ctx.Header("Cache-Control", "no-store")
+	ctx.Header("Pragma", "no-cache")
+
+	var req oauthTokenReq
+	if err := ctx.ShouldBindWith(&req, binding.FormPost); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, oauthErrorRes{Error: "invalid_request", ErrorDescription: invalidRequestDescription(err)})
+		return
+	}
+	credentials := auth.OAuthClientCredentials{ClientID: req.ClientID, ClientSecret: req.ClientSecret}
+	if id, secret, ok := ctx.Request.BasicAuth(); ok {
+		// the credentials of basic authentication are form-encoded
+		credentials.ClientID, _ = url.QueryUnescape(id)
+		credentials.ClientSecret, _ = url.QueryUnescape(secret)
+	}
+
+	var grant auth.OAuthGrant
+	var err error
+	switch req.GrantType {
+	case grantTypeAuthorizationCode:
+		grant, err = server.authenticator.ExchangeOAuthCode(ctx, auth.ExchangeOAuthCodeParams{
+			Client:       credentials,
+			Code:         req.Code,
+			RedirectURI:  req.RedirectURI,
+			CodeVerifier: req.CodeVerifier,
+		})
+	case grantTypeRefreshToken:
+		// the scope parameter is ignored: a refreshed token keeps the scopes
+		// the user granted
+		grant, err = server.authenticator.RefreshOAuthToken(ctx, auth.RefreshOAuthTokenParams{
+			Client:       credentials,
+			RefreshToken: req.RefreshToken,
+		})
+	default:
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, oauthErrorRes{Error: "unsupported_grant_type", ErrorDescription: "grant_type must be authorization_code or refresh_token"})
+		return
+	}
+	if err != nil {
+		abortWithOAuthError(ctx, err)
+		return
+	}
+
+	accessToken, err := server.tokenMaker.CreateToken(grant.Username, grant.Scopes, server.config.AccessTokenDuration)
+	if err != nil {
+		abortWithOAuthError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, oauthTokenRes{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(server.config.AccessTokenDuration / time.Second),
+		RefreshToken: grant.RefreshToken,
+		Scope:        strings.Join(grant.Scopes, " "),
+	})
+}
+
+// abortWithOAuthError answers the RFC 6749 error of err. Unknown errors are
+// logged and answered as server_error.
+func abortWithOAuthError(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, auth.ErrInvalidOAuthClient):
+		ctx.Header("WWW-Authenticate", `Basic realm="oauth"`)
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, oauthErrorRes{Error: "invalid_client", ErrorDescription: "unknown client or wrong client secret"})
+	case errors.Is(err, auth.ErrInvalidGrant):
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, oauthErrorRes{Error: "invalid_grant", ErrorDescription: "authorization code or refresh token is invalid, expired or revoked"})
+	default:
+		ctx.Error(err)
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, oauthErrorRes{Error: "server_error"})
+	}
+}
+
+// invalidRequestDescription describes the first field failing validation,
+// as RFC 6749 has a single description for the error
+func invalidRequestDescription(err error) string {
+	apiErr := invalidRequest(err)
+	if len(apiErr.Details) == 0 {
+		return apiErr.Message
+	}
+	return apiErr.Details[0].Field + " " + apiErr.Details[0].Message
+}
@@ -0,0 +1,157 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	memdb "github.com/dpsigor/cheatsheet-golang-postgres/db/memory"
+	"github.com/dpsigor/cheatsheet-golang-postgres/util"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+const testRedirectURI = "https://partner.example.com/callback"
+
+// postOAuthToken posts form to the token endpoint, authenticating the
+// client with HTTP basic authentication
+func postOAuthToken(t *testing.T, server *Server, clientID, clientSecret string, form url.Values) *httptest.ResponseRecorder {
+	request, err := http.NewRequest(http.MethodPost, "/oauth/token", strings.NewReader(form.Encode()))
+	require.NoError(t, err)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.SetBasicAuth(url.QueryEscape(clientID), url.QueryEscape(clientSecret))
+	recorder := httptest.NewRecorder()
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, "no-store", recorder.Header().Get("Cache-Control"))
+	return recorder
+}
+
+func requireOAuthError(t *testing.T, recorder *httptest.ResponseRecorder, status int, code string) {
+	require.Equal(t, status, recorder.Code)
+	require.Equal(t, code, decode[oauthErrorRes](t, recorder).Error)
+}
+
+func TestOAuthAPI(t *testing.T) {
+	server := newTestServer(t, memdb.NewStore())
+	alice := signUp(t, server)
+	recorder := alice.do(http.MethodPost, "/accounts", gin.H{"owner": "ignored", "currency": util.USD}, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	// clients cannot ask for users:write
+	recorder = alice.do(http.MethodPost, "/oauth/clients", gin.H{
+		"name":          "partner",
+		"redirect_uris": []string{testRedirectURI},
+		"scopes":        []string{util.UsersWriteScope},
+	}, nil)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	apiErr := requireBodyMatchErrorCode(t, recorder.Body, CodeInvalidRequest)
+	require.Equal(t, "oauth_scope", apiErr.Details[0].Rule)
+	recorder = alice.do(http.MethodPost, "/oauth/clients", gin.H{
+		"name":          "partner",
+		"redirect_uris": []string{"http://partner.example.com/callback"},
+		"scopes":        []string{util.AccountsReadScope},
+	}, nil)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	apiErr = requireBodyMatchErrorCode(t, recorder.Body, CodeInvalidRequest)
+	require.Equal(t, "redirect_uri", apiErr.Details[0].Rule)
+
+	recorder = alice.do(http.MethodPost, "/oauth/clients", gin.H{
+		"name":          "partner",
+		"redirect_uris": []string{testRedirectURI},
+		"scopes":        []string{util.AccountsReadScope, util.TransfersWriteScope},
+	}, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	client := decode[registerOAuthClientRes](t, recorder)
+	require.NotEmpty(t, client.ClientSecret)
+	clientID := client.Client.ClientID
+
+	verifier := util.RandomString(64)
+	sum := sha256.Sum256([]byte(verifier))
+	authorization := gin.H{
+		"response_type":         "code",
+		"client_id":             clientID,
+		"redirect_uri":          testRedirectURI,
+		"scope":                 util.AccountsReadScope,
+		"state":                 "xyz",
+		"code_challenge":        base64.RawURLEncoding.EncodeToString(sum[:]),
+		"code_challenge_method": "S256",
+	}
+	query := url.Values{}
+	for key, value := range authorization {
+		query.Set(key, value.(string))
+	}
+
+	recorder = alice.do(http.MethodGet, "/oauth/authorize?"+query.Encode(), nil, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	consent := decode[oauthAuthorizationRes](t, recorder)
+	require.Equal(t, "partner", consent.ClientName)
+	require.Equal(t, []string{util.AccountsReadScope}, consent.Scopes)
+	query.Set("redirect_uri", "https://attacker.example.com/callback")
+	recorder = alice.do(http.MethodGet, "/oauth/authorize?"+query.Encode(), nil, nil)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	requireBodyMatchErrorCode(t, recorder.Body, CodeInvalidRedirectURI)
+
+	// a denial is sent back to the client
+	authorization["approve"] = false
+	recorder = alice.do(http.MethodPost, "/oauth/authorize", authorization, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	redirectTo, err := url.Parse(decode[approveOAuthAuthorizationRes](t, recorder).RedirectTo)
+	require.NoError(t, err)
+	require.Equal(t, "access_denied", redirectTo.Query().Get("error"))
+	require.Equal(t, "xyz", redirectTo.Query().Get("state"))
+
+	authorization["approve"] = true
+	recorder = alice.do(http.MethodPost, "/oauth/authorize", authorization, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	redirectTo, err = url.Parse(decode[approveOAuthAuthorizationRes](t, recorder).RedirectTo)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(redirectTo.String(), testRedirectURI+"?"))
+	require.Equal(t, "xyz", redirectTo.Query().Get("state"))
+	code := redirectTo.Query().Get("code")
+	require.NotEmpty(t, code)
+
+	exchange := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {testRedirectURI},
+		"code_verifier": {verifier},
+	}
+	recorder = postOAuthToken(t, server, clientID, "wrong", exchange)
+	requireOAuthError(t, recorder, http.StatusUnauthorized, "invalid_client")
+	recorder = postOAuthToken(t, server, clientID, client.ClientSecret, url.Values{"grant_type": {"password"}})
+	requireOAuthError(t, recorder, http.StatusBadRequest, "unsupported_grant_type")
+
+	recorder = postOAuthToken(t, server, clientID, client.ClientSecret, exchange)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	tokens := decode[oauthTokenRes](t, recorder)
+	require.Equal(t, "Bearer", tokens.TokenType)
+	require.Equal(t, int64(60), tokens.ExpiresIn)
+	require.Equal(t, util.AccountsReadScope, tokens.Scope)
+	require.NotEmpty(t, tokens.RefreshToken)
+
+	// codes are exchanged once
+	recorder = postOAuthToken(t, server, clientID, client.ClientSecret, exchange)
+	requireOAuthError(t, recorder, http.StatusBadRequest, "invalid_grant")
+
+	// the token acts for alice within the scopes she granted
+	partner := &apiClient{t: t, server: server, accessToken: tokens.AccessToken}
+	recorder = partner.do(http.MethodGet, "/accounts?page_id=1&page_size=5", nil, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	recorder = partner.do(http.MethodPost, "/transfers", gin.H{"from_account_id": 1, "to_account_id": 2, "amount": 1, "currency": util.USD}, nil)
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+	requireBodyMatchErrorCode(t, recorder.Body, CodeInsufficientScope)
+
+	// refresh tokens rotate
+	refresh := url.Values{"grant_type": {"refresh_token"}, "refresh_token": {tokens.RefreshToken}}
+	recorder = postOAuthToken(t, server, clientID, client.ClientSecret, refresh)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	refreshed := decode[oauthTokenRes](t, recorder)
+	require.Equal(t, util.AccountsReadScope, refreshed.Scope)
+	require.NotEqual(t, tokens.RefreshToken, refreshed.RefreshToken)
+	recorder = postOAuthToken(t, server, clientID, client.ClientSecret, refresh)
+	requireOAuthError(t, recorder, http.StatusBadRequest, "invalid_grant")
+}
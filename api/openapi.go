@@ -0,0 +1,640 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	db "github.com/dpsigor/cheatsheet-golang-postgres/db/sqlc"
+	"github.com/dpsigor/cheatsheet-golang-postgres/util"
+	"github.com/dpsigor/cheatsheet-golang-postgres/val"
+	"github.com/google/uuid"
+)
+
+// operation documents a route registered in setupRouter. The request and
+// response fields hold zero values of the types the handler binds and
+// returns, and are used to generate the OpenAPI schemas.
+type operation struct {
+	method  string
+	path    string
+	summary string
+	auth    bool
+	// scope is the scope the token or API key of an auth route must grant,
+	// which requireScope checks
+	scope string
+	// bearerOnly routes refuse API keys
+	bearerOnly  bool
+	idempotent  bool
+	rateLimited bool
+	// formBody routes take their form fields as an
+	// application/x-www-form-urlencoded body, rather than in the query
+	formBody bool
+	request  interface{}
+	response interface{}
+	// errorResponse is the body of the error responses, Error if nil
+	errorResponse interface{}
+}
+
+// operations must have an entry for every route of the API
+var operations = []operation{
+	{
+		method:     http.MethodPost,
+		path:       "/users",
+		idempotent: true,
+		summary:    "Create a new user",
+		request:    createUserReq{},
+		response:   userRes{},
+	},
+	{
+		method:      http.MethodPost,
+		path:        "/users/login",
+		rateLimited: true,
+		summary:     "Login a user and get an access token, or a challenge if two-factor authentication is enabled",
+		request:     loginUserReq{},
+		response:    loginUserRes{},
+	},
+	{
+		method:      http.MethodPost,
+		path:        "/users/login/totp",
+		rateLimited: true,
+		summary:     "Answer a login challenge with a TOTP code or a recovery code and get an access token",
+		request:     loginTOTPReq{},
+		response:    loginUserRes{},
+	},
+	{
+		method:     http.MethodPost,
+		path:       "/users/totp",
+		summary:    "Generate a TOTP secret for the authenticated user",
+		auth:       true,
+		scope:      util.UsersWriteScope,
+		bearerOnly: true,
+		response:   enrollTOTPRes{},
+	},
+	{
+		method:     http.MethodPost,
+		path:       "/users/totp/confirm",
+		summary:    "Enable two-factor authentication with a code of the TOTP secret and get recovery codes",
+		auth:       true,
+		scope:      util.UsersWriteScope,
+		bearerOnly: true,
+		request:    confirmTOTPReq{},
+		response:   confirmTOTPRes{},
+	},
+	{
+		method:   http.MethodGet,
+		path:     "/users/me",
+		summary:  "Get the profile of the authenticated user",
+		auth:     true,
+		scope:    util.UsersReadScope,
+		response: userRes{},
+	},
+	{
+		method:     http.MethodPatch,
+		path:       "/users/me",
+		summary:    "Update the full name or email of the authenticated user; the email is changed with current_password and has to be verified again",
+		auth:       true,
+		scope:      util.UsersWriteScope,
+		bearerOnly: true,
+		request:    updateUserReq{},
+		response:   userRes{},
+	},
+	{
+		method:     http.MethodPut,
+		path:       "/users/me/password",
+		summary:    "Change the password of the authenticated user, which revokes their access tokens",
+		auth:       true,
+		scope:      util.UsersWriteScope,
+		bearerOnly: true,
+		request:    changePasswordReq{},
+		response:   userRes{},
+	},
+	{
+		method:      http.MethodPost,
+		path:        "/users/password_reset",
+		rateLimited: true,
+		summary:     "Email a password reset link to the user with the email, if any",
+		request:     requestPasswordResetReq{},
+		response:    requestPasswordResetRes{},
+	},
+	{
+		method:      http.MethodPost,
+		path:        "/users/password_reset/confirm",
+		rateLimited: true,
+		summary:     "Set a new password with the token of a password reset link",
+		request:     resetPasswordReq{},
+		response:    userRes{},
+	},
+	{
+		method:      http.MethodGet,
+		path:        "/users/verify_email",
+		rateLimited: true,
+		summary:     "Verify the email of a user with the token of a verification link",
+		request:     verifyEmailReq{},
+		response:    userRes{},
+	},
+	{
+		method:      http.MethodPost,
+		path:        "/users/verify_email",
+		rateLimited: true,
+		summary:     "Email another verification link to the authenticated user",
+		auth:        true,
+		scope:       util.UsersWriteScope,
+		response:    sendVerificationEmailRes{},
+	},
+	{
+		method:     http.MethodPost,
+		path:       "/users/me/api_keys",
+		summary:    "Create an API key for the authenticated user; the key is only answered now",
+		auth:       true,
+		scope:      util.UsersWriteScope,
+		bearerOnly: true,
+		request:    createAPIKeyReq{},
+		response:   createAPIKeyRes{},
+	},
+	{
+		method:     http.MethodGet,
+		path:       "/users/me/api_keys",
+		summary:    "List the API keys of the authenticated user",
+		auth:       true,
+		scope:      util.UsersReadScope,
+		bearerOnly: true,
+		response:   []apiKeyRes{},
+	},
+	{
+		method:     http.MethodDelete,
+		path:       "/users/me/api_keys/:id",
+		summary:    "Revoke an API key of the authenticated user",
+		auth:       true,
+		scope:      util.UsersWriteScope,
+		bearerOnly: true,
+		request:    deleteAPIKeyReq{},
+		response:   apiKeyRes{},
+	},
+	{
+		method:     http.MethodPost,
+		path:       "/oauth/clients",
+		summary:    "Register an OAuth client owned by the authenticated user; the client secret is only answered now",
+		auth:       true,
+		scope:      util.UsersWriteScope,
+		bearerOnly: true,
+		request:    registerOAuthClientReq{},
+		response:   registerOAuthClientRes{},
+	},
+	{
+		method:     http.MethodGet,
+		path:       "/oauth/authorize",
+		summary:    "Check an OAuth authorization request and get what the authenticated user is asked to consent to",
+		auth:       true,
+		scope:      util.UsersWriteScope,
+		bearerOnly: true,
+		request:    oauthAuthorizationReq{},
+		response:   oauthAuthorizationRes{},
+	},
+	{
+		method:     http.MethodPost,
+		path:       "/oauth/authorize",
+		summary:    "Approve or deny an OAuth authorization request and get the redirect back to the client",
+		auth:       true,
+		scope:      util.UsersWriteScope,
+		bearerOnly: true,
+		request:    approveOAuthAuthorizationReq{},
+		response:   approveOAuthAuthorizationRes{},
+	},
+	{
+		method:        http.MethodPost,
+		path:          "/oauth/token",
+		rateLimited:   true,
+		formBody:      true,
+		summary:       "Exchange an authorization code or a refresh token for an access token, authenticating the client with HTTP basic authentication or the client_id and client_secret fields",
+		request:       oauthTokenReq{},
+		response:      oauthTokenRes{},
+		errorResponse: oauthErrorRes{},
+	},
+	{
+		method:   http.MethodGet,
+		path:     "/users/login_attempts",
+		summary:  "List the login attempts of the authenticated user, most recent first",
+		auth:     true,
+		scope:    util.UsersReadScope,
+		request:  listLoginAttemptsReq{},
+		response: []db.LoginAttempt{},
+	},
+	{
+		method:     http.MethodPost,
+		path:       "/accounts",
+		idempotent: true,
+		summary:    "Create an account for the authenticated user",
+		auth:       true,
+		scope:      util.AccountsWriteScope,
+		request:    createAccountReq{},
+		response:   db.Account{},
+	},
+	{
+		method:   http.MethodGet,
+		path:     "/accounts/:id",
+		summary:  "Get an account of the authenticated user",
+		auth:     true,
+		scope:    util.AccountsReadScope,
+		request:  getAccountReq{},
+		response: db.Account{},
+	},
+	{
+		method:   http.MethodGet,
+		path:     "/accounts",
+		summary:  "List the accounts of the authenticated user",
+		auth:     true,
+		scope:    util.AccountsReadScope,
+		request:  listAccountReq{},
+		response: []db.Account{},
+	},
+	{
+		method:      http.MethodPost,
+		path:        "/transfers",
+		idempotent:  true,
+		rateLimited: true,
+		summary:     "Transfer money between two accounts",
+		auth:        true,
+		scope:       util.TransfersWriteScope,
+		request:     transferReq{},
+		response:    db.TransferTxResult{},
+	},
+}
+
+// undocumentedRoutes are served by the router but are not part of the API
+var undocumentedRoutes = map[string]bool{
+	"/openapi.json": true,
+	"/docs/*any":    true,
+	"/metrics":      true,
+	"/healthz":      true,
+	"/readyz":       true,
+}
+
+// openAPISpec is an OpenAPI 3 document
+type openAPISpec struct {
+	OpenAPI    string                       `json:"openapi"`
+	Info       openAPIInfo                  `json:"info"`
+	Paths      map[string]map[string]*apiOp `json:"paths"`
+	Components openAPIComponents            `json:"components"`
+}
+
+type openAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type openAPIComponents struct {
+	Schemas         map[string]*schema        `json:"schemas"`
+	SecuritySchemes map[string]securityScheme `json:"securitySchemes"`
+}
+
+type securityScheme struct {
+	Type   string `json:"type"`
+	Scheme string `json:"scheme,omitempty"`
+	In     string `json:"in,omitempty"`
+	Name   string `json:"name,omitempty"`
+}
+
+type apiOp struct {
+	Summary     string                `json:"summary"`
+	Description string                `json:"description,omitempty"`
+	Parameters  []parameter           `json:"parameters,omitempty"`
+	RequestBody *requestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]response   `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+type parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Schema   *schema `json:"schema"`
+}
+
+type requestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]mediaType `json:"content"`
+}
+
+type response struct {
+	Description string               `json:"description"`
+	Content     map[string]mediaType `json:"content,omitempty"`
+}
+
+type mediaType struct {
+	Schema *schema `json:"schema"`
+}
+
+type schema struct {
+	Ref              string             `json:"$ref,omitempty"`
+	Type             string             `json:"type,omitempty"`
+	Format           string             `json:"format,omitempty"`
+	Pattern          string             `json:"pattern,omitempty"`
+	Enum             []string           `json:"enum,omitempty"`
+	Minimum          *float64           `json:"minimum,omitempty"`
+	Maximum          *float64           `json:"maximum,omitempty"`
+	ExclusiveMinimum bool               `json:"exclusiveMinimum,omitempty"`
+	MinLength        *int               `json:"minLength,omitempty"`
+	MaxLength        *int               `json:"maxLength,omitempty"`
+	MinItems         *int               `json:"minItems,omitempty"`
+	MaxItems         *int               `json:"maxItems,omitempty"`
+	Items            *schema            `json:"items,omitempty"`
+	Properties       map[string]*schema `json:"properties,omitempty"`
+	Required         []string           `json:"required,omitempty"`
+}
+
+const (
+	bearerAuth = "bearerAuth"
+	// apiKeyAuth is an "Authorization: ApiKey <key>" header, which OpenAPI 3.0
+	// can only describe as an opaque header
+	apiKeyAuth = "apiKeyAuth"
+)
+
+// newOpenAPISpec builds the OpenAPI document of the given operations
+func newOpenAPISpec(ops []operation) *openAPISpec {
+	spec := &openAPISpec{
+		OpenAPI: "3.0.3",
+		Info:    openAPIInfo{Title: "Simple Bank API", Version: "1.0"},
+		Paths:   map[string]map[string]*apiOp{},
+		Components: openAPIComponents{
+			Schemas: map[string]*schema{},
+			SecuritySchemes: map[string]securityScheme{
+				bearerAuth: {Type: "http", Scheme: "bearer"},
+				apiKeyAuth: {Type: "apiKey", In: "header", Name: "Authorization"},
+			},
+		},
+	}
+
+	spec.schemaOf(reflect.TypeOf(Error{}))
+
+	for _, op := range ops {
+		path := openAPIPath(op.path)
+		if spec.Paths[path] == nil {
+			spec.Paths[path] = map[string]*apiOp{}
+		}
+		spec.Paths[path][strings.ToLower(op.method)] = spec.newOperation(op)
+	}
+	return spec
+}
+
+func (spec *openAPISpec) newOperation(op operation) *apiOp {
+	errorContent := map[string]mediaType{
+		"application/json": {Schema: &schema{Ref: "#/components/schemas/Error"}},
+	}
+	if op.errorResponse != nil {
+		errorContent = map[string]mediaType{
+			"application/json": {Schema: spec.schemaOf(reflect.TypeOf(op.errorResponse))},
+		}
+	}
+	o := &apiOp{
+		Summary: op.summary,
+		Responses: map[string]response{
+			"200": {
+				Description: "OK",
+				Content: map[string]mediaType{
+					"application/json": {Schema: spec.schemaOf(reflect.TypeOf(op.response))},
+				},
+			},
+			"400": {Description: "Invalid request", Content: errorContent},
+			"404": {Description: "Not found", Content: errorContent},
+			"409": {Description: "Conflict", Content: errorContent},
+			"422": {Description: "Unprocessable request", Content: errorContent},
+			"500": {Description: "Internal error", Content: errorContent},
+		},
+	}
+	if op.auth {
+		o.Security = []map[string][]string{{bearerAuth: {}}}
+		if !op.bearerOnly {
+			o.Security = append(o.Security, map[string][]string{apiKeyAuth: {}})
+		}
+		if op.scope != "" {
+			o.Description = fmt.Sprintf("Requires the `%s` scope.", op.scope)
+		}
+		o.Responses["401"] = response{Description: "Unauthorized", Content: errorContent}
+		o.Responses["403"] = response{Description: "Forbidden", Content: errorContent}
+	}
+
+	if op.rateLimited {
+		o.Responses["429"] = response{Description: "Too many requests, retry after the Retry-After header", Content: errorContent}
+	}
+
+	if op.idempotent {
+		o.Parameters = append(o.Parameters, parameter{Name: idempotencyKeyHeaderKey, In: "header", Schema: &schema{Type: "string", Pattern: isValidIdempotencyKeyPattern}})
+	}
+
+	if op.request == nil {
+		return o
+	}
+	t := reflect.TypeOf(op.request)
+	if op.formBody {
+		o.RequestBody = &requestBody{
+			Required: true,
+			Content: map[string]mediaType{
+				"application/x-www-form-urlencoded": {Schema: formSchema(spec, t)},
+			},
+		}
+		return o
+	}
+	hasBody := false
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if name, ok := tagName(f, "uri"); ok {
+			o.Parameters = append(o.Parameters, parameter{Name: name, In: "path", Required: true, Schema: fieldSchema(spec, f)})
+		} else if name, ok := tagName(f, "form"); ok {
+			o.Parameters = append(o.Parameters, parameter{Name: name, In: "query", Required: isRequired(f), Schema: fieldSchema(spec, f)})
+		} else if _, ok := tagName(f, "json"); ok {
+			hasBody = true
+		}
+	}
+	if hasBody {
+		o.RequestBody = &requestBody{
+			Required: true,
+			Content: map[string]mediaType{
+				"application/json": {Schema: spec.schemaOf(t)},
+			},
+		}
+	}
+	return o
+}
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	uuidType = reflect.TypeOf(uuid.UUID{})
+)
+
+// schemaOf returns the schema of t, registering structs as components
+func (spec *openAPISpec) schemaOf(t reflect.Type) *schema {
+	switch {
+	case t == timeType:
+		return &schema{Type: "string", Format: "date-time"}
+	case t == uuidType:
+		return &schema{Type: "string", Format: "uuid"}
+	case t.Kind() == reflect.Ptr:
+		return spec.schemaOf(t.Elem())
+	case t.Kind() == reflect.Slice:
+		return &schema{Type: "array", Items: spec.schemaOf(t.Elem())}
+	case t.Kind() == reflect.Struct:
+		name := schemaName(t)
+		if _, ok := spec.Components.Schemas[name]; !ok {
+			s := &schema{Type: "object", Properties: map[string]*schema{}}
+			spec.Components.Schemas[name] = s
+			for i := 0; i < t.NumField(); i++ {
+				f := t.Field(i)
+				jsonName, ok := tagName(f, "json")
+				if !ok {
+					continue
+				}
+				s.Properties[jsonName] = fieldSchema(spec, f)
+				if isRequired(f) {
+					s.Required = append(s.Required, jsonName)
+				}
+			}
+		}
+		return &schema{Ref: "#/components/schemas/" + name}
+	case t.Kind() == reflect.String:
+		return &schema{Type: "string"}
+	case t.Kind() == reflect.Bool:
+		return &schema{Type: "boolean"}
+	case t.Kind() == reflect.Int64:
+		return &schema{Type: "integer", Format: "int64"}
+	case t.Kind() == reflect.Int32:
+		return &schema{Type: "integer", Format: "int32"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		return &schema{Type: "integer"}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		return &schema{Type: "number"}
+	}
+	return &schema{}
+}
+
+// formSchema returns the inline schema of the form fields of t, for the
+// routes taking a form body
+func formSchema(spec *openAPISpec, t reflect.Type) *schema {
+	s := &schema{Type: "object", Properties: map[string]*schema{}}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, ok := tagName(f, "form")
+		if !ok {
+			continue
+		}
+		s.Properties[name] = fieldSchema(spec, f)
+		if isRequired(f) {
+			s.Required = append(s.Required, name)
+		}
+	}
+	return s
+}
+
+// fieldSchema returns the schema of a struct field, including the
+// constraints declared in its binding tag. The rules following dive apply to
+// the items of an array.
+func fieldSchema(spec *openAPISpec, f reflect.StructField) *schema {
+	field := spec.schemaOf(f.Type)
+	if field.Ref != "" {
+		return field
+	}
+	s := field
+	for _, rule := range strings.Split(f.Tag.Get("binding"), ",") {
+		name, param, _ := strings.Cut(rule, "=")
+		isString := s.Type == "string"
+		isArray := s.Type == "array"
+		switch name {
+		case "dive":
+			s = s.Items
+		case "min", "gte":
+			if isArray {
+				s.MinItems = intParam(param)
+			} else if isString {
+				s.MinLength = intParam(param)
+			} else {
+				s.Minimum = floatParam(param)
+			}
+		case "max", "lte":
+			if isArray {
+				s.MaxItems = intParam(param)
+			} else if isString {
+				s.MaxLength = intParam(param)
+			} else {
+				s.Maximum = floatParam(param)
+			}
+		case "gt":
+			s.Minimum = floatParam(param)
+			s.ExclusiveMinimum = true
+		case "email":
+			s.Format = "email"
+		case "alphanum", "username":
+			s.Pattern = "^[a-zA-Z0-9]+$"
+		case "totp_code":
+			s.Pattern = fmt.Sprintf("^[0-9]{%d}$", val.TOTPCodeLength)
+		case "password":
+			n := val.MinPasswordLength
+			s.MinLength = &n
+		case "eq":
+			s.Enum = []string{param}
+		case "currency":
+			s.Enum = util.SupportedCurrencies()
+		case "scope":
+			s.Enum = util.SupportedScopes()
+		case "oauth_scope":
+			s.Enum = util.OAuthScopes()
+		case "redirect_uri":
+			s.Format = "uri"
+		}
+	}
+	return field
+}
+
+func tagName(f reflect.StructField, key string) (string, bool) {
+	name, _, _ := strings.Cut(f.Tag.Get(key), ",")
+	if name == "" || name == "-" {
+		return "", false
+	}
+	return name, true
+}
+
+func isRequired(f reflect.StructField) bool {
+	for _, rule := range strings.Split(f.Tag.Get("binding"), ",") {
+		if rule == "required" {
+			return true
+		}
+	}
+	return false
+}
+
+func intParam(param string) *int {
+	n, err := strconv.Atoi(param)
+	if err != nil {
+		panic(fmt.Sprintf("invalid binding parameter %q", param))
+	}
+	return &n
+}
+
+func floatParam(param string) *float64 {
+	n, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		panic(fmt.Sprintf("invalid binding parameter %q", param))
+	}
+	return &n
+}
+
+// schemaName exports the name of the type, e.g. createAccountReq becomes
+// CreateAccountReq
+func schemaName(t reflect.Type) string {
+	name := []rune(t.Name())
+	name[0] = unicode.ToUpper(name[0])
+	return string(name)
+}
+
+// openAPIPath converts a gin path like /accounts/:id to /accounts/{id}
+func openAPIPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
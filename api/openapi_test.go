@@ -0,0 +1,127 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	memdb "github.com/dpsigor/cheatsheet-golang-postgres/db/memory"
+	"github.com/dpsigor/cheatsheet-golang-postgres/util"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+// TestOpenAPIRoutesDocumented fails when a route is registered in
+// setupRouter without an entry in operations
+func TestOpenAPIRoutesDocumented(t *testing.T) {
+	server := newTestServer(t, nil)
+	for _, route := range server.router.Routes() {
+		if undocumentedRoutes[route.Path] {
+			continue
+		}
+		path := openAPIPath(route.Path)
+		ops, ok := server.spec.Paths[path]
+		require.True(t, ok, "route %s %s has no OpenAPI entry", route.Method, route.Path)
+		_, ok = ops[strings.ToLower(route.Method)]
+		require.True(t, ok, "route %s %s has no OpenAPI entry", route.Method, route.Path)
+	}
+}
+
+// TestOpenAPIOperationsEnforced fails when the scope or bearerOnly of an
+// operations entry, which the spec documents, is not what the router enforces
+func TestOpenAPIOperationsEnforced(t *testing.T) {
+	server := newTestServer(t, memdb.NewStore())
+	c := signUp(t, server)
+	recorder := c.do(http.MethodPost, "/users/me/api_keys", gin.H{"name": "full"}, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	keyHeader := http.Header{"Authorization": {"ApiKey " + decode[createAPIKeyRes](t, recorder).Key}}
+	keyClient := &apiClient{t: t, server: server}
+
+	for _, op := range operations {
+		if !op.auth {
+			continue
+		}
+		path := strings.ReplaceAll(op.path, ":id", "0")
+
+		// a token with the documented scope alone is let through
+		accessToken, err := server.tokenMaker.CreateToken(c.username, []string{op.scope}, time.Minute)
+		require.NoError(t, err)
+		scoped := &apiClient{t: t, server: server, username: c.username, accessToken: accessToken}
+		recorder = scoped.do(op.method, path, nil, nil)
+		require.NotEqual(t, http.StatusUnauthorized, recorder.Code, "route %s %s", op.method, op.path)
+		if recorder.Code == http.StatusForbidden {
+			require.NotEqual(t, CodeInsufficientScope, decode[Error](t, recorder).Code, "route %s %s", op.method, op.path)
+		}
+
+		// an API key with every scope is refused by the bearerOnly routes only
+		recorder = keyClient.do(op.method, path, nil, keyHeader)
+		refused := recorder.Code == http.StatusForbidden && decode[Error](t, recorder).Code == CodeForbidden
+		require.Equal(t, op.bearerOnly, refused, "route %s %s", op.method, op.path)
+	}
+}
+
+func TestOpenAPISpec(t *testing.T) {
+	server := newTestServer(t, nil)
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest(http.MethodGet, "/openapi.json", nil)
+	require.NoError(t, err)
+
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var spec openAPISpec
+	err = json.NewDecoder(recorder.Body).Decode(&spec)
+	require.NoError(t, err)
+	require.Equal(t, "3.0.3", spec.OpenAPI)
+
+	createAccount := spec.Components.Schemas["CreateAccountReq"]
+	require.NotNil(t, createAccount)
+	require.Equal(t, util.SupportedCurrencies(), createAccount.Properties["currency"].Enum)
+	require.ElementsMatch(t, []string{"owner", "currency"}, createAccount.Required)
+
+	listAccounts := spec.Paths["/accounts"]["get"]
+	require.NotNil(t, listAccounts)
+	require.Equal(t, []map[string][]string{{bearerAuth: {}}, {apiKeyAuth: {}}}, listAccounts.Security)
+	require.Equal(t, "Requires the `accounts:read` scope.", listAccounts.Description)
+	createAPIKey := spec.Paths["/users/me/api_keys"]["post"]
+	require.NotNil(t, createAPIKey)
+	require.Equal(t, []map[string][]string{{bearerAuth: {}}}, createAPIKey.Security)
+	require.Equal(t, util.SupportedScopes(), spec.Components.Schemas["CreateAPIKeyReq"].Properties["scopes"].Items.Enum)
+	for _, param := range listAccounts.Parameters {
+		require.Equal(t, "query", param.In)
+		if param.Name == "page_size" {
+			require.Equal(t, float64(5), *param.Schema.Minimum)
+			require.Equal(t, float64(10), *param.Schema.Maximum)
+		}
+	}
+
+	require.Contains(t, spec.Paths["/users/login"]["post"].Responses, "429")
+	require.NotContains(t, listAccounts.Responses, "429")
+
+	getAccount := spec.Paths["/accounts/{id}"]["get"]
+	require.NotNil(t, getAccount)
+	require.Len(t, getAccount.Parameters, 1)
+	require.Equal(t, "path", getAccount.Parameters[0].In)
+
+	transfer := spec.Components.Schemas["TransferReq"]
+	require.NotNil(t, transfer)
+	require.True(t, transfer.Properties["amount"].ExclusiveMinimum)
+	require.Equal(t, float64(0), *transfer.Properties["amount"].Minimum)
+}
+
+func TestDocs(t *testing.T) {
+	server := newTestServer(t, nil)
+
+	for _, path := range []string{"/docs/", "/docs/swagger-ui-bundle.js"} {
+		recorder := httptest.NewRecorder()
+		request, err := http.NewRequest(http.MethodGet, path, nil)
+		require.NoError(t, err)
+
+		server.router.ServeHTTP(recorder, request)
+		require.Equal(t, http.StatusOK, recorder.Code, path)
+		require.NotZero(t, recorder.Body.Len())
+	}
+}
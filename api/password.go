@@ -0,0 +1,113 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	db "github.com/dpsigor/cheatsheet-golang-postgres/db/sqlc"
+	"github.com/dpsigor/cheatsheet-golang-postgres/mail"
+	"github.com/dpsigor/cheatsheet-golang-postgres/token"
+	"github.com/dpsigor/cheatsheet-golang-postgres/val"
+	"github.com/gin-gonic/gin"
+)
+
+type changePasswordReq struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+
+	policy   val.PasswordPolicy
+	username string
+}
+
+func (req changePasswordReq) newPassword() (string, string, val.PasswordPolicy, val.PasswordUser) {
+	return "new_password", req.NewPassword, req.policy, val.PasswordUser{Username: req.username}
+}
+
+// changePassword sets a new password for the authenticated user, which logs
+// them out of every session, this one included
+func (server *Server) changePassword(ctx *gin.Context) {
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	req := changePasswordReq{policy: server.passwordPolicy, username: authPayload.Username}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		abortWithError(ctx, invalidRequest(err))
+		return
+	}
+
+	user, err := server.authenticator.ChangePassword(ctx, authPayload.Username, req.CurrentPassword, req.NewPassword)
+	if err != nil {
+		abortWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, newUserResponse(user))
+}
+
+type requestPasswordResetReq struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type requestPasswordResetRes struct {
+	Message string `json:"message"`
+}
+
+// requestPasswordReset emails a reset link to the user with the email. The
+// response is the same whether a user has the email or not, so that it does
+// not tell which emails are registered.
+func (server *Server) requestPasswordReset(ctx *gin.Context) {
+	var req requestPasswordResetReq
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		abortWithError(ctx, invalidRequest(err))
+		return
+	}
+
+	reset, err := server.authenticator.RequestPasswordReset(ctx, req.Email)
+	if err != nil && !errors.Is(err, db.ErrRecordNotFound) {
+		abortWithError(ctx, err)
+		return
+	}
+	if err == nil {
+		if err := server.mailer.Send(ctx, mail.PasswordResetMessage(
+			server.config.MailFrom, reset.User.Email, reset.User.FullName,
+			mail.Link(server.config.PasswordResetURL, reset.Token),
+		)); err != nil {
+			abortWithError(ctx, fmt.Errorf("cannot queue password reset email: %w", err))
+			return
+		}
+	}
+
+	ctx.JSON(http.StatusOK, requestPasswordResetRes{
+		Message: "if a user has this email, a password reset link was sent to it",
+	})
+}
+
+type resetPasswordReq struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+
+	policy val.PasswordPolicy
+}
+
+// newPassword knows nothing of the user, who is only known from the token
+// once the request is valid
+func (req resetPasswordReq) newPassword() (string, string, val.PasswordPolicy, val.PasswordUser) {
+	return "new_password", req.NewPassword, req.policy, val.PasswordUser{}
+}
+
+// resetPassword sets a new password for the user of a reset token sent by
+// requestPasswordReset
+func (server *Server) resetPassword(ctx *gin.Context) {
+	req := resetPasswordReq{policy: server.passwordPolicy}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		abortWithError(ctx, invalidRequest(err))
+		return
+	}
+
+	user, err := server.authenticator.ResetPassword(ctx, req.Token, req.NewPassword)
+	if err != nil {
+		abortWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, newUserResponse(user))
+}
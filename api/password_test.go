@@ -0,0 +1,85 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	memdb "github.com/dpsigor/cheatsheet-golang-postgres/db/memory"
+	"github.com/dpsigor/cheatsheet-golang-postgres/util"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChangePasswordAPI(t *testing.T) {
+	server := newTestServer(t, memdb.NewStore())
+	alice := signUp(t, server)
+
+	recorder := alice.do(http.MethodPut, "/users/me/password", gin.H{"current_password": alice.password, "new_password": "short"}, nil)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	requireBodyMatchErrorCode(t, recorder.Body, CodeInvalidRequest)
+	recorder = alice.do(http.MethodPut, "/users/me/password", gin.H{"current_password": "wrong-password", "new_password": util.RandomString(10)}, nil)
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+	requireBodyMatchErrorCode(t, recorder.Body, CodeInvalidCredentials)
+
+	newPassword := util.RandomString(10)
+	recorder = alice.do(http.MethodPut, "/users/me/password", gin.H{"current_password": alice.password, "new_password": newPassword}, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, alice.username, decode[userRes](t, recorder).Username)
+
+	// the sessions opened before the change are closed
+	recorder = alice.do(http.MethodGet, "/accounts?page_id=1&page_size=5", nil, nil)
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+	requireBodyMatchErrorCode(t, recorder.Body, CodeTokenRevoked)
+
+	recorder = alice.do(http.MethodPost, "/users/login", gin.H{"username": alice.username, "password": newPassword}, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	alice.accessToken = decode[loginUserRes](t, recorder).AccessToken
+	recorder = alice.do(http.MethodGet, "/accounts?page_id=1&page_size=5", nil, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+}
+
+func TestResetPasswordAPI(t *testing.T) {
+	server := newTestServerWithConfig(t, memdb.NewStore(), func(config *util.Config) {
+		config.MailFrom = "no-reply@example.com"
+		config.PasswordResetURL = "http://localhost/reset-password"
+	})
+	alice := signUp(t, server)
+	sent := sentMessages(server)
+	user, err := server.store.GetUser(context.Background(), alice.username)
+	require.NoError(t, err)
+
+	// unknown emails are answered the same, without a message
+	recorder := alice.do(http.MethodPost, "/users/password_reset", gin.H{"email": "unknown" + user.Email}, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, sent, sentMessages(server))
+	recorder = alice.do(http.MethodPost, "/users/password_reset", gin.H{"email": "not an email"}, nil)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	recorder = alice.do(http.MethodPost, "/users/password_reset", gin.H{"email": user.Email}, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, sent+1, sentMessages(server))
+	msg, resetToken := lastMessage(t, server)
+	require.Equal(t, "no-reply@example.com", msg.From)
+	require.Equal(t, user.Email, msg.To)
+	require.Contains(t, msg.Body, "http://localhost/reset-password?token=")
+
+	recorder = alice.do(http.MethodPost, "/users/password_reset/confirm", gin.H{"token": "wrong", "new_password": util.RandomString(10)}, nil)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	requireBodyMatchErrorCode(t, recorder.Body, CodeInvalidResetToken)
+
+	newPassword := util.RandomString(10)
+	recorder = alice.do(http.MethodPost, "/users/password_reset/confirm", gin.H{"token": resetToken, "new_password": newPassword}, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, alice.username, decode[userRes](t, recorder).Username)
+
+	recorder = alice.do(http.MethodPost, "/users/password_reset/confirm", gin.H{"token": resetToken, "new_password": util.RandomString(10)}, nil)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	requireBodyMatchErrorCode(t, recorder.Body, CodeInvalidResetToken)
+
+	recorder = alice.do(http.MethodGet, "/accounts?page_id=1&page_size=5", nil, nil)
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+	requireBodyMatchErrorCode(t, recorder.Body, CodeTokenRevoked)
+	recorder = alice.do(http.MethodPost, "/users/login", gin.H{"username": alice.username, "password": newPassword}, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+}
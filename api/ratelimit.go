@@ -0,0 +1,47 @@
+package api
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dpsigor/cheatsheet-golang-postgres/ratelimit"
+	"github.com/dpsigor/cheatsheet-golang-postgres/token"
+	"github.com/gin-gonic/gin"
+)
+
+const retryAfterHeaderKey = "Retry-After"
+
+// rateLimitMiddleware allows policy.Limit requests per policy.Period to the
+// route named name, for every authenticated user or, on public routes, for
+// every client IP. Requests over the limit are answered 429 with a
+// Retry-After header. When the limiter fails, the request is served, so that
+// an outage of its backend does not take the API down.
+func (server *Server) rateLimitMiddleware(name string, policy ratelimit.Policy) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if !policy.Enabled() {
+			ctx.Next()
+			return
+		}
+
+		key := name + ":ip:" + ctx.ClientIP()
+		if payload, ok := ctx.Get(authorizationPayloadKey); ok {
+			key = name + ":user:" + payload.(*token.Payload).Username
+		}
+
+		result, err := server.limiter.Allow(ctx, key, policy)
+		if err != nil {
+			ctx.Error(err)
+			ctx.Next()
+			return
+		}
+		if !result.Allowed {
+			// clients must not retry before the next token, so round up
+			ctx.Header(retryAfterHeaderKey, strconv.Itoa(int(math.Ceil(result.RetryAfter.Seconds()))))
+			abortWithError(ctx, newError(http.StatusTooManyRequests, CodeRateLimited, "too many requests, retry in %s", result.RetryAfter.Round(time.Second)))
+			return
+		}
+		ctx.Next()
+	}
+}
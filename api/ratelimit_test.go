@@ -0,0 +1,168 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	memdb "github.com/dpsigor/cheatsheet-golang-postgres/db/memory"
+	"github.com/dpsigor/cheatsheet-golang-postgres/ratelimit"
+	"github.com/dpsigor/cheatsheet-golang-postgres/token"
+	"github.com/dpsigor/cheatsheet-golang-postgres/util"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func login(t *testing.T, server *Server, remoteAddr string, header http.Header) *httptest.ResponseRecorder {
+	body, err := json.Marshal(gin.H{"username": "alice", "password": "secret123"})
+	require.NoError(t, err)
+	request, err := http.NewRequest(http.MethodPost, "/users/login", bytes.NewReader(body))
+	require.NoError(t, err)
+	request.RemoteAddr = remoteAddr
+	for key, values := range header {
+		request.Header[key] = values
+	}
+	recorder := httptest.NewRecorder()
+	server.router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestLoginRateLimit(t *testing.T) {
+	server := newTestServerWithConfig(t, memdb.NewStore(), func(config *util.Config) {
+		config.LoginRateLimit = 2
+		config.LoginRateLimitPeriod = time.Hour
+	})
+
+	// failed logins count too
+	for i := 0; i < 2; i++ {
+		recorder := login(t, server, "10.0.0.1:1234", nil)
+		require.Equal(t, http.StatusUnauthorized, recorder.Code)
+	}
+	recorder := login(t, server, "10.0.0.1:5678", nil)
+	require.Equal(t, http.StatusTooManyRequests, recorder.Code)
+	require.Equal(t, "1800", recorder.Header().Get(retryAfterHeaderKey))
+	requireBodyMatchErrorCode(t, recorder.Body, CodeRateLimited)
+
+	// other clients have their own limit
+	recorder = login(t, server, "10.0.0.2:1234", nil)
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	// the X-Forwarded-For header of an untrusted client is ignored
+	recorder = login(t, server, "10.0.0.1:1234", http.Header{"X-Forwarded-For": {"10.0.0.3"}})
+	require.Equal(t, http.StatusTooManyRequests, recorder.Code)
+}
+
+func TestLoginRateLimitTrustedProxy(t *testing.T) {
+	server := newTestServerWithConfig(t, memdb.NewStore(), func(config *util.Config) {
+		config.TrustedProxies = []string{"10.0.0.0/8"}
+		config.LoginRateLimit = 1
+		config.LoginRateLimitPeriod = time.Hour
+	})
+
+	recorder := login(t, server, "10.0.0.1:1234", http.Header{"X-Forwarded-For": {"192.0.2.1"}})
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+	recorder = login(t, server, "10.0.0.2:1234", http.Header{"X-Forwarded-For": {"192.0.2.1"}})
+	require.Equal(t, http.StatusTooManyRequests, recorder.Code)
+	recorder = login(t, server, "10.0.0.1:1234", http.Header{"X-Forwarded-For": {"192.0.2.2"}})
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+}
+
+func TestTransferRateLimit(t *testing.T) {
+	store := memdb.NewStore()
+	server := newTestServerWithConfig(t, store, func(config *util.Config) {
+		config.RateLimitBackend = ratelimit.BackendPostgres
+		config.TransferRateLimit = 1
+		config.TransferRateLimitPeriod = time.Minute
+	})
+	alice := signUp(t, server)
+	bob := signUp(t, server)
+
+	transfer := gin.H{"from_account_id": 1, "to_account_id": 2, "amount": 10, "currency": util.USD}
+	recorder := alice.do(http.MethodPost, "/transfers", transfer, nil)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+	recorder = alice.do(http.MethodPost, "/transfers", transfer, nil)
+	require.Equal(t, http.StatusTooManyRequests, recorder.Code)
+	require.Equal(t, "60", recorder.Header().Get(retryAfterHeaderKey))
+
+	// the limit is per user
+	recorder = bob.do(http.MethodPost, "/transfers", transfer, nil)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+
+	// the buckets are kept in the store
+	_, err := store.DeleteRateLimitBuckets(context.Background(), time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	recorder = alice.do(http.MethodPost, "/transfers", transfer, nil)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+// TestRouteRateLimits checks that the public routes other than the login
+// have limits of their own, rather than the one of the login
+func TestRouteRateLimits(t *testing.T) {
+	server := newTestServerWithConfig(t, memdb.NewStore(), func(config *util.Config) {
+		config.LoginRateLimit = 1
+		config.LoginRateLimitPeriod = time.Hour
+		config.PasswordResetRateLimit = 2
+		config.PasswordResetRateLimitPeriod = time.Hour
+		config.VerifyEmailRateLimit = 3
+		config.VerifyEmailRateLimitPeriod = time.Hour
+		config.OAuthTokenRateLimit = 4
+		config.OAuthTokenRateLimitPeriod = time.Hour
+	})
+	anonymous := &apiClient{t: t, server: server}
+
+	for _, route := range []struct {
+		method, path string
+		limit        int
+	}{
+		{http.MethodPost, "/users/password_reset", 2},
+		{http.MethodPost, "/users/password_reset/confirm", 0},
+		{http.MethodGet, "/users/verify_email", 3},
+		{http.MethodPost, "/oauth/token", 4},
+	} {
+		for i := 0; i < route.limit; i++ {
+			recorder := anonymous.do(route.method, route.path, nil, nil)
+			require.NotEqual(t, http.StatusTooManyRequests, recorder.Code, route.path)
+		}
+		// the routes of a limit share its bucket
+		recorder := anonymous.do(route.method, route.path, nil, nil)
+		require.Equal(t, http.StatusTooManyRequests, recorder.Code, route.path)
+	}
+}
+
+type failingLimiter struct{}
+
+func (failingLimiter) Allow(ctx context.Context, key string, policy ratelimit.Policy) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errors.New("limiter is down")
+}
+
+func TestRateLimitFailsOpen(t *testing.T) {
+	server := newTestServerWithConfig(t, memdb.NewStore(), func(config *util.Config) {
+		config.LoginRateLimit = 1
+		config.LoginRateLimitPeriod = time.Hour
+	})
+	server.limiter = failingLimiter{}
+	require.NoError(t, server.setupRouter())
+
+	for i := 0; i < 2; i++ {
+		recorder := login(t, server, "10.0.0.1:1234", nil)
+		require.Equal(t, http.StatusUnauthorized, recorder.Code)
+	}
+}
+
+func TestNewServerRateLimitConfig(t *testing.T) {
+	tokenMaker, err := token.NewPasetoMaker(util.RandomString(32))
+	require.NoError(t, err)
+	config := util.Config{RateLimitBackend: "redis"}
+	_, err = NewServer(config, nil, tokenMaker, zerolog.Nop(), nil, nil)
+	require.Error(t, err)
+
+	config = util.Config{TrustedProxies: []string{"not an ip"}}
+	_, err = NewServer(config, nil, tokenMaker, zerolog.Nop(), nil, nil)
+	require.Error(t, err)
+}
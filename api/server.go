@@ -1,68 +1,217 @@
 package api
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net"
+	"net/http"
 
+	"github.com/dpsigor/cheatsheet-golang-postgres/auth"
 	db "github.com/dpsigor/cheatsheet-golang-postgres/db/sqlc"
+	"github.com/dpsigor/cheatsheet-golang-postgres/health"
+	"github.com/dpsigor/cheatsheet-golang-postgres/mail"
+	"github.com/dpsigor/cheatsheet-golang-postgres/metrics"
+	"github.com/dpsigor/cheatsheet-golang-postgres/password"
+	"github.com/dpsigor/cheatsheet-golang-postgres/ratelimit"
 	"github.com/dpsigor/cheatsheet-golang-postgres/token"
+	"github.com/dpsigor/cheatsheet-golang-postgres/tracing"
 	"github.com/dpsigor/cheatsheet-golang-postgres/util"
+	"github.com/dpsigor/cheatsheet-golang-postgres/val"
 	"github.com/gin-gonic/gin"
 	"github.com/gin-gonic/gin/binding"
 	"github.com/go-playground/validator/v10"
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
 
 // Server serves HTTP requests for our banking service
 type Server struct {
-	config     util.Config
-	store      db.Store
-	tokenMaker token.Maker
-	router     *gin.Engine
+	config        util.Config
+	store         db.Store
+	tokenMaker    token.Maker
+	authenticator *auth.Authenticator
+	// passwordPolicy is the policy of the passwords users choose, set on the
+	// requests choosing one before they are bound
+	passwordPolicy val.PasswordPolicy
+	router         *gin.Engine
+	spec           *openAPISpec
+	logger         zerolog.Logger
+	metrics        *metrics.Metrics
+	health         *health.Checker
+	limiter        ratelimit.Limiter
+	mailer         mail.Mailer
+	mailQueue      *mail.Queue
+	httpServer     *http.Server
 }
 
-func (server *Server) setupRouter() {
-	router := gin.Default()
+func (server *Server) setupRouter() error {
+	router := gin.New()
+	// the rate limiter and the logs see the IP of the client, rather than
+	// the IP of the proxy it connects through
+	if err := router.SetTrustedProxies(server.config.TrustedProxies); err != nil {
+		return fmt.Errorf("invalid trusted proxies: %w", err)
+	}
+	// handlers hand the gin context to the store, which then sees the values
+	// and cancellation of the request context
+	router.ContextWithFallback = true
+	// the tracing middleware comes first, so the logs and error responses of
+	// the request carry its trace ID
+	router.Use(
+		otelgin.Middleware(tracing.ServiceName),
+		requestIDMiddleware(),
+		loggerMiddleware(server.logger),
+		gin.Recovery(),
+	)
+	if server.metrics != nil {
+		router.Use(metricsMiddleware(server.metrics))
+	}
+
+	router.POST("/users", server.idempotencyMiddleware(), server.createUser)
+	loginPolicy := ratelimit.Policy{Limit: server.config.LoginRateLimit, Period: server.config.LoginRateLimitPeriod}
+	router.POST("/users/login", server.rateLimitMiddleware("login", loginPolicy), server.loginUser)
+	router.POST("/users/login/totp", server.rateLimitMiddleware("login", loginPolicy), server.loginTOTP)
+	passwordResetPolicy := ratelimit.Policy{Limit: server.config.PasswordResetRateLimit, Period: server.config.PasswordResetRateLimitPeriod}
+	router.POST("/users/password_reset", server.rateLimitMiddleware("password_reset", passwordResetPolicy), server.requestPasswordReset)
+	router.POST("/users/password_reset/confirm", server.rateLimitMiddleware("password_reset", passwordResetPolicy), server.resetPassword)
+	verifyEmailPolicy := ratelimit.Policy{Limit: server.config.VerifyEmailRateLimit, Period: server.config.VerifyEmailRateLimitPeriod}
+	router.GET("/users/verify_email", server.rateLimitMiddleware("verify_email", verifyEmailPolicy), server.verifyEmail)
+	oauthTokenPolicy := ratelimit.Policy{Limit: server.config.OAuthTokenRateLimit, Period: server.config.OAuthTokenRateLimitPeriod}
+	router.POST("/oauth/token", server.rateLimitMiddleware("oauth_token", oauthTokenPolicy), server.createOAuthToken)
+
+	authRoutes := router.Group("/").Use(authMiddleware(server.tokenMaker, server.authenticator))
+
+	// the scope of every route must match the one of its operations entry
+	usersRead := requireScope(util.UsersReadScope)
+	usersWrite := requireScope(util.UsersWriteScope)
+	authRoutes.GET("/users/login_attempts", usersRead, server.listLoginAttempts)
+	// the second factor, email and password secure the account, so an API
+	// key cannot change them either
+	authRoutes.POST("/users/totp", bearerOnlyMiddleware(), usersWrite, server.enrollTOTP)
+	authRoutes.POST("/users/totp/confirm", bearerOnlyMiddleware(), usersWrite, server.confirmTOTP)
+	authRoutes.GET("/users/me", usersRead, server.getUser)
+	authRoutes.PATCH("/users/me", bearerOnlyMiddleware(), usersWrite, server.updateUser)
+	authRoutes.PUT("/users/me/password", bearerOnlyMiddleware(), usersWrite, server.changePassword)
+	authRoutes.POST("/users/verify_email", usersWrite, server.rateLimitMiddleware("verify_email", verifyEmailPolicy), server.sendVerificationEmail)
+	authRoutes.POST("/users/me/api_keys", bearerOnlyMiddleware(), usersWrite, server.createAPIKey)
+	authRoutes.GET("/users/me/api_keys", bearerOnlyMiddleware(), usersRead, server.listAPIKeys)
+	authRoutes.DELETE("/users/me/api_keys/:id", bearerOnlyMiddleware(), usersWrite, server.deleteAPIKey)
+	// OAuth clients are never granted users:write, so partners can neither
+	// register clients nor consent on behalf of users
+	authRoutes.POST("/oauth/clients", bearerOnlyMiddleware(), usersWrite, server.registerOAuthClient)
+	authRoutes.GET("/oauth/authorize", bearerOnlyMiddleware(), usersWrite, server.getOAuthAuthorization)
+	authRoutes.POST("/oauth/authorize", bearerOnlyMiddleware(), usersWrite, server.approveOAuthAuthorization)
 
-	router.POST("/users", server.createUser)
-	router.POST("/users/login", server.loginUser)
+	authRoutes.POST("/accounts", requireScope(util.AccountsWriteScope), server.idempotencyMiddleware(), server.createAccount)
+	authRoutes.GET("/accounts/:id", requireScope(util.AccountsReadScope), server.getAccount)
+	authRoutes.GET("/accounts", requireScope(util.AccountsReadScope), server.listAccount)
 
-	authRoutes := router.Group("/").Use(authMiddleware(server.tokenMaker))
+	transferPolicy := ratelimit.Policy{Limit: server.config.TransferRateLimit, Period: server.config.TransferRateLimitPeriod}
+	authRoutes.POST("/transfers", requireScope(util.TransfersWriteScope), server.rateLimitMiddleware("transfers", transferPolicy), server.idempotencyMiddleware(), server.createTransfer)
 
-	authRoutes.POST("/accounts", server.createAccount)
-	authRoutes.GET("/accounts/:id", server.getAccount)
-	authRoutes.GET("/accounts", server.listAccount)
+	router.GET("/healthz", server.healthz)
+	router.GET("/readyz", server.readyz)
 
-	authRoutes.POST("/transfers", server.createTransfer)
+	router.GET("/openapi.json", server.serveOpenAPISpec)
+	router.GET("/docs/*any", server.serveDocs)
+	if server.metrics != nil {
+		router.GET("/metrics", gin.WrapH(server.metrics.Handler()))
+	}
 
 	server.router = router
+	return nil
 }
 
-// NewServer creates a new HTTP server and setup routing
-func NewServer(config util.Config, store db.Store) (*Server, error) {
-	tokenMaker, err := token.NewPasetoMaker(config.TokenSymmetricKey)
+// NewServer creates a new HTTP server and setup routing. The access tokens
+// are issued and checked with tokenMaker, which the gRPC server shares. The
+// server records request metrics and serves /metrics unless m is nil.
+// /readyz runs the checks of checker.
+func NewServer(config util.Config, store db.Store, tokenMaker token.Maker, logger zerolog.Logger, m *metrics.Metrics, checker *health.Checker) (*Server, error) {
+	limiter, err := ratelimit.New(config.RateLimitBackend, store)
+	if err != nil {
+		return nil, err
+	}
+	hasher, err := password.NewHasherFromConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	mailer, err := mail.New(config.MailBackend, config.MailDir)
 	if err != nil {
-		return nil, fmt.Errorf("cannot create token maker: %v", err)
+		return nil, err
 	}
+	mailQueue := mail.NewQueue(mailer, logger, mail.DefaultQueueSize)
 	server := &Server{
-		config:     config,
-		store:      store,
-		tokenMaker: tokenMaker,
+		config:         config,
+		store:          store,
+		tokenMaker:     tokenMaker,
+		authenticator:  auth.NewAuthenticator(store, auth.LockoutPolicyFromConfig(config), hasher),
+		passwordPolicy: val.PasswordPolicyFromConfig(config),
+		spec:           newOpenAPISpec(operations),
+		logger:         logger,
+		metrics:        m,
+		health:         checker,
+		limiter:        limiter,
+		mailer:         mailQueue,
+		mailQueue:      mailQueue,
 	}
 
 	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
 		v.RegisterValidation("currency", validCurrency)
+		v.RegisterValidation("username", validUsername)
+		v.RegisterValidation("password", validPassword)
+		v.RegisterValidation("totp_code", validTOTPCode)
+		v.RegisterValidation("scope", validScope)
+		v.RegisterValidation("oauth_scope", validOAuthScope)
+		v.RegisterValidation("redirect_uri", validRedirectURI)
+		v.RegisterStructValidation(validPasswordPolicy, createUserReq{}, changePasswordReq{}, resetPasswordReq{})
+		v.RegisterTagNameFunc(fieldName)
 	} else {
 		return nil, fmt.Errorf("failed to call gin validator")
 	}
 
-	server.setupRouter()
+	if err := server.setupRouter(); err != nil {
+		return nil, err
+	}
+	server.httpServer = &http.Server{
+		Handler:           server.router,
+		ReadHeaderTimeout: config.HTTPReadTimeout,
+		ReadTimeout:       config.HTTPReadTimeout,
+		WriteTimeout:      config.HTTPWriteTimeout,
+		IdleTimeout:       config.HTTPIdleTimeout,
+	}
 	return server, nil
 }
 
-// Start runs the HTTP server on a specific address
+// Handler returns the handler serving the routes of the API
+func (server *Server) Handler() http.Handler {
+	return server.router
+}
+
+// Start runs the HTTP server on a specific address. It returns nil once the
+// server is stopped by Shutdown.
 func (server *Server) Start(address string) error {
-	return server.router.Run(address)
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	return server.Serve(listener)
 }
 
-func errorResponse(err error) gin.H {
-	return gin.H{"error": err.Error()}
+// Serve runs the HTTP server on listener. It returns nil once the server is
+// stopped by Shutdown.
+func (server *Server) Serve(listener net.Listener) error {
+	err := server.httpServer.Serve(listener)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Shutdown stops accepting connections and waits for the in-flight requests
+// to complete and the emails they queued to be sent, or for ctx to be done
+func (server *Server) Shutdown(ctx context.Context) error {
+	if err := server.httpServer.Shutdown(ctx); err != nil {
+		return err
+	}
+	return server.mailQueue.Close(ctx)
 }
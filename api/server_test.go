@@ -0,0 +1,72 @@
+package api
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShutdown(t *testing.T) {
+	server := newTestServer(t, nil)
+	started := make(chan struct{})
+	server.router.GET("/slow", func(ctx *gin.Context) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		ctx.Status(http.StatusOK)
+	})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	served := make(chan error)
+	go func() {
+		served <- server.Serve(listener)
+	}()
+
+	responded := make(chan int)
+	go func() {
+		rsp, err := http.Get("http://" + listener.Addr().String() + "/slow")
+		if err != nil {
+			responded <- 0
+			return
+		}
+		rsp.Body.Close()
+		responded <- rsp.StatusCode
+	}()
+	<-started
+
+	// the in-flight request completes before Shutdown returns
+	err = server.Shutdown(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, <-responded)
+	require.NoError(t, <-served)
+
+	_, err = http.Get("http://" + listener.Addr().String() + "/slow")
+	require.Error(t, err)
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	server := newTestServer(t, nil)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	server.router.GET("/stuck", func(ctx *gin.Context) {
+		close(started)
+		<-release
+	})
+	defer close(release)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go server.Serve(listener)
+	go http.Get("http://" + listener.Addr().String() + "/stuck")
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = server.Shutdown(ctx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
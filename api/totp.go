@@ -0,0 +1,100 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/dpsigor/cheatsheet-golang-postgres/auth"
+	"github.com/dpsigor/cheatsheet-golang-postgres/token"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type totpChallengeRes struct {
+	ID        uuid.UUID `json:"id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type loginTOTPReq struct {
+	ChallengeID uuid.UUID `json:"challenge_id" binding:"required"`
+	// Code is a TOTP code or a recovery code
+	Code string `json:"code" binding:"required,max=32"`
+	// Scopes restrict the access token, as the ones of loginUserReq
+	Scopes []string `json:"scopes" binding:"omitempty,dive,scope"`
+}
+
+// loginTOTP completes the login of a user with two-factor authentication
+// enabled, answering the challenge returned by loginUser
+func (server *Server) loginTOTP(ctx *gin.Context) {
+	var req loginTOTPReq
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		abortWithError(ctx, invalidRequest(err))
+		return
+	}
+
+	user, err := server.authenticator.LoginTOTP(ctx, req.ChallengeID, req.Code, auth.Client{
+		IP:        ctx.ClientIP(),
+		UserAgent: ctx.Request.UserAgent(),
+	})
+	if err != nil {
+		abortWithError(ctx, err)
+		return
+	}
+
+	rsp, err := server.newLoginResponse(user, req.Scopes)
+	if err != nil {
+		abortWithError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, rsp)
+}
+
+type enrollTOTPRes struct {
+	Secret string `json:"secret"`
+	// URI is the otpauth URI of the secret, to be shown as a QR code
+	URI string `json:"uri"`
+}
+
+// enrollTOTP generates a TOTP secret for the authenticated user, enabled
+// once confirmed by confirmTOTP
+func (server *Server) enrollTOTP(ctx *gin.Context) {
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	enrollment, err := server.authenticator.EnrollTOTP(ctx, authPayload.Username)
+	if err != nil {
+		abortWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, enrollTOTPRes{
+		Secret: enrollment.Secret,
+		URI:    enrollment.URI,
+	})
+}
+
+type confirmTOTPReq struct {
+	Code string `json:"code" binding:"required,totp_code"`
+}
+
+type confirmTOTPRes struct {
+	// RecoveryCodes replace a TOTP code once each, and are not shown again
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// confirmTOTP enables the TOTP of the authenticated user once they send a
+// code of their secret
+func (server *Server) confirmTOTP(ctx *gin.Context) {
+	var req confirmTOTPReq
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		abortWithError(ctx, invalidRequest(err))
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	codes, err := server.authenticator.ConfirmTOTP(ctx, authPayload.Username, req.Code)
+	if err != nil {
+		abortWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, confirmTOTPRes{RecoveryCodes: codes})
+}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/dpsigor/cheatsheet-golang-postgres/auth"
+	memdb "github.com/dpsigor/cheatsheet-golang-postgres/db/memory"
+	db "github.com/dpsigor/cheatsheet-golang-postgres/db/sqlc"
+	"github.com/dpsigor/cheatsheet-golang-postgres/util"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+// totpCodes returns the codes of a secret for the periods around the
+// current one, which the server accepts for clocks out of sync. It waits
+// for the next period if the current one is about to end, so that the
+// codes stay valid during the test.
+func totpCodes(t *testing.T, secret string) (previous, current, next string) {
+	const period = 30 * time.Second
+	now := time.Now()
+	if left := period - now.Sub(now.Truncate(period)); left < 5*time.Second {
+		time.Sleep(left)
+		now = time.Now()
+	}
+	codes := make([]string, 3)
+	for i := range codes {
+		code, err := auth.GenerateTOTPCode(secret, now.Add(time.Duration(i-1)*period))
+		require.NoError(t, err)
+		codes[i] = code
+	}
+	return codes[0], codes[1], codes[2]
+}
+
+func TestTOTPFlow(t *testing.T) {
+	store := memdb.NewStore()
+	server := newTestServerWithConfig(t, store, func(config *util.Config) {
+		config.TransferStepUpAmount = 50
+	})
+	alice := signUp(t, server)
+	bob := signUp(t, server)
+
+	recorder := alice.do(http.MethodPost, "/accounts", gin.H{"owner": "ignored", "currency": util.USD}, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	from := decode[db.Account](t, recorder)
+	recorder = bob.do(http.MethodPost, "/accounts", gin.H{"owner": "ignored", "currency": util.USD}, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	to := decode[db.Account](t, recorder)
+	_, err := store.AddAccountBalance(context.Background(), db.AddAccountBalanceParams{ID: from.ID, Amount: 1000})
+	require.NoError(t, err)
+
+	// transfers above the threshold require two-factor authentication
+	transfer := gin.H{"from_account_id": from.ID, "to_account_id": to.ID, "amount": 100, "currency": util.USD}
+	recorder = alice.do(http.MethodPost, "/transfers", transfer, nil)
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+	requireBodyMatchErrorCode(t, recorder.Body, CodeTOTPNotEnabled)
+	recorder = alice.do(http.MethodPost, "/transfers", gin.H{"from_account_id": from.ID, "to_account_id": to.ID, "amount": 50, "currency": util.USD}, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	recorder = alice.do(http.MethodPost, "/users/totp/confirm", gin.H{"code": "123456"}, nil)
+	require.Equal(t, http.StatusConflict, recorder.Code)
+	requireBodyMatchErrorCode(t, recorder.Body, CodeTOTPNotEnrolled)
+
+	recorder = alice.do(http.MethodPost, "/users/totp", nil, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	enrollment := decode[enrollTOTPRes](t, recorder)
+	require.Contains(t, enrollment.URI, "secret="+enrollment.Secret)
+	previous, current, next := totpCodes(t, enrollment.Secret)
+
+	recorder = alice.do(http.MethodPost, "/users/totp/confirm", gin.H{"code": "12345"}, nil)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	requireBodyMatchErrorCode(t, recorder.Body, CodeInvalidRequest)
+	recorder = alice.do(http.MethodPost, "/users/totp/confirm", gin.H{"code": previous}, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	recoveryCodes := decode[confirmTOTPRes](t, recorder).RecoveryCodes
+	require.Len(t, recoveryCodes, 10)
+
+	recorder = alice.do(http.MethodPost, "/users/totp", nil, nil)
+	require.Equal(t, http.StatusConflict, recorder.Code)
+	requireBodyMatchErrorCode(t, recorder.Body, CodeTOTPAlreadyEnabled)
+
+	// the password alone is answered with a challenge
+	credentials := gin.H{"username": alice.username, "password": alice.password}
+	recorder = alice.do(http.MethodPost, "/users/login", credentials, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	rsp := decode[loginUserRes](t, recorder)
+	require.Empty(t, rsp.AccessToken)
+	require.Nil(t, rsp.User)
+	require.NotNil(t, rsp.TOTPChallenge)
+
+	recorder = alice.do(http.MethodPost, "/users/login/totp", gin.H{"challenge_id": rsp.TOTPChallenge.ID, "code": current}, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	rsp = decode[loginUserRes](t, recorder)
+	require.NotEmpty(t, rsp.AccessToken)
+	require.Equal(t, alice.username, rsp.User.Username)
+
+	// recovery codes replace a TOTP code, and a challenge is answered once
+	recorder = alice.do(http.MethodPost, "/users/login", credentials, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	challenge := decode[loginUserRes](t, recorder).TOTPChallenge
+	recorder = alice.do(http.MethodPost, "/users/login/totp", gin.H{"challenge_id": challenge.ID, "code": recoveryCodes[0]}, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	recorder = alice.do(http.MethodPost, "/users/login/totp", gin.H{"challenge_id": challenge.ID, "code": next}, nil)
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+	requireBodyMatchErrorCode(t, recorder.Body, CodeInvalidCredentials)
+
+	recorder = alice.do(http.MethodPost, "/transfers", transfer, nil)
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+	requireBodyMatchErrorCode(t, recorder.Body, CodeTOTPRequired)
+	transfer["totp_code"] = "1234"
+	recorder = alice.do(http.MethodPost, "/transfers", transfer, nil)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	// codes are used once
+	transfer["totp_code"] = current
+	recorder = alice.do(http.MethodPost, "/transfers", transfer, nil)
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+	requireBodyMatchErrorCode(t, recorder.Body, CodeInvalidTOTPCode)
+	transfer["totp_code"] = next
+	recorder = alice.do(http.MethodPost, "/transfers", transfer, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, int64(850), decode[db.TransferTxResult](t, recorder).FromAccount.Balance)
+}
@@ -1,9 +1,7 @@
 package api
 
 import (
-	"database/sql"
 	"errors"
-	"fmt"
 	"net/http"
 
 	db "github.com/dpsigor/cheatsheet-golang-postgres/db/sqlc"
@@ -16,35 +14,48 @@ type transferReq struct {
 	ToAccountID   int64  `json:"to_account_id" binding:"required,min=1"`
 	Amount        int64  `json:"amount" binding:"required,gt=0"`
 	Currency      string `json:"currency" binding:"required,currency"`
+	// TOTPCode is required above the TRANSFER_STEP_UP_AMOUNT setting
+	TOTPCode string `json:"totp_code" binding:"omitempty,totp_code"`
 }
 
 func (s *Server) createTransfer(ctx *gin.Context) {
 	var req transferReq
 	if err := ctx.ShouldBindJSON(&req); err != nil {
-		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		abortWithError(ctx, invalidRequest(err))
 		return
 	}
 
-	fromAccount, valid := s.validAccount(ctx, req.FromAccountID, req.Currency)
-	if !valid {
-		err := errors.New("invalid from account")
-		ctx.JSON(http.StatusUnauthorized, errorResponse(err))
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	if err := s.authenticator.RequireVerifiedEmail(ctx, authPayload.Username); err != nil {
+		abortWithError(ctx, err)
+		return
+	}
+
+	fromAccount, err := s.validAccount(ctx, req.FromAccountID, req.Currency)
+	if err != nil {
+		abortWithError(ctx, err)
 		return
 	}
 
-	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
 	if fromAccount.Owner != authPayload.Username {
-		err := errors.New("from account doesn't belong to the authenticated user")
-		ctx.JSON(http.StatusUnauthorized, errorResponse(err))
+		abortWithError(ctx, newError(http.StatusForbidden, CodeForbidden, "from account doesn't belong to the authenticated user"))
 		return
 	}
 
-	if _, valid := s.validAccount(ctx, req.ToAccountID, req.Currency); !valid {
-		err := errors.New("invalid to account")
-		ctx.JSON(http.StatusUnauthorized, errorResponse(err))
+	if _, err := s.validAccount(ctx, req.ToAccountID, req.Currency); err != nil {
+		abortWithError(ctx, err)
 		return
 	}
 
+	// checked last, so that the code is not used up by a transfer failing
+	// validation
+	if s.config.TransferStepUpAmount > 0 && req.Amount > s.config.TransferStepUpAmount {
+		if err := s.authenticator.VerifyTOTP(ctx, authPayload.Username, req.TOTPCode); err != nil {
+			abortWithError(ctx, err)
+			return
+		}
+	}
+
 	arg := db.TransferTxParams{
 		FromAccountID: req.FromAccountID,
 		ToAccountID:   req.ToAccountID,
@@ -53,27 +64,28 @@ func (s *Server) createTransfer(ctx *gin.Context) {
 
 	result, err := s.store.TransferTx(ctx, arg)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		abortWithError(ctx, err)
 		return
 	}
 
 	ctx.JSON(http.StatusOK, result)
 }
 
-func (s *Server) validAccount(ctx *gin.Context, accountID int64, currency string) (db.Account, bool) {
+// validAccount returns the account if it exists, holds the currency and is
+// not frozen
+func (s *Server) validAccount(ctx *gin.Context, accountID int64, currency string) (db.Account, error) {
 	account, err := s.store.GetAccount(ctx, accountID)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			ctx.JSON(http.StatusNotFound, errorResponse(err))
-			return account, false
+		if errors.Is(err, db.ErrRecordNotFound) {
+			return account, newError(http.StatusNotFound, CodeAccountNotFound, "account %d not found", accountID)
 		}
-		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
-		return account, false
+		return account, err
 	}
 	if account.Currency != currency {
-		err := fmt.Errorf("account [%d] currency mismatch: %s vs %s", account.ID, account.Currency, currency)
-		ctx.JSON(http.StatusBadRequest, errorResponse(err))
-		return account, false
+		return account, newError(http.StatusBadRequest, CodeCurrencyMismatch, "account [%d] currency mismatch: %s vs %s", account.ID, account.Currency, currency)
+	}
+	if account.Frozen {
+		return account, newError(http.StatusUnprocessableEntity, CodeAccountFrozen, "account %d is frozen", account.ID)
 	}
-	return account, true
+	return account, nil
 }
@@ -0,0 +1,205 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	memdb "github.com/dpsigor/cheatsheet-golang-postgres/db/memory"
+	mockdb "github.com/dpsigor/cheatsheet-golang-postgres/db/mock"
+	db "github.com/dpsigor/cheatsheet-golang-postgres/db/sqlc"
+	"github.com/dpsigor/cheatsheet-golang-postgres/util"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateTransfer(t *testing.T) {
+	user1, _ := randomUser(t)
+	user2, _ := randomUser(t)
+	account1 := randomAccount(user1.Username)
+	account2 := randomAccount(user2.Username)
+	account2.ID = account1.ID + 1
+	account1.Currency = util.USD
+	account2.Currency = util.USD
+	amount := int64(10)
+
+	tests := []struct {
+		name       string
+		body       gin.H
+		buildStubs func(store *mockdb.MockStore)
+		checkRes   func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			body: gin.H{"from_account_id": account1.ID, "to_account_id": account2.ID, "amount": amount, "currency": util.USD},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account1.ID)).Times(1).Return(account1, nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account2.ID)).Times(1).Return(account2, nil)
+				arg := db.TransferTxParams{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: amount}
+				store.EXPECT().TransferTx(gomock.Any(), gomock.Eq(arg)).Times(1)
+			},
+			checkRes: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name: "FromAccountFrozen",
+			body: gin.H{"from_account_id": account1.ID, "to_account_id": account2.ID, "amount": amount, "currency": util.USD},
+			buildStubs: func(store *mockdb.MockStore) {
+				frozen := account1
+				frozen.Frozen = true
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account1.ID)).Times(1).Return(frozen, nil)
+				store.EXPECT().TransferTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkRes: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+				requireBodyMatchErrorCode(t, recorder.Body, CodeAccountFrozen)
+			},
+		},
+		{
+			name: "ToAccountFrozen",
+			body: gin.H{"from_account_id": account1.ID, "to_account_id": account2.ID, "amount": amount, "currency": util.USD},
+			buildStubs: func(store *mockdb.MockStore) {
+				frozen := account2
+				frozen.Frozen = true
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account1.ID)).Times(1).Return(account1, nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account2.ID)).Times(1).Return(frozen, nil)
+				store.EXPECT().TransferTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkRes: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+				requireBodyMatchErrorCode(t, recorder.Body, CodeAccountFrozen)
+			},
+		},
+		{
+			name: "CurrencyMismatch",
+			body: gin.H{"from_account_id": account1.ID, "to_account_id": account2.ID, "amount": amount, "currency": util.EUR},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account1.ID)).Times(1).Return(account1, nil)
+				store.EXPECT().TransferTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkRes: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				requireBodyMatchErrorCode(t, recorder.Body, CodeCurrencyMismatch)
+			},
+		},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			store := newMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			bs, err := json.Marshal(tc.body)
+			require.NoError(t, err)
+			request, err := http.NewRequest(http.MethodPost, "/transfers", bytes.NewReader(bs))
+			require.NoError(t, err)
+			addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, user1.Username, time.Minute)
+
+			server.router.ServeHTTP(recorder, request)
+			tc.checkRes(t, recorder)
+		})
+	}
+}
+
+// FuzzCreateTransfer sends arbitrary bodies to POST /transfers, as the owner
+// of the from account. Two of the accounts hold balances close to the limits
+// of int64, so that an amount the binding lets through without checking
+// overflows them, as a sender or as a receiver. Whatever the body, the server
+// must not fail, and a transfer must move exactly its amount.
+func FuzzCreateTransfer(f *testing.F) {
+	for _, body := range []string{
+		`{"from_account_id":1,"to_account_id":2,"amount":10,"currency":"USD"}`,
+		`{"from_account_id":1,"to_account_id":2,"amount":101,"currency":"USD"}`,
+		`{"from_account_id":1,"to_account_id":1,"amount":9223372036854775807,"currency":"USD"}`,
+		`{"from_account_id":1,"to_account_id":2,"amount":9223372036854775807,"currency":"USD"}`,
+		`{"from_account_id":1,"to_account_id":2,"amount":9223372036854775808,"currency":"USD"}`,
+		`{"from_account_id":1,"to_account_id":2,"amount":-9223372036854775808,"currency":"USD"}`,
+		`{"from_account_id":1,"to_account_id":2,"amount":0,"currency":"USD"}`,
+		`{"from_account_id":1,"to_account_id":2,"amount":1e3,"currency":"USD"}`,
+		`{"from_account_id":1,"to_account_id":2,"amount":"10","currency":"USD"}`,
+		`{"from_account_id":2,"to_account_id":1,"amount":10,"currency":"USD"}`,
+		`{"from_account_id":3,"to_account_id":2,"amount":101,"currency":"USD"}`,
+		`{"from_account_id":1,"to_account_id":3,"amount":101,"currency":"USD"}`,
+		`{"from_account_id":3,"to_account_id":1,"amount":9223372036854775807,"currency":"USD"}`,
+	} {
+		f.Add([]byte(body))
+	}
+
+	store := memdb.NewStore()
+	ctx := context.Background()
+	var accountIDs []int64
+	owners := map[int64]string{}
+	for _, balance := range []int64{math.MinInt64 + 100, math.MaxInt64 - 100, 0} {
+		user, err := store.CreateUser(ctx, db.CreateUserParams{
+			Username: util.RandomOwner(),
+			Email:    util.RandomEmail(),
+		})
+		require.NoError(f, err)
+		account, err := store.CreateAccount(ctx, db.CreateAccountParams{Owner: user.Username, Balance: balance, Currency: util.USD})
+		require.NoError(f, err)
+		accountIDs = append(accountIDs, account.ID)
+		owners[account.ID] = user.Username
+	}
+	server := newTestServer(f, store)
+
+	balances := func(t *testing.T) []int64 {
+		var balances []int64
+		for _, id := range accountIDs {
+			account, err := store.GetAccount(ctx, id)
+			require.NoError(t, err)
+			balances = append(balances, account.Balance)
+		}
+		return balances
+	}
+
+	f.Fuzz(func(t *testing.T, body []byte) {
+		before := balances(t)
+		request, err := http.NewRequest(http.MethodPost, "/transfers", bytes.NewReader(body))
+		require.NoError(t, err)
+		var req struct {
+			FromAccountID int64 `json:"from_account_id"`
+		}
+		json.Unmarshal(body, &req)
+		owner, ok := owners[req.FromAccountID]
+		if !ok {
+			owner = owners[accountIDs[0]]
+		}
+		addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, owner, time.Minute)
+		recorder := httptest.NewRecorder()
+		server.router.ServeHTTP(recorder, request)
+
+		require.Less(t, recorder.Code, http.StatusInternalServerError, recorder.Body.String())
+		after := balances(t)
+		if recorder.Code != http.StatusOK {
+			require.Equal(t, before, after)
+			return
+		}
+
+		var result db.TransferTxResult
+		require.NoError(t, json.NewDecoder(recorder.Body).Decode(&result))
+		amount := big.NewInt(result.Transfer.Amount)
+		require.Positive(t, amount.Sign())
+		moved := map[int64]*big.Int{}
+		for i, id := range accountIDs {
+			moved[id] = new(big.Int).Sub(big.NewInt(after[i]), big.NewInt(before[i]))
+		}
+		if result.Transfer.FromAccountID == result.Transfer.ToAccountID {
+			require.Zero(t, moved[result.Transfer.FromAccountID].Sign())
+			return
+		}
+		require.Zero(t, new(big.Int).Neg(amount).Cmp(moved[result.Transfer.FromAccountID]))
+		require.Zero(t, amount.Cmp(moved[result.Transfer.ToAccountID]))
+	})
+}
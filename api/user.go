@@ -2,27 +2,36 @@ package api
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
 
+	"github.com/dpsigor/cheatsheet-golang-postgres/auth"
 	db "github.com/dpsigor/cheatsheet-golang-postgres/db/sqlc"
-	"github.com/dpsigor/cheatsheet-golang-postgres/util"
+	"github.com/dpsigor/cheatsheet-golang-postgres/token"
+	"github.com/dpsigor/cheatsheet-golang-postgres/val"
 	"github.com/gin-gonic/gin"
-	"github.com/lib/pq"
 )
 
 type createUserReq struct {
-	Username string `json:"username" binding:"required,alphanum"`
-	Password string `json:"password" binding:"required,min=6"`
+	Username string `json:"username" binding:"required,username"`
+	Password string `json:"password" binding:"required"`
 	FullName string `json:"full_name" binding:"required"`
 	Email    string `json:"email" binding:"required,email"`
+
+	policy val.PasswordPolicy
+}
+
+func (req createUserReq) newPassword() (string, string, val.PasswordPolicy, val.PasswordUser) {
+	return "password", req.Password, req.policy, val.PasswordUser{Username: req.Username, Email: req.Email}
 }
 
 type userRes struct {
 	Username          string    `json:"username"`
 	FullName          string    `json:"full_name"`
 	Email             string    `json:"email"`
+	IsEmailVerified   bool      `json:"is_email_verified"`
 	PasswordChangedAt time.Time `json:"password_changed_at"`
 	CreatedAt         time.Time `json:"created_at"`
 }
@@ -32,21 +41,22 @@ func newUserResponse(user db.User) userRes {
 		Username:          user.Username,
 		FullName:          user.FullName,
 		Email:             user.Email,
+		IsEmailVerified:   user.IsEmailVerified,
 		PasswordChangedAt: user.PasswordChangedAt,
 		CreatedAt:         user.CreatedAt,
 	}
 }
 
 func (server *Server) createUser(ctx *gin.Context) {
-	var req createUserReq
+	req := createUserReq{policy: server.passwordPolicy}
 	if err := ctx.ShouldBindJSON(&req); err != nil {
-		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		abortWithError(ctx, invalidRequest(err))
 		return
 	}
 
-	hashedPw, err := util.HashPassword(req.Password)
+	hashedPw, err := server.authenticator.HashPassword(req.Password)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		abortWithError(ctx, err)
 		return
 	}
 
@@ -59,70 +69,190 @@ func (server *Server) createUser(ctx *gin.Context) {
 
 	user, err := server.store.CreateUser(ctx, arg)
 	if err != nil {
-		if pgErr, ok := err.(*pq.Error); ok {
-			fmt.Printf("pgErr.Constraint = %+v\n", pgErr.Constraint)
-			switch pgErr.Code.Name() {
-			case "unique_violation":
-				switch pgErr.Constraint {
-				case "users_email_key":
-					ctx.JSON(http.StatusForbidden, errorResponse(fmt.Errorf("email '%s' already exists", req.Email)))
-					return
-				case "users_pkey":
-					ctx.JSON(http.StatusForbidden, errorResponse(fmt.Errorf("username '%s' already exists", req.Username)))
-					return
-				}
-			}
+		switch {
+		case errors.Is(err, db.ErrDuplicateEmail):
+			abortWithError(ctx, newError(http.StatusConflict, CodeEmailTaken, "email '%s' already exists", req.Email))
+			return
+		case errors.Is(err, db.ErrDuplicateUsername):
+			abortWithError(ctx, newError(http.StatusConflict, CodeUsernameTaken, "username '%s' already exists", req.Username))
+			return
 		}
-		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		abortWithError(ctx, err)
 		return
 	}
+	// the user is created even if the email cannot be sent, and asks for
+	// another one with POST /users/verify_email
+	if _, err := server.queueVerificationEmail(ctx, user); err != nil {
+		ctx.Error(fmt.Errorf("cannot send verification email: %w", err))
+	}
 
 	rsp := newUserResponse(user)
 	ctx.JSON(http.StatusOK, rsp)
 }
 
+// getUser returns the profile of the authenticated user
+func (server *Server) getUser(ctx *gin.Context) {
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	user, err := server.store.GetUser(ctx, authPayload.Username)
+	if err != nil {
+		abortWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, newUserResponse(user))
+}
+
+type updateUserReq struct {
+	FullName *string `json:"full_name" binding:"omitempty,min=1"`
+	Email    *string `json:"email" binding:"omitempty,email"`
+	// CurrentPassword is required to change the email, which password
+	// resets are sent to
+	CurrentPassword string `json:"current_password"`
+}
+
+// updateUser updates the fields given of the profile of the authenticated
+// user. A new email is no longer verified, so a verification link is sent
+// to it.
+func (server *Server) updateUser(ctx *gin.Context) {
+	var req updateUserReq
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		abortWithError(ctx, invalidRequest(err))
+		return
+	}
+	if req.FullName == nil && req.Email == nil {
+		abortWithError(ctx, newError(http.StatusBadRequest, CodeInvalidRequest, "full_name or email is required"))
+		return
+	}
+	if req.Email != nil && req.CurrentPassword == "" {
+		abortWithError(ctx, newError(http.StatusBadRequest, CodeInvalidRequest, "current_password is required to change the email"))
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	if req.Email != nil {
+		if _, err := server.authenticator.CheckPassword(ctx, authPayload.Username, req.CurrentPassword); err != nil {
+			abortWithError(ctx, err)
+			return
+		}
+	}
+	arg := db.UpdateUserParams{Username: authPayload.Username}
+	if req.FullName != nil {
+		arg.FullName = sql.NullString{String: *req.FullName, Valid: true}
+	}
+	if req.Email != nil {
+		arg.Email = sql.NullString{String: *req.Email, Valid: true}
+	}
+
+	user, err := server.store.UpdateUser(ctx, arg)
+	if err != nil {
+		if errors.Is(err, db.ErrDuplicateEmail) {
+			abortWithError(ctx, newError(http.StatusConflict, CodeEmailTaken, "email '%s' already exists", *req.Email))
+			return
+		}
+		abortWithError(ctx, err)
+		return
+	}
+	if req.Email != nil && !user.IsEmailVerified {
+		if _, err := server.queueVerificationEmail(ctx, user); err != nil {
+			ctx.Error(fmt.Errorf("cannot send verification email: %w", err))
+		}
+	}
+
+	ctx.JSON(http.StatusOK, newUserResponse(user))
+}
+
 type loginUserReq struct {
-	Username string `json:"username" binding:"required,alphanum"`
-	Password string `json:"password" binding:"required,min=6"`
+	Username string `json:"username" binding:"required,username"`
+	Password string `json:"password" binding:"required,password"`
+	// Scopes restrict the access token, which has all the permissions of the
+	// user without them
+	Scopes []string `json:"scopes" binding:"omitempty,dive,scope"`
 }
 
 type loginUserRes struct {
-	AccessToken string  `json:"access_token"`
-	User        userRes `json:"user"`
+	AccessToken          string     `json:"access_token,omitempty"`
+	AccessTokenExpiresAt *time.Time `json:"access_token_expires_at,omitempty"`
+	Scopes               []string   `json:"scopes,omitempty"`
+	User                 *userRes   `json:"user,omitempty"`
+	// TOTPChallenge is answered instead of an access token to the users
+	// with two-factor authentication enabled
+	TOTPChallenge *totpChallengeRes `json:"totp_challenge,omitempty"`
 }
 
 func (server *Server) loginUser(ctx *gin.Context) {
 	var req loginUserReq
 	if err := ctx.ShouldBindJSON(&req); err != nil {
-		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		abortWithError(ctx, invalidRequest(err))
 		return
 	}
 
-	user, err := server.store.GetUser(ctx, req.Username)
+	result, err := server.authenticator.Login(ctx, req.Username, req.Password, auth.Client{
+		IP:        ctx.ClientIP(),
+		UserAgent: ctx.Request.UserAgent(),
+	})
 	if err != nil {
-		if err == sql.ErrNoRows {
-			ctx.JSON(http.StatusNotFound, errorResponse(err))
-			return
-		}
-		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		abortWithError(ctx, err)
+		return
+	}
+	if result.Challenge != nil {
+		ctx.JSON(http.StatusOK, loginUserRes{TOTPChallenge: &totpChallengeRes{
+			ID:        result.Challenge.ID,
+			ExpiresAt: result.Challenge.ExpiresAt,
+		}})
 		return
 	}
 
-	err = util.CheckPassword(req.Password, user.HashedPassword)
+	rsp, err := server.newLoginResponse(result.User, req.Scopes)
 	if err != nil {
-		ctx.JSON(http.StatusUnauthorized, errorResponse(err))
+		abortWithError(ctx, err)
 		return
 	}
+	ctx.JSON(http.StatusOK, rsp)
+}
 
-	accessToken, err := server.tokenMaker.CreateToken(user.Username, server.config.AccessTokenDuration)
+// newLoginResponse creates an access token for the user, restricted to the
+// scopes, if any
+func (server *Server) newLoginResponse(user db.User, scopes []string) (loginUserRes, error) {
+	// taken before the token is created, so it never exceeds its expiry
+	expiresAt := time.Now().Add(server.config.AccessTokenDuration)
+	accessToken, err := server.tokenMaker.CreateToken(user.Username, scopes, server.config.AccessTokenDuration)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return loginUserRes{}, err
+	}
+
+	userRsp := newUserResponse(user)
+	return loginUserRes{
+		AccessToken:          accessToken,
+		AccessTokenExpiresAt: &expiresAt,
+		Scopes:               scopes,
+		User:                 &userRsp,
+	}, nil
+}
+
+type listLoginAttemptsReq struct {
+	PageID   int32 `form:"page_id" binding:"required,min=1"`
+	PageSize int32 `form:"page_size" binding:"required,min=5,max=10"`
+}
+
+// listLoginAttempts lists the logins of the authenticated user, most recent
+// first
+func (server *Server) listLoginAttempts(ctx *gin.Context) {
+	var req listLoginAttemptsReq
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		abortWithError(ctx, invalidRequest(err))
 		return
 	}
 
-	rsp := loginUserRes{
-		AccessToken: accessToken,
-		User:        newUserResponse(user),
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	attempts, err := server.store.ListLoginAttempts(ctx, db.ListLoginAttemptsParams{
+		Username: authPayload.Username,
+		Limit:    req.PageSize,
+		Offset:   (req.PageID - 1) * req.PageSize,
+	})
+	if err != nil {
+		abortWithError(ctx, err)
+		return
 	}
-	ctx.JSON(http.StatusOK, rsp)
+
+	ctx.JSON(http.StatusOK, attempts)
 }
@@ -8,10 +8,14 @@ import (
 	"net/http/httptest"
 	"reflect"
 	"testing"
+	"time"
 
+	memdb "github.com/dpsigor/cheatsheet-golang-postgres/db/memory"
 	mockdb "github.com/dpsigor/cheatsheet-golang-postgres/db/mock"
 	db "github.com/dpsigor/cheatsheet-golang-postgres/db/sqlc"
+	"github.com/dpsigor/cheatsheet-golang-postgres/password"
 	"github.com/dpsigor/cheatsheet-golang-postgres/util"
+	"github.com/dpsigor/cheatsheet-golang-postgres/val"
 	"github.com/gin-gonic/gin"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/require"
@@ -35,7 +39,7 @@ func (e eqCreateUserParamsMatcher) Matches(x interface{}) bool {
 	if !ok {
 		return false
 	}
-	err := util.CheckPassword(e.password, arg.HashedPassword)
+	err := testHasher.Check(e.password, arg.HashedPassword)
 	if err != nil {
 		return false
 	}
@@ -49,7 +53,7 @@ func (e eqCreateUserParamsMatcher) String() string {
 
 func TestCreateUser(t *testing.T) {
 	user, pw := randomUser(t)
-	hashedPw, err := util.HashPassword(pw)
+	hashedPw, err := testHasher.Hash(pw)
 	require.NoError(t, err)
 
 	tests := []struct {
@@ -77,6 +81,10 @@ func TestCreateUser(t *testing.T) {
 					CreateUser(gomock.Any(), eqCreateUserParamsMatcher{arg: arg, password: pw}).
 					Times(1).
 					Return(user, nil)
+				store.EXPECT().
+					CreateVerifyEmail(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.VerifyEmail{Username: user.Username, Email: user.Email}, nil)
 			},
 			checkRes: func(t *testing.T, recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusOK, recorder.Code)
@@ -86,6 +94,25 @@ func TestCreateUser(t *testing.T) {
 				require.Equal(t, user, gotUser)
 			},
 		},
+		{
+			name: "DuplicateEmail",
+			body: gin.H{
+				"username":  user.Username,
+				"password":  pw,
+				"full_name": user.FullName,
+				"email":     user.Email,
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					CreateUser(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.User{}, db.ErrDuplicateEmail)
+			},
+			checkRes: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusConflict, recorder.Code)
+				requireBodyMatchErrorCode(t, recorder.Body, CodeEmailTaken)
+			},
+		},
 	}
 	for _, tc := range tests {
 		tc := tc
@@ -108,3 +135,191 @@ func TestCreateUser(t *testing.T) {
 		})
 	}
 }
+
+func TestLoginUserLockout(t *testing.T) {
+	store := memdb.NewStore()
+	server := newTestServerWithConfig(t, store, func(config *util.Config) {
+		config.LoginMaxFailedAttempts = 2
+		config.LoginLockoutDuration = time.Minute
+	})
+	alice := signUp(t, server)
+	username := alice.username
+	anonymous := &apiClient{t: t, server: server}
+
+	// unknown users and wrong passwords get the same answer
+	var bodies []string
+	for _, req := range []gin.H{
+		{"username": "unknown" + util.RandomString(6), "password": alice.password},
+		{"username": username, "password": "wrong-password"},
+		{"username": username, "password": "wrong-password"},
+		// locked out
+		{"username": username, "password": alice.password},
+	} {
+		recorder := anonymous.do(http.MethodPost, "/users/login", req, http.Header{"User-Agent": {"api-test"}})
+		require.Equal(t, http.StatusUnauthorized, recorder.Code)
+		rsp := decode[Error](t, recorder)
+		require.Equal(t, CodeInvalidCredentials, rsp.Code)
+		bodies = append(bodies, rsp.Message)
+	}
+	for _, body := range bodies {
+		require.Equal(t, bodies[0], body)
+	}
+
+	recorder := alice.do(http.MethodGet, "/users/login_attempts?page_id=1&page_size=5", nil, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	attempts := decode[[]db.LoginAttempt](t, recorder)
+	require.Len(t, attempts, 4)
+	for _, attempt := range attempts[:3] {
+		require.False(t, attempt.Success)
+		require.Equal(t, "api-test", attempt.UserAgent)
+	}
+	// the login of signUp
+	require.True(t, attempts[3].Success)
+
+	recorder = alice.do(http.MethodGet, "/users/login_attempts?page_id=0&page_size=5", nil, nil)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	recorder = anonymous.do(http.MethodGet, "/users/login_attempts?page_id=1&page_size=5", nil, nil)
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+}
+
+func TestUpdateUserAPI(t *testing.T) {
+	server := newTestServer(t, memdb.NewStore())
+	alice := signUp(t, server)
+	bob := signUp(t, server)
+
+	recorder := alice.do(http.MethodGet, "/users/me", nil, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	user := decode[userRes](t, recorder)
+	require.Equal(t, alice.username, user.Username)
+	require.True(t, user.IsEmailVerified)
+	recorder = bob.do(http.MethodGet, "/users/me", nil, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	bobEmail := decode[userRes](t, recorder).Email
+
+	for _, body := range []gin.H{
+		{},
+		{"full_name": ""},
+		{"email": "not an email", "current_password": alice.password},
+		// the email, which password resets are sent to, is only changed
+		// with the password
+		{"email": util.RandomEmail()},
+	} {
+		recorder = alice.do(http.MethodPatch, "/users/me", body, nil)
+		require.Equal(t, http.StatusBadRequest, recorder.Code)
+		requireBodyMatchErrorCode(t, recorder.Body, CodeInvalidRequest)
+	}
+	recorder = alice.do(http.MethodPatch, "/users/me", gin.H{"email": util.RandomEmail(), "current_password": "wrong-password"}, nil)
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+	requireBodyMatchErrorCode(t, recorder.Body, CodeInvalidCredentials)
+	recorder = alice.do(http.MethodPatch, "/users/me", gin.H{"email": bobEmail, "current_password": alice.password}, nil)
+	require.Equal(t, http.StatusConflict, recorder.Code)
+	requireBodyMatchErrorCode(t, recorder.Body, CodeEmailTaken)
+
+	// changing the full name keeps the email verified
+	sent := sentMessages(server)
+	fullName := util.RandomOwner()
+	recorder = alice.do(http.MethodPatch, "/users/me", gin.H{"full_name": fullName}, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	updated := decode[userRes](t, recorder)
+	require.Equal(t, fullName, updated.FullName)
+	require.Equal(t, user.Email, updated.Email)
+	require.True(t, updated.IsEmailVerified)
+	require.Equal(t, sent, sentMessages(server))
+
+	// a new email has to be verified before creating accounts
+	email := util.RandomEmail()
+	recorder = alice.do(http.MethodPatch, "/users/me", gin.H{"email": email, "current_password": alice.password}, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	updated = decode[userRes](t, recorder)
+	require.Equal(t, email, updated.Email)
+	require.Equal(t, fullName, updated.FullName)
+	require.False(t, updated.IsEmailVerified)
+	require.Equal(t, sent+1, sentMessages(server))
+	msg, verificationToken := lastMessage(t, server)
+	require.Equal(t, email, msg.To)
+
+	recorder = alice.do(http.MethodPost, "/accounts", gin.H{"owner": alice.username, "currency": util.USD}, nil)
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+	requireBodyMatchErrorCode(t, recorder.Body, CodeEmailNotVerified)
+	recorder = alice.do(http.MethodGet, "/users/verify_email?token="+verificationToken, nil, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	recorder = alice.do(http.MethodPost, "/accounts", gin.H{"owner": alice.username, "currency": util.USD}, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	anonymous := &apiClient{t: t, server: server}
+	recorder = anonymous.do(http.MethodGet, "/users/me", nil, nil)
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+}
+
+func TestCreateUserPasswordTooLong(t *testing.T) {
+	server := newTestServerWithConfig(t, memdb.NewStore(), func(config *util.Config) {
+		config.PasswordHashAlgorithm = password.Bcrypt
+	})
+	c := &apiClient{t: t, server: server}
+
+	// bcrypt would ignore the bytes past the 72nd
+	recorder := c.do(http.MethodPost, "/users", gin.H{
+		"username":  util.RandomOwner() + util.RandomString(4),
+		"password":  util.RandomString(100),
+		"full_name": util.RandomOwner(),
+		"email":     util.RandomEmail(),
+	}, nil)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	requireBodyMatchErrorCode(t, recorder.Body, CodeInvalidRequest)
+}
+
+func TestCreateUserPasswordPolicy(t *testing.T) {
+	server := newTestServerWithConfig(t, memdb.NewStore(), func(config *util.Config) {
+		config.PasswordMinLength = 10
+		config.PasswordMinCharacterClasses = 3
+	})
+	c := &apiClient{t: t, server: server}
+	username := util.RandomOwner() + util.RandomString(4)
+	signUp := func(password string) *httptest.ResponseRecorder {
+		return c.do(http.MethodPost, "/users", gin.H{
+			"username":  username,
+			"password":  password,
+			"full_name": util.RandomOwner(),
+			"email":     "jdoe1984@example.com",
+		}, nil)
+	}
+
+	recorder := signUp("qwerty")
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	apiErr := requireBodyMatchErrorCode(t, recorder.Body, CodeInvalidRequest)
+	require.Equal(t, []FieldError{
+		{Field: "password", Rule: val.PasswordLengthRule, Message: "must contain at least 10 characters"},
+		{Field: "password", Rule: val.PasswordCharacterClassesRule, Message: "must mix at least 3 of lowercase letters, uppercase letters, digits and symbols"},
+		{Field: "password", Rule: val.PasswordCommonRule, Message: "is too common, having been found in data breaches"},
+	}, apiErr.Details)
+
+	recorder = signUp("My-" + username + "-Jdoe1984")
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	apiErr = requireBodyMatchErrorCode(t, recorder.Body, CodeInvalidRequest)
+	require.Equal(t, []FieldError{
+		{Field: "password", Rule: val.PasswordUserInputRule, Message: "must not contain the username"},
+		{Field: "password", Rule: val.PasswordUserInputRule, Message: "must not contain the email"},
+	}, apiErr.Details)
+
+	recorder = signUp("Correct-Horse-Battery-" + util.RandomString(120))
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	apiErr = requireBodyMatchErrorCode(t, recorder.Body, CodeInvalidRequest)
+	require.Equal(t, []FieldError{
+		{Field: "password", Rule: val.PasswordMaxLengthRule, Message: "must contain at most 128 bytes"},
+	}, apiErr.Details)
+
+	password := "Correct-Horse-Battery-9"
+	recorder = signUp(password)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	// changed passwords follow the policy too
+	recorder = c.do(http.MethodPost, "/users/login", gin.H{"username": username, "password": password}, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	c.accessToken = decode[loginUserRes](t, recorder).AccessToken
+	recorder = c.do(http.MethodPut, "/users/me/password", gin.H{"current_password": password, "new_password": "New-" + username + "-1"}, nil)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	apiErr = requireBodyMatchErrorCode(t, recorder.Body, CodeInvalidRequest)
+	require.Equal(t, []FieldError{
+		{Field: "new_password", Rule: val.PasswordUserInputRule, Message: "must not contain the username"},
+	}, apiErr.Details)
+}
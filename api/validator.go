@@ -1,13 +1,82 @@
 package api
 
 import (
-	"github.com/dpsigor/cheatsheet-golang-postgres/util"
+	"github.com/dpsigor/cheatsheet-golang-postgres/val"
 	"github.com/go-playground/validator/v10"
 )
 
 var validCurrency validator.Func = func(fl validator.FieldLevel) bool {
 	if currency, ok := fl.Field().Interface().(string); ok {
-		return util.IsSupportedCurrency(currency)
+		return val.ValidateCurrency(currency) == nil
 	}
 	return false
 }
+
+var validUsername validator.Func = func(fl validator.FieldLevel) bool {
+	if username, ok := fl.Field().Interface().(string); ok {
+		return val.ValidateUsername(username) == nil
+	}
+	return false
+}
+
+var validPassword validator.Func = func(fl validator.FieldLevel) bool {
+	if password, ok := fl.Field().Interface().(string); ok {
+		return val.ValidatePassword(password) == nil
+	}
+	return false
+}
+
+var validScope validator.Func = func(fl validator.FieldLevel) bool {
+	if scope, ok := fl.Field().Interface().(string); ok {
+		return val.ValidateScope(scope) == nil
+	}
+	return false
+}
+
+var validOAuthScope validator.Func = func(fl validator.FieldLevel) bool {
+	if scope, ok := fl.Field().Interface().(string); ok {
+		return val.ValidateOAuthScope(scope) == nil
+	}
+	return false
+}
+
+var validRedirectURI validator.Func = func(fl validator.FieldLevel) bool {
+	if uri, ok := fl.Field().Interface().(string); ok {
+		return val.ValidateRedirectURI(uri) == nil
+	}
+	return false
+}
+
+var validTOTPCode validator.Func = func(fl validator.FieldLevel) bool {
+	if code, ok := fl.Field().Interface().(string); ok {
+		return val.ValidateTOTPCode(code) == nil
+	}
+	return false
+}
+
+// newPasswordReq is a request choosing a password. The handler sets the
+// policy of the server, and what it knows of the user, on the request before
+// binding it, since gin shares its validator between servers.
+type newPasswordReq interface {
+	// newPassword returns the name of the field of the password, the
+	// password, the policy it must follow and the user choosing it
+	newPassword() (field, password string, policy val.PasswordPolicy, user val.PasswordUser)
+}
+
+// validPasswordPolicy reports an error, tagged with the rule, for every rule
+// of the password policy the password of a newPasswordReq breaks, so that the
+// client learns all of them at once
+var validPasswordPolicy validator.StructLevelFunc = func(sl validator.StructLevel) {
+	req, ok := sl.Current().Interface().(newPasswordReq)
+	if !ok {
+		return
+	}
+	field, password, policy, user := req.newPassword()
+	// a missing password is reported by the required rule
+	if password == "" {
+		return
+	}
+	for _, violation := range policy.Check(password, user) {
+		sl.ReportError(password, field, field, violation.Rule, violation.Param)
+	}
+}
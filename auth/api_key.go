@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	db "github.com/dpsigor/cheatsheet-golang-postgres/db/sqlc"
+	"github.com/dpsigor/cheatsheet-golang-postgres/token"
+)
+
+// ErrInvalidAPIKey is returned for malformed, unknown, revoked and expired
+// API keys alike
+var ErrInvalidAPIKey = errors.New("invalid, revoked or expired API key")
+
+const (
+	// apiKeyTag starts every API key, so that leaked keys are easy to find
+	apiKeyTag = "sb_"
+	// apiKeyPrefixSize is the number of random bytes of the public prefix
+	// identifying a key
+	apiKeyPrefixSize = 6
+	// apiKeyTouchInterval is how often last_used_at is updated, so that a
+	// busy key does not write on every request
+	apiKeyTouchInterval = time.Minute
+)
+
+// NewAPIKey is an API key just created. Key is only known now: the database
+// keeps the hash of its secret.
+type NewAPIKey struct {
+	APIKey db.APIKey
+	Key    string
+}
+
+// CreateAPIKeyParams are the settings of a new API key. A zero ExpiresAt
+// never expires, and empty Scopes grant all the permissions of the user.
+type CreateAPIKeyParams struct {
+	Username  string
+	Name      string
+	Scopes    []string
+	ExpiresAt time.Time
+}
+
+// CreateAPIKey creates an API key for the user, of the form
+// sb_<prefix>_<secret>
+func (a *Authenticator) CreateAPIKey(ctx context.Context, arg CreateAPIKeyParams) (NewAPIKey, error) {
+	b := make([]byte, apiKeyPrefixSize)
+	if _, err := rand.Read(b); err != nil {
+		return NewAPIKey{}, fmt.Errorf("cannot generate API key prefix: %w", err)
+	}
+	prefix := hex.EncodeToString(b)
+	secret, err := newSecretToken()
+	if err != nil {
+		return NewAPIKey{}, fmt.Errorf("cannot generate API key secret: %w", err)
+	}
+
+	apiKey, err := a.store.CreateAPIKey(ctx, db.CreateAPIKeyParams{
+		Username:     arg.Username,
+		Name:         arg.Name,
+		Prefix:       prefix,
+		HashedSecret: hashSecretToken(secret),
+		Scopes:       arg.Scopes,
+		ExpiresAt:    arg.ExpiresAt,
+	})
+	if err != nil {
+		return NewAPIKey{}, fmt.Errorf("cannot create API key: %w", err)
+	}
+	return NewAPIKey{APIKey: apiKey, Key: apiKeyTag + prefix + "_" + secret}, nil
+}
+
+// CheckAPIKey returns the principal of an API key, with the scopes of the
+// key. Unlike access tokens, API keys are not revoked by a password change:
+// they are revoked by deleting them.
+func (a *Authenticator) CheckAPIKey(ctx context.Context, key string) (*token.Payload, error) {
+	prefix, secret, ok := strings.Cut(strings.TrimPrefix(key, apiKeyTag), "_")
+	if !ok || !strings.HasPrefix(key, apiKeyTag) {
+		return nil, ErrInvalidAPIKey
+	}
+	apiKey, err := a.store.GetAPIKeyByPrefix(ctx, prefix)
+	if errors.Is(err, db.ErrRecordNotFound) {
+		return nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot get API key: %w", err)
+	}
+	if subtle.ConstantTimeCompare([]byte(hashSecretToken(secret)), []byte(apiKey.HashedSecret)) != 1 {
+		return nil, ErrInvalidAPIKey
+	}
+	now := a.now()
+	if !apiKey.ExpiresAt.IsZero() && !apiKey.ExpiresAt.After(now) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	if now.Sub(apiKey.LastUsedAt) >= apiKeyTouchInterval {
+		if err := a.store.TouchAPIKey(ctx, db.TouchAPIKeyParams{ID: apiKey.ID, LastUsedAt: now}); err != nil {
+			return nil, fmt.Errorf("cannot update API key: %w", err)
+		}
+	}
+	return &token.Payload{
+		Username:  apiKey.Username,
+		Scopes:    apiKey.Scopes,
+		IssuedAt:  apiKey.CreatedAt,
+		ExpiresAt: apiKey.ExpiresAt,
+	}, nil
+}
@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	memdb "github.com/dpsigor/cheatsheet-golang-postgres/db/memory"
+	"github.com/dpsigor/cheatsheet-golang-postgres/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckAPIKey(t *testing.T) {
+	store := memdb.NewStore()
+	a := NewAuthenticator(store, LockoutPolicy{}, testHasher)
+	user, _ := createUser(t, store)
+	ctx := context.Background()
+
+	created, err := a.CreateAPIKey(ctx, CreateAPIKeyParams{
+		Username: user.Username,
+		Name:     "batch",
+		Scopes:   []string{util.AccountsReadScope},
+	})
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(created.Key, apiKeyTag+created.APIKey.Prefix+"_"))
+
+	payload, err := a.CheckAPIKey(ctx, created.Key)
+	require.NoError(t, err)
+	require.Equal(t, user.Username, payload.Username)
+	require.Equal(t, []string{util.AccountsReadScope}, payload.Scopes)
+
+	// the first use is recorded, and the next ones once a minute
+	apiKey, err := store.GetAPIKeyByPrefix(ctx, created.APIKey.Prefix)
+	require.NoError(t, err)
+	require.WithinDuration(t, time.Now(), apiKey.LastUsedAt, time.Second)
+	lastUsedAt := apiKey.LastUsedAt
+	_, err = a.CheckAPIKey(ctx, created.Key)
+	require.NoError(t, err)
+	apiKey, err = store.GetAPIKeyByPrefix(ctx, created.APIKey.Prefix)
+	require.NoError(t, err)
+	require.Equal(t, lastUsedAt, apiKey.LastUsedAt)
+
+	for _, key := range []string{
+		"",
+		created.APIKey.Prefix,
+		strings.TrimPrefix(created.Key, apiKeyTag),
+		created.Key + "x",
+		apiKeyTag + "missing_" + util.RandomString(43),
+	} {
+		_, err = a.CheckAPIKey(ctx, key)
+		require.ErrorIs(t, err, ErrInvalidAPIKey, key)
+	}
+}
+
+func TestCheckAPIKeyExpired(t *testing.T) {
+	store := memdb.NewStore()
+	a := NewAuthenticator(store, LockoutPolicy{}, testHasher)
+	user, _ := createUser(t, store)
+	ctx := context.Background()
+
+	created, err := a.CreateAPIKey(ctx, CreateAPIKeyParams{
+		Username:  user.Username,
+		Name:      "batch",
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+	payload, err := a.CheckAPIKey(ctx, created.Key)
+	require.NoError(t, err)
+	require.Empty(t, payload.Scopes)
+
+	a.now = func() time.Time { return time.Now().Add(time.Hour) }
+	_, err = a.CheckAPIKey(ctx, created.Key)
+	require.ErrorIs(t, err, ErrInvalidAPIKey)
+}
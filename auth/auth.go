@@ -0,0 +1,232 @@
+// Package auth checks the credentials of users. It is shared by the HTTP and
+// gRPC servers, so that both lock out users and audit logins the same way.
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	db "github.com/dpsigor/cheatsheet-golang-postgres/db/sqlc"
+	"github.com/dpsigor/cheatsheet-golang-postgres/password"
+	"github.com/dpsigor/cheatsheet-golang-postgres/util"
+)
+
+// ErrInvalidCredentials is returned for every failed login, whether the user
+// does not exist, the password is wrong or the user is locked out, so that
+// the response does not tell which usernames exist
+var ErrInvalidCredentials = errors.New("invalid username or password")
+
+// LockoutPolicy locks a user out for Duration once MaxAttempts logins failed
+// in a row. Every further failure doubles the duration, up to MaxDuration, or
+// not at all if MaxDuration is not longer than Duration.
+type LockoutPolicy struct {
+	MaxAttempts int
+	Duration    time.Duration
+	MaxDuration time.Duration
+}
+
+// Enabled reports whether the policy locks users out
+func (p LockoutPolicy) Enabled() bool {
+	return p.MaxAttempts > 0 && p.Duration > 0
+}
+
+// maxDuration is the longest a user is locked out for
+func (p LockoutPolicy) maxDuration() time.Duration {
+	if p.MaxDuration < p.Duration {
+		return p.Duration
+	}
+	return p.MaxDuration
+}
+
+// Client describes where a login comes from, for the audit log
+type Client struct {
+	IP        string
+	UserAgent string
+}
+
+// maxUserAgentLength bounds the user agents stored in the audit log
+const maxUserAgentLength = 512
+
+// sanitize makes the values sent by the client fit a varchar column, which
+// rejects NUL bytes and invalid UTF-8
+func sanitize(s string, maxLength int) string {
+	if len(s) > maxLength {
+		s = s[:maxLength]
+	}
+	return strings.ToValidUTF8(strings.ReplaceAll(s, "\x00", ""), "")
+}
+
+// Authenticator logs users in
+type Authenticator struct {
+	store   db.Store
+	lockout LockoutPolicy
+	hasher  password.Hasher
+	now     func() time.Time
+
+	dummyHashOnce sync.Once
+	dummyHash     string
+}
+
+// LockoutPolicyFromConfig returns the lockout policy set by the
+// LOGIN_MAX_FAILED_ATTEMPTS, LOGIN_LOCKOUT_DURATION and
+// LOGIN_MAX_LOCKOUT_DURATION settings
+func LockoutPolicyFromConfig(config util.Config) LockoutPolicy {
+	return LockoutPolicy{
+		MaxAttempts: config.LoginMaxFailedAttempts,
+		Duration:    config.LoginLockoutDuration,
+		MaxDuration: config.LoginMaxLockoutDuration,
+	}
+}
+
+// NewAuthenticator creates an Authenticator locking users out with lockout,
+// and checking the passwords with hasher
+func NewAuthenticator(store db.Store, lockout LockoutPolicy, hasher password.Hasher) *Authenticator {
+	return &Authenticator{store: store, lockout: lockout, hasher: hasher, now: time.Now}
+}
+
+// HashPassword hashes a new password of a user
+func (a *Authenticator) HashPassword(password string) (string, error) {
+	return a.hasher.Hash(password)
+}
+
+// checkDummyPassword takes as long as checking a real password, so that
+// logins of unknown users cannot be told apart by their latency
+func (a *Authenticator) checkDummyPassword(password string) {
+	a.dummyHashOnce.Do(func() {
+		a.dummyHash, _ = a.hasher.Hash(util.RandomString(16))
+	})
+	a.hasher.Check(password, a.dummyHash)
+}
+
+// LoginResult is the outcome of a successful password check
+type LoginResult struct {
+	User db.User
+	// Challenge is set instead of User when the user has TOTP enabled. The
+	// login is then completed by LoginTOTP, with a code of the user.
+	Challenge *db.LoginChallenge
+}
+
+// Login checks the password of the user and records the attempt. The
+// password of a locked out user is not accepted, even if right.
+func (a *Authenticator) Login(ctx context.Context, username, password string, client Client) (LoginResult, error) {
+	user, err := a.store.GetUser(ctx, username)
+	if errors.Is(err, db.ErrRecordNotFound) {
+		a.checkDummyPassword(password)
+		return LoginResult{}, ErrInvalidCredentials
+	}
+	if err != nil {
+		return LoginResult{}, err
+	}
+
+	locked := user.LockedUntil.After(a.now())
+	if err := a.hasher.Check(password, user.HashedPassword); err != nil || locked {
+		return LoginResult{}, a.loginFailed(ctx, user, locked, client)
+	}
+	if user, err = a.rehashPassword(ctx, user, password); err != nil {
+		return LoginResult{}, err
+	}
+
+	// the failures are only reset, and the login recorded, once the second
+	// factor is checked too
+	if user.TotpEnabled {
+		challenge, err := a.newLoginChallenge(ctx, user.Username)
+		if err != nil {
+			return LoginResult{}, err
+		}
+		return LoginResult{Challenge: &challenge}, nil
+	}
+
+	user, err = a.loginSucceeded(ctx, user, client)
+	if err != nil {
+		return LoginResult{}, err
+	}
+	return LoginResult{User: user}, nil
+}
+
+// rehashPassword replaces the hash of the password of the user once checked,
+// if it was created by another algorithm or with outdated parameters
+func (a *Authenticator) rehashPassword(ctx context.Context, user db.User, password string) (db.User, error) {
+	if !a.hasher.NeedsRehash(user.HashedPassword) {
+		return user, nil
+	}
+	hashedPassword, err := a.hasher.Hash(password)
+	if err != nil {
+		return db.User{}, err
+	}
+	err = a.store.RehashUserPassword(ctx, db.RehashUserPasswordParams{
+		Username:          user.Username,
+		HashedPassword:    hashedPassword,
+		OldHashedPassword: user.HashedPassword,
+	})
+	if err != nil {
+		return db.User{}, fmt.Errorf("cannot rehash password: %w", err)
+	}
+	user.HashedPassword = hashedPassword
+	return user, nil
+}
+
+// loginFailed counts a failed login of the user, records the attempt and
+// returns ErrInvalidCredentials
+func (a *Authenticator) loginFailed(ctx context.Context, user db.User, locked bool, client Client) error {
+	// the failures of a locked out user are not counted, or guessing would
+	// keep them locked out
+	if !locked {
+		if err := a.recordFailedLogin(ctx, user.Username); err != nil {
+			return err
+		}
+	}
+	if err := a.recordAttempt(ctx, user.Username, client, false); err != nil {
+		return err
+	}
+	return ErrInvalidCredentials
+}
+
+// loginSucceeded resets the failed logins of the user and records the
+// attempt
+func (a *Authenticator) loginSucceeded(ctx context.Context, user db.User, client Client) (db.User, error) {
+	if user.FailedLoginAttempts > 0 {
+		if err := a.store.ResetFailedLogins(ctx, user.Username); err != nil {
+			return db.User{}, fmt.Errorf("cannot reset failed logins: %w", err)
+		}
+		user.FailedLoginAttempts = 0
+	}
+	if err := a.recordAttempt(ctx, user.Username, client, true); err != nil {
+		return db.User{}, err
+	}
+	return user, nil
+}
+
+func (a *Authenticator) recordFailedLogin(ctx context.Context, username string) error {
+	if !a.lockout.Enabled() {
+		return nil
+	}
+	_, err := a.store.RecordFailedLogin(ctx, db.RecordFailedLoginParams{
+		Username:          username,
+		MaxAttempts:       int32(a.lockout.MaxAttempts),
+		LockoutSeconds:    a.lockout.Duration.Seconds(),
+		MaxLockoutSeconds: a.lockout.maxDuration().Seconds(),
+		// the lockout is checked against the same clock
+		Now: a.now(),
+	})
+	if err != nil {
+		return fmt.Errorf("cannot record failed login: %w", err)
+	}
+	return nil
+}
+
+func (a *Authenticator) recordAttempt(ctx context.Context, username string, client Client, success bool) error {
+	_, err := a.store.CreateLoginAttempt(ctx, db.CreateLoginAttemptParams{
+		Username:  username,
+		IpAddress: client.IP,
+		UserAgent: sanitize(client.UserAgent, maxUserAgentLength),
+		Success:   success,
+	})
+	if err != nil {
+		return fmt.Errorf("cannot record login attempt: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package auth
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	memdb "github.com/dpsigor/cheatsheet-golang-postgres/db/memory"
+	db "github.com/dpsigor/cheatsheet-golang-postgres/db/sqlc"
+	"github.com/dpsigor/cheatsheet-golang-postgres/password"
+	"github.com/dpsigor/cheatsheet-golang-postgres/util"
+	"github.com/stretchr/testify/require"
+)
+
+var testHasher = password.NewTestHasher()
+
+func createUser(t *testing.T, store db.Store) (db.User, string) {
+	password := util.RandomString(10)
+	hashedPassword, err := testHasher.Hash(password)
+	require.NoError(t, err)
+	user, err := store.CreateUser(context.Background(), db.CreateUserParams{
+		Username:       util.RandomOwner() + util.RandomString(6),
+		HashedPassword: hashedPassword,
+		FullName:       util.RandomOwner(),
+		Email:          util.RandomEmail(),
+	})
+	require.NoError(t, err)
+	return user, password
+}
+
+func listAttempts(t *testing.T, store db.Store, username string) []db.LoginAttempt {
+	attempts, err := store.ListLoginAttempts(context.Background(), db.ListLoginAttemptsParams{Username: username, Limit: 100})
+	require.NoError(t, err)
+	return attempts
+}
+
+func TestLogin(t *testing.T) {
+	store := memdb.NewStore()
+	a := NewAuthenticator(store, LockoutPolicy{MaxAttempts: 3, Duration: time.Minute, MaxDuration: 3 * time.Minute}, testHasher)
+	user, password := createUser(t, store)
+	client := Client{IP: "192.0.2.1", UserAgent: "test"}
+	ctx := context.Background()
+
+	got, err := a.Login(ctx, user.Username, password, client)
+	require.NoError(t, err)
+	require.Equal(t, user.Username, got.User.Username)
+	require.Nil(t, got.Challenge)
+
+	attempts := listAttempts(t, store, user.Username)
+	require.Len(t, attempts, 1)
+	require.True(t, attempts[0].Success)
+	require.Equal(t, client.IP, attempts[0].IpAddress)
+	require.Equal(t, client.UserAgent, attempts[0].UserAgent)
+
+	// unknown users and wrong passwords fail the same way
+	_, err = a.Login(ctx, "unknown"+util.RandomString(6), password, client)
+	require.ErrorIs(t, err, ErrInvalidCredentials)
+	_, err = a.Login(ctx, user.Username, "wrong-password", client)
+	require.ErrorIs(t, err, ErrInvalidCredentials)
+
+	attempts = listAttempts(t, store, user.Username)
+	require.Len(t, attempts, 2)
+	require.False(t, attempts[0].Success)
+}
+
+func TestLoginLockout(t *testing.T) {
+	store := memdb.NewStore()
+	policy := LockoutPolicy{MaxAttempts: 3, Duration: time.Minute, MaxDuration: 3 * time.Minute}
+	a := NewAuthenticator(store, policy, testHasher)
+	user, password := createUser(t, store)
+	ctx := context.Background()
+
+	for i := 0; i < policy.MaxAttempts; i++ {
+		_, err := a.Login(ctx, user.Username, "wrong-password", Client{})
+		require.ErrorIs(t, err, ErrInvalidCredentials)
+	}
+	user, err := store.GetUser(ctx, user.Username)
+	require.NoError(t, err)
+	require.Equal(t, int32(3), user.FailedLoginAttempts)
+	require.WithinDuration(t, time.Now().Add(policy.Duration), user.LockedUntil, time.Second)
+
+	// the right password is refused while locked out, and the failure is not
+	// counted
+	_, err = a.Login(ctx, user.Username, password, Client{})
+	require.ErrorIs(t, err, ErrInvalidCredentials)
+	got, err := store.GetUser(ctx, user.Username)
+	require.NoError(t, err)
+	require.Equal(t, user.FailedLoginAttempts, got.FailedLoginAttempts)
+	require.Equal(t, user.LockedUntil, got.LockedUntil)
+
+	// once the lockout is over, every failure doubles it, from the clock
+	// the lockout is checked with
+	now := user.LockedUntil.Add(time.Second)
+	a.now = func() time.Time { return now }
+	_, err = a.Login(ctx, user.Username, "wrong-password", Client{})
+	require.ErrorIs(t, err, ErrInvalidCredentials)
+	user, err = store.GetUser(ctx, user.Username)
+	require.NoError(t, err)
+	require.Equal(t, now.Add(2*policy.Duration), user.LockedUntil)
+
+	// up to MaxDuration
+	now = user.LockedUntil.Add(time.Second)
+	_, err = a.Login(ctx, user.Username, "wrong-password", Client{})
+	require.ErrorIs(t, err, ErrInvalidCredentials)
+	user, err = store.GetUser(ctx, user.Username)
+	require.NoError(t, err)
+	require.Equal(t, now.Add(policy.MaxDuration), user.LockedUntil)
+
+	// a successful login resets the count
+	now = user.LockedUntil.Add(time.Second)
+	_, err = a.Login(ctx, user.Username, password, Client{})
+	require.NoError(t, err)
+	user, err = store.GetUser(ctx, user.Username)
+	require.NoError(t, err)
+	require.Zero(t, user.FailedLoginAttempts)
+
+	attempts := listAttempts(t, store, user.Username)
+	require.Len(t, attempts, 7)
+	require.True(t, attempts[0].Success)
+}
+
+func TestLoginLockoutDisabled(t *testing.T) {
+	store := memdb.NewStore()
+	a := NewAuthenticator(store, LockoutPolicy{}, testHasher)
+	user, password := createUser(t, store)
+	ctx := context.Background()
+
+	for i := 0; i < 10; i++ {
+		_, err := a.Login(ctx, user.Username, "wrong-password", Client{})
+		require.ErrorIs(t, err, ErrInvalidCredentials)
+	}
+	_, err := a.Login(ctx, user.Username, password, Client{})
+	require.NoError(t, err)
+}
+
+func TestLockoutPolicyMaxDuration(t *testing.T) {
+	// a MaxDuration shorter than Duration does not shorten the lockout
+	store := memdb.NewStore()
+	a := NewAuthenticator(store, LockoutPolicy{MaxAttempts: 1, Duration: time.Minute}, testHasher)
+	user, _ := createUser(t, store)
+
+	_, err := a.Login(context.Background(), user.Username, "wrong-password", Client{})
+	require.ErrorIs(t, err, ErrInvalidCredentials)
+	user, err = store.GetUser(context.Background(), user.Username)
+	require.NoError(t, err)
+	require.WithinDuration(t, time.Now().Add(time.Minute), user.LockedUntil, time.Second)
+}
+
+func TestSanitize(t *testing.T) {
+	require.Equal(t, "curl/8.0", sanitize("curl/8.0", 10))
+	require.Equal(t, "ab", sanitize("a\x00b", 10))
+	require.Equal(t, "ab", sanitize("a\xffb", 10))
+	require.Equal(t, strings.Repeat("a", 10), sanitize(strings.Repeat("a", 20), 10))
+	// a multi-byte character cut in half is dropped
+	require.Equal(t, "aaaaaaaaa", sanitize("aaaaaaaaaé", 10))
+}
+
+func TestLoginRehash(t *testing.T) {
+	store := memdb.NewStore()
+	a := NewAuthenticator(store, LockoutPolicy{}, testHasher)
+	ctx := context.Background()
+	pw := util.RandomString(10)
+	legacyHash, err := password.NewBcryptHasher(0).Hash(pw)
+	require.NoError(t, err)
+	user, err := store.CreateUser(ctx, db.CreateUserParams{
+		Username:       util.RandomOwner() + util.RandomString(6),
+		HashedPassword: legacyHash,
+		FullName:       util.RandomOwner(),
+		Email:          util.RandomEmail(),
+	})
+	require.NoError(t, err)
+
+	// a wrong password does not replace the hash
+	_, err = a.Login(ctx, user.Username, "wrong-password", Client{})
+	require.ErrorIs(t, err, ErrInvalidCredentials)
+	got, err := store.GetUser(ctx, user.Username)
+	require.NoError(t, err)
+	require.Equal(t, legacyHash, got.HashedPassword)
+
+	result, err := a.Login(ctx, user.Username, pw, Client{})
+	require.NoError(t, err)
+	got, err = store.GetUser(ctx, user.Username)
+	require.NoError(t, err)
+	require.Equal(t, password.Argon2id, password.Algorithm(got.HashedPassword))
+	require.Equal(t, got.HashedPassword, result.User.HashedPassword)
+	require.False(t, testHasher.NeedsRehash(got.HashedPassword))
+	// the access tokens issued before stay valid
+	require.Equal(t, user.PasswordChangedAt, got.PasswordChangedAt)
+
+	_, err = a.Login(ctx, user.Username, pw, Client{})
+	require.NoError(t, err)
+	again, err := store.GetUser(ctx, user.Username)
+	require.NoError(t, err)
+	require.Equal(t, got.HashedPassword, again.HashedPassword)
+}
@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	db "github.com/dpsigor/cheatsheet-golang-postgres/db/sqlc"
+)
+
+// Errors of the email verification
+var (
+	ErrInvalidVerificationToken = errors.New("invalid or expired email verification token")
+	ErrEmailNotVerified         = errors.New("email is not verified")
+	ErrEmailAlreadyVerified     = errors.New("email is already verified")
+)
+
+// emailVerificationDuration is how long the user has to follow the
+// verification link sent to them
+const emailVerificationDuration = 24 * time.Hour
+
+// EmailVerification is a verification token of the email of a user, to be
+// sent to that email
+type EmailVerification struct {
+	User      db.User
+	Token     string
+	ExpiresAt time.Time
+}
+
+// CreateEmailVerification creates a token verifying the current email of the
+// user. The tokens created before stay valid until they expire.
+func (a *Authenticator) CreateEmailVerification(ctx context.Context, user db.User) (EmailVerification, error) {
+	if user.IsEmailVerified {
+		return EmailVerification{}, ErrEmailAlreadyVerified
+	}
+	verificationToken, err := newSecretToken()
+	if err != nil {
+		return EmailVerification{}, fmt.Errorf("cannot generate email verification token: %w", err)
+	}
+	stored, err := a.store.CreateVerifyEmail(ctx, db.CreateVerifyEmailParams{
+		Username:    user.Username,
+		Email:       user.Email,
+		HashedToken: hashSecretToken(verificationToken),
+		ExpiresAt:   a.now().Add(emailVerificationDuration),
+	})
+	if err != nil {
+		return EmailVerification{}, fmt.Errorf("cannot create email verification token: %w", err)
+	}
+	return EmailVerification{User: user, Token: verificationToken, ExpiresAt: stored.ExpiresAt}, nil
+}
+
+// VerifyEmail marks the email of the user of a verification token as
+// verified. A token is used once, and only verifies the email it was sent to.
+func (a *Authenticator) VerifyEmail(ctx context.Context, verificationToken string) (db.User, error) {
+	result, err := a.store.VerifyEmailTx(ctx, db.VerifyEmailTxParams{HashedToken: hashSecretToken(verificationToken)})
+	if errors.Is(err, db.ErrRecordNotFound) {
+		return db.User{}, ErrInvalidVerificationToken
+	}
+	if err != nil {
+		return db.User{}, err
+	}
+	return result.User, nil
+}
+
+// RequireVerifiedEmail returns ErrEmailNotVerified unless the user verified
+// their email
+func (a *Authenticator) RequireVerifiedEmail(ctx context.Context, username string) error {
+	verified, err := a.store.IsEmailVerified(ctx, username)
+	if err != nil {
+		return fmt.Errorf("cannot check email verification: %w", err)
+	}
+	if !verified {
+		return ErrEmailNotVerified
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	memdb "github.com/dpsigor/cheatsheet-golang-postgres/db/memory"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyEmail(t *testing.T) {
+	store := memdb.NewStore()
+	a := NewAuthenticator(store, LockoutPolicy{}, testHasher)
+	user, _ := createUser(t, store)
+	ctx := context.Background()
+
+	require.ErrorIs(t, a.RequireVerifiedEmail(ctx, user.Username), ErrEmailNotVerified)
+
+	// a link followed too late does not verify the email
+	a.now = func() time.Time { return time.Now().Add(-emailVerificationDuration) }
+	expired, err := a.CreateEmailVerification(ctx, user)
+	require.NoError(t, err)
+	_, err = a.VerifyEmail(ctx, expired.Token)
+	require.ErrorIs(t, err, ErrInvalidVerificationToken)
+	a.now = time.Now
+
+	verification, err := a.CreateEmailVerification(ctx, user)
+	require.NoError(t, err)
+	require.Equal(t, user.Username, verification.User.Username)
+	require.WithinDuration(t, time.Now().Add(emailVerificationDuration), verification.ExpiresAt, time.Second)
+
+	_, err = a.VerifyEmail(ctx, "wrong"+verification.Token)
+	require.ErrorIs(t, err, ErrInvalidVerificationToken)
+	verified, err := a.VerifyEmail(ctx, verification.Token)
+	require.NoError(t, err)
+	require.True(t, verified.IsEmailVerified)
+	require.NoError(t, a.RequireVerifiedEmail(ctx, user.Username))
+
+	// a token is used once
+	_, err = a.VerifyEmail(ctx, verification.Token)
+	require.ErrorIs(t, err, ErrInvalidVerificationToken)
+
+	_, err = a.CreateEmailVerification(ctx, verified)
+	require.ErrorIs(t, err, ErrEmailAlreadyVerified)
+}
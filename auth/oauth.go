@@ -0,0 +1,336 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	db "github.com/dpsigor/cheatsheet-golang-postgres/db/sqlc"
+)
+
+// Errors of the OAuth authorization server. The token endpoint reports
+// them with the error codes of RFC 6749.
+var (
+	ErrInvalidOAuthClient   = errors.New("unknown OAuth client or wrong client secret")
+	ErrInvalidRedirectURI   = errors.New("redirect URI is not registered for the OAuth client")
+	ErrInvalidOAuthScope    = errors.New("scope is not allowed for the OAuth client")
+	ErrInvalidCodeChallenge = errors.New("code challenge must be a PKCE S256 challenge")
+	ErrInvalidGrant         = errors.New("invalid, expired or revoked authorization code or refresh token")
+)
+
+// CodeChallengeMethodS256 is the only PKCE method accepted: the plain method
+// would send the verifier itself through the browser
+const CodeChallengeMethodS256 = "S256"
+
+const (
+	// oauthClientIDSize is the number of random bytes of a client ID
+	oauthClientIDSize = 16
+	// oauthCodeDuration is how long a client has to exchange an
+	// authorization code, as recommended by RFC 6749
+	oauthCodeDuration = 10 * time.Minute
+	// oauthRefreshTokenDuration is how long a refresh token is valid. Every
+	// refresh replaces it with a new one.
+	oauthRefreshTokenDuration = 30 * 24 * time.Hour
+)
+
+var (
+	// isValidCodeChallenge matches the base64url SHA-256 of a verifier
+	isValidCodeChallenge = regexp.MustCompile(`^[A-Za-z0-9_-]{43}$`).MatchString
+	// isValidCodeVerifier matches the verifiers of RFC 7636
+	isValidCodeVerifier = regexp.MustCompile(`^[A-Za-z0-9._~-]{43,128}$`).MatchString
+)
+
+// NewOAuthClient is an OAuth client just registered. Secret is only known
+// now: the database keeps its hash.
+type NewOAuthClient struct {
+	Client db.OAuthClient
+	Secret string
+}
+
+// RegisterOAuthClientParams are the settings of a new OAuth client. Scopes
+// are the ones the client may ask the users for.
+type RegisterOAuthClientParams struct {
+	Owner        string
+	Name         string
+	RedirectURIs []string
+	Scopes       []string
+}
+
+// RegisterOAuthClient registers a third-party application, which then asks
+// the users for their consent with the authorization code flow
+func (a *Authenticator) RegisterOAuthClient(ctx context.Context, arg RegisterOAuthClientParams) (NewOAuthClient, error) {
+	b := make([]byte, oauthClientIDSize)
+	if _, err := rand.Read(b); err != nil {
+		return NewOAuthClient{}, fmt.Errorf("cannot generate OAuth client ID: %w", err)
+	}
+	secret, err := newSecretToken()
+	if err != nil {
+		return NewOAuthClient{}, fmt.Errorf("cannot generate OAuth client secret: %w", err)
+	}
+
+	client, err := a.store.CreateOAuthClient(ctx, db.CreateOAuthClientParams{
+		ID:           hex.EncodeToString(b),
+		Owner:        arg.Owner,
+		Name:         arg.Name,
+		HashedSecret: hashSecretToken(secret),
+		RedirectURIs: arg.RedirectURIs,
+		Scopes:       arg.Scopes,
+	})
+	if err != nil {
+		return NewOAuthClient{}, fmt.Errorf("cannot create OAuth client: %w", err)
+	}
+	return NewOAuthClient{Client: client, Secret: secret}, nil
+}
+
+// OAuthAuthorizationRequest is the request of a client for the consent of a
+// user, as received by the authorization endpoint
+type OAuthAuthorizationRequest struct {
+	ClientID string
+	// RedirectURI may be empty when the client registered a single one
+	RedirectURI string
+	// Scope is a space-delimited list of scopes, all the scopes of the client
+	// if empty
+	Scope               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+// OAuthAuthorization is an authorization request found valid, to be shown to
+// the user for their consent
+type OAuthAuthorization struct {
+	Client      db.OAuthClient
+	RedirectURI string
+	// RedirectURIGiven is whether the request had the redirect URI, which the
+	// token request must then repeat
+	RedirectURIGiven bool
+	Scopes           []string
+	CodeChallenge    string
+}
+
+// CheckOAuthAuthorization checks an authorization request. Until it
+// succeeds, the redirect URI is not known to belong to the client, so errors
+// must be shown to the user rather than sent to the redirect URI.
+func (a *Authenticator) CheckOAuthAuthorization(ctx context.Context, req OAuthAuthorizationRequest) (OAuthAuthorization, error) {
+	client, err := a.store.GetOAuthClient(ctx, req.ClientID)
+	if errors.Is(err, db.ErrRecordNotFound) {
+		return OAuthAuthorization{}, ErrInvalidOAuthClient
+	}
+	if err != nil {
+		return OAuthAuthorization{}, fmt.Errorf("cannot get OAuth client: %w", err)
+	}
+
+	redirectURI := req.RedirectURI
+	if redirectURI == "" && len(client.RedirectURIs) == 1 {
+		redirectURI = client.RedirectURIs[0]
+	}
+	if !contains(client.RedirectURIs, redirectURI) {
+		return OAuthAuthorization{}, ErrInvalidRedirectURI
+	}
+	if req.CodeChallengeMethod != CodeChallengeMethodS256 || !isValidCodeChallenge(req.CodeChallenge) {
+		return OAuthAuthorization{}, ErrInvalidCodeChallenge
+	}
+
+	scopes := strings.Fields(req.Scope)
+	if len(scopes) == 0 {
+		scopes = client.Scopes
+	}
+	for _, scope := range scopes {
+		if !contains(client.Scopes, scope) {
+			return OAuthAuthorization{}, fmt.Errorf("%w: %s", ErrInvalidOAuthScope, scope)
+		}
+	}
+	return OAuthAuthorization{
+		Client:           client,
+		RedirectURI:      redirectURI,
+		RedirectURIGiven: req.RedirectURI != "",
+		Scopes:           scopes,
+		CodeChallenge:    req.CodeChallenge,
+	}, nil
+}
+
+// CreateOAuthCode returns the authorization code of the consent of the user
+// to authz, which the client exchanges for tokens with ExchangeOAuthCode
+func (a *Authenticator) CreateOAuthCode(ctx context.Context, username string, authz OAuthAuthorization) (string, error) {
+	code, err := newSecretToken()
+	if err != nil {
+		return "", fmt.Errorf("cannot generate authorization code: %w", err)
+	}
+	now := a.now()
+	_, err = a.store.CreateOAuthAuthorizationCode(ctx, db.CreateOAuthAuthorizationCodeParams{
+		HashedCode:       hashSecretToken(code),
+		ClientID:         authz.Client.ID,
+		Username:         username,
+		RedirectURI:      authz.RedirectURI,
+		RedirectURIGiven: authz.RedirectURIGiven,
+		Scopes:           authz.Scopes,
+		CodeChallenge:    authz.CodeChallenge,
+		IssuedAt:         now,
+		ExpiresAt:        now.Add(oauthCodeDuration),
+	})
+	if err != nil {
+		return "", fmt.Errorf("cannot create authorization code: %w", err)
+	}
+	return code, nil
+}
+
+// OAuthClientCredentials authenticate a client at the token endpoint
+type OAuthClientCredentials struct {
+	ClientID     string
+	ClientSecret string
+}
+
+// OAuthGrant is the access a user granted to a client. The caller creates
+// the access token of the grant with its token maker.
+type OAuthGrant struct {
+	ClientID     string
+	Username     string
+	Scopes       []string
+	RefreshToken string
+}
+
+// ExchangeOAuthCodeParams is a request of the authorization_code grant
+type ExchangeOAuthCodeParams struct {
+	Client OAuthClientCredentials
+	Code   string
+	// RedirectURI must be the one of the authorization request, if it had
+	// one, as RFC 6749 requires
+	RedirectURI  string
+	CodeVerifier string
+}
+
+// ExchangeOAuthCode exchanges an authorization code for a grant, once the
+// client and the PKCE verifier are checked. A code is exchanged once, even
+// if the exchange fails.
+func (a *Authenticator) ExchangeOAuthCode(ctx context.Context, arg ExchangeOAuthCodeParams) (OAuthGrant, error) {
+	// the client is checked first, so that others cannot use up its codes
+	client, err := a.authenticateOAuthClient(ctx, arg.Client)
+	if err != nil {
+		return OAuthGrant{}, err
+	}
+	code, err := a.store.DeleteOAuthAuthorizationCode(ctx, hashSecretToken(arg.Code))
+	if errors.Is(err, db.ErrRecordNotFound) {
+		return OAuthGrant{}, ErrInvalidGrant
+	}
+	if err != nil {
+		return OAuthGrant{}, fmt.Errorf("cannot claim authorization code: %w", err)
+	}
+	if code.ClientID != client.ID || !code.ExpiresAt.After(a.now()) {
+		return OAuthGrant{}, ErrInvalidGrant
+	}
+	if code.RedirectURIGiven && code.RedirectURI != arg.RedirectURI {
+		return OAuthGrant{}, ErrInvalidGrant
+	}
+	if !isValidCodeVerifier(arg.CodeVerifier) || subtle.ConstantTimeCompare([]byte(codeChallenge(arg.CodeVerifier)), []byte(code.CodeChallenge)) != 1 {
+		return OAuthGrant{}, ErrInvalidGrant
+	}
+	// issued_at is set with the clock the password change time is, rather
+	// than by the database as created_at is
+	if err := a.checkNotRevoked(ctx, code.Username, code.IssuedAt); err != nil {
+		return OAuthGrant{}, grantError(err)
+	}
+	return a.newOAuthGrant(ctx, client.ID, code.Username, code.Scopes)
+}
+
+// RefreshOAuthTokenParams is a request of the refresh_token grant
+type RefreshOAuthTokenParams struct {
+	Client       OAuthClientCredentials
+	RefreshToken string
+}
+
+// RefreshOAuthToken replaces a refresh token with a new grant of the same
+// scopes. A refresh token is used once, and is revoked by a password change
+// of the user, as their access tokens are.
+func (a *Authenticator) RefreshOAuthToken(ctx context.Context, arg RefreshOAuthTokenParams) (OAuthGrant, error) {
+	client, err := a.authenticateOAuthClient(ctx, arg.Client)
+	if err != nil {
+		return OAuthGrant{}, err
+	}
+	refreshToken, err := a.store.DeleteOAuthRefreshToken(ctx, hashSecretToken(arg.RefreshToken))
+	if errors.Is(err, db.ErrRecordNotFound) {
+		return OAuthGrant{}, ErrInvalidGrant
+	}
+	if err != nil {
+		return OAuthGrant{}, fmt.Errorf("cannot claim refresh token: %w", err)
+	}
+	if refreshToken.ClientID != client.ID || !refreshToken.ExpiresAt.After(a.now()) {
+		return OAuthGrant{}, ErrInvalidGrant
+	}
+	if err := a.checkNotRevoked(ctx, refreshToken.Username, refreshToken.IssuedAt); err != nil {
+		return OAuthGrant{}, grantError(err)
+	}
+	return a.newOAuthGrant(ctx, client.ID, refreshToken.Username, refreshToken.Scopes)
+}
+
+// authenticateOAuthClient returns the client of the credentials, comparing
+// the secret in constant time
+func (a *Authenticator) authenticateOAuthClient(ctx context.Context, credentials OAuthClientCredentials) (db.OAuthClient, error) {
+	client, err := a.store.GetOAuthClient(ctx, credentials.ClientID)
+	if errors.Is(err, db.ErrRecordNotFound) {
+		return db.OAuthClient{}, ErrInvalidOAuthClient
+	}
+	if err != nil {
+		return db.OAuthClient{}, fmt.Errorf("cannot get OAuth client: %w", err)
+	}
+	if subtle.ConstantTimeCompare([]byte(hashSecretToken(credentials.ClientSecret)), []byte(client.HashedSecret)) != 1 {
+		return db.OAuthClient{}, ErrInvalidOAuthClient
+	}
+	return client, nil
+}
+
+// newOAuthGrant creates the refresh token of a grant
+func (a *Authenticator) newOAuthGrant(ctx context.Context, clientID, username string, scopes []string) (OAuthGrant, error) {
+	refreshToken, err := newSecretToken()
+	if err != nil {
+		return OAuthGrant{}, fmt.Errorf("cannot generate refresh token: %w", err)
+	}
+	now := a.now()
+	_, err = a.store.CreateOAuthRefreshToken(ctx, db.CreateOAuthRefreshTokenParams{
+		HashedToken: hashSecretToken(refreshToken),
+		ClientID:    clientID,
+		Username:    username,
+		Scopes:      scopes,
+		IssuedAt:    now,
+		ExpiresAt:   now.Add(oauthRefreshTokenDuration),
+	})
+	if err != nil {
+		return OAuthGrant{}, fmt.Errorf("cannot create refresh token: %w", err)
+	}
+	return OAuthGrant{
+		ClientID:     clientID,
+		Username:     username,
+		Scopes:       scopes,
+		RefreshToken: refreshToken,
+	}, nil
+}
+
+// grantError reports a code or refresh token revoked by a password change
+// as any other invalid grant
+func grantError(err error) error {
+	if errors.Is(err, ErrTokenRevoked) {
+		return ErrInvalidGrant
+	}
+	return err
+}
+
+// codeChallenge returns the PKCE S256 challenge of a verifier
+func codeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
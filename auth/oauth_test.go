@@ -0,0 +1,249 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	memdb "github.com/dpsigor/cheatsheet-golang-postgres/db/memory"
+	db "github.com/dpsigor/cheatsheet-golang-postgres/db/sqlc"
+	"github.com/dpsigor/cheatsheet-golang-postgres/util"
+	"github.com/stretchr/testify/require"
+)
+
+const testRedirectURI = "https://partner.example.com/callback"
+
+func registerOAuthClient(t *testing.T, a *Authenticator, owner string) NewOAuthClient {
+	created, err := a.RegisterOAuthClient(context.Background(), RegisterOAuthClientParams{
+		Owner:        owner,
+		Name:         "partner",
+		RedirectURIs: []string{testRedirectURI},
+		Scopes:       []string{util.AccountsReadScope, util.UsersReadScope},
+	})
+	require.NoError(t, err)
+	return created
+}
+
+func TestOAuthAuthorizationCodeFlow(t *testing.T) {
+	store := memdb.NewStore()
+	a := NewAuthenticator(store, LockoutPolicy{}, testHasher)
+	user, _ := createUser(t, store)
+	ctx := context.Background()
+	client := registerOAuthClient(t, a, user.Username)
+	credentials := OAuthClientCredentials{ClientID: client.Client.ID, ClientSecret: client.Secret}
+	verifier := util.RandomString(64)
+
+	authz, err := a.CheckOAuthAuthorization(ctx, OAuthAuthorizationRequest{
+		ClientID:            client.Client.ID,
+		Scope:               util.AccountsReadScope,
+		CodeChallenge:       codeChallenge(verifier),
+		CodeChallengeMethod: CodeChallengeMethodS256,
+	})
+	require.NoError(t, err)
+	require.Equal(t, testRedirectURI, authz.RedirectURI)
+	require.Equal(t, []string{util.AccountsReadScope}, authz.Scopes)
+	code, err := a.CreateOAuthCode(ctx, user.Username, authz)
+	require.NoError(t, err)
+
+	grant, err := a.ExchangeOAuthCode(ctx, ExchangeOAuthCodeParams{
+		Client:       credentials,
+		Code:         code,
+		RedirectURI:  testRedirectURI,
+		CodeVerifier: verifier,
+	})
+	require.NoError(t, err)
+	require.Equal(t, user.Username, grant.Username)
+	require.Equal(t, []string{util.AccountsReadScope}, grant.Scopes)
+
+	// codes and refresh tokens are used once
+	_, err = a.ExchangeOAuthCode(ctx, ExchangeOAuthCodeParams{
+		Client:       credentials,
+		Code:         code,
+		RedirectURI:  testRedirectURI,
+		CodeVerifier: verifier,
+	})
+	require.ErrorIs(t, err, ErrInvalidGrant)
+
+	refreshed, err := a.RefreshOAuthToken(ctx, RefreshOAuthTokenParams{Client: credentials, RefreshToken: grant.RefreshToken})
+	require.NoError(t, err)
+	require.Equal(t, grant.Scopes, refreshed.Scopes)
+	require.NotEqual(t, grant.RefreshToken, refreshed.RefreshToken)
+	_, err = a.RefreshOAuthToken(ctx, RefreshOAuthTokenParams{Client: credentials, RefreshToken: grant.RefreshToken})
+	require.ErrorIs(t, err, ErrInvalidGrant)
+
+	// a wrong secret neither refreshes nor uses up the token
+	_, err = a.RefreshOAuthToken(ctx, RefreshOAuthTokenParams{
+		Client:       OAuthClientCredentials{ClientID: client.Client.ID, ClientSecret: "wrong"},
+		RefreshToken: refreshed.RefreshToken,
+	})
+	require.ErrorIs(t, err, ErrInvalidOAuthClient)
+	_, err = a.RefreshOAuthToken(ctx, RefreshOAuthTokenParams{Client: credentials, RefreshToken: refreshed.RefreshToken})
+	require.NoError(t, err)
+}
+
+func TestCheckOAuthAuthorization(t *testing.T) {
+	store := memdb.NewStore()
+	a := NewAuthenticator(store, LockoutPolicy{}, testHasher)
+	user, _ := createUser(t, store)
+	client := registerOAuthClient(t, a, user.Username)
+	valid := OAuthAuthorizationRequest{
+		ClientID:            client.Client.ID,
+		RedirectURI:         testRedirectURI,
+		CodeChallenge:       codeChallenge(util.RandomString(64)),
+		CodeChallengeMethod: CodeChallengeMethodS256,
+	}
+
+	authz, err := a.CheckOAuthAuthorization(context.Background(), valid)
+	require.NoError(t, err)
+	require.Equal(t, client.Client.Scopes, authz.Scopes)
+
+	testCases := []struct {
+		name   string
+		modify func(req *OAuthAuthorizationRequest)
+		err    error
+	}{
+		{"UnknownClient", func(req *OAuthAuthorizationRequest) { req.ClientID = "unknown" }, ErrInvalidOAuthClient},
+		{"UnregisteredRedirectURI", func(req *OAuthAuthorizationRequest) { req.RedirectURI = testRedirectURI + "/other" }, ErrInvalidRedirectURI},
+		{"PlainChallenge", func(req *OAuthAuthorizationRequest) { req.CodeChallengeMethod = "plain" }, ErrInvalidCodeChallenge},
+		{"NoChallenge", func(req *OAuthAuthorizationRequest) { req.CodeChallenge = "" }, ErrInvalidCodeChallenge},
+		{"ScopeNotAllowed", func(req *OAuthAuthorizationRequest) { req.Scope = util.TransfersWriteScope }, ErrInvalidOAuthScope},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := valid
+			tc.modify(&req)
+			_, err := a.CheckOAuthAuthorization(context.Background(), req)
+			require.ErrorIs(t, err, tc.err)
+		})
+	}
+}
+
+func TestExchangeOAuthCodeInvalid(t *testing.T) {
+	store := memdb.NewStore()
+	a := NewAuthenticator(store, LockoutPolicy{}, testHasher)
+	user, password := createUser(t, store)
+	ctx := context.Background()
+	client := registerOAuthClient(t, a, user.Username)
+	other := registerOAuthClient(t, a, user.Username)
+	verifier := util.RandomString(64)
+
+	newCode := func() string {
+		authz, err := a.CheckOAuthAuthorization(ctx, OAuthAuthorizationRequest{
+			ClientID:            client.Client.ID,
+			RedirectURI:         testRedirectURI,
+			CodeChallenge:       codeChallenge(verifier),
+			CodeChallengeMethod: CodeChallengeMethodS256,
+		})
+		require.NoError(t, err)
+		code, err := a.CreateOAuthCode(ctx, user.Username, authz)
+		require.NoError(t, err)
+		return code
+	}
+	valid := func() ExchangeOAuthCodeParams {
+		return ExchangeOAuthCodeParams{
+			Client:       OAuthClientCredentials{ClientID: client.Client.ID, ClientSecret: client.Secret},
+			Code:         newCode(),
+			RedirectURI:  testRedirectURI,
+			CodeVerifier: verifier,
+		}
+	}
+
+	testCases := []struct {
+		name   string
+		modify func(arg *ExchangeOAuthCodeParams)
+		setup  func()
+		err    error
+	}{
+		{
+			name:   "WrongSecret",
+			modify: func(arg *ExchangeOAuthCodeParams) { arg.Client.ClientSecret = other.Secret },
+			err:    ErrInvalidOAuthClient,
+		},
+		{
+			name: "OtherClient",
+			modify: func(arg *ExchangeOAuthCodeParams) {
+				arg.Client = OAuthClientCredentials{ClientID: other.Client.ID, ClientSecret: other.Secret}
+			},
+			err: ErrInvalidGrant,
+		},
+		{
+			name:   "WrongVerifier",
+			modify: func(arg *ExchangeOAuthCodeParams) { arg.CodeVerifier = util.RandomString(64) },
+			err:    ErrInvalidGrant,
+		},
+		{
+			name:   "WrongRedirectURI",
+			modify: func(arg *ExchangeOAuthCodeParams) { arg.RedirectURI = testRedirectURI + "/other" },
+			err:    ErrInvalidGrant,
+		},
+		{
+			name:   "NoRedirectURI",
+			modify: func(arg *ExchangeOAuthCodeParams) { arg.RedirectURI = "" },
+			err:    ErrInvalidGrant,
+		},
+		{
+			name:   "Expired",
+			modify: func(arg *ExchangeOAuthCodeParams) {},
+			setup:  func() { a.now = func() time.Time { return time.Now().Add(oauthCodeDuration) } },
+			err:    ErrInvalidGrant,
+		},
+		{
+			name:   "PasswordChanged",
+			modify: func(arg *ExchangeOAuthCodeParams) {},
+			setup: func() {
+				time.Sleep(time.Millisecond)
+				_, err := a.ChangePassword(ctx, user.Username, password, util.RandomString(10))
+				require.NoError(t, err)
+			},
+			err: ErrInvalidGrant,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			arg := valid()
+			tc.modify(&arg)
+			if tc.setup != nil {
+				tc.setup()
+			}
+			defer func() { a.now = time.Now }()
+			_, err := a.ExchangeOAuthCode(ctx, arg)
+			require.ErrorIs(t, err, tc.err)
+			// the code is used up, even by a failed exchange of its client
+			if tc.err == ErrInvalidGrant {
+				_, err = store.DeleteOAuthAuthorizationCode(ctx, hashSecretToken(arg.Code))
+				require.ErrorIs(t, err, db.ErrRecordNotFound)
+			}
+		})
+	}
+}
+
+func TestExchangeOAuthCodeRedirectURINotGiven(t *testing.T) {
+	store := memdb.NewStore()
+	a := NewAuthenticator(store, LockoutPolicy{}, testHasher)
+	user, _ := createUser(t, store)
+	ctx := context.Background()
+	client := registerOAuthClient(t, a, user.Username)
+	verifier := util.RandomString(64)
+
+	// the client registered a single redirect URI and did not send it, so
+	// the token request need not send it either
+	for _, redirectURI := range []string{"", testRedirectURI} {
+		authz, err := a.CheckOAuthAuthorization(ctx, OAuthAuthorizationRequest{
+			ClientID:            client.Client.ID,
+			CodeChallenge:       codeChallenge(verifier),
+			CodeChallengeMethod: CodeChallengeMethodS256,
+		})
+		require.NoError(t, err)
+		require.False(t, authz.RedirectURIGiven)
+		code, err := a.CreateOAuthCode(ctx, user.Username, authz)
+		require.NoError(t, err)
+
+		_, err = a.ExchangeOAuthCode(ctx, ExchangeOAuthCodeParams{
+			Client:       OAuthClientCredentials{ClientID: client.Client.ID, ClientSecret: client.Secret},
+			Code:         code,
+			RedirectURI:  redirectURI,
+			CodeVerifier: verifier,
+		})
+		require.NoError(t, err)
+	}
+}
@@ -0,0 +1,175 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	db "github.com/dpsigor/cheatsheet-golang-postgres/db/sqlc"
+	"github.com/dpsigor/cheatsheet-golang-postgres/token"
+)
+
+// Errors of the password change and reset
+var (
+	ErrInvalidResetToken = errors.New("invalid or expired password reset token")
+	ErrTokenRevoked      = errors.New("token was revoked by a password change")
+)
+
+const (
+	// passwordResetDuration is how long the user has to follow the reset
+	// link sent to them
+	passwordResetDuration = time.Hour
+	// secretTokenSize is the number of random bytes of the tokens sent by
+	// email
+	secretTokenSize = 32
+)
+
+// CheckPassword checks the password of the user before a sensitive change
+// of their account, such as of their password or email. A wrong password
+// counts as a failed login, so that it cannot be guessed through these calls
+// either, and the password of a locked out user is not accepted.
+func (a *Authenticator) CheckPassword(ctx context.Context, username, password string) (db.User, error) {
+	user, err := a.store.GetUser(ctx, username)
+	if err != nil {
+		return db.User{}, err
+	}
+	locked := user.LockedUntil.After(a.now())
+	if err := a.hasher.Check(password, user.HashedPassword); err != nil || locked {
+		if !locked {
+			if err := a.recordFailedLogin(ctx, user.Username); err != nil {
+				return db.User{}, err
+			}
+		}
+		return db.User{}, ErrInvalidCredentials
+	}
+	return user, nil
+}
+
+// ChangePassword sets a new password for the user once their current
+// password is checked by CheckPassword
+func (a *Authenticator) ChangePassword(ctx context.Context, username, currentPassword, newPassword string) (db.User, error) {
+	user, err := a.CheckPassword(ctx, username, currentPassword)
+	if err != nil {
+		return db.User{}, err
+	}
+	return a.setPassword(ctx, user.Username, newPassword)
+}
+
+// PasswordReset is a reset token of a user, to be sent to their email
+type PasswordReset struct {
+	User      db.User
+	Token     string
+	ExpiresAt time.Time
+}
+
+// RequestPasswordReset creates a reset token for the user with the email,
+// replacing the tokens requested before. It returns db.ErrRecordNotFound when
+// no user has the email, which callers should not tell the client. An email
+// the user has not verified is treated as unknown, as it may not be theirs.
+func (a *Authenticator) RequestPasswordReset(ctx context.Context, email string) (PasswordReset, error) {
+	user, err := a.store.GetUserByEmail(ctx, email)
+	if err != nil {
+		return PasswordReset{}, err
+	}
+	if !user.IsEmailVerified {
+		return PasswordReset{}, db.ErrRecordNotFound
+	}
+	if err := a.store.DeletePasswordResetTokens(ctx, user.Username); err != nil {
+		return PasswordReset{}, fmt.Errorf("cannot delete password reset tokens: %w", err)
+	}
+
+	resetToken, err := newSecretToken()
+	if err != nil {
+		return PasswordReset{}, fmt.Errorf("cannot generate password reset token: %w", err)
+	}
+	stored, err := a.store.CreatePasswordResetToken(ctx, db.CreatePasswordResetTokenParams{
+		Username:    user.Username,
+		HashedToken: hashSecretToken(resetToken),
+		ExpiresAt:   a.now().Add(passwordResetDuration),
+	})
+	if err != nil {
+		return PasswordReset{}, fmt.Errorf("cannot create password reset token: %w", err)
+	}
+	return PasswordReset{User: user, Token: resetToken, ExpiresAt: stored.ExpiresAt}, nil
+}
+
+// ResetPassword sets a new password for the user of a reset token. A token
+// is used once, even if the password cannot be set.
+func (a *Authenticator) ResetPassword(ctx context.Context, resetToken, newPassword string) (db.User, error) {
+	stored, err := a.store.DeletePasswordResetToken(ctx, hashSecretToken(resetToken))
+	if errors.Is(err, db.ErrRecordNotFound) {
+		return db.User{}, ErrInvalidResetToken
+	}
+	if err != nil {
+		return db.User{}, err
+	}
+	if !stored.ExpiresAt.After(a.now()) {
+		return db.User{}, ErrInvalidResetToken
+	}
+	return a.setPassword(ctx, stored.Username, newPassword)
+}
+
+// CheckToken returns ErrTokenRevoked if the password of the user changed
+// since the access token was issued, or the user no longer exists
+func (a *Authenticator) CheckToken(ctx context.Context, payload *token.Payload) error {
+	return a.checkNotRevoked(ctx, payload.Username, payload.IssuedAt)
+}
+
+// checkNotRevoked returns ErrTokenRevoked if the password of the user changed
+// since issuedAt, or the user no longer exists
+func (a *Authenticator) checkNotRevoked(ctx context.Context, username string, issuedAt time.Time) error {
+	changedAt, err := a.store.GetPasswordChangedAt(ctx, username)
+	if errors.Is(err, db.ErrRecordNotFound) {
+		return ErrTokenRevoked
+	}
+	if err != nil {
+		return fmt.Errorf("cannot get password change time: %w", err)
+	}
+	if issuedAt.Before(changedAt) {
+		return ErrTokenRevoked
+	}
+	return nil
+}
+
+// setPassword changes the password of the user, which revokes their access
+// tokens and password reset tokens
+func (a *Authenticator) setPassword(ctx context.Context, username, password string) (db.User, error) {
+	hashedPassword, err := a.hasher.Hash(password)
+	if err != nil {
+		return db.User{}, err
+	}
+	// the change time comes from the clock the access tokens are issued
+	// with, so that a token issued right after the change is not revoked
+	user, err := a.store.ChangePasswordTx(ctx, db.ChangePasswordTxParams{
+		Username:          username,
+		HashedPassword:    hashedPassword,
+		PasswordChangedAt: a.now(),
+	})
+	if err != nil {
+		return db.User{}, fmt.Errorf("cannot change password: %w", err)
+	}
+	return user, nil
+}
+
+// newSecretToken returns a random token to send by email, such as a password
+// reset token
+func newSecretToken() (string, error) {
+	b := make([]byte, secretTokenSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashSecretToken returns the hash of a token of newSecretToken stored in the
+// database. The tokens are random, so unlike passwords they need no salt nor
+// slow hash.
+func hashSecretToken(secretToken string) string {
+	sum := sha256.Sum256([]byte(secretToken))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,130 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	memdb "github.com/dpsigor/cheatsheet-golang-postgres/db/memory"
+	db "github.com/dpsigor/cheatsheet-golang-postgres/db/sqlc"
+	"github.com/dpsigor/cheatsheet-golang-postgres/token"
+	"github.com/dpsigor/cheatsheet-golang-postgres/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChangePassword(t *testing.T) {
+	store := memdb.NewStore()
+	a := NewAuthenticator(store, LockoutPolicy{MaxAttempts: 1, Duration: time.Hour}, testHasher)
+	user, password := createUser(t, store)
+	ctx := context.Background()
+
+	newPassword := util.RandomString(10)
+	updated, err := a.ChangePassword(ctx, user.Username, password, newPassword)
+	require.NoError(t, err)
+	require.True(t, updated.PasswordChangedAt.After(user.PasswordChangedAt))
+	require.NoError(t, testHasher.Check(newPassword, updated.HashedPassword))
+
+	_, err = a.Login(ctx, user.Username, password, Client{})
+	require.ErrorIs(t, err, ErrInvalidCredentials)
+	// the failed login locked the user out, so the right password is refused
+	_, err = a.ChangePassword(ctx, user.Username, newPassword, util.RandomString(10))
+	require.ErrorIs(t, err, ErrInvalidCredentials)
+
+	// a wrong current password counts as a failed login
+	other, _ := createUser(t, store)
+	_, err = a.ChangePassword(ctx, other.Username, "wrong-password", util.RandomString(10))
+	require.ErrorIs(t, err, ErrInvalidCredentials)
+	got, err := store.GetUser(ctx, other.Username)
+	require.NoError(t, err)
+	require.Equal(t, int32(1), got.FailedLoginAttempts)
+}
+
+func TestResetPassword(t *testing.T) {
+	store := memdb.NewStore()
+	a := NewAuthenticator(store, LockoutPolicy{}, testHasher)
+	c := &clock{now: time.Now()}
+	a.now = c.Now
+	user, _ := createUser(t, store)
+	ctx := context.Background()
+
+	_, err := a.RequestPasswordReset(ctx, "unknown"+user.Email)
+	require.ErrorIs(t, err, db.ErrRecordNotFound)
+	// an unverified email may not be the user's
+	_, err = a.RequestPasswordReset(ctx, user.Email)
+	require.ErrorIs(t, err, db.ErrRecordNotFound)
+	_, err = store.VerifyUserEmail(ctx, db.VerifyUserEmailParams{Username: user.Username, Email: user.Email})
+	require.NoError(t, err)
+
+	first, err := a.RequestPasswordReset(ctx, user.Email)
+	require.NoError(t, err)
+	reset, err := a.RequestPasswordReset(ctx, user.Email)
+	require.NoError(t, err)
+	require.Equal(t, user.Username, reset.User.Username)
+	require.NotEqual(t, first.Token, reset.Token)
+	require.WithinDuration(t, c.now.Add(passwordResetDuration), reset.ExpiresAt, time.Millisecond)
+
+	// requesting a reset again replaces the token
+	_, err = a.ResetPassword(ctx, first.Token, util.RandomString(10))
+	require.ErrorIs(t, err, ErrInvalidResetToken)
+
+	password := util.RandomString(10)
+	_, err = a.ResetPassword(ctx, reset.Token, password)
+	require.NoError(t, err)
+	result, err := a.Login(ctx, user.Username, password, Client{})
+	require.NoError(t, err)
+	require.Equal(t, user.Username, result.User.Username)
+
+	// a token is used once
+	_, err = a.ResetPassword(ctx, reset.Token, util.RandomString(10))
+	require.ErrorIs(t, err, ErrInvalidResetToken)
+
+	reset, err = a.RequestPasswordReset(ctx, user.Email)
+	require.NoError(t, err)
+	c.now = c.now.Add(passwordResetDuration)
+	_, err = a.ResetPassword(ctx, reset.Token, util.RandomString(10))
+	require.ErrorIs(t, err, ErrInvalidResetToken)
+
+	// changing the password revokes the reset tokens
+	reset, err = a.RequestPasswordReset(ctx, user.Email)
+	require.NoError(t, err)
+	_, err = a.ChangePassword(ctx, user.Username, password, util.RandomString(10))
+	require.NoError(t, err)
+	_, err = a.ResetPassword(ctx, reset.Token, util.RandomString(10))
+	require.ErrorIs(t, err, ErrInvalidResetToken)
+}
+
+func TestCheckToken(t *testing.T) {
+	store := memdb.NewStore()
+	a := NewAuthenticator(store, LockoutPolicy{}, testHasher)
+	user, password := createUser(t, store)
+	ctx := context.Background()
+
+	payload := &token.Payload{Username: user.Username, IssuedAt: time.Now()}
+	require.NoError(t, a.CheckToken(ctx, payload))
+
+	_, err := a.ChangePassword(ctx, user.Username, password, util.RandomString(10))
+	require.NoError(t, err)
+	require.ErrorIs(t, a.CheckToken(ctx, payload), ErrTokenRevoked)
+	payload.IssuedAt = time.Now()
+	require.NoError(t, a.CheckToken(ctx, payload))
+
+	payload.Username = "missing" + util.RandomString(6)
+	require.ErrorIs(t, a.CheckToken(ctx, payload), ErrTokenRevoked)
+}
+
+func TestChangePasswordClock(t *testing.T) {
+	store := memdb.NewStore()
+	a := NewAuthenticator(store, LockoutPolicy{}, testHasher)
+	user, password := createUser(t, store)
+	ctx := context.Background()
+
+	// the change time comes from the clock the access tokens are issued
+	// with, rather than from the clock of the database
+	changedAt := time.Now().Add(-time.Hour).Truncate(time.Microsecond)
+	a.now = func() time.Time { return changedAt }
+	updated, err := a.ChangePassword(ctx, user.Username, password, util.RandomString(10))
+	require.NoError(t, err)
+	require.True(t, changedAt.Equal(updated.PasswordChangedAt))
+	require.NoError(t, a.CheckToken(ctx, &token.Payload{Username: user.Username, IssuedAt: changedAt}))
+	require.ErrorIs(t, a.CheckToken(ctx, &token.Payload{Username: user.Username, IssuedAt: changedAt.Add(-time.Microsecond)}), ErrTokenRevoked)
+}
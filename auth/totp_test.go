@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"encoding/base32"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTOTPCode(t *testing.T) {
+	// the SHA1 test vectors of RFC 6238, truncated to 6 digits
+	secret := []byte("12345678901234567890")
+	for _, tc := range []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	} {
+		require.Equal(t, tc.code, totpCode(secret, totpStep(time.Unix(tc.unix, 0))), "time %d", tc.unix)
+	}
+
+	code, err := GenerateTOTPCode(strings.ToLower(totpEncoding.EncodeToString(secret)), time.Unix(59, 0))
+	require.NoError(t, err)
+	require.Equal(t, "287082", code)
+	_, err = GenerateTOTPCode("not base32!", time.Now())
+	require.Error(t, err)
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret, err := newTOTPSecret()
+	require.NoError(t, err)
+	key, err := totpEncoding.DecodeString(secret)
+	require.NoError(t, err)
+	require.Len(t, key, totpSecretSize)
+
+	now := time.Now()
+	step := totpStep(now)
+	for i := int64(-totpSkew); i <= totpSkew; i++ {
+		got, ok := validateTOTP(secret, totpCode(key, step+i), now)
+		require.True(t, ok)
+		require.Equal(t, step+i, got)
+	}
+	_, ok := validateTOTP(secret, totpCode(key, step+totpSkew+1), now)
+	require.False(t, ok)
+	_, ok = validateTOTP(secret, totpCode(key, step-totpSkew-1), now)
+	require.False(t, ok)
+
+	// the secret may be typed in lower case
+	_, ok = validateTOTP(strings.ToLower(secret), totpCode(key, step), now)
+	require.True(t, ok)
+
+	for _, code := range []string{"", "12345", "1234567", "12345a", " 12345"} {
+		_, ok = validateTOTP(secret, code, now)
+		require.False(t, ok, code)
+	}
+	_, ok = validateTOTP("not base32!", "123456", now)
+	require.False(t, ok)
+}
+
+func TestTOTPURI(t *testing.T) {
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+	u, err := url.Parse(totpURI("alice", secret))
+	require.NoError(t, err)
+	require.Equal(t, "otpauth", u.Scheme)
+	require.Equal(t, "totp", u.Host)
+	require.Equal(t, "/Simple Bank:alice", u.Path)
+	require.Equal(t, secret, u.Query().Get("secret"))
+	require.Equal(t, "Simple Bank", u.Query().Get("issuer"))
+	require.Equal(t, "6", u.Query().Get("digits"))
+	require.Equal(t, "30", u.Query().Get("period"))
+}
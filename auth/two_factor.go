@@ -0,0 +1,259 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	db "github.com/dpsigor/cheatsheet-golang-postgres/db/sqlc"
+	"github.com/google/uuid"
+)
+
+// Errors of the two-factor authentication
+var (
+	ErrTOTPAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrTOTPNotEnrolled    = errors.New("two-factor authentication enrollment was not started")
+	ErrTOTPNotEnabled     = errors.New("two-factor authentication is not enabled")
+	ErrTOTPCodeRequired   = errors.New("a two-factor authentication code is required")
+	ErrInvalidTOTPCode    = errors.New("invalid two-factor authentication code")
+)
+
+const (
+	// loginChallengeDuration is how long the user has to send their code
+	// once their password is checked
+	loginChallengeDuration = 5 * time.Minute
+
+	recoveryCodeCount  = 10
+	recoveryCodeLength = 10
+	// recoveryCodeAlphabet avoids the characters easily mistaken for one
+	// another, as the base32 alphabet
+	recoveryCodeAlphabet = "abcdefghijklmnopqrstuvwxyz234567"
+)
+
+// TOTPEnrollment is the secret to add to an authenticator app, as text and
+// as an otpauth URI
+type TOTPEnrollment struct {
+	Secret string
+	URI    string
+}
+
+// EnrollTOTP generates a new TOTP secret for the user. TOTP is enabled once
+// ConfirmTOTP receives a code of the secret, and until then enrolling again
+// replaces the secret.
+func (a *Authenticator) EnrollTOTP(ctx context.Context, username string) (TOTPEnrollment, error) {
+	secret, err := newTOTPSecret()
+	if err != nil {
+		return TOTPEnrollment{}, err
+	}
+	user, err := a.store.SetTOTPSecret(ctx, db.SetTOTPSecretParams{
+		Username:   username,
+		TotpSecret: secret,
+	})
+	if err != nil {
+		if errors.Is(err, db.ErrRecordNotFound) {
+			return TOTPEnrollment{}, ErrTOTPAlreadyEnabled
+		}
+		return TOTPEnrollment{}, fmt.Errorf("cannot set TOTP secret: %w", err)
+	}
+	return TOTPEnrollment{Secret: secret, URI: totpURI(user.Username, secret)}, nil
+}
+
+// ConfirmTOTP enables the TOTP enrolled by the user once code proves their
+// authenticator app is set up. It returns the recovery codes of the user,
+// which are only stored hashed and cannot be shown again.
+func (a *Authenticator) ConfirmTOTP(ctx context.Context, username, code string) ([]string, error) {
+	user, err := a.store.GetUser(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	if user.TotpEnabled {
+		return nil, ErrTOTPAlreadyEnabled
+	}
+	if user.TotpSecret == "" {
+		return nil, ErrTOTPNotEnrolled
+	}
+	step, ok := validateTOTP(user.TotpSecret, code, a.now())
+	if !ok {
+		return nil, ErrInvalidTOTPCode
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	hashedCodes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		codes[i], err = newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		hashedCodes[i], err = a.hasher.Hash(normalizeRecoveryCode(codes[i]))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = a.store.EnableTOTPTx(ctx, db.EnableTOTPTxParams{
+		Username:            user.Username,
+		LastStep:            step,
+		HashedRecoveryCodes: hashedCodes,
+	})
+	if err != nil {
+		// enabled by a concurrent confirmation
+		if errors.Is(err, db.ErrRecordNotFound) {
+			return nil, ErrTOTPAlreadyEnabled
+		}
+		return nil, fmt.Errorf("cannot enable TOTP: %w", err)
+	}
+	return codes, nil
+}
+
+// LoginTOTP completes the login started by Login with a TOTP code or a
+// recovery code of the user. A challenge is answered once: a wrong code
+// counts as a failed login, and the user has to send their password again.
+func (a *Authenticator) LoginTOTP(ctx context.Context, challengeID uuid.UUID, code string, client Client) (db.User, error) {
+	challenge, err := a.store.DeleteLoginChallenge(ctx, challengeID)
+	if errors.Is(err, db.ErrRecordNotFound) {
+		return db.User{}, ErrInvalidCredentials
+	}
+	if err != nil {
+		return db.User{}, err
+	}
+	if !challenge.ExpiresAt.After(a.now()) {
+		return db.User{}, ErrInvalidCredentials
+	}
+
+	user, err := a.store.GetUser(ctx, challenge.Username)
+	if err != nil {
+		return db.User{}, err
+	}
+	locked := user.LockedUntil.After(a.now())
+	var ok bool
+	if !locked {
+		if isTOTPCode(code) {
+			ok, err = a.useTOTPCode(ctx, user, code)
+		} else {
+			ok, err = a.useRecoveryCode(ctx, user, code)
+		}
+		if err != nil {
+			return db.User{}, err
+		}
+	}
+	if !ok {
+		return db.User{}, a.loginFailed(ctx, user, locked, client)
+	}
+	return a.loginSucceeded(ctx, user, client)
+}
+
+// VerifyTOTP checks a TOTP code of the user before a sensitive operation. A
+// wrong code counts as a failed login, so that guessing codes locks the user
+// out.
+func (a *Authenticator) VerifyTOTP(ctx context.Context, username, code string) error {
+	user, err := a.store.GetUser(ctx, username)
+	if err != nil {
+		return err
+	}
+	if !user.TotpEnabled {
+		return ErrTOTPNotEnabled
+	}
+	if code == "" {
+		return ErrTOTPCodeRequired
+	}
+	if user.LockedUntil.After(a.now()) {
+		return ErrInvalidTOTPCode
+	}
+
+	ok, err := a.useTOTPCode(ctx, user, code)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		if err := a.recordFailedLogin(ctx, user.Username); err != nil {
+			return err
+		}
+		return ErrInvalidTOTPCode
+	}
+	return nil
+}
+
+func (a *Authenticator) newLoginChallenge(ctx context.Context, username string) (db.LoginChallenge, error) {
+	// the challenges never answered are deleted as the user logs in again
+	if err := a.store.DeleteExpiredLoginChallenges(ctx, username); err != nil {
+		return db.LoginChallenge{}, fmt.Errorf("cannot delete expired login challenges: %w", err)
+	}
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return db.LoginChallenge{}, err
+	}
+	challenge, err := a.store.CreateLoginChallenge(ctx, db.CreateLoginChallengeParams{
+		ID:        id,
+		Username:  username,
+		ExpiresAt: a.now().Add(loginChallengeDuration),
+	})
+	if err != nil {
+		return db.LoginChallenge{}, fmt.Errorf("cannot create login challenge: %w", err)
+	}
+	return challenge, nil
+}
+
+// useTOTPCode reports whether code is a TOTP code of the user that was not
+// used yet, and marks it used
+func (a *Authenticator) useTOTPCode(ctx context.Context, user db.User, code string) (bool, error) {
+	step, ok := validateTOTP(user.TotpSecret, code, a.now())
+	if !ok {
+		return false, nil
+	}
+	n, err := a.store.UseTOTPStep(ctx, db.UseTOTPStepParams{
+		Username:     user.Username,
+		TotpLastStep: step,
+	})
+	if err != nil {
+		return false, fmt.Errorf("cannot use TOTP code: %w", err)
+	}
+	return n == 1, nil
+}
+
+// useRecoveryCode reports whether code is a recovery code of the user, and
+// deletes it
+func (a *Authenticator) useRecoveryCode(ctx context.Context, user db.User, code string) (bool, error) {
+	code = normalizeRecoveryCode(code)
+	if len(code) != recoveryCodeLength {
+		return false, nil
+	}
+	codes, err := a.store.ListRecoveryCodes(ctx, user.Username)
+	if err != nil {
+		return false, fmt.Errorf("cannot list recovery codes: %w", err)
+	}
+	for _, c := range codes {
+		if a.hasher.Check(code, c.HashedCode) != nil {
+			continue
+		}
+		// a code used by a concurrent login is not deleted again
+		n, err := a.store.DeleteRecoveryCode(ctx, c.ID)
+		if err != nil {
+			return false, fmt.Errorf("cannot delete recovery code: %w", err)
+		}
+		return n == 1, nil
+	}
+	return false, nil
+}
+
+// newRecoveryCode returns a random recovery code, formatted as xxxxx-xxxxx
+// to be written down
+func newRecoveryCode() (string, error) {
+	b := make([]byte, recoveryCodeLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("cannot generate recovery code: %w", err)
+	}
+	for i := range b {
+		// the alphabet has 32 characters, so the modulo is not biased
+		b[i] = recoveryCodeAlphabet[int(b[i])%len(recoveryCodeAlphabet)]
+	}
+	return string(b[:recoveryCodeLength/2]) + "-" + string(b[recoveryCodeLength/2:]), nil
+}
+
+// normalizeRecoveryCode accepts recovery codes typed in upper case or
+// without the dash
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
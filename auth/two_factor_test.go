@@ -0,0 +1,236 @@
+package auth
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	memdb "github.com/dpsigor/cheatsheet-golang-postgres/db/memory"
+	db "github.com/dpsigor/cheatsheet-golang-postgres/db/sqlc"
+	"github.com/dpsigor/cheatsheet-golang-postgres/util"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+// clock is the time of an Authenticator, moved forward by the tests
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time { return c.now }
+
+// nextCode moves the clock to the next TOTP period and returns the code of
+// key, so that every code is accepted once
+func (c *clock) nextCode(key []byte) string {
+	c.now = c.now.Add(totpPeriod)
+	return totpCode(key, totpStep(c.now))
+}
+
+func newTOTPAuthenticator(lockout LockoutPolicy) (*Authenticator, *clock) {
+	c := &clock{now: time.Now()}
+	a := NewAuthenticator(memdb.NewStore(), lockout, testHasher)
+	a.now = c.Now
+	return a, c
+}
+
+// enableTOTP enables the TOTP of the user, returning the secret and the
+// recovery codes
+func enableTOTP(t *testing.T, a *Authenticator, c *clock, username string) ([]byte, []string) {
+	enrollment, err := a.EnrollTOTP(context.Background(), username)
+	require.NoError(t, err)
+	key, err := totpEncoding.DecodeString(enrollment.Secret)
+	require.NoError(t, err)
+	codes, err := a.ConfirmTOTP(context.Background(), username, c.nextCode(key))
+	require.NoError(t, err)
+	return key, codes
+}
+
+func TestEnrollTOTP(t *testing.T) {
+	a, c := newTOTPAuthenticator(LockoutPolicy{})
+	user, _ := createUser(t, a.store)
+	ctx := context.Background()
+
+	_, err := a.ConfirmTOTP(ctx, user.Username, "123456")
+	require.ErrorIs(t, err, ErrTOTPNotEnrolled)
+
+	enrollment, err := a.EnrollTOTP(ctx, user.Username)
+	require.NoError(t, err)
+	require.Contains(t, enrollment.URI, "secret="+enrollment.Secret)
+	key, err := totpEncoding.DecodeString(enrollment.Secret)
+	require.NoError(t, err)
+
+	// enrolling again replaces the secret
+	enrollment, err = a.EnrollTOTP(ctx, user.Username)
+	require.NoError(t, err)
+	_, err = a.ConfirmTOTP(ctx, user.Username, c.nextCode(key))
+	require.ErrorIs(t, err, ErrInvalidTOTPCode)
+	got, err := a.store.GetUser(ctx, user.Username)
+	require.NoError(t, err)
+	require.False(t, got.TotpEnabled)
+
+	key, err = totpEncoding.DecodeString(enrollment.Secret)
+	require.NoError(t, err)
+	codes, err := a.ConfirmTOTP(ctx, user.Username, c.nextCode(key))
+	require.NoError(t, err)
+	require.Len(t, codes, recoveryCodeCount)
+	for _, code := range codes {
+		require.Regexp(t, "^[a-z2-7]{5}-[a-z2-7]{5}$", code)
+	}
+	got, err = a.store.GetUser(ctx, user.Username)
+	require.NoError(t, err)
+	require.True(t, got.TotpEnabled)
+	stored, err := a.store.ListRecoveryCodes(ctx, user.Username)
+	require.NoError(t, err)
+	require.Len(t, stored, recoveryCodeCount)
+	require.NotContains(t, stored[0].HashedCode, normalizeRecoveryCode(codes[0]))
+
+	// the secret in use is not replaced
+	_, err = a.EnrollTOTP(ctx, user.Username)
+	require.ErrorIs(t, err, ErrTOTPAlreadyEnabled)
+	_, err = a.ConfirmTOTP(ctx, user.Username, c.nextCode(key))
+	require.ErrorIs(t, err, ErrTOTPAlreadyEnabled)
+}
+
+func TestLoginTOTP(t *testing.T) {
+	a, c := newTOTPAuthenticator(LockoutPolicy{})
+	user, password := createUser(t, a.store)
+	key, _ := enableTOTP(t, a, c, user.Username)
+	client := Client{IP: "192.0.2.1", UserAgent: "test"}
+	ctx := context.Background()
+
+	result, err := a.Login(ctx, user.Username, password, client)
+	require.NoError(t, err)
+	require.Empty(t, result.User.Username)
+	require.NotNil(t, result.Challenge)
+	require.Equal(t, user.Username, result.Challenge.Username)
+	require.WithinDuration(t, c.now.Add(loginChallengeDuration), result.Challenge.ExpiresAt, time.Millisecond)
+	// the login is recorded once complete
+	require.Empty(t, listAttempts(t, a.store, user.Username))
+
+	code := c.nextCode(key)
+	got, err := a.LoginTOTP(ctx, result.Challenge.ID, code, client)
+	require.NoError(t, err)
+	require.Equal(t, user.Username, got.Username)
+	attempts := listAttempts(t, a.store, user.Username)
+	require.Len(t, attempts, 1)
+	require.True(t, attempts[0].Success)
+
+	// a challenge is answered once
+	_, err = a.LoginTOTP(ctx, result.Challenge.ID, c.nextCode(key), client)
+	require.ErrorIs(t, err, ErrInvalidCredentials)
+	_, err = a.LoginTOTP(ctx, uuid.New(), c.nextCode(key), client)
+	require.ErrorIs(t, err, ErrInvalidCredentials)
+
+	// a code is used once
+	result, err = a.Login(ctx, user.Username, password, client)
+	require.NoError(t, err)
+	_, err = a.LoginTOTP(ctx, result.Challenge.ID, code, client)
+	require.ErrorIs(t, err, ErrInvalidCredentials)
+
+	// an expired challenge is refused
+	result, err = a.Login(ctx, user.Username, password, client)
+	require.NoError(t, err)
+	c.now = c.now.Add(loginChallengeDuration)
+	_, err = a.LoginTOTP(ctx, result.Challenge.ID, c.nextCode(key), client)
+	require.ErrorIs(t, err, ErrInvalidCredentials)
+}
+
+func TestLoginTOTPFailures(t *testing.T) {
+	a, c := newTOTPAuthenticator(LockoutPolicy{MaxAttempts: 2, Duration: time.Hour})
+	user, password := createUser(t, a.store)
+	key, _ := enableTOTP(t, a, c, user.Username)
+	ctx := context.Background()
+
+	// a wrong code counts as a failed login and uses up the challenge
+	result, err := a.Login(ctx, user.Username, password, Client{})
+	require.NoError(t, err)
+	_, err = a.LoginTOTP(ctx, result.Challenge.ID, "000000", Client{})
+	require.ErrorIs(t, err, ErrInvalidCredentials)
+	_, err = a.LoginTOTP(ctx, result.Challenge.ID, c.nextCode(key), Client{})
+	require.ErrorIs(t, err, ErrInvalidCredentials)
+	got, err := a.store.GetUser(ctx, user.Username)
+	require.NoError(t, err)
+	require.Equal(t, int32(1), got.FailedLoginAttempts)
+	attempts := listAttempts(t, a.store, user.Username)
+	require.Len(t, attempts, 1)
+	require.False(t, attempts[0].Success)
+
+	// a challenge started before the user is locked out is refused after
+	pending, err := a.Login(ctx, user.Username, password, Client{})
+	require.NoError(t, err)
+	result, err = a.Login(ctx, user.Username, password, Client{})
+	require.NoError(t, err)
+	_, err = a.LoginTOTP(ctx, result.Challenge.ID, "not a code", Client{})
+	require.ErrorIs(t, err, ErrInvalidCredentials)
+	_, err = a.LoginTOTP(ctx, pending.Challenge.ID, c.nextCode(key), Client{})
+	require.ErrorIs(t, err, ErrInvalidCredentials)
+	got, err = a.store.GetUser(ctx, user.Username)
+	require.NoError(t, err)
+	require.Equal(t, int32(2), got.FailedLoginAttempts)
+	require.True(t, got.LockedUntil.After(c.now))
+
+	c.now = got.LockedUntil
+	result, err = a.Login(ctx, user.Username, password, Client{})
+	require.NoError(t, err)
+	_, err = a.LoginTOTP(ctx, result.Challenge.ID, c.nextCode(key), Client{})
+	require.NoError(t, err)
+	got, err = a.store.GetUser(ctx, user.Username)
+	require.NoError(t, err)
+	require.Zero(t, got.FailedLoginAttempts)
+}
+
+func TestLoginRecoveryCode(t *testing.T) {
+	a, c := newTOTPAuthenticator(LockoutPolicy{})
+	user, password := createUser(t, a.store)
+	_, codes := enableTOTP(t, a, c, user.Username)
+	ctx := context.Background()
+
+	// recovery codes may be typed in upper case and without the dash
+	code := strings.ToUpper(strings.ReplaceAll(codes[3], "-", ""))
+	result, err := a.Login(ctx, user.Username, password, Client{})
+	require.NoError(t, err)
+	got, err := a.LoginTOTP(ctx, result.Challenge.ID, code, Client{})
+	require.NoError(t, err)
+	require.Equal(t, user.Username, got.Username)
+	stored, err := a.store.ListRecoveryCodes(ctx, user.Username)
+	require.NoError(t, err)
+	require.Len(t, stored, recoveryCodeCount-1)
+
+	// a recovery code is used once
+	result, err = a.Login(ctx, user.Username, password, Client{})
+	require.NoError(t, err)
+	_, err = a.LoginTOTP(ctx, result.Challenge.ID, codes[3], Client{})
+	require.ErrorIs(t, err, ErrInvalidCredentials)
+}
+
+func TestVerifyTOTP(t *testing.T) {
+	a, c := newTOTPAuthenticator(LockoutPolicy{MaxAttempts: 2, Duration: time.Hour})
+	user, _ := createUser(t, a.store)
+	ctx := context.Background()
+
+	err := a.VerifyTOTP(ctx, user.Username, "123456")
+	require.ErrorIs(t, err, ErrTOTPNotEnabled)
+
+	key, codes := enableTOTP(t, a, c, user.Username)
+	err = a.VerifyTOTP(ctx, user.Username, "")
+	require.ErrorIs(t, err, ErrTOTPCodeRequired)
+
+	code := c.nextCode(key)
+	require.NoError(t, a.VerifyTOTP(ctx, user.Username, code))
+	err = a.VerifyTOTP(ctx, user.Username, code)
+	require.ErrorIs(t, err, ErrInvalidTOTPCode)
+	// recovery codes are for logins only
+	err = a.VerifyTOTP(ctx, user.Username, codes[0])
+	require.ErrorIs(t, err, ErrInvalidTOTPCode)
+
+	// wrong codes lock the user out
+	got, err := a.store.GetUser(ctx, user.Username)
+	require.NoError(t, err)
+	require.Equal(t, int32(2), got.FailedLoginAttempts)
+	err = a.VerifyTOTP(ctx, user.Username, c.nextCode(key))
+	require.ErrorIs(t, err, ErrInvalidTOTPCode)
+
+	err = a.VerifyTOTP(ctx, "missing"+util.RandomString(6), code)
+	require.ErrorIs(t, err, db.ErrRecordNotFound)
+}
@@ -0,0 +1,642 @@
+// Package client is a Go client of the Simple Bank HTTP API.
+//
+// The client logs in with the credentials given to Login and renews the
+// access token by logging in again shortly before it expires, or when the
+// server reports that it has expired. The users with two-factor
+// authentication enabled complete their login with LoginTOTP, and log in
+// again once the token expires. The server revokes the tokens of a user
+// whose password changes, which the client also handles by logging in again.
+// Batch jobs authenticate with an API key given to WithAPIKey instead, and
+// never log in. Requests that fail with a network error or a transient status
+// are retried with exponential backoff. The requests
+// creating resources carry an Idempotency-Key header that is the same for
+// every attempt, so a retry never creates a resource twice.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// DefaultMaxRetries is the number of times a failed request is retried
+	DefaultMaxRetries = 3
+	// DefaultBackoff is the delay before the first retry. It doubles with
+	// every retry.
+	DefaultBackoff = 200 * time.Millisecond
+	// DefaultTimeout bounds every attempt of the default HTTP client
+	DefaultTimeout = 30 * time.Second
+
+	// tokenRefreshMargin is how long before its expiry the access token is
+	// renewed
+	tokenRefreshMargin = 10 * time.Second
+)
+
+// Client calls the Simple Bank HTTP API. It is safe for concurrent use.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	maxRetries int
+	backoff    time.Duration
+	now        func() time.Time
+
+	apiKey string
+	scopes []string
+
+	mu          sync.Mutex
+	username    string
+	password    string
+	accessToken string
+	expiresAt   time.Time
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client used to send requests
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithMaxRetries sets the number of times a failed request is retried. Zero
+// disables retries.
+func WithMaxRetries(n int) Option {
+	return func(c *Client) {
+		c.maxRetries = n
+	}
+}
+
+// WithBackoff sets the delay before the first retry
+func WithBackoff(d time.Duration) Option {
+	return func(c *Client) {
+		c.backoff = d
+	}
+}
+
+// WithAPIKey authenticates the requests with an API key created by
+// CreateAPIKey, rather than the access token of a login
+func WithAPIKey(key string) Option {
+	return func(c *Client) {
+		c.apiKey = key
+	}
+}
+
+// WithScopes restricts the access tokens of the logins of the client to the
+// scopes, e.g. read-only scopes for a dashboard. The server answers
+// CodeInsufficientScope to the requests outside of them.
+func WithScopes(scopes ...string) Option {
+	return func(c *Client) {
+		c.scopes = scopes
+	}
+}
+
+// New creates a client of the API served at baseURL, e.g.
+// http://localhost:8080
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{Timeout: DefaultTimeout},
+		maxRetries: DefaultMaxRetries,
+		backoff:    DefaultBackoff,
+		now:        time.Now,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// CreateUser creates a new user. It does not log the client in.
+func (c *Client) CreateUser(ctx context.Context, req CreateUserRequest) (User, error) {
+	var user User
+	err := c.do(ctx, request{
+		method:     http.MethodPost,
+		path:       "/users",
+		body:       req,
+		idempotent: true,
+	}, &user)
+	return user, err
+}
+
+// Login authenticates the client as the given user. The credentials are kept
+// in memory to renew the access token when it expires.
+//
+// If the user has two-factor authentication enabled, Login returns
+// ErrTOTPRequired along with the challenge to answer with LoginTOTP.
+func (c *Client) Login(ctx context.Context, username, password string) (LoginResponse, error) {
+	var rsp LoginResponse
+	err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   "/users/login",
+		body: struct {
+			Username string   `json:"username"`
+			Password string   `json:"password"`
+			Scopes   []string `json:"scopes,omitempty"`
+		}{username, password, c.scopes},
+	}, &rsp)
+	if err != nil {
+		return LoginResponse{}, err
+	}
+	if rsp.TOTPChallenge != nil {
+		return rsp, ErrTOTPRequired
+	}
+
+	c.setLogin(username, password, rsp)
+	return rsp, nil
+}
+
+// LoginTOTP completes a login challenged by Login with a code of the
+// authenticator app of the user, or one of their recovery codes. The client
+// cannot renew the access token it gets, so once it expires the requests
+// fail with ErrTOTPRequired until the user logs in again.
+func (c *Client) LoginTOTP(ctx context.Context, challengeID uuid.UUID, code string) (LoginResponse, error) {
+	var rsp LoginResponse
+	err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   "/users/login/totp",
+		body: struct {
+			ChallengeID uuid.UUID `json:"challenge_id"`
+			Code        string    `json:"code"`
+			Scopes      []string  `json:"scopes,omitempty"`
+		}{challengeID, code, c.scopes},
+	}, &rsp)
+	if err != nil {
+		return LoginResponse{}, err
+	}
+
+	c.setLogin(rsp.User.Username, "", rsp)
+	return rsp, nil
+}
+
+// EnrollTOTP starts enabling two-factor authentication for the logged in
+// user, returning the secret to add to their authenticator app. Enrolling
+// again before ConfirmTOTP replaces the secret.
+func (c *Client) EnrollTOTP(ctx context.Context) (TOTPEnrollment, error) {
+	var enrollment TOTPEnrollment
+	err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   "/users/totp",
+		auth:   true,
+	}, &enrollment)
+	return enrollment, err
+}
+
+// ConfirmTOTP enables the two-factor authentication enrolled by EnrollTOTP
+// with a code of the authenticator app. It returns the recovery codes of the
+// user, which are not shown again.
+func (c *Client) ConfirmTOTP(ctx context.Context, code string) ([]string, error) {
+	var rsp struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   "/users/totp/confirm",
+		body: struct {
+			Code string `json:"code"`
+		}{code},
+		auth: true,
+	}, &rsp)
+	return rsp.RecoveryCodes, err
+}
+
+// GetUser returns the profile of the logged in user
+func (c *Client) GetUser(ctx context.Context) (User, error) {
+	var user User
+	err := c.do(ctx, request{
+		method: http.MethodGet,
+		path:   "/users/me",
+		auth:   true,
+	}, &user)
+	return user, err
+}
+
+// UpdateUser updates the full name or email of the logged in user. A new
+// email has to be verified again with VerifyEmail before creating accounts
+// and transfers.
+func (c *Client) UpdateUser(ctx context.Context, req UpdateUserRequest) (User, error) {
+	var user User
+	err := c.do(ctx, request{
+		method: http.MethodPatch,
+		path:   "/users/me",
+		body:   req,
+		auth:   true,
+	}, &user)
+	return user, err
+}
+
+// ChangePassword sets a new password for the logged in user. The server
+// revokes the access tokens of the user, so the client logs in again with the
+// new password on the next request. Users logged in by LoginTOTP have to log
+// in again themselves.
+func (c *Client) ChangePassword(ctx context.Context, currentPassword, newPassword string) (User, error) {
+	var user User
+	err := c.do(ctx, request{
+		method: http.MethodPut,
+		path:   "/users/me/password",
+		body: struct {
+			CurrentPassword string `json:"current_password"`
+			NewPassword     string `json:"new_password"`
+		}{currentPassword, newPassword},
+		auth: true,
+	}, &user)
+	if err != nil {
+		return User{}, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.password != "" {
+		c.password = newPassword
+	}
+	c.accessToken = ""
+	return user, nil
+}
+
+// RequestPasswordReset asks the server to email a password reset link to the
+// user with email. It succeeds whether a user has the email or not.
+func (c *Client) RequestPasswordReset(ctx context.Context, email string) error {
+	return c.do(ctx, request{
+		method: http.MethodPost,
+		path:   "/users/password_reset",
+		body: struct {
+			Email string `json:"email"`
+		}{email},
+	}, nil)
+}
+
+// ResetPassword sets a new password with the token of a password reset link.
+// It does not log the client in.
+func (c *Client) ResetPassword(ctx context.Context, resetToken, newPassword string) (User, error) {
+	var user User
+	err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   "/users/password_reset/confirm",
+		body: struct {
+			Token       string `json:"token"`
+			NewPassword string `json:"new_password"`
+		}{resetToken, newPassword},
+	}, &user)
+	return user, err
+}
+
+// VerifyEmail verifies the email of a user with the token of the link sent
+// on signup or by SendVerificationEmail. Accounts and transfers can only be
+// created once the email of the user is verified.
+func (c *Client) VerifyEmail(ctx context.Context, verificationToken string) (User, error) {
+	var user User
+	err := c.do(ctx, request{
+		method: http.MethodGet,
+		path:   "/users/verify_email",
+		query:  url.Values{"token": {verificationToken}},
+	}, &user)
+	return user, err
+}
+
+// SendVerificationEmail asks the server to email another verification link
+// to the logged in user
+func (c *Client) SendVerificationEmail(ctx context.Context) (EmailVerification, error) {
+	var verification EmailVerification
+	err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   "/users/verify_email",
+		auth:   true,
+	}, &verification)
+	return verification, err
+}
+
+// CreateAPIKey creates an API key for the logged in user. The server refuses
+// to manage API keys with an API key, so the client must be logged in.
+func (c *Client) CreateAPIKey(ctx context.Context, req CreateAPIKeyRequest) (NewAPIKey, error) {
+	var apiKey NewAPIKey
+	err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   "/users/me/api_keys",
+		body:   req,
+		auth:   true,
+	}, &apiKey)
+	return apiKey, err
+}
+
+// ListAPIKeys returns the API keys of the logged in user
+func (c *Client) ListAPIKeys(ctx context.Context) ([]APIKey, error) {
+	var apiKeys []APIKey
+	err := c.do(ctx, request{
+		method: http.MethodGet,
+		path:   "/users/me/api_keys",
+		auth:   true,
+	}, &apiKeys)
+	return apiKeys, err
+}
+
+// DeleteAPIKey revokes an API key of the logged in user
+func (c *Client) DeleteAPIKey(ctx context.Context, id int64) (APIKey, error) {
+	var apiKey APIKey
+	err := c.do(ctx, request{
+		method: http.MethodDelete,
+		path:   "/users/me/api_keys/" + strconv.FormatInt(id, 10),
+		auth:   true,
+	}, &apiKey)
+	return apiKey, err
+}
+
+// CreateAccount creates an account of the logged in user in currency
+func (c *Client) CreateAccount(ctx context.Context, currency string) (Account, error) {
+	c.mu.Lock()
+	owner := c.username
+	c.mu.Unlock()
+
+	var account Account
+	err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   "/accounts",
+		body: struct {
+			Owner    string `json:"owner"`
+			Currency string `json:"currency"`
+		}{owner, currency},
+		auth:       true,
+		idempotent: true,
+	}, &account)
+	return account, err
+}
+
+// GetAccount returns an account of the logged in user
+func (c *Client) GetAccount(ctx context.Context, id int64) (Account, error) {
+	var account Account
+	err := c.do(ctx, request{
+		method: http.MethodGet,
+		path:   "/accounts/" + strconv.FormatInt(id, 10),
+		auth:   true,
+	}, &account)
+	return account, err
+}
+
+// ListAccounts returns a page of the accounts of the logged in user
+func (c *Client) ListAccounts(ctx context.Context, req ListAccountsRequest) ([]Account, error) {
+	var accounts []Account
+	err := c.do(ctx, request{
+		method: http.MethodGet,
+		path:   "/accounts",
+		query: url.Values{
+			"page_id":   {strconv.FormatInt(int64(req.PageID), 10)},
+			"page_size": {strconv.FormatInt(int64(req.PageSize), 10)},
+		},
+		auth: true,
+	}, &accounts)
+	return accounts, err
+}
+
+// ListLoginAttempts returns a page of the login attempts of the logged in
+// user, most recent first
+func (c *Client) ListLoginAttempts(ctx context.Context, req ListLoginAttemptsRequest) ([]LoginAttempt, error) {
+	var attempts []LoginAttempt
+	err := c.do(ctx, request{
+		method: http.MethodGet,
+		path:   "/users/login_attempts",
+		query: url.Values{
+			"page_id":   {strconv.FormatInt(int64(req.PageID), 10)},
+			"page_size": {strconv.FormatInt(int64(req.PageSize), 10)},
+		},
+		auth: true,
+	}, &attempts)
+	return attempts, err
+}
+
+// CreateTransfer moves money from an account of the logged in user to
+// another account
+func (c *Client) CreateTransfer(ctx context.Context, req CreateTransferRequest) (TransferResult, error) {
+	var result TransferResult
+	err := c.do(ctx, request{
+		method:     http.MethodPost,
+		path:       "/transfers",
+		body:       req,
+		auth:       true,
+		idempotent: true,
+	}, &result)
+	return result, err
+}
+
+// request describes a call to the API
+type request struct {
+	method string
+	path   string
+	query  url.Values
+	body   interface{}
+	// auth sends the access token of the logged in user
+	auth bool
+	// idempotent sends an Idempotency-Key, so the request can be retried
+	// without being applied twice
+	idempotent bool
+}
+
+// retryable reports whether r may be sent again after a transient error.
+// Other requests may have been applied before the error, e.g. when the
+// response was lost, and sending them again could apply them twice.
+func (r request) retryable() bool {
+	return r.method == http.MethodGet || r.idempotent
+}
+
+// do sends r, retrying it while it fails with a transient error if it is
+// retryable, and decodes the response into out
+func (c *Client) do(ctx context.Context, r request, out interface{}) error {
+	var body []byte
+	if r.body != nil {
+		var err error
+		body, err = json.Marshal(r.body)
+		if err != nil {
+			return fmt.Errorf("cannot encode request: %w", err)
+		}
+	}
+	var key string
+	if r.idempotent {
+		key = uuid.NewString()
+	}
+
+	renewed := false
+	for attempt := 0; ; attempt++ {
+		err := c.send(ctx, r, body, key, out)
+		if r.auth && !renewed && (IsCode(err, CodeTokenExpired) || IsCode(err, CodeTokenRevoked)) {
+			// the token expired earlier than the client expected, e.g.
+			// because of clock skew, or was revoked by a password change,
+			// so log in again once
+			renewed = true
+			c.expireToken()
+			err = c.send(ctx, r, body, key, out)
+		}
+		if err == nil || !r.retryable() || attempt >= c.maxRetries || !isRetryable(err) || ctx.Err() != nil {
+			return err
+		}
+
+		timer := time.NewTimer(retryDelay(err, c.backoff<<attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// send makes a single attempt of r
+func (c *Client) send(ctx context.Context, r request, body []byte, key string, out interface{}) error {
+	u := c.baseURL + r.path
+	if len(r.query) > 0 {
+		u += "?" + r.query.Encode()
+	}
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, r.method, u, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if key != "" {
+		req.Header.Set("Idempotency-Key", key)
+	}
+	if r.auth && c.apiKey != "" {
+		req.Header.Set("Authorization", "ApiKey "+c.apiKey)
+	} else if r.auth {
+		accessToken, err := c.token(ctx)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+
+	rsp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	data, err := io.ReadAll(rsp.Body)
+	if err != nil {
+		return fmt.Errorf("cannot read response: %w", err)
+	}
+
+	if rsp.StatusCode < 200 || rsp.StatusCode > 299 {
+		apiErr := newError(rsp.StatusCode, data)
+		apiErr.RetryAfter = retryAfter(rsp.Header)
+		return apiErr
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("cannot decode response: %w", err)
+	}
+	return nil
+}
+
+// newError decodes an error response. Responses that are not an error of
+// the API, e.g. from a proxy, keep their body as the message.
+func newError(status int, body []byte) *Error {
+	apiErr := &Error{}
+	if err := json.Unmarshal(body, apiErr); err != nil || apiErr.Code == "" {
+		apiErr = &Error{Message: strings.TrimSpace(string(body))}
+		if apiErr.Message == "" {
+			apiErr.Message = http.StatusText(status)
+		}
+	}
+	apiErr.StatusCode = status
+	return apiErr
+}
+
+// retryAfter parses a Retry-After header given in seconds. Dates are not
+// sent by the API and are ignored.
+func retryAfter(header http.Header) time.Duration {
+	seconds, err := strconv.Atoi(header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// retryDelay is how long to wait before retrying a request that failed with
+// err: backoff, or longer if the server asked so
+func retryDelay(err error, backoff time.Duration) time.Duration {
+	var apiErr *Error
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > backoff {
+		return apiErr.RetryAfter
+	}
+	return backoff
+}
+
+// token returns the access token of the logged in user, logging in again
+// when it is about to expire
+func (c *Client) token(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	username, password := c.username, c.password
+	accessToken, expiresAt := c.accessToken, c.expiresAt
+	c.mu.Unlock()
+
+	if username == "" {
+		return "", ErrNotLoggedIn
+	}
+	if accessToken != "" && c.now().Before(expiresAt.Add(-tokenRefreshMargin)) {
+		return accessToken, nil
+	}
+	// logged in by LoginTOTP
+	if password == "" {
+		return "", fmt.Errorf("cannot renew access token: %w", ErrTOTPRequired)
+	}
+
+	rsp, err := c.Login(ctx, username, password)
+	if err != nil {
+		return "", fmt.Errorf("cannot renew access token: %w", err)
+	}
+	return rsp.AccessToken, nil
+}
+
+// setLogin keeps the access token of a login, and the credentials to renew
+// it
+func (c *Client) setLogin(username, password string, rsp LoginResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.username = username
+	c.password = password
+	c.accessToken = rsp.AccessToken
+	c.expiresAt = rsp.AccessTokenExpiresAt
+}
+
+// expireToken makes the next request log in again
+func (c *Client) expireToken() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.accessToken = ""
+}
+
+// isRetryable reports whether a request that failed with err may succeed if
+// sent again
+func isRetryable(err error) bool {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		switch apiErr.StatusCode {
+		case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		case http.StatusConflict:
+			return apiErr.Code == CodeIdempotencyKeyInProgress
+		}
+		return false
+	}
+	// the request did not get a response
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
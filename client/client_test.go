@@ -0,0 +1,733 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dpsigor/cheatsheet-golang-postgres/api"
+	"github.com/dpsigor/cheatsheet-golang-postgres/auth"
+	memdb "github.com/dpsigor/cheatsheet-golang-postgres/db/memory"
+	mockdb "github.com/dpsigor/cheatsheet-golang-postgres/db/mock"
+	db "github.com/dpsigor/cheatsheet-golang-postgres/db/sqlc"
+	"github.com/dpsigor/cheatsheet-golang-postgres/health"
+	"github.com/dpsigor/cheatsheet-golang-postgres/password"
+	"github.com/dpsigor/cheatsheet-golang-postgres/token"
+	"github.com/dpsigor/cheatsheet-golang-postgres/util"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
+
+// newTestHandler serves the API backed by store, issuing access tokens valid
+// for tokenDuration
+func newTestHandler(t *testing.T, store db.Store, tokenDuration time.Duration) http.Handler {
+	return newTestServer(t, store, util.Config{
+		TokenSymmetricKey:   util.RandomString(32),
+		AccessTokenDuration: tokenDuration,
+		MailDir:             t.TempDir(),
+	}).Handler()
+}
+
+// newTestServer creates the API server of config, which sends the emails
+// it queued before the test ends
+func newTestServer(t *testing.T, store db.Store, config util.Config) *api.Server {
+	tokenMaker, err := token.NewPasetoMaker(config.TokenSymmetricKey)
+	require.NoError(t, err)
+	server, err := api.NewServer(config, store, tokenMaker, zerolog.Nop(), nil, health.NewChecker(time.Second))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, server.Shutdown(context.Background()))
+	})
+	return server
+}
+
+// waitForLink waits for an email with a link to baseURL to be written in
+// dir, and returns the token of the link
+func waitForLink(t *testing.T, dir, baseURL string) string {
+	linkRegexp := regexp.MustCompile(regexp.QuoteMeta(baseURL) + `\?token=([A-Za-z0-9_-]+)`)
+	var token string
+	require.Eventually(t, func() bool {
+		files, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		for _, file := range files {
+			message, err := os.ReadFile(filepath.Join(dir, file.Name()))
+			require.NoError(t, err)
+			if match := linkRegexp.FindSubmatch(message); match != nil {
+				token = string(match[1])
+				return true
+			}
+		}
+		return false
+	}, time.Second, 10*time.Millisecond)
+	return token
+}
+
+func newTestClient(t *testing.T, handler http.Handler) *Client {
+	ts := httptest.NewServer(handler)
+	t.Cleanup(ts.Close)
+	return New(ts.URL, WithHTTPClient(ts.Client()), WithBackoff(time.Millisecond))
+}
+
+var testHasher = password.NewTestHasher()
+
+func randomUser(t *testing.T) (db.User, string) {
+	password := util.RandomString(10)
+	hashedPassword, err := testHasher.Hash(password)
+	require.NoError(t, err)
+	return db.User{
+		Username:       util.RandomOwner(),
+		HashedPassword: hashedPassword,
+		FullName:       util.RandomOwner(),
+		Email:          util.RandomEmail(),
+		Role:           util.DepositorRole,
+	}, password
+}
+
+func randomAccount(owner string) db.Account {
+	return db.Account{
+		ID:       util.RandomInt(1, 1000),
+		Owner:    owner,
+		Balance:  util.RandomMoney(),
+		Currency: util.USD,
+	}
+}
+
+// login logs c in as user, who is looked up in store once and whose login
+// is recorded. The user never changed their password, so the token stays
+// valid, and verified their email.
+func login(t *testing.T, c *Client, store *mockdb.MockStore, user db.User, password string) {
+	store.EXPECT().GetPasswordChangedAt(gomock.Any(), user.Username).AnyTimes()
+	store.EXPECT().IsEmailVerified(gomock.Any(), user.Username).AnyTimes().Return(true, nil)
+	store.EXPECT().GetUser(gomock.Any(), user.Username).Times(1).Return(user, nil)
+	store.EXPECT().CreateLoginAttempt(gomock.Any(), gomock.Any()).Times(1)
+	_, err := c.Login(context.Background(), user.Username, password)
+	require.NoError(t, err)
+}
+
+func TestCreateUser(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	store := mockdb.NewMockStore(ctrl)
+	c := newTestClient(t, newTestHandler(t, store, time.Minute))
+	user, password := randomUser(t)
+	req := CreateUserRequest{
+		Username: user.Username,
+		Password: password,
+		FullName: user.FullName,
+		Email:    user.Email,
+	}
+
+	store.EXPECT().CreateIdempotencyKey(gomock.Any(), gomock.Any()).Times(2).Return(db.IdempotencyKey{}, nil)
+	store.EXPECT().SetIdempotencyKeyResponse(gomock.Any(), gomock.Any()).Times(2).Return(nil)
+	gomock.InOrder(
+		store.EXPECT().CreateUser(gomock.Any(), gomock.Any()).Times(1).Return(user, nil),
+		store.EXPECT().CreateUser(gomock.Any(), gomock.Any()).Times(1).Return(db.User{}, db.ErrDuplicateEmail),
+	)
+	store.EXPECT().CreateVerifyEmail(gomock.Any(), gomock.Any()).Times(1)
+
+	got, err := c.CreateUser(context.Background(), req)
+	require.NoError(t, err)
+	require.Equal(t, user.Username, got.Username)
+	require.Equal(t, user.Email, got.Email)
+
+	_, err = c.CreateUser(context.Background(), req)
+	var apiErr *Error
+	require.ErrorAs(t, err, &apiErr)
+	require.Equal(t, http.StatusConflict, apiErr.StatusCode)
+	require.Equal(t, CodeEmailTaken, apiErr.Code)
+	require.NotEmpty(t, apiErr.RequestID)
+	require.True(t, IsCode(err, CodeEmailTaken))
+}
+
+func TestLogin(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	store := mockdb.NewMockStore(ctrl)
+	c := newTestClient(t, newTestHandler(t, store, time.Minute))
+	user, password := randomUser(t)
+
+	store.EXPECT().GetUser(gomock.Any(), user.Username).Times(1).Return(user, nil)
+	store.EXPECT().CreateLoginAttempt(gomock.Any(), gomock.Any()).Times(1)
+	_, err := c.Login(context.Background(), user.Username, "wrong-password")
+	require.True(t, IsCode(err, CodeInvalidCredentials))
+
+	_, err = c.GetAccount(context.Background(), 1)
+	require.ErrorIs(t, err, ErrNotLoggedIn)
+
+	store.EXPECT().GetUser(gomock.Any(), user.Username).Times(1).Return(user, nil)
+	store.EXPECT().CreateLoginAttempt(gomock.Any(), gomock.Any()).Times(1)
+	rsp, err := c.Login(context.Background(), user.Username, password)
+	require.NoError(t, err)
+	require.NotEmpty(t, rsp.AccessToken)
+	require.WithinDuration(t, time.Now().Add(time.Minute), rsp.AccessTokenExpiresAt, time.Second)
+	require.Equal(t, user.Username, rsp.User.Username)
+}
+
+func TestListLoginAttempts(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	store := mockdb.NewMockStore(ctrl)
+	c := newTestClient(t, newTestHandler(t, store, time.Minute))
+	user, password := randomUser(t)
+	login(t, c, store, user, password)
+
+	attempt := db.LoginAttempt{ID: 1, Username: user.Username, IpAddress: "127.0.0.1", UserAgent: "Go-http-client/1.1", Success: true}
+	store.EXPECT().
+		ListLoginAttempts(gomock.Any(), db.ListLoginAttemptsParams{Username: user.Username, Limit: 5, Offset: 0}).
+		Times(1).
+		Return([]db.LoginAttempt{attempt}, nil)
+	attempts, err := c.ListLoginAttempts(context.Background(), ListLoginAttemptsRequest{PageID: 1, PageSize: 5})
+	require.NoError(t, err)
+	require.Len(t, attempts, 1)
+	require.Equal(t, attempt.IpAddress, attempts[0].IPAddress)
+	require.True(t, attempts[0].Success)
+}
+
+func TestAccounts(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	store := mockdb.NewMockStore(ctrl)
+	c := newTestClient(t, newTestHandler(t, store, time.Minute))
+	user, password := randomUser(t)
+	login(t, c, store, user, password)
+	account := randomAccount(user.Username)
+
+	store.EXPECT().CreateIdempotencyKey(gomock.Any(), gomock.Any()).Times(1).Return(db.IdempotencyKey{}, nil)
+	store.EXPECT().SetIdempotencyKeyResponse(gomock.Any(), gomock.Any()).Times(1).Return(nil)
+	store.EXPECT().
+		CreateAccount(gomock.Any(), db.CreateAccountParams{Owner: user.Username, Currency: util.USD}).
+		Times(1).
+		Return(account, nil)
+	created, err := c.CreateAccount(context.Background(), util.USD)
+	require.NoError(t, err)
+	require.Equal(t, account.ID, created.ID)
+	require.Equal(t, account.Balance, created.Balance)
+
+	store.EXPECT().GetAccount(gomock.Any(), account.ID).Times(1).Return(account, nil)
+	got, err := c.GetAccount(context.Background(), account.ID)
+	require.NoError(t, err)
+	require.Equal(t, created, got)
+
+	store.EXPECT().GetAccount(gomock.Any(), account.ID+1).Times(1).Return(db.Account{}, db.ErrRecordNotFound)
+	_, err = c.GetAccount(context.Background(), account.ID+1)
+	require.True(t, IsCode(err, CodeAccountNotFound))
+
+	store.EXPECT().
+		ListAccounts(gomock.Any(), db.ListAccountsParams{Owner: user.Username, Limit: 5, Offset: 5}).
+		Times(1).
+		Return([]db.Account{account}, nil)
+	accounts, err := c.ListAccounts(context.Background(), ListAccountsRequest{PageID: 2, PageSize: 5})
+	require.NoError(t, err)
+	require.Equal(t, []Account{got}, accounts)
+
+	_, err = c.ListAccounts(context.Background(), ListAccountsRequest{PageID: 1, PageSize: 50})
+	var apiErr *Error
+	require.ErrorAs(t, err, &apiErr)
+	require.Equal(t, CodeInvalidRequest, apiErr.Code)
+	require.Equal(t, "page_size", apiErr.Details[0].Field)
+}
+
+// TestCreateTransferRetry loses the response of the first attempt, so the
+// retry is answered with the stored response instead of transferring twice
+func TestCreateTransferRetry(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	store := mockdb.NewMockStore(ctrl)
+	handler := newTestHandler(t, store, time.Minute)
+	var transfers int32
+	var keys []string
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/transfers" {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		keys = append(keys, r.Header.Get("Idempotency-Key"))
+		if atomic.AddInt32(&transfers, 1) == 1 {
+			handler.ServeHTTP(httptest.NewRecorder(), r)
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	user, password := randomUser(t)
+	login(t, c, store, user, password)
+	from := randomAccount(user.Username)
+	to := randomAccount(util.RandomOwner())
+	to.ID = from.ID + 1
+
+	var stored db.IdempotencyKey
+	gomock.InOrder(
+		store.EXPECT().
+			CreateIdempotencyKey(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, arg db.CreateIdempotencyKeyParams) (db.IdempotencyKey, error) {
+				stored = db.IdempotencyKey{Scope: arg.Scope, Key: arg.Key, RequestHash: arg.RequestHash}
+				return stored, nil
+			}),
+		store.EXPECT().
+			CreateIdempotencyKey(gomock.Any(), gomock.Any()).
+			Return(db.IdempotencyKey{}, db.ErrRecordNotFound),
+	)
+	store.EXPECT().
+		SetIdempotencyKeyResponse(gomock.Any(), gomock.Any()).
+		Times(1).
+		DoAndReturn(func(_ context.Context, arg db.SetIdempotencyKeyResponseParams) error {
+			stored.ResponseStatus = arg.ResponseStatus
+			stored.ResponseBody = arg.ResponseBody
+			return nil
+		})
+	store.EXPECT().
+		GetIdempotencyKey(gomock.Any(), gomock.Any()).
+		Times(1).
+		DoAndReturn(func(_ context.Context, arg db.GetIdempotencyKeyParams) (db.IdempotencyKey, error) {
+			return stored, nil
+		})
+	store.EXPECT().GetAccount(gomock.Any(), from.ID).Times(1).Return(from, nil)
+	store.EXPECT().GetAccount(gomock.Any(), to.ID).Times(1).Return(to, nil)
+	store.EXPECT().
+		TransferTx(gomock.Any(), db.TransferTxParams{FromAccountID: from.ID, ToAccountID: to.ID, Amount: 10}).
+		Times(1).
+		Return(db.TransferTxResult{
+			Transfer:    db.Transfer{ID: 7, FromAccountID: from.ID, ToAccountID: to.ID, Amount: 10},
+			FromAccount: from,
+			ToAccount:   to,
+		}, nil)
+
+	result, err := c.CreateTransfer(context.Background(), CreateTransferRequest{
+		FromAccountID: from.ID,
+		ToAccountID:   to.ID,
+		Amount:        10,
+		Currency:      util.USD,
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(7), result.Transfer.ID)
+	require.Equal(t, from.ID, result.FromAccount.ID)
+	require.Len(t, keys, 2)
+	require.NotEmpty(t, keys[0])
+	require.Equal(t, keys[0], keys[1])
+}
+
+func TestRetriesExhausted(t *testing.T) {
+	var attempts int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		http.Error(w, "upstream unavailable", http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+	c := New(ts.URL, WithHTTPClient(ts.Client()), WithAPIKey("sb_key_secret"), WithMaxRetries(2), WithBackoff(time.Millisecond))
+
+	_, err := c.GetAccount(context.Background(), 1)
+	var apiErr *Error
+	require.ErrorAs(t, err, &apiErr)
+	require.Equal(t, http.StatusServiceUnavailable, apiErr.StatusCode)
+	require.Equal(t, "upstream unavailable", apiErr.Message)
+	require.Equal(t, int32(3), atomic.LoadInt32(&attempts))
+}
+
+func TestNoRetryNotIdempotent(t *testing.T) {
+	var attempts int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		http.Error(w, "upstream unavailable", http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+	c := New(ts.URL, WithHTTPClient(ts.Client()), WithMaxRetries(2), WithBackoff(time.Millisecond))
+
+	// the login may have been counted before the response was lost
+	_, err := c.Login(context.Background(), util.RandomOwner(), util.RandomString(10))
+	var apiErr *Error
+	require.ErrorAs(t, err, &apiErr)
+	require.Equal(t, http.StatusServiceUnavailable, apiErr.StatusCode)
+	require.Equal(t, int32(1), atomic.LoadInt32(&attempts))
+}
+
+func TestRetryAfter(t *testing.T) {
+	var attempts int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"code":"rate_limited","message":"too many requests"}`))
+			return
+		}
+		w.Write([]byte(`{"id":1}`))
+	}))
+	defer ts.Close()
+	c := New(ts.URL, WithHTTPClient(ts.Client()), WithAPIKey("sb_key_secret"), WithBackoff(time.Millisecond))
+
+	start := time.Now()
+	_, err := c.GetAccount(context.Background(), 1)
+	require.NoError(t, err)
+	require.Equal(t, int32(2), atomic.LoadInt32(&attempts))
+	require.GreaterOrEqual(t, time.Since(start), time.Second)
+}
+
+func TestTokenRefresh(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	store := mockdb.NewMockStore(ctrl)
+	c := newTestClient(t, newTestHandler(t, store, time.Minute))
+	user, password := randomUser(t)
+	login(t, c, store, user, password)
+	account := randomAccount(user.Username)
+	store.EXPECT().GetAccount(gomock.Any(), account.ID).AnyTimes().Return(account, nil)
+
+	_, err := c.GetAccount(context.Background(), account.ID)
+	require.NoError(t, err)
+
+	// the token is about to expire, so the client logs in before the request
+	c.now = func() time.Time { return time.Now().Add(time.Minute - tokenRefreshMargin/2) }
+	store.EXPECT().GetUser(gomock.Any(), user.Username).Times(1).Return(user, nil)
+	store.EXPECT().CreateLoginAttempt(gomock.Any(), gomock.Any()).Times(1)
+	_, err = c.GetAccount(context.Background(), account.ID)
+	require.NoError(t, err)
+}
+
+func TestExpiredTokenRelogin(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	store := mockdb.NewMockStore(ctrl)
+	// the server issues tokens that are already expired
+	c := newTestClient(t, newTestHandler(t, store, -time.Minute))
+	c.now = func() time.Time { return time.Now().Add(-time.Hour) }
+	user, password := randomUser(t)
+	login(t, c, store, user, password)
+
+	// the client logs in again once, and then gives up
+	store.EXPECT().GetUser(gomock.Any(), user.Username).Times(1).Return(user, nil)
+	store.EXPECT().CreateLoginAttempt(gomock.Any(), gomock.Any()).Times(1)
+	_, err := c.GetAccount(context.Background(), 1)
+	var apiErr *Error
+	require.ErrorAs(t, err, &apiErr)
+	require.Equal(t, http.StatusUnauthorized, apiErr.StatusCode)
+	require.Equal(t, CodeTokenExpired, apiErr.Code)
+}
+
+func TestLoginTOTP(t *testing.T) {
+	store := memdb.NewStore()
+	c := newTestClient(t, newTestHandler(t, store, time.Minute))
+	ctx := context.Background()
+	req := CreateUserRequest{
+		Username: util.RandomOwner() + util.RandomString(6),
+		Password: util.RandomString(10),
+		FullName: util.RandomOwner(),
+		Email:    util.RandomEmail(),
+	}
+	_, err := c.CreateUser(ctx, req)
+	require.NoError(t, err)
+	_, err = c.Login(ctx, req.Username, req.Password)
+	require.NoError(t, err)
+
+	enrollment, err := c.EnrollTOTP(ctx)
+	require.NoError(t, err)
+	// the codes of the previous and current periods are both accepted, and
+	// each is used once
+	now := time.Now()
+	if left := 30*time.Second - now.Sub(now.Truncate(30*time.Second)); left < 5*time.Second {
+		time.Sleep(left)
+		now = time.Now()
+	}
+	previous, err := auth.GenerateTOTPCode(enrollment.Secret, now.Add(-30*time.Second))
+	require.NoError(t, err)
+	current, err := auth.GenerateTOTPCode(enrollment.Secret, now)
+	require.NoError(t, err)
+	recoveryCodes, err := c.ConfirmTOTP(ctx, previous)
+	require.NoError(t, err)
+	require.NotEmpty(t, recoveryCodes)
+
+	rsp, err := c.Login(ctx, req.Username, req.Password)
+	require.ErrorIs(t, err, ErrTOTPRequired)
+	require.NotNil(t, rsp.TOTPChallenge)
+	_, err = c.LoginTOTP(ctx, rsp.TOTPChallenge.ID, previous)
+	require.True(t, IsCode(err, CodeInvalidCredentials))
+
+	rsp, err = c.Login(ctx, req.Username, req.Password)
+	require.ErrorIs(t, err, ErrTOTPRequired)
+	rsp, err = c.LoginTOTP(ctx, rsp.TOTPChallenge.ID, current)
+	require.NoError(t, err)
+	require.Equal(t, req.Username, rsp.User.Username)
+	_, err = c.ListAccounts(ctx, ListAccountsRequest{PageID: 1, PageSize: 5})
+	require.NoError(t, err)
+
+	// the token cannot be renewed without a code
+	c.now = func() time.Time { return time.Now().Add(time.Minute) }
+	_, err = c.ListAccounts(ctx, ListAccountsRequest{PageID: 1, PageSize: 5})
+	require.ErrorIs(t, err, ErrTOTPRequired)
+}
+
+func TestChangePassword(t *testing.T) {
+	store := memdb.NewStore()
+	c := newTestClient(t, newTestHandler(t, store, time.Minute))
+	other := newTestClient(t, newTestHandler(t, store, time.Minute))
+	ctx := context.Background()
+	req := CreateUserRequest{
+		Username: util.RandomOwner() + util.RandomString(6),
+		Password: util.RandomString(10),
+		FullName: util.RandomOwner(),
+		Email:    util.RandomEmail(),
+	}
+	_, err := c.CreateUser(ctx, req)
+	require.NoError(t, err)
+	_, err = c.Login(ctx, req.Username, req.Password)
+	require.NoError(t, err)
+	_, err = other.Login(ctx, req.Username, req.Password)
+	require.NoError(t, err)
+
+	_, err = c.ChangePassword(ctx, "wrong-password", util.RandomString(10))
+	require.True(t, IsCode(err, CodeInvalidCredentials))
+	newPassword := util.RandomString(10)
+	user, err := c.ChangePassword(ctx, req.Password, newPassword)
+	require.NoError(t, err)
+	require.Equal(t, req.Username, user.Username)
+
+	// the client logs in again with the new password
+	_, err = c.ListAccounts(ctx, ListAccountsRequest{PageID: 1, PageSize: 5})
+	require.NoError(t, err)
+	// the token of the other client was revoked, and its password is wrong
+	_, err = other.ListAccounts(ctx, ListAccountsRequest{PageID: 1, PageSize: 5})
+	require.True(t, IsCode(err, CodeInvalidCredentials))
+}
+
+func TestResetPassword(t *testing.T) {
+	dir := t.TempDir()
+	server := newTestServer(t, memdb.NewStore(), util.Config{
+		TokenSymmetricKey:    util.RandomString(32),
+		AccessTokenDuration:  time.Minute,
+		MailDir:              dir,
+		PasswordResetURL:     "http://localhost/reset-password",
+		EmailVerificationURL: "http://localhost/verify-email",
+	})
+	c := newTestClient(t, server.Handler())
+	ctx := context.Background()
+	req := CreateUserRequest{
+		Username: util.RandomOwner() + util.RandomString(6),
+		Password: util.RandomString(10),
+		FullName: util.RandomOwner(),
+		Email:    util.RandomEmail(),
+	}
+	_, err := c.CreateUser(ctx, req)
+	require.NoError(t, err)
+	// resets are only sent to verified emails
+	_, err = c.VerifyEmail(ctx, waitForLink(t, dir, "http://localhost/verify-email"))
+	require.NoError(t, err)
+
+	require.NoError(t, c.RequestPasswordReset(ctx, "unknown"+req.Email))
+	require.NoError(t, c.RequestPasswordReset(ctx, req.Email))
+	resetToken := waitForLink(t, dir, "http://localhost/reset-password")
+
+	_, err = c.ResetPassword(ctx, "wrong", util.RandomString(10))
+	require.True(t, IsCode(err, CodeInvalidResetToken))
+	newPassword := util.RandomString(10)
+	user, err := c.ResetPassword(ctx, resetToken, newPassword)
+	require.NoError(t, err)
+	require.Equal(t, req.Username, user.Username)
+
+	_, err = c.Login(ctx, req.Username, newPassword)
+	require.NoError(t, err)
+}
+
+func TestVerifyEmail(t *testing.T) {
+	dir := t.TempDir()
+	server := newTestServer(t, memdb.NewStore(), util.Config{
+		TokenSymmetricKey:    util.RandomString(32),
+		AccessTokenDuration:  time.Minute,
+		MailDir:              dir,
+		EmailVerificationURL: "http://localhost/verify-email",
+	})
+	c := newTestClient(t, server.Handler())
+	ctx := context.Background()
+	req := CreateUserRequest{
+		Username: util.RandomOwner() + util.RandomString(6),
+		Password: util.RandomString(10),
+		FullName: util.RandomOwner(),
+		Email:    util.RandomEmail(),
+	}
+	user, err := c.CreateUser(ctx, req)
+	require.NoError(t, err)
+	require.False(t, user.IsEmailVerified)
+	_, err = c.Login(ctx, req.Username, req.Password)
+	require.NoError(t, err)
+
+	_, err = c.CreateAccount(ctx, util.USD)
+	require.True(t, IsCode(err, CodeEmailNotVerified))
+	verification, err := c.SendVerificationEmail(ctx)
+	require.NoError(t, err)
+	require.Equal(t, req.Email, verification.Email)
+	require.True(t, verification.ExpiresAt.After(time.Now()))
+
+	_, err = c.VerifyEmail(ctx, "wrong")
+	require.True(t, IsCode(err, CodeInvalidVerificationToken))
+	user, err = c.VerifyEmail(ctx, waitForLink(t, dir, "http://localhost/verify-email"))
+	require.NoError(t, err)
+	require.True(t, user.IsEmailVerified)
+
+	_, err = c.CreateAccount(ctx, util.USD)
+	require.NoError(t, err)
+	_, err = c.SendVerificationEmail(ctx)
+	require.True(t, IsCode(err, CodeEmailAlreadyVerified))
+}
+
+func TestUpdateUser(t *testing.T) {
+	dir := t.TempDir()
+	server := newTestServer(t, memdb.NewStore(), util.Config{
+		TokenSymmetricKey:    util.RandomString(32),
+		AccessTokenDuration:  time.Minute,
+		MailDir:              dir,
+		EmailVerificationURL: "http://localhost/verify-email",
+	})
+	c := newTestClient(t, server.Handler())
+	ctx := context.Background()
+	req := CreateUserRequest{
+		Username: util.RandomOwner() + util.RandomString(6),
+		Password: util.RandomString(10),
+		FullName: util.RandomOwner(),
+		Email:    util.RandomEmail(),
+	}
+	_, err := c.CreateUser(ctx, req)
+	require.NoError(t, err)
+	_, err = c.Login(ctx, req.Username, req.Password)
+	require.NoError(t, err)
+
+	user, err := c.GetUser(ctx)
+	require.NoError(t, err)
+	require.Equal(t, req.Username, user.Username)
+	require.Equal(t, req.FullName, user.FullName)
+
+	fullName := util.RandomOwner()
+	user, err = c.UpdateUser(ctx, UpdateUserRequest{FullName: &fullName})
+	require.NoError(t, err)
+	require.Equal(t, fullName, user.FullName)
+	require.Equal(t, req.Email, user.Email)
+	email := util.RandomEmail()
+	_, err = c.UpdateUser(ctx, UpdateUserRequest{Email: &email, CurrentPassword: "wrong-password"})
+	require.True(t, IsCode(err, CodeInvalidCredentials))
+	user, err = c.UpdateUser(ctx, UpdateUserRequest{Email: &email, CurrentPassword: req.Password})
+	require.NoError(t, err)
+	require.Equal(t, email, user.Email)
+	require.Equal(t, fullName, user.FullName)
+
+	_, err = c.UpdateUser(ctx, UpdateUserRequest{})
+	require.True(t, IsCode(err, CodeInvalidRequest))
+}
+
+func TestAPIKeys(t *testing.T) {
+	c := newTestClient(t, newTestHandler(t, memdb.NewStore(), time.Minute))
+	ctx := context.Background()
+	req := CreateUserRequest{
+		Username: util.RandomOwner() + util.RandomString(6),
+		Password: util.RandomString(10),
+		FullName: util.RandomOwner(),
+		Email:    util.RandomEmail(),
+	}
+	_, err := c.CreateUser(ctx, req)
+	require.NoError(t, err)
+	_, err = c.Login(ctx, req.Username, req.Password)
+	require.NoError(t, err)
+
+	created, err := c.CreateAPIKey(ctx, CreateAPIKeyRequest{Name: "batch", Scopes: []string{"users:read"}})
+	require.NoError(t, err)
+	require.NotEmpty(t, created.Key)
+	require.Equal(t, []string{"users:read"}, created.APIKey.Scopes)
+	require.Nil(t, created.APIKey.ExpiresAt)
+
+	keyed := New(c.baseURL, WithHTTPClient(c.httpClient), WithBackoff(time.Millisecond), WithAPIKey(created.Key))
+	user, err := keyed.GetUser(ctx)
+	require.NoError(t, err)
+	require.Equal(t, req.Username, user.Username)
+	_, err = keyed.ListAccounts(ctx, ListAccountsRequest{PageID: 1, PageSize: 5})
+	require.True(t, IsCode(err, CodeInsufficientScope))
+	// API keys cannot mint API keys
+	_, err = keyed.CreateAPIKey(ctx, CreateAPIKeyRequest{Name: "other"})
+	require.True(t, IsCode(err, CodeForbidden))
+
+	apiKeys, err := c.ListAPIKeys(ctx)
+	require.NoError(t, err)
+	require.Len(t, apiKeys, 1)
+	require.Equal(t, created.APIKey.ID, apiKeys[0].ID)
+	require.NotNil(t, apiKeys[0].LastUsedAt)
+
+	deleted, err := c.DeleteAPIKey(ctx, created.APIKey.ID)
+	require.NoError(t, err)
+	require.Equal(t, created.APIKey.Prefix, deleted.Prefix)
+	_, err = keyed.GetUser(ctx)
+	require.True(t, IsCode(err, CodeAPIKeyInvalid))
+	_, err = c.DeleteAPIKey(ctx, created.APIKey.ID)
+	require.True(t, IsCode(err, CodeAPIKeyNotFound))
+}
+
+func TestScopes(t *testing.T) {
+	c := newTestClient(t, newTestHandler(t, memdb.NewStore(), time.Minute))
+	ctx := context.Background()
+	req := CreateUserRequest{
+		Username: util.RandomOwner() + util.RandomString(6),
+		Password: util.RandomString(10),
+		FullName: util.RandomOwner(),
+		Email:    util.RandomEmail(),
+	}
+	_, err := c.CreateUser(ctx, req)
+	require.NoError(t, err)
+
+	readOnly := New(c.baseURL, WithHTTPClient(c.httpClient), WithBackoff(time.Millisecond), WithScopes("users:read", "accounts:read"))
+	rsp, err := readOnly.Login(ctx, req.Username, req.Password)
+	require.NoError(t, err)
+	require.Equal(t, []string{"users:read", "accounts:read"}, rsp.Scopes)
+
+	user, err := readOnly.GetUser(ctx)
+	require.NoError(t, err)
+	require.Equal(t, req.Username, user.Username)
+	fullName := util.RandomOwner()
+	_, err = readOnly.UpdateUser(ctx, UpdateUserRequest{FullName: &fullName})
+	require.True(t, IsCode(err, CodeInsufficientScope))
+}
+
+func TestErrorCodes(t *testing.T) {
+	codes := map[ErrorCode]api.ErrorCode{
+		CodeInvalidRequest:           api.CodeInvalidRequest,
+		CodeAuthorizationMissing:     api.CodeAuthorizationMissing,
+		CodeAuthorizationInvalid:     api.CodeAuthorizationInvalid,
+		CodeTokenExpired:             api.CodeTokenExpired,
+		CodeTokenInvalid:             api.CodeTokenInvalid,
+		CodeTokenRevoked:             api.CodeTokenRevoked,
+		CodeInvalidCredentials:       api.CodeInvalidCredentials,
+		CodeForbidden:                api.CodeForbidden,
+		CodeInsufficientScope:        api.CodeInsufficientScope,
+		CodeNotFound:                 api.CodeNotFound,
+		CodeUserNotFound:             api.CodeUserNotFound,
+		CodeAccountNotFound:          api.CodeAccountNotFound,
+		CodeAlreadyExists:            api.CodeAlreadyExists,
+		CodeUsernameTaken:            api.CodeUsernameTaken,
+		CodeEmailTaken:               api.CodeEmailTaken,
+		CodeAccountExists:            api.CodeAccountExists,
+		CodeInvalidReference:         api.CodeInvalidReference,
+		CodeCurrencyMismatch:         api.CodeCurrencyMismatch,
+		CodeAccountFrozen:            api.CodeAccountFrozen,
+		CodeAmountOutOfRange:         api.CodeAmountOutOfRange,
+		CodeIdempotencyKeyReused:     api.CodeIdempotencyKeyReused,
+		CodeIdempotencyKeyInProgress: api.CodeIdempotencyKeyInProgress,
+		CodeRateLimited:              api.CodeRateLimited,
+		CodeTOTPRequired:             api.CodeTOTPRequired,
+		CodeTOTPNotEnabled:           api.CodeTOTPNotEnabled,
+		CodeInvalidTOTPCode:          api.CodeInvalidTOTPCode,
+		CodeTOTPAlreadyEnabled:       api.CodeTOTPAlreadyEnabled,
+		CodeTOTPNotEnrolled:          api.CodeTOTPNotEnrolled,
+		CodeInvalidResetToken:        api.CodeInvalidResetToken,
+		CodeEmailNotVerified:         api.CodeEmailNotVerified,
+		CodeEmailAlreadyVerified:     api.CodeEmailAlreadyVerified,
+		CodeInvalidVerificationToken: api.CodeInvalidVerificationToken,
+		CodeAPIKeyInvalid:            api.CodeAPIKeyInvalid,
+		CodeAPIKeyNotFound:           api.CodeAPIKeyNotFound,
+		CodeInvalidOAuthClient:       api.CodeInvalidOAuthClient,
+		CodeInvalidRedirectURI:       api.CodeInvalidRedirectURI,
+		CodeInvalidOAuthScope:        api.CodeInvalidOAuthScope,
+		CodeInvalidCodeChallenge:     api.CodeInvalidCodeChallenge,
+		CodeInternal:                 api.CodeInternal,
+	}
+	for clientCode, apiCode := range codes {
+		require.Equal(t, string(apiCode), string(clientCode))
+	}
+}
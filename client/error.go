@@ -0,0 +1,94 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrorCode is a stable, machine-readable identifier of an error returned by
+// the API
+type ErrorCode string
+
+// Error codes returned by the API
+const (
+	CodeInvalidRequest           ErrorCode = "invalid_request"
+	CodeAuthorizationMissing     ErrorCode = "authorization_missing"
+	CodeAuthorizationInvalid     ErrorCode = "authorization_invalid"
+	CodeTokenExpired             ErrorCode = "token_expired"
+	CodeTokenInvalid             ErrorCode = "token_invalid"
+	CodeTokenRevoked             ErrorCode = "token_revoked"
+	CodeInvalidCredentials       ErrorCode = "invalid_credentials"
+	CodeForbidden                ErrorCode = "forbidden"
+	CodeInsufficientScope        ErrorCode = "insufficient_scope"
+	CodeNotFound                 ErrorCode = "not_found"
+	CodeUserNotFound             ErrorCode = "user_not_found"
+	CodeAccountNotFound          ErrorCode = "account_not_found"
+	CodeAlreadyExists            ErrorCode = "already_exists"
+	CodeUsernameTaken            ErrorCode = "username_taken"
+	CodeEmailTaken               ErrorCode = "email_taken"
+	CodeAccountExists            ErrorCode = "account_exists"
+	CodeInvalidReference         ErrorCode = "invalid_reference"
+	CodeCurrencyMismatch         ErrorCode = "currency_mismatch"
+	CodeAccountFrozen            ErrorCode = "account_frozen"
+	CodeAmountOutOfRange         ErrorCode = "amount_out_of_range"
+	CodeIdempotencyKeyReused     ErrorCode = "idempotency_key_reused"
+	CodeIdempotencyKeyInProgress ErrorCode = "idempotency_key_in_progress"
+	CodeRateLimited              ErrorCode = "rate_limited"
+	CodeTOTPRequired             ErrorCode = "totp_required"
+	CodeTOTPNotEnabled           ErrorCode = "totp_not_enabled"
+	CodeInvalidTOTPCode          ErrorCode = "invalid_totp_code"
+	CodeTOTPAlreadyEnabled       ErrorCode = "totp_already_enabled"
+	CodeTOTPNotEnrolled          ErrorCode = "totp_not_enrolled"
+	CodeInvalidResetToken        ErrorCode = "invalid_reset_token"
+	CodeEmailNotVerified         ErrorCode = "email_not_verified"
+	CodeEmailAlreadyVerified     ErrorCode = "email_already_verified"
+	CodeInvalidVerificationToken ErrorCode = "invalid_verification_token"
+	CodeAPIKeyInvalid            ErrorCode = "api_key_invalid"
+	CodeAPIKeyNotFound           ErrorCode = "api_key_not_found"
+	CodeInvalidOAuthClient       ErrorCode = "invalid_oauth_client"
+	CodeInvalidRedirectURI       ErrorCode = "invalid_redirect_uri"
+	CodeInvalidOAuthScope        ErrorCode = "invalid_oauth_scope"
+	CodeInvalidCodeChallenge     ErrorCode = "invalid_code_challenge"
+	CodeInternal                 ErrorCode = "internal"
+)
+
+// ErrNotLoggedIn is returned by the methods that need an access token when
+// Login was not called, nor an API key given with WithAPIKey
+var ErrNotLoggedIn = errors.New("client is not logged in")
+
+// ErrTOTPRequired is returned by Login when the user has two-factor
+// authentication enabled, and the login is completed by LoginTOTP. It is
+// also returned once the access token of such a user expires, as the client
+// cannot log in again without a code.
+var ErrTOTPRequired = errors.New("a two-factor authentication code is required")
+
+// Error is an error response of the API
+type Error struct {
+	StatusCode int          `json:"-"`
+	Code       ErrorCode    `json:"code"`
+	Message    string       `json:"message"`
+	Details    []FieldError `json:"details,omitempty"`
+	RequestID  string       `json:"request_id,omitempty"`
+	TraceID    string       `json:"trace_id,omitempty"`
+	// RetryAfter is how long the server asked to wait before sending the
+	// request again, from the Retry-After header of a 429 or 503
+	RetryAfter time.Duration `json:"-"`
+}
+
+// FieldError describes why a field of the request failed validation
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s (status %d)", e.Code, e.Message, e.StatusCode)
+}
+
+// IsCode reports whether err is an Error with the given code
+func IsCode(err error, code ErrorCode) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.Code == code
+}
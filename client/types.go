@@ -0,0 +1,167 @@
+package client
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// User is a user of the bank. The hashed password is never returned by the
+// API.
+type User struct {
+	Username          string    `json:"username"`
+	FullName          string    `json:"full_name"`
+	Email             string    `json:"email"`
+	IsEmailVerified   bool      `json:"is_email_verified"`
+	PasswordChangedAt time.Time `json:"password_changed_at"`
+	CreatedAt         time.Time `json:"created_at"`
+}
+
+// CreateUserRequest holds the fields of a new user
+type CreateUserRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	FullName string `json:"full_name"`
+	Email    string `json:"email"`
+}
+
+// UpdateUserRequest holds the fields of the profile to update. The nil
+// fields are kept.
+type UpdateUserRequest struct {
+	FullName *string `json:"full_name,omitempty"`
+	Email    *string `json:"email,omitempty"`
+	// CurrentPassword is required to change the email
+	CurrentPassword string `json:"current_password,omitempty"`
+}
+
+// EmailVerification tells where a verification link was sent, and until
+// when it can be used
+type EmailVerification struct {
+	Email     string    `json:"email"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// APIKey is an API key of the user, without its secret. The nil ExpiresAt of
+// a key that never expires and LastUsedAt of a key never used are left out.
+type APIKey struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// CreateAPIKeyRequest holds the settings of a new API key. A key without
+// scopes has all the permissions of the user, and a nil ExpiresAt never
+// expires.
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// NewAPIKey is returned by CreateAPIKey. Key is not returned again.
+type NewAPIKey struct {
+	APIKey APIKey `json:"api_key"`
+	Key    string `json:"key"`
+}
+
+// LoginResponse is returned by Login and LoginTOTP. The users with
+// two-factor authentication enabled get a TOTPChallenge from Login instead
+// of an access token.
+type LoginResponse struct {
+	AccessToken          string    `json:"access_token"`
+	AccessTokenExpiresAt time.Time `json:"access_token_expires_at"`
+	// Scopes are the ones the client was created WithScopes, if any
+	Scopes        []string       `json:"scopes,omitempty"`
+	User          User           `json:"user"`
+	TOTPChallenge *TOTPChallenge `json:"totp_challenge,omitempty"`
+}
+
+// TOTPChallenge is answered by LoginTOTP with a code of the authenticator
+// app of the user, or one of their recovery codes, before ExpiresAt
+type TOTPChallenge struct {
+	ID        uuid.UUID `json:"id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// TOTPEnrollment is the secret to add to an authenticator app, as text and
+// as an otpauth URI to be shown as a QR code
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// Account is a bank account. Balance is in the minor unit of Currency.
+type Account struct {
+	ID        int64     `json:"id"`
+	Owner     string    `json:"owner"`
+	Balance   int64     `json:"balance"`
+	Currency  string    `json:"currency"`
+	CreatedAt time.Time `json:"created_at"`
+	Frozen    bool      `json:"frozen"`
+}
+
+// LoginAttempt is a login of a user, successful or not
+type LoginAttempt struct {
+	ID        int64     `json:"id"`
+	Username  string    `json:"username"`
+	IPAddress string    `json:"ip_address"`
+	UserAgent string    `json:"user_agent"`
+	Success   bool      `json:"success"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ListLoginAttemptsRequest selects a page of the login attempts of the
+// logged in user. PageID starts at 1 and PageSize must be between 5 and 10.
+type ListLoginAttemptsRequest struct {
+	PageID   int32
+	PageSize int32
+}
+
+// ListAccountsRequest selects a page of the accounts of the logged in user.
+// PageID starts at 1 and PageSize must be between 5 and 10.
+type ListAccountsRequest struct {
+	PageID   int32
+	PageSize int32
+}
+
+// CreateTransferRequest moves Amount from one account to another. Both
+// accounts must be in Currency. TOTPCode is required for the amounts the
+// server considers high.
+type CreateTransferRequest struct {
+	FromAccountID int64  `json:"from_account_id"`
+	ToAccountID   int64  `json:"to_account_id"`
+	Amount        int64  `json:"amount"`
+	Currency      string `json:"currency"`
+	TOTPCode      string `json:"totp_code,omitempty"`
+}
+
+// Transfer records money moved between two accounts
+type Transfer struct {
+	ID            int64     `json:"id"`
+	FromAccountID int64     `json:"from_account_id"`
+	ToAccountID   int64     `json:"to_account_id"`
+	Amount        int64     `json:"amount"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// Entry records a change to the balance of an account. Amount is negative
+// for money leaving the account.
+type Entry struct {
+	ID        int64     `json:"id"`
+	AccountID int64     `json:"account_id"`
+	Amount    int64     `json:"amount"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TransferResult is returned by CreateTransfer
+type TransferResult struct {
+	Transfer    Transfer `json:"transfer"`
+	FromAccount Account  `json:"from_account"`
+	ToAccount   Account  `json:"to_account"`
+	FromEntry   Entry    `json:"from_entry"`
+	ToEntry     Entry    `json:"to_entry"`
+}
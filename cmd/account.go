@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+
+	db "github.com/dpsigor/cheatsheet-golang-postgres/db/sqlc"
+	"github.com/dpsigor/cheatsheet-golang-postgres/util"
+	"github.com/spf13/cobra"
+)
+
+func newAccountCmd(c *cli) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "account",
+		Short: "Manage the accounts of the bank",
+	}
+	cmd.AddCommand(
+		newAccountCreateCmd(c),
+		newAccountFreezeCmd(c, true),
+		newAccountFreezeCmd(c, false),
+	)
+	return cmd
+}
+
+func newAccountCreateCmd(c *cli) *cobra.Command {
+	var arg db.CreateAccountParams
+
+	cmd := &cobra.Command{
+		Use:   "create",
+		Short: "Create an empty account for a user",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !util.IsSupportedCurrency(arg.Currency) {
+				return fmt.Errorf("unsupported currency %q, must be one of %v", arg.Currency, util.SupportedCurrencies())
+			}
+
+			store, err := c.openStore()
+			if err != nil {
+				return err
+			}
+			account, err := store.CreateAccount(cmd.Context(), arg)
+			if err != nil {
+				return fmt.Errorf("cannot create account: %w", err)
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "created %s account %d for %s\n", account.Currency, account.ID, account.Owner)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&arg.Owner, "owner", "", "username of the owner")
+	cmd.Flags().StringVar(&arg.Currency, "currency", "", "currency of the account")
+	cmd.MarkFlagRequired("owner")
+	cmd.MarkFlagRequired("currency")
+	return cmd
+}
+
+// newAccountFreezeCmd creates the freeze command, or unfreeze when frozen is
+// false. A frozen account can neither send nor receive transfers.
+func newAccountFreezeCmd(c *cli, frozen bool) *cobra.Command {
+	use, short, state := "freeze", "Block the transfers from and to an account", "frozen"
+	if !frozen {
+		use, short, state = "unfreeze", "Allow the transfers of a frozen account again", "unfrozen"
+	}
+
+	return &cobra.Command{
+		Use:   use + " ID",
+		Short: short,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid account ID %q", args[0])
+			}
+
+			store, err := c.openStore()
+			if err != nil {
+				return err
+			}
+			account, err := store.SetAccountFrozen(cmd.Context(), db.SetAccountFrozenParams{ID: id, Frozen: frozen})
+			if err != nil {
+				return fmt.Errorf("cannot %s account %d: %w", use, id, err)
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "account %d of %s is %s\n", account.ID, account.Owner, state)
+			return nil
+		},
+	}
+}
@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"testing"
+
+	mockdb "github.com/dpsigor/cheatsheet-golang-postgres/db/mock"
+	db "github.com/dpsigor/cheatsheet-golang-postgres/db/sqlc"
+	"github.com/dpsigor/cheatsheet-golang-postgres/util"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccountCreate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	store := mockdb.NewMockStore(ctrl)
+	store.EXPECT().
+		CreateAccount(gomock.Any(), db.CreateAccountParams{Owner: "alice", Currency: util.EUR}).
+		Times(1).
+		Return(db.Account{ID: 7, Owner: "alice", Currency: util.EUR}, nil)
+
+	out, err := runCmd(t, testConfig(), store, "account", "create", "--owner", "alice", "--currency", util.EUR)
+	require.NoError(t, err)
+	require.Equal(t, "created EUR account 7 for alice\n", out)
+}
+
+func TestAccountFreeze(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	store := mockdb.NewMockStore(ctrl)
+	store.EXPECT().
+		SetAccountFrozen(gomock.Any(), db.SetAccountFrozenParams{ID: 7, Frozen: true}).
+		Times(1).
+		Return(db.Account{ID: 7, Owner: "alice", Frozen: true}, nil)
+	store.EXPECT().
+		SetAccountFrozen(gomock.Any(), db.SetAccountFrozenParams{ID: 8, Frozen: false}).
+		Times(1).
+		Return(db.Account{}, db.ErrRecordNotFound)
+
+	out, err := runCmd(t, testConfig(), store, "account", "freeze", "7")
+	require.NoError(t, err)
+	require.Equal(t, "account 7 of alice is frozen\n", out)
+
+	_, err = runCmd(t, testConfig(), store, "account", "unfreeze", "8")
+	require.ErrorIs(t, err, db.ErrRecordNotFound)
+}
@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	db "github.com/dpsigor/cheatsheet-golang-postgres/db/sqlc"
+	"github.com/dpsigor/cheatsheet-golang-postgres/password"
+	"github.com/dpsigor/cheatsheet-golang-postgres/util"
+)
+
+var testHasher = password.NewTestHasher()
+
+func testConfig() util.Config {
+	return util.Config{
+		TokenSymmetricKey:   util.RandomString(32),
+		AccessTokenDuration: time.Minute,
+	}
+}
+
+// runCmd runs the CLI with args against store, returning what it printed
+func runCmd(t *testing.T, config util.Config, store db.Store, args ...string) (string, error) {
+	c := &cli{config: &config, store: store}
+	root := newRootCmd(c)
+	var out bytes.Buffer
+	root.SetOut(&out)
+	root.SetErr(&out)
+	root.SetArgs(args)
+	err := root.ExecuteContext(context.Background())
+	return out.String(), err
+}
@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/dpsigor/cheatsheet-golang-postgres/db/migration"
+	"github.com/dpsigor/cheatsheet-golang-postgres/util"
+	"github.com/rs/zerolog"
+	"github.com/spf13/cobra"
+)
+
+func newMigrateCmd(c *cli) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Apply or roll back the migrations embedded in the binary",
+	}
+
+	// run returns a RunE applying fn with a migrator, then printing the
+	// resulting status
+	run := func(fn func(m *migration.Migrator, args []string) error) func(*cobra.Command, []string) error {
+		return func(cmd *cobra.Command, args []string) error {
+			migrator, err := migration.NewMigrator(c.config.DBDriver, c.config.DBSource)
+			if err != nil {
+				return err
+			}
+			defer migrator.Close()
+
+			if err := fn(migrator, args); err != nil {
+				return err
+			}
+			status, err := migrator.Status()
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "version %d of %d", status.Version, status.Latest)
+			if status.Dirty {
+				fmt.Fprint(cmd.OutOrStdout(), " (dirty)")
+			}
+			fmt.Fprintln(cmd.OutOrStdout())
+			return nil
+		}
+	}
+
+	cmd.AddCommand(
+		&cobra.Command{
+			Use:   "up",
+			Short: "Apply all the pending migrations",
+			Args:  cobra.NoArgs,
+			RunE: run(func(m *migration.Migrator, args []string) error {
+				return m.Up()
+			}),
+		},
+		&cobra.Command{
+			Use:   "down",
+			Short: "Roll back the last applied migration",
+			Args:  cobra.NoArgs,
+			RunE: run(func(m *migration.Migrator, args []string) error {
+				return m.Down()
+			}),
+		},
+		&cobra.Command{
+			Use:   "goto VERSION",
+			Short: "Migrate up or down to VERSION",
+			Args:  cobra.ExactArgs(1),
+			RunE: run(func(m *migration.Migrator, args []string) error {
+				version, err := strconv.ParseUint(args[0], 10, 32)
+				if err != nil {
+					return fmt.Errorf("invalid version %q", args[0])
+				}
+				return m.Goto(uint(version))
+			}),
+		},
+		&cobra.Command{
+			Use:   "status",
+			Short: "Print the version of the database",
+			Args:  cobra.NoArgs,
+			RunE: run(func(m *migration.Migrator, args []string) error {
+				return nil
+			}),
+		},
+	)
+	return cmd
+}
+
+// autoMigrate applies the pending migrations before the servers start. A
+// replica started while another one migrates waits for it to finish.
+func autoMigrate(cfg util.Config, logger zerolog.Logger) error {
+	migrator, err := migration.NewMigrator(cfg.DBDriver, cfg.DBSource)
+	if err != nil {
+		return err
+	}
+	defer migrator.Close()
+
+	if err := migrator.Up(); err != nil {
+		return err
+	}
+	status, err := migrator.Status()
+	if err != nil {
+		return err
+	}
+	logger.Info().Uint("version", status.Version).Msg("db migrated")
+	return nil
+}
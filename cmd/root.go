@@ -0,0 +1,130 @@
+// Package cmd implements the command-line interface of the simple bank: the
+// servers and the operations tasks run inside its container.
+package cmd
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	db "github.com/dpsigor/cheatsheet-golang-postgres/db/sqlc"
+	"github.com/dpsigor/cheatsheet-golang-postgres/password"
+	"github.com/dpsigor/cheatsheet-golang-postgres/util"
+	"github.com/dpsigor/cheatsheet-golang-postgres/val"
+	_ "github.com/lib/pq"
+	"github.com/rs/zerolog"
+	"github.com/spf13/cobra"
+)
+
+// cli holds the dependencies shared by the commands. The database is opened
+// by the first command that needs it.
+type cli struct {
+	configPath string
+	config     *util.Config
+	logger     zerolog.Logger
+	conn       *sql.DB
+	store      db.Store
+}
+
+// Execute runs the command given in the arguments of the process
+func Execute() {
+	c := &cli{}
+	if err := newRootCmd(c).ExecuteContext(context.Background()); err != nil {
+		os.Exit(1)
+	}
+}
+
+func newRootCmd(c *cli) *cobra.Command {
+	root := &cobra.Command{
+		Use:          "simplebank",
+		Short:        "Simple Bank servers and operations tasks",
+		SilenceUsage: true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			return c.loadConfig()
+		},
+		PersistentPostRunE: func(cmd *cobra.Command, args []string) error {
+			return c.close()
+		},
+	}
+	root.PersistentFlags().StringVar(&c.configPath, "config", ".", "directory of the app.env config file")
+
+	root.AddCommand(
+		newServeCmd(c),
+		newMigrateCmd(c),
+		newUserCmd(c),
+		newAccountCmd(c),
+		newTokenCmd(c),
+		newSeedCmd(c),
+	)
+	return root
+}
+
+// loadConfig reads the config and creates the logger, unless a config was
+// already given
+func (c *cli) loadConfig() error {
+	if c.config == nil {
+		config, err := util.LoadConfig(c.configPath)
+		if err != nil {
+			return fmt.Errorf("cannot load config: %w", err)
+		}
+		c.config = &config
+	}
+
+	logger, err := util.NewLogger(c.config.LogLevel)
+	if err != nil {
+		return fmt.Errorf("cannot create logger: %w", err)
+	}
+	c.logger = logger
+	return nil
+}
+
+// openStore returns the store of the database in the config
+func (c *cli) openStore() (db.Store, error) {
+	if c.store != nil {
+		return c.store, nil
+	}
+	conn, err := sql.Open(c.config.DBDriver, c.config.DBSource)
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to db: %w", err)
+	}
+	c.conn = conn
+	c.store = db.NewStore(conn, c.logger)
+	return c.store, nil
+}
+
+// hashPassword hashes a password with the algorithm and parameters of the
+// config, as the servers do
+func (c *cli) hashPassword(pw string) (string, error) {
+	hasher, err := password.NewHasherFromConfig(*c.config)
+	if err != nil {
+		return "", err
+	}
+	return hasher.Hash(pw)
+}
+
+// checkPassword returns a validation of the passwords user chooses against
+// the password policy of the configuration, failing with every rule broken
+func (c *cli) checkPassword(user val.PasswordUser) func(string) error {
+	policy := val.PasswordPolicyFromConfig(*c.config)
+	return func(password string) error {
+		violations := policy.Check(password, user)
+		if len(violations) == 0 {
+			return nil
+		}
+		reasons := make([]string, len(violations))
+		for i, violation := range violations {
+			reasons[i] = violation.Error()
+		}
+		return errors.New(strings.Join(reasons, ", "))
+	}
+}
+
+func (c *cli) close() error {
+	if c.conn == nil {
+		return nil
+	}
+	return c.conn.Close()
+}
@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	db "github.com/dpsigor/cheatsheet-golang-postgres/db/sqlc"
+	"github.com/dpsigor/cheatsheet-golang-postgres/util"
+	"github.com/dpsigor/cheatsheet-golang-postgres/val"
+	"github.com/spf13/cobra"
+)
+
+// seedUsers are created by the seed command, with an account per currency
+var seedUsers = []db.CreateUserParams{
+	{Username: "alice", FullName: "Alice Demo", Email: "alice@example.com"},
+	{Username: "bob", FullName: "Bob Demo", Email: "bob@example.com"},
+	{Username: "carol", FullName: "Carol Demo", Email: "carol@example.com"},
+}
+
+func newSeedCmd(c *cli) *cobra.Command {
+	var password string
+	var balance int64
+
+	cmd := &cobra.Command{
+		Use:   "seed",
+		Short: "Create demo users with funded accounts in every currency",
+		Long: "Create demo users, with verified emails, and funded accounts in every currency. " +
+			"Users and accounts that already exist are left untouched, so seeding twice is harmless.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// the demo users share a password, only held to the length
+			// logins check
+			password, generated, err := passwordOrGenerate(password, val.ValidatePassword)
+			if err != nil {
+				return err
+			}
+			hashedPassword, err := c.hashPassword(password)
+			if err != nil {
+				return err
+			}
+
+			store, err := c.openStore()
+			if err != nil {
+				return err
+			}
+			out := cmd.OutOrStdout()
+			for _, arg := range seedUsers {
+				arg.HashedPassword = hashedPassword
+				_, err := store.CreateUser(cmd.Context(), arg)
+				switch {
+				case errors.Is(err, db.ErrUniqueViolation):
+					fmt.Fprintf(out, "user %s exists\n", arg.Username)
+				case err != nil:
+					return fmt.Errorf("cannot create user %s: %w", arg.Username, err)
+				default:
+					// the demo users can open accounts and transfer right away
+					if _, err := store.VerifyUserEmail(cmd.Context(), db.VerifyUserEmailParams{Username: arg.Username, Email: arg.Email}); err != nil {
+						return fmt.Errorf("cannot verify email of %s: %w", arg.Username, err)
+					}
+					fmt.Fprintf(out, "created user %s\n", arg.Username)
+				}
+
+				for _, currency := range util.SupportedCurrencies() {
+					account, err := store.CreateAccount(cmd.Context(), db.CreateAccountParams{
+						Owner:    arg.Username,
+						Balance:  balance,
+						Currency: currency,
+					})
+					switch {
+					case errors.Is(err, db.ErrOwnerCurrencyExists):
+					case err != nil:
+						return fmt.Errorf("cannot create %s account of %s: %w", currency, arg.Username, err)
+					default:
+						fmt.Fprintf(out, "created %s account %d for %s\n", currency, account.ID, arg.Username)
+					}
+				}
+			}
+			if generated {
+				fmt.Fprintf(out, "password of the created users: %s\n", password)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&password, "password", "", "password of the created users, generated and printed if empty")
+	cmd.Flags().Int64Var(&balance, "balance", 1000, "initial balance of the created accounts")
+	return cmd
+}
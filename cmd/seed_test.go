@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"testing"
+
+	mockdb "github.com/dpsigor/cheatsheet-golang-postgres/db/mock"
+	db "github.com/dpsigor/cheatsheet-golang-postgres/db/sqlc"
+	"github.com/dpsigor/cheatsheet-golang-postgres/util"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSeed(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	store := mockdb.NewMockStore(ctrl)
+
+	// the first user already exists with its accounts
+	store.EXPECT().
+		CreateUser(gomock.Any(), gomock.Any()).
+		Times(len(seedUsers)).
+		DoAndReturn(func(_ interface{}, arg db.CreateUserParams) (db.User, error) {
+			if arg.Username == seedUsers[0].Username {
+				return db.User{}, db.ErrDuplicateUsername
+			}
+			return db.User{Username: arg.Username}, nil
+		})
+	// only the created users are verified
+	for _, arg := range seedUsers[1:] {
+		store.EXPECT().
+			VerifyUserEmail(gomock.Any(), db.VerifyUserEmailParams{Username: arg.Username, Email: arg.Email}).
+			Times(1).
+			Return(db.User{Username: arg.Username, IsEmailVerified: true}, nil)
+	}
+	store.EXPECT().
+		CreateAccount(gomock.Any(), gomock.Any()).
+		Times(len(seedUsers) * len(util.SupportedCurrencies())).
+		DoAndReturn(func(_ interface{}, arg db.CreateAccountParams) (db.Account, error) {
+			require.Equal(t, int64(500), arg.Balance)
+			if arg.Owner == seedUsers[0].Username {
+				return db.Account{}, db.ErrOwnerCurrencyExists
+			}
+			return db.Account{ID: 1, Owner: arg.Owner, Currency: arg.Currency}, nil
+		})
+
+	out, err := runCmd(t, testConfig(), store, "seed", "--balance", "500", "--password", "secret123")
+	require.NoError(t, err)
+	require.Contains(t, out, "user alice exists")
+	require.Contains(t, out, "created user bob")
+	require.Contains(t, out, "created USD account 1 for carol")
+	require.NotContains(t, out, "password")
+}
@@ -0,0 +1,162 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/dpsigor/cheatsheet-golang-postgres/api"
+	db "github.com/dpsigor/cheatsheet-golang-postgres/db/sqlc"
+	"github.com/dpsigor/cheatsheet-golang-postgres/gapi"
+	"github.com/dpsigor/cheatsheet-golang-postgres/health"
+	"github.com/dpsigor/cheatsheet-golang-postgres/metrics"
+	"github.com/dpsigor/cheatsheet-golang-postgres/token"
+	"github.com/dpsigor/cheatsheet-golang-postgres/tracing"
+	"github.com/dpsigor/cheatsheet-golang-postgres/util"
+	"github.com/rs/zerolog"
+	"github.com/spf13/cobra"
+	"golang.org/x/sync/errgroup"
+	"google.golang.org/grpc"
+)
+
+// readinessTimeout bounds the checks run by /readyz
+const readinessTimeout = 2 * time.Second
+
+func newServeCmd(c *cli) *cobra.Command {
+	return &cobra.Command{
+		Use:   "serve",
+		Short: "Run the HTTP and gRPC servers until SIGINT or SIGTERM",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return serve(cmd.Context(), *c.config, c.logger)
+		},
+	}
+}
+
+func serve(ctx context.Context, cfg util.Config, logger zerolog.Logger) error {
+	if cfg.AutoMigrate {
+		if err := autoMigrate(cfg, logger); err != nil {
+			return fmt.Errorf("cannot migrate db: %w", err)
+		}
+	}
+
+	// SIGINT and SIGTERM cancel ctx, which starts the shutdown
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	shutdownTracing, err := tracing.Setup(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("cannot setup tracing: %w", err)
+	}
+
+	conn, err := tracing.OpenDB(cfg.DBDriver, cfg.DBSource)
+	if err != nil {
+		return fmt.Errorf("cannot connect to db: %w", err)
+	}
+
+	m := metrics.New()
+	m.RegisterDBStats(conn)
+
+	var store db.Store = db.NewStore(conn, logger)
+	store = tracing.NewStore(store)
+	store = metrics.NewStore(store, m)
+
+	grpcWorker := &health.Worker{}
+	checker := health.NewChecker(readinessTimeout)
+	checker.Add("database", conn.PingContext)
+	checker.Add("schema", func(ctx context.Context) error {
+		return db.CheckSchemaVersion(ctx, conn)
+	})
+	checker.Add("grpc_server", grpcWorker.Check)
+
+	// both servers share the token maker, so that a token issued by one is
+	// accepted by the other
+	tokenMaker, err := token.NewPasetoMaker(cfg.TokenSymmetricKey)
+	if err != nil {
+		return fmt.Errorf("cannot create token maker: %w", err)
+	}
+	server, err := api.NewServer(cfg, store, tokenMaker, logger, m, checker)
+	if err != nil {
+		return fmt.Errorf("failed to instantiate server: %w", err)
+	}
+	gServer, err := gapi.NewServer(cfg, store, tokenMaker, logger)
+	if err != nil {
+		return fmt.Errorf("failed to instantiate gRPC server: %w", err)
+	}
+	grpcServer := gServer.GRPCServer()
+
+	group, ctx := errgroup.WithContext(ctx)
+	group.Go(func() error {
+		return runGinServer(cfg, server, logger)
+	})
+	group.Go(func() error {
+		return runGRPCServer(cfg, grpcServer, grpcWorker, logger)
+	})
+	group.Go(func() error {
+		// a server failing to start also cancels ctx
+		<-ctx.Done()
+		logger.Info().Dur("timeout", cfg.ShutdownTimeout).Msg("shutting down")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+		defer cancel()
+
+		// the servers drain their in-flight requests before the pool used
+		// by them is closed, and the spans they recorded are flushed last
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			logger.Error().Err(err).Msg("cannot shutdown HTTP server")
+		}
+		stopGRPCServer(shutdownCtx, grpcServer)
+		if err := gServer.Close(shutdownCtx); err != nil {
+			logger.Error().Err(err).Msg("cannot send queued emails")
+		}
+		if err := conn.Close(); err != nil {
+			logger.Error().Err(err).Msg("cannot close db")
+		}
+		if err := shutdownTracing(shutdownCtx); err != nil {
+			logger.Error().Err(err).Msg("cannot flush traces")
+		}
+		return nil
+	})
+
+	if err := group.Wait(); err != nil {
+		return err
+	}
+	logger.Info().Msg("server stopped")
+	return nil
+}
+
+func runGinServer(cfg util.Config, server *api.Server, logger zerolog.Logger) error {
+	logger.Info().Str("address", cfg.ServerAddress).Msg("start HTTP server")
+	return server.Start(cfg.ServerAddress)
+}
+
+func runGRPCServer(cfg util.Config, server *grpc.Server, worker *health.Worker, logger zerolog.Logger) error {
+	listener, err := net.Listen("tcp", cfg.GRPCServerAddress)
+	if err != nil {
+		return err
+	}
+
+	logger.Info().Str("address", listener.Addr().String()).Msg("start gRPC server")
+	worker.Start()
+	err = server.Serve(listener)
+	worker.Stop(err)
+	return err
+}
+
+// stopGRPCServer waits for the pending calls to complete, and cancels them
+// once ctx is done
+func stopGRPCServer(ctx context.Context, server *grpc.Server) {
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		server.Stop()
+	}
+}
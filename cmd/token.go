@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/dpsigor/cheatsheet-golang-postgres/token"
+	"github.com/dpsigor/cheatsheet-golang-postgres/val"
+	"github.com/spf13/cobra"
+)
+
+func newTokenCmd(c *cli) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "token",
+		Short: "Issue and inspect access tokens",
+	}
+	cmd.AddCommand(
+		newTokenIssueCmd(c),
+		newTokenInspectCmd(c),
+	)
+	return cmd
+}
+
+func newTokenIssueCmd(c *cli) *cobra.Command {
+	var duration time.Duration
+	var scopes []string
+
+	cmd := &cobra.Command{
+		Use:   "issue USERNAME",
+		Short: "Issue an access token for an existing user",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			for _, scope := range scopes {
+				if err := val.ValidateScope(scope); err != nil {
+					return err
+				}
+			}
+			tokenMaker, err := token.NewPasetoMaker(c.config.TokenSymmetricKey)
+			if err != nil {
+				return fmt.Errorf("cannot create token maker: %w", err)
+			}
+
+			store, err := c.openStore()
+			if err != nil {
+				return err
+			}
+			user, err := store.GetUser(cmd.Context(), args[0])
+			if err != nil {
+				return fmt.Errorf("cannot get user %s: %w", args[0], err)
+			}
+
+			if duration == 0 {
+				duration = c.config.AccessTokenDuration
+			}
+			accessToken, err := tokenMaker.CreateToken(user.Username, scopes, duration)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), accessToken)
+			return nil
+		},
+	}
+	cmd.Flags().DurationVar(&duration, "duration", 0, "validity of the token, ACCESS_TOKEN_DURATION if zero")
+	cmd.Flags().StringSliceVar(&scopes, "scope", nil, "scope the token is restricted to, all the permissions of the user if none")
+	return cmd
+}
+
+func newTokenInspectCmd(c *cli) *cobra.Command {
+	return &cobra.Command{
+		Use:   "inspect TOKEN",
+		Short: "Verify an access token and print its payload",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			tokenMaker, err := token.NewPasetoMaker(c.config.TokenSymmetricKey)
+			if err != nil {
+				return fmt.Errorf("cannot create token maker: %w", err)
+			}
+
+			payload, err := tokenMaker.VerifyToken(args[0])
+			if err != nil {
+				return err
+			}
+			enc := json.NewEncoder(cmd.OutOrStdout())
+			enc.SetIndent("", "  ")
+			return enc.Encode(payload)
+		},
+	}
+}
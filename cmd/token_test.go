@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	mockdb "github.com/dpsigor/cheatsheet-golang-postgres/db/mock"
+	db "github.com/dpsigor/cheatsheet-golang-postgres/db/sqlc"
+	"github.com/dpsigor/cheatsheet-golang-postgres/token"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenIssueInspect(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	store := mockdb.NewMockStore(ctrl)
+	store.EXPECT().GetUser(gomock.Any(), "alice").Times(1).Return(db.User{Username: "alice"}, nil)
+	store.EXPECT().GetUser(gomock.Any(), "nobody").Times(1).Return(db.User{}, db.ErrRecordNotFound)
+	config := testConfig()
+
+	out, err := runCmd(t, config, store, "token", "issue", "alice", "--duration", "1h", "--scope", "accounts:read,users:read")
+	require.NoError(t, err)
+	accessToken := strings.TrimSpace(out)
+
+	// the token is accepted by the servers sharing the config
+	tokenMaker, err := token.NewPasetoMaker(config.TokenSymmetricKey)
+	require.NoError(t, err)
+	payload, err := tokenMaker.VerifyToken(accessToken)
+	require.NoError(t, err)
+	require.Equal(t, "alice", payload.Username)
+	require.Equal(t, []string{"accounts:read", "users:read"}, payload.Scopes)
+	require.WithinDuration(t, time.Now().Add(time.Hour), payload.ExpiresAt, time.Second)
+
+	out, err = runCmd(t, config, nil, "token", "inspect", accessToken)
+	require.NoError(t, err)
+	var inspected token.Payload
+	require.NoError(t, json.Unmarshal([]byte(out), &inspected))
+	require.Equal(t, payload.ID, inspected.ID)
+
+	_, err = runCmd(t, testConfig(), nil, "token", "inspect", accessToken)
+	require.ErrorIs(t, err, token.ErrInvalidToken)
+
+	_, err = runCmd(t, config, store, "token", "issue", "nobody")
+	require.ErrorIs(t, err, db.ErrRecordNotFound)
+	_, err = runCmd(t, config, store, "token", "issue", "alice", "--scope", "accounts:admin")
+	require.ErrorContains(t, err, "unsupported scope")
+}
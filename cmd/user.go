@@ -0,0 +1,192 @@
+package cmd
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	db "github.com/dpsigor/cheatsheet-golang-postgres/db/sqlc"
+	"github.com/dpsigor/cheatsheet-golang-postgres/util"
+	"github.com/dpsigor/cheatsheet-golang-postgres/val"
+	"github.com/spf13/cobra"
+)
+
+func newUserCmd(c *cli) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "user",
+		Short: "Manage the users of the bank",
+	}
+	cmd.AddCommand(
+		newUserCreateCmd(c),
+		newUserResetPasswordCmd(c),
+		newUserSetRoleCmd(c),
+	)
+	return cmd
+}
+
+func newUserCreateCmd(c *cli) *cobra.Command {
+	var arg db.CreateUserParams
+	var password, role string
+	var verified bool
+
+	cmd := &cobra.Command{
+		Use:   "create",
+		Short: "Create a user, generating a password unless one is given",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := validateUser(arg, role); err != nil {
+				return err
+			}
+			password, generated, err := passwordOrGenerate(password, c.checkPassword(val.PasswordUser{Username: arg.Username, Email: arg.Email}))
+			if err != nil {
+				return err
+			}
+			arg.HashedPassword, err = c.hashPassword(password)
+			if err != nil {
+				return err
+			}
+
+			store, err := c.openStore()
+			if err != nil {
+				return err
+			}
+			user, err := store.CreateUser(cmd.Context(), arg)
+			if err != nil {
+				return fmt.Errorf("cannot create user: %w", err)
+			}
+			if role != user.Role {
+				user, err = store.UpdateUserRole(cmd.Context(), db.UpdateUserRoleParams{Username: user.Username, Role: role})
+				if err != nil {
+					return fmt.Errorf("cannot set role: %w", err)
+				}
+			}
+			if verified {
+				user, err = store.VerifyUserEmail(cmd.Context(), db.VerifyUserEmailParams{Username: user.Username, Email: user.Email})
+				if err != nil {
+					return fmt.Errorf("cannot verify email: %w", err)
+				}
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "created %s %s\n", user.Role, user.Username)
+			if generated {
+				fmt.Fprintf(cmd.OutOrStdout(), "password: %s\n", password)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&arg.Username, "username", "", "username, letters and digits only")
+	cmd.Flags().StringVar(&arg.FullName, "full-name", "", "full name")
+	cmd.Flags().StringVar(&arg.Email, "email", "", "email address")
+	cmd.Flags().StringVar(&password, "password", "", "password, generated and printed if empty")
+	cmd.Flags().StringVar(&role, "role", util.DepositorRole, "role of the user")
+	cmd.Flags().BoolVar(&verified, "verified", false, "mark the email as verified, without sending a verification link")
+	cmd.MarkFlagRequired("username")
+	cmd.MarkFlagRequired("full-name")
+	cmd.MarkFlagRequired("email")
+	return cmd
+}
+
+func newUserResetPasswordCmd(c *cli) *cobra.Command {
+	var password string
+
+	cmd := &cobra.Command{
+		Use:   "reset-password USERNAME",
+		Short: "Replace the password of a user, generating one unless given",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			password, generated, err := passwordOrGenerate(password, c.checkPassword(val.PasswordUser{Username: args[0]}))
+			if err != nil {
+				return err
+			}
+			hashedPassword, err := c.hashPassword(password)
+			if err != nil {
+				return err
+			}
+
+			store, err := c.openStore()
+			if err != nil {
+				return err
+			}
+			// like a reset by email, this revokes the access tokens and the
+			// outstanding password reset links of the user
+			user, err := store.ChangePasswordTx(cmd.Context(), db.ChangePasswordTxParams{
+				Username:          args[0],
+				HashedPassword:    hashedPassword,
+				PasswordChangedAt: time.Now(),
+			})
+			if err != nil {
+				return fmt.Errorf("cannot reset password of %s: %w", args[0], err)
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "reset password of %s\n", user.Username)
+			if generated {
+				fmt.Fprintf(cmd.OutOrStdout(), "password: %s\n", password)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&password, "password", "", "new password, generated and printed if empty")
+	return cmd
+}
+
+func newUserSetRoleCmd(c *cli) *cobra.Command {
+	return &cobra.Command{
+		Use:   "set-role USERNAME ROLE",
+		Short: "Change the role of a user",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !util.IsSupportedRole(args[1]) {
+				return fmt.Errorf("unsupported role %q, must be one of %v", args[1], util.SupportedRoles())
+			}
+
+			store, err := c.openStore()
+			if err != nil {
+				return err
+			}
+			user, err := store.UpdateUserRole(cmd.Context(), db.UpdateUserRoleParams{
+				Username: args[0],
+				Role:     args[1],
+			})
+			if err != nil {
+				return fmt.Errorf("cannot set role of %s: %w", args[0], err)
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "%s is now a %s\n", user.Username, user.Role)
+			return nil
+		},
+	}
+}
+
+func validateUser(arg db.CreateUserParams, role string) error {
+	if err := val.ValidateUsername(arg.Username); err != nil {
+		return fmt.Errorf("invalid username: %w", err)
+	}
+	if err := val.ValidateFullName(arg.FullName); err != nil {
+		return fmt.Errorf("invalid full name: %w", err)
+	}
+	if err := val.ValidateEmail(arg.Email); err != nil {
+		return fmt.Errorf("invalid email: %w", err)
+	}
+	if !util.IsSupportedRole(role) {
+		return fmt.Errorf("unsupported role %q, must be one of %v", role, util.SupportedRoles())
+	}
+	return nil
+}
+
+// passwordOrGenerate validates password with validate, or generates a random
+// one when it is empty
+func passwordOrGenerate(password string, validate func(string) error) (string, bool, error) {
+	if password != "" {
+		if err := validate(password); err != nil {
+			return "", false, fmt.Errorf("invalid password: %w", err)
+		}
+		return password, false, nil
+	}
+
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", false, fmt.Errorf("cannot generate password: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), true, nil
+}
@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	mockdb "github.com/dpsigor/cheatsheet-golang-postgres/db/mock"
+	db "github.com/dpsigor/cheatsheet-golang-postgres/db/sqlc"
+	"github.com/dpsigor/cheatsheet-golang-postgres/util"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserCreate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	store := mockdb.NewMockStore(ctrl)
+	user := db.User{Username: "alice", FullName: "Alice", Email: "alice@example.com", Role: util.DepositorRole}
+
+	var hashedPassword string
+	store.EXPECT().
+		CreateUser(gomock.Any(), gomock.Any()).
+		Times(1).
+		DoAndReturn(func(_ interface{}, arg db.CreateUserParams) (db.User, error) {
+			require.Equal(t, user.Username, arg.Username)
+			hashedPassword = arg.HashedPassword
+			return user, nil
+		})
+	store.EXPECT().
+		UpdateUserRole(gomock.Any(), db.UpdateUserRoleParams{Username: user.Username, Role: util.BankerRole}).
+		Times(1).
+		DoAndReturn(func(_ interface{}, arg db.UpdateUserRoleParams) (db.User, error) {
+			user.Role = arg.Role
+			return user, nil
+		})
+	store.EXPECT().VerifyUserEmail(gomock.Any(), gomock.Any()).Times(0)
+
+	out, err := runCmd(t, testConfig(), store, "user", "create",
+		"--username", user.Username, "--full-name", user.FullName, "--email", user.Email, "--role", util.BankerRole)
+	require.NoError(t, err)
+	require.Contains(t, out, "created banker alice")
+
+	// the generated password is printed and matches the stored hash
+	match := regexp.MustCompile(`password: (\S+)`).FindStringSubmatch(out)
+	require.Len(t, match, 2)
+	require.NoError(t, testHasher.Check(match[1], hashedPassword))
+}
+
+func TestUserCreateVerified(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	store := mockdb.NewMockStore(ctrl)
+	user := db.User{Username: "alice", FullName: "Alice", Email: "alice@example.com", Role: util.DepositorRole}
+
+	store.EXPECT().CreateUser(gomock.Any(), gomock.Any()).Times(1).Return(user, nil)
+	store.EXPECT().
+		VerifyUserEmail(gomock.Any(), db.VerifyUserEmailParams{Username: user.Username, Email: user.Email}).
+		Times(1).
+		DoAndReturn(func(_ interface{}, arg db.VerifyUserEmailParams) (db.User, error) {
+			user.IsEmailVerified = true
+			return user, nil
+		})
+
+	out, err := runCmd(t, testConfig(), store, "user", "create",
+		"--username", user.Username, "--full-name", user.FullName, "--email", user.Email, "--verified")
+	require.NoError(t, err)
+	require.Contains(t, out, "created depositor alice")
+}
+
+func TestUserCreateInvalid(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	store := mockdb.NewMockStore(ctrl)
+	store.EXPECT().CreateUser(gomock.Any(), gomock.Any()).Times(0)
+
+	_, err := runCmd(t, testConfig(), store, "user", "create",
+		"--username", "not valid", "--full-name", "Alice", "--email", "alice@example.com")
+	require.ErrorContains(t, err, "invalid username")
+
+	_, err = runCmd(t, testConfig(), store, "user", "create",
+		"--username", "alice", "--full-name", "Alice", "--email", "alice@example.com", "--password", "abc")
+	require.ErrorContains(t, err, "invalid password")
+
+	_, err = runCmd(t, testConfig(), store, "user", "create",
+		"--username", "alice", "--full-name", "Alice", "--email", "alice@example.com", "--password", "Alice-Pass-1")
+	require.ErrorContains(t, err, "must not contain the username")
+}
+
+func TestUserResetPassword(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	store := mockdb.NewMockStore(ctrl)
+
+	password := util.RandomString(10)
+	store.EXPECT().
+		ChangePasswordTx(gomock.Any(), gomock.Any()).
+		Times(1).
+		DoAndReturn(func(_ interface{}, arg db.ChangePasswordTxParams) (db.User, error) {
+			require.Equal(t, "alice", arg.Username)
+			require.NoError(t, testHasher.Check(password, arg.HashedPassword))
+			require.WithinDuration(t, time.Now(), arg.PasswordChangedAt, time.Second)
+			return db.User{Username: arg.Username}, nil
+		})
+
+	out, err := runCmd(t, testConfig(), store, "user", "reset-password", "alice", "--password", password)
+	require.NoError(t, err)
+	require.Equal(t, "reset password of alice\n", out)
+}
+
+func TestUserSetRole(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	store := mockdb.NewMockStore(ctrl)
+	store.EXPECT().
+		UpdateUserRole(gomock.Any(), db.UpdateUserRoleParams{Username: "bob", Role: util.BankerRole}).
+		Times(1).
+		Return(db.User{Username: "bob", Role: util.BankerRole}, nil)
+
+	out, err := runCmd(t, testConfig(), store, "user", "set-role", "bob", util.BankerRole)
+	require.NoError(t, err)
+	require.Equal(t, "bob is now a banker\n", out)
+
+	_, err = runCmd(t, testConfig(), store, "user", "set-role", "bob", "admin")
+	require.ErrorContains(t, err, `unsupported role "admin"`)
+}
@@ -1,3 +1,3 @@
 #!/bin/bash
 
-complete -W "postgres createdb dropdb execdb migrateup migratedown sqlc lint test watch mock migratedown1 migrateup1" ./scripts.bash
+complete -W "postgres createdb dropdb execdb migrateup migratedown sqlc lint test watch mock migratedown1 migrateup1 migratestatus seed proto" ./scripts.bash
@@ -0,0 +1,1373 @@
+// Package memdb implements db.Store in memory. It enforces the constraints of
+// the schema in db/migration and returns the same errors as db.SQLStore, so
+// it can stand in for Postgres in tests. db/storetest checks that both stores
+// behave the same.
+package memdb
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	db "github.com/dpsigor/cheatsheet-golang-postgres/db/sqlc"
+	"github.com/dpsigor/cheatsheet-golang-postgres/util"
+	"github.com/google/uuid"
+)
+
+// idempotencyKeyTTL is how long an idempotency key is kept before it can be
+// claimed again, as in the CreateIdempotencyKey query
+const idempotencyKeyTTL = 24 * time.Hour
+
+type idempotencyKeyID struct {
+	scope string
+	key   string
+}
+
+// Store is an in-memory db.Store. It is safe for concurrent use, and every
+// method, including TransferTx, is atomic.
+type Store struct {
+	mu              sync.Mutex
+	users           map[string]db.User
+	accounts        map[int64]db.Account
+	entries         map[int64]db.Entry
+	transfers       map[int64]db.Transfer
+	idempotencyKeys map[idempotencyKeyID]db.IdempotencyKey
+	rateLimits      map[string]db.RateLimitBucket
+	loginAttempts   []db.LoginAttempt
+	recoveryCodes   map[int64]db.RecoveryCode
+	loginChallenges map[uuid.UUID]db.LoginChallenge
+	resetTokens     map[int64]db.PasswordResetToken
+	verifyEmails    map[int64]db.VerifyEmail
+	apiKeys         map[int64]db.APIKey
+	oauthClients    map[string]db.OAuthClient
+	oauthCodes      map[int64]db.OAuthAuthorizationCode
+	refreshTokens   map[int64]db.OAuthRefreshToken
+	lastAccountID   int64
+	lastEntryID     int64
+	lastTransferID  int64
+	lastAttemptID   int64
+	lastCodeID      int64
+	lastResetID     int64
+	lastVerifyID    int64
+	lastAPIKeyID    int64
+	lastOAuthCodeID int64
+	lastRefreshID   int64
+	now             func() time.Time
+}
+
+var _ db.Store = (*Store)(nil)
+
+// NewStore creates an empty Store
+func NewStore() *Store {
+	return &Store{
+		users:           map[string]db.User{},
+		accounts:        map[int64]db.Account{},
+		entries:         map[int64]db.Entry{},
+		transfers:       map[int64]db.Transfer{},
+		idempotencyKeys: map[idempotencyKeyID]db.IdempotencyKey{},
+		rateLimits:      map[string]db.RateLimitBucket{},
+		recoveryCodes:   map[int64]db.RecoveryCode{},
+		loginChallenges: map[uuid.UUID]db.LoginChallenge{},
+		resetTokens:     map[int64]db.PasswordResetToken{},
+		verifyEmails:    map[int64]db.VerifyEmail{},
+		apiKeys:         map[int64]db.APIKey{},
+		oauthClients:    map[string]db.OAuthClient{},
+		oauthCodes:      map[int64]db.OAuthAuthorizationCode{},
+		refreshTokens:   map[int64]db.OAuthRefreshToken{},
+		now:             time.Now,
+	}
+}
+
+// lock acquires the store for a call made with ctx. Like the database, the
+// store refuses calls whose context is done.
+func (s *Store) lock(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	return nil
+}
+
+// timestamp returns the current time with the precision of a timestamptz
+func (s *Store) timestamp() time.Time {
+	return s.now().Truncate(time.Microsecond)
+}
+
+func constraintError(constraint string, err error) error {
+	return &db.ConstraintError{Constraint: constraint, Err: err}
+}
+
+func (s *Store) CreateUser(ctx context.Context, arg db.CreateUserParams) (db.User, error) {
+	if err := s.lock(ctx); err != nil {
+		return db.User{}, err
+	}
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[arg.Username]; ok {
+		return db.User{}, constraintError("users_pkey", db.ErrDuplicateUsername)
+	}
+	for _, user := range s.users {
+		if user.Email == arg.Email {
+			return db.User{}, constraintError("users_email_key", db.ErrDuplicateEmail)
+		}
+	}
+	user := db.User{
+		Username:          arg.Username,
+		HashedPassword:    arg.HashedPassword,
+		FullName:          arg.FullName,
+		Email:             arg.Email,
+		PasswordChangedAt: time.Time{},
+		CreatedAt:         s.timestamp(),
+		Role:              util.DepositorRole,
+	}
+	s.users[user.Username] = user
+	return user, nil
+}
+
+func (s *Store) GetUser(ctx context.Context, username string) (db.User, error) {
+	if err := s.lock(ctx); err != nil {
+		return db.User{}, err
+	}
+	defer s.mu.Unlock()
+
+	user, ok := s.users[username]
+	if !ok {
+		return db.User{}, db.ErrRecordNotFound
+	}
+	return user, nil
+}
+
+func (s *Store) GetUserByEmail(ctx context.Context, email string) (db.User, error) {
+	if err := s.lock(ctx); err != nil {
+		return db.User{}, err
+	}
+	defer s.mu.Unlock()
+
+	for _, user := range s.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return db.User{}, db.ErrRecordNotFound
+}
+
+func (s *Store) GetPasswordChangedAt(ctx context.Context, username string) (time.Time, error) {
+	if err := s.lock(ctx); err != nil {
+		return time.Time{}, err
+	}
+	defer s.mu.Unlock()
+
+	user, ok := s.users[username]
+	if !ok {
+		return time.Time{}, db.ErrRecordNotFound
+	}
+	return user.PasswordChangedAt, nil
+}
+
+func (s *Store) UpdateUser(ctx context.Context, arg db.UpdateUserParams) (db.User, error) {
+	if err := s.lock(ctx); err != nil {
+		return db.User{}, err
+	}
+	defer s.mu.Unlock()
+
+	user, ok := s.users[arg.Username]
+	if !ok {
+		return db.User{}, db.ErrRecordNotFound
+	}
+	if arg.FullName.Valid {
+		user.FullName = arg.FullName.String
+	}
+	if arg.Email.Valid && arg.Email.String != user.Email {
+		for _, other := range s.users {
+			if other.Email == arg.Email.String {
+				return db.User{}, constraintError("users_email_key", db.ErrDuplicateEmail)
+			}
+		}
+		user.Email = arg.Email.String
+		user.IsEmailVerified = false
+	}
+	s.users[user.Username] = user
+	return user, nil
+}
+
+func (s *Store) UpdateUserPassword(ctx context.Context, arg db.UpdateUserPasswordParams) (db.User, error) {
+	if err := s.lock(ctx); err != nil {
+		return db.User{}, err
+	}
+	defer s.mu.Unlock()
+
+	return s.updateUserPassword(arg)
+}
+
+func (s *Store) updateUserPassword(arg db.UpdateUserPasswordParams) (db.User, error) {
+	user, ok := s.users[arg.Username]
+	if !ok {
+		return db.User{}, db.ErrRecordNotFound
+	}
+	user.HashedPassword = arg.HashedPassword
+	user.PasswordChangedAt = arg.PasswordChangedAt.Truncate(time.Microsecond)
+	s.users[user.Username] = user
+	return user, nil
+}
+
+func (s *Store) RehashUserPassword(ctx context.Context, arg db.RehashUserPasswordParams) error {
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	user, ok := s.users[arg.Username]
+	if !ok || user.HashedPassword != arg.OldHashedPassword {
+		return nil
+	}
+	user.HashedPassword = arg.HashedPassword
+	s.users[user.Username] = user
+	return nil
+}
+
+// ChangePasswordTx sets the password of the user and deletes their password
+// reset tokens. The store is locked for the whole transaction, so it is
+// applied atomically.
+func (s *Store) ChangePasswordTx(ctx context.Context, arg db.ChangePasswordTxParams) (db.User, error) {
+	if err := s.lock(ctx); err != nil {
+		return db.User{}, err
+	}
+	defer s.mu.Unlock()
+
+	user, err := s.updateUserPassword(db.UpdateUserPasswordParams{
+		Username:          arg.Username,
+		HashedPassword:    arg.HashedPassword,
+		PasswordChangedAt: arg.PasswordChangedAt,
+	})
+	if err != nil {
+		return db.User{}, err
+	}
+	s.deletePasswordResetTokens(arg.Username)
+	return user, nil
+}
+
+func (s *Store) CreatePasswordResetToken(ctx context.Context, arg db.CreatePasswordResetTokenParams) (db.PasswordResetToken, error) {
+	if err := s.lock(ctx); err != nil {
+		return db.PasswordResetToken{}, err
+	}
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[arg.Username]; !ok {
+		return db.PasswordResetToken{}, constraintError("password_reset_tokens_username_fkey", db.ErrForeignKey)
+	}
+	for _, resetToken := range s.resetTokens {
+		if resetToken.HashedToken == arg.HashedToken {
+			return db.PasswordResetToken{}, constraintError("password_reset_tokens_hashed_token_key", db.ErrUniqueViolation)
+		}
+	}
+	s.lastResetID++
+	resetToken := db.PasswordResetToken{
+		ID:          s.lastResetID,
+		Username:    arg.Username,
+		HashedToken: arg.HashedToken,
+		ExpiresAt:   arg.ExpiresAt.Truncate(time.Microsecond),
+		CreatedAt:   s.timestamp(),
+	}
+	s.resetTokens[resetToken.ID] = resetToken
+	return resetToken, nil
+}
+
+func (s *Store) DeletePasswordResetToken(ctx context.Context, hashedToken string) (db.PasswordResetToken, error) {
+	if err := s.lock(ctx); err != nil {
+		return db.PasswordResetToken{}, err
+	}
+	defer s.mu.Unlock()
+
+	for id, resetToken := range s.resetTokens {
+		if resetToken.HashedToken == hashedToken {
+			delete(s.resetTokens, id)
+			return resetToken, nil
+		}
+	}
+	return db.PasswordResetToken{}, db.ErrRecordNotFound
+}
+
+func (s *Store) DeletePasswordResetTokens(ctx context.Context, username string) error {
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	s.deletePasswordResetTokens(username)
+	return nil
+}
+
+func (s *Store) deletePasswordResetTokens(username string) {
+	for id, resetToken := range s.resetTokens {
+		if resetToken.Username == username {
+			delete(s.resetTokens, id)
+		}
+	}
+}
+
+func (s *Store) IsEmailVerified(ctx context.Context, username string) (bool, error) {
+	if err := s.lock(ctx); err != nil {
+		return false, err
+	}
+	defer s.mu.Unlock()
+
+	user, ok := s.users[username]
+	if !ok {
+		return false, db.ErrRecordNotFound
+	}
+	return user.IsEmailVerified, nil
+}
+
+func (s *Store) VerifyUserEmail(ctx context.Context, arg db.VerifyUserEmailParams) (db.User, error) {
+	if err := s.lock(ctx); err != nil {
+		return db.User{}, err
+	}
+	defer s.mu.Unlock()
+
+	return s.verifyUserEmail(arg)
+}
+
+func (s *Store) verifyUserEmail(arg db.VerifyUserEmailParams) (db.User, error) {
+	user, ok := s.users[arg.Username]
+	if !ok || user.Email != arg.Email {
+		return db.User{}, db.ErrRecordNotFound
+	}
+	user.IsEmailVerified = true
+	s.users[user.Username] = user
+	return user, nil
+}
+
+func (s *Store) CreateVerifyEmail(ctx context.Context, arg db.CreateVerifyEmailParams) (db.VerifyEmail, error) {
+	if err := s.lock(ctx); err != nil {
+		return db.VerifyEmail{}, err
+	}
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[arg.Username]; !ok {
+		return db.VerifyEmail{}, constraintError("verify_emails_username_fkey", db.ErrForeignKey)
+	}
+	for _, verifyEmail := range s.verifyEmails {
+		if verifyEmail.HashedToken == arg.HashedToken {
+			return db.VerifyEmail{}, constraintError("verify_emails_hashed_token_key", db.ErrUniqueViolation)
+		}
+	}
+	s.lastVerifyID++
+	verifyEmail := db.VerifyEmail{
+		ID:          s.lastVerifyID,
+		Username:    arg.Username,
+		Email:       arg.Email,
+		HashedToken: arg.HashedToken,
+		ExpiresAt:   arg.ExpiresAt.Truncate(time.Microsecond),
+		CreatedAt:   s.timestamp(),
+	}
+	s.verifyEmails[verifyEmail.ID] = verifyEmail
+	return verifyEmail, nil
+}
+
+func (s *Store) UseVerifyEmail(ctx context.Context, hashedToken string) (db.VerifyEmail, error) {
+	if err := s.lock(ctx); err != nil {
+		return db.VerifyEmail{}, err
+	}
+	defer s.mu.Unlock()
+
+	verifyEmail, err := s.findVerifyEmail(hashedToken)
+	if err != nil {
+		return db.VerifyEmail{}, err
+	}
+	verifyEmail.IsUsed = true
+	s.verifyEmails[verifyEmail.ID] = verifyEmail
+	return verifyEmail, nil
+}
+
+// findVerifyEmail returns the unused and unexpired token with hashedToken,
+// as matched by the UseVerifyEmail query
+func (s *Store) findVerifyEmail(hashedToken string) (db.VerifyEmail, error) {
+	now := s.now()
+	for _, verifyEmail := range s.verifyEmails {
+		if verifyEmail.HashedToken == hashedToken && !verifyEmail.IsUsed && verifyEmail.ExpiresAt.After(now) {
+			return verifyEmail, nil
+		}
+	}
+	return db.VerifyEmail{}, db.ErrRecordNotFound
+}
+
+// VerifyEmailTx claims an email verification token and verifies the email of
+// its user. The store is locked for the whole transaction, and the token is
+// only claimed once the email is verified, so it is applied atomically.
+func (s *Store) VerifyEmailTx(ctx context.Context, arg db.VerifyEmailTxParams) (db.VerifyEmailTxResult, error) {
+	if err := s.lock(ctx); err != nil {
+		return db.VerifyEmailTxResult{}, err
+	}
+	defer s.mu.Unlock()
+
+	verifyEmail, err := s.findVerifyEmail(arg.HashedToken)
+	if err != nil {
+		return db.VerifyEmailTxResult{}, err
+	}
+	user, err := s.verifyUserEmail(db.VerifyUserEmailParams{
+		Username: verifyEmail.Username,
+		Email:    verifyEmail.Email,
+	})
+	if err != nil {
+		return db.VerifyEmailTxResult{}, err
+	}
+	verifyEmail.IsUsed = true
+	s.verifyEmails[verifyEmail.ID] = verifyEmail
+	return db.VerifyEmailTxResult{VerifyEmail: verifyEmail, User: user}, nil
+}
+
+func (s *Store) CreateAPIKey(ctx context.Context, arg db.CreateAPIKeyParams) (db.APIKey, error) {
+	if err := s.lock(ctx); err != nil {
+		return db.APIKey{}, err
+	}
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[arg.Username]; !ok {
+		return db.APIKey{}, constraintError("api_keys_username_fkey", db.ErrForeignKey)
+	}
+	for _, apiKey := range s.apiKeys {
+		if apiKey.Prefix == arg.Prefix {
+			return db.APIKey{}, constraintError("api_keys_prefix_key", db.ErrUniqueViolation)
+		}
+	}
+	s.lastAPIKeyID++
+	apiKey := db.APIKey{
+		ID:           s.lastAPIKeyID,
+		Username:     arg.Username,
+		Name:         arg.Name,
+		Prefix:       arg.Prefix,
+		HashedSecret: arg.HashedSecret,
+		Scopes:       append([]string{}, arg.Scopes...),
+		ExpiresAt:    arg.ExpiresAt.Truncate(time.Microsecond),
+		CreatedAt:    s.timestamp(),
+	}
+	s.apiKeys[apiKey.ID] = apiKey
+	return copyAPIKey(apiKey), nil
+}
+
+func (s *Store) GetAPIKeyByPrefix(ctx context.Context, prefix string) (db.APIKey, error) {
+	if err := s.lock(ctx); err != nil {
+		return db.APIKey{}, err
+	}
+	defer s.mu.Unlock()
+
+	for _, apiKey := range s.apiKeys {
+		if apiKey.Prefix == prefix {
+			return copyAPIKey(apiKey), nil
+		}
+	}
+	return db.APIKey{}, db.ErrRecordNotFound
+}
+
+func (s *Store) ListAPIKeys(ctx context.Context, username string) ([]db.APIKey, error) {
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	apiKeys := []db.APIKey{}
+	for _, apiKey := range s.apiKeys {
+		if apiKey.Username == username {
+			apiKeys = append(apiKeys, copyAPIKey(apiKey))
+		}
+	}
+	sort.Slice(apiKeys, func(i, j int) bool { return apiKeys[i].ID < apiKeys[j].ID })
+	return apiKeys, nil
+}
+
+func (s *Store) DeleteAPIKey(ctx context.Context, arg db.DeleteAPIKeyParams) (db.APIKey, error) {
+	if err := s.lock(ctx); err != nil {
+		return db.APIKey{}, err
+	}
+	defer s.mu.Unlock()
+
+	apiKey, ok := s.apiKeys[arg.ID]
+	if !ok || apiKey.Username != arg.Username {
+		return db.APIKey{}, db.ErrRecordNotFound
+	}
+	delete(s.apiKeys, arg.ID)
+	return apiKey, nil
+}
+
+func (s *Store) TouchAPIKey(ctx context.Context, arg db.TouchAPIKeyParams) error {
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	if apiKey, ok := s.apiKeys[arg.ID]; ok {
+		apiKey.LastUsedAt = arg.LastUsedAt.Truncate(time.Microsecond)
+		s.apiKeys[arg.ID] = apiKey
+	}
+	return nil
+}
+
+// copyAPIKey returns apiKey with its own scopes, so that callers cannot
+// change the stored ones
+func copyAPIKey(apiKey db.APIKey) db.APIKey {
+	apiKey.Scopes = append([]string{}, apiKey.Scopes...)
+	return apiKey
+}
+
+func (s *Store) CreateOAuthClient(ctx context.Context, arg db.CreateOAuthClientParams) (db.OAuthClient, error) {
+	if err := s.lock(ctx); err != nil {
+		return db.OAuthClient{}, err
+	}
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[arg.Owner]; !ok {
+		return db.OAuthClient{}, constraintError("oauth_clients_owner_fkey", db.ErrForeignKey)
+	}
+	if _, ok := s.oauthClients[arg.ID]; ok {
+		return db.OAuthClient{}, constraintError("oauth_clients_pkey", db.ErrUniqueViolation)
+	}
+	client := db.OAuthClient{
+		ID:           arg.ID,
+		Owner:        arg.Owner,
+		Name:         arg.Name,
+		HashedSecret: arg.HashedSecret,
+		RedirectURIs: append([]string{}, arg.RedirectURIs...),
+		Scopes:       append([]string{}, arg.Scopes...),
+		CreatedAt:    s.timestamp(),
+	}
+	s.oauthClients[client.ID] = client
+	return copyOAuthClient(client), nil
+}
+
+func (s *Store) GetOAuthClient(ctx context.Context, id string) (db.OAuthClient, error) {
+	if err := s.lock(ctx); err != nil {
+		return db.OAuthClient{}, err
+	}
+	defer s.mu.Unlock()
+
+	client, ok := s.oauthClients[id]
+	if !ok {
+		return db.OAuthClient{}, db.ErrRecordNotFound
+	}
+	return copyOAuthClient(client), nil
+}
+
+// copyOAuthClient returns client with its own slices, so that callers cannot
+// change the stored ones
+func copyOAuthClient(client db.OAuthClient) db.OAuthClient {
+	client.RedirectURIs = append([]string{}, client.RedirectURIs...)
+	client.Scopes = append([]string{}, client.Scopes...)
+	return client
+}
+
+func (s *Store) CreateOAuthAuthorizationCode(ctx context.Context, arg db.CreateOAuthAuthorizationCodeParams) (db.OAuthAuthorizationCode, error) {
+	if err := s.lock(ctx); err != nil {
+		return db.OAuthAuthorizationCode{}, err
+	}
+	defer s.mu.Unlock()
+
+	if _, ok := s.oauthClients[arg.ClientID]; !ok {
+		return db.OAuthAuthorizationCode{}, constraintError("oauth_authorization_codes_client_id_fkey", db.ErrForeignKey)
+	}
+	if _, ok := s.users[arg.Username]; !ok {
+		return db.OAuthAuthorizationCode{}, constraintError("oauth_authorization_codes_username_fkey", db.ErrForeignKey)
+	}
+	for _, code := range s.oauthCodes {
+		if code.HashedCode == arg.HashedCode {
+			return db.OAuthAuthorizationCode{}, constraintError("oauth_authorization_codes_hashed_code_key", db.ErrUniqueViolation)
+		}
+	}
+	s.lastOAuthCodeID++
+	code := db.OAuthAuthorizationCode{
+		ID:               s.lastOAuthCodeID,
+		HashedCode:       arg.HashedCode,
+		ClientID:         arg.ClientID,
+		Username:         arg.Username,
+		RedirectURI:      arg.RedirectURI,
+		RedirectURIGiven: arg.RedirectURIGiven,
+		Scopes:           append([]string{}, arg.Scopes...),
+		CodeChallenge:    arg.CodeChallenge,
+		IssuedAt:         arg.IssuedAt.Truncate(time.Microsecond),
+		ExpiresAt:        arg.ExpiresAt.Truncate(time.Microsecond),
+		CreatedAt:        s.timestamp(),
+	}
+	s.oauthCodes[code.ID] = code
+	return code, nil
+}
+
+func (s *Store) DeleteOAuthAuthorizationCode(ctx context.Context, hashedCode string) (db.OAuthAuthorizationCode, error) {
+	if err := s.lock(ctx); err != nil {
+		return db.OAuthAuthorizationCode{}, err
+	}
+	defer s.mu.Unlock()
+
+	for id, code := range s.oauthCodes {
+		if code.HashedCode == hashedCode {
+			delete(s.oauthCodes, id)
+			return code, nil
+		}
+	}
+	return db.OAuthAuthorizationCode{}, db.ErrRecordNotFound
+}
+
+func (s *Store) CreateOAuthRefreshToken(ctx context.Context, arg db.CreateOAuthRefreshTokenParams) (db.OAuthRefreshToken, error) {
+	if err := s.lock(ctx); err != nil {
+		return db.OAuthRefreshToken{}, err
+	}
+	defer s.mu.Unlock()
+
+	if _, ok := s.oauthClients[arg.ClientID]; !ok {
+		return db.OAuthRefreshToken{}, constraintError("oauth_refresh_tokens_client_id_fkey", db.ErrForeignKey)
+	}
+	if _, ok := s.users[arg.Username]; !ok {
+		return db.OAuthRefreshToken{}, constraintError("oauth_refresh_tokens_username_fkey", db.ErrForeignKey)
+	}
+	for _, refreshToken := range s.refreshTokens {
+		if refreshToken.HashedToken == arg.HashedToken {
+			return db.OAuthRefreshToken{}, constraintError("oauth_refresh_tokens_hashed_token_key", db.ErrUniqueViolation)
+		}
+	}
+	s.lastRefreshID++
+	refreshToken := db.OAuthRefreshToken{
+		ID:          s.lastRefreshID,
+		HashedToken: arg.HashedToken,
+		ClientID:    arg.ClientID,
+		Username:    arg.Username,
+		Scopes:      append([]string{}, arg.Scopes...),
+		IssuedAt:    arg.IssuedAt.Truncate(time.Microsecond),
+		ExpiresAt:   arg.ExpiresAt.Truncate(time.Microsecond),
+		CreatedAt:   s.timestamp(),
+	}
+	s.refreshTokens[refreshToken.ID] = refreshToken
+	return refreshToken, nil
+}
+
+func (s *Store) DeleteOAuthRefreshToken(ctx context.Context, hashedToken string) (db.OAuthRefreshToken, error) {
+	if err := s.lock(ctx); err != nil {
+		return db.OAuthRefreshToken{}, err
+	}
+	defer s.mu.Unlock()
+
+	for id, refreshToken := range s.refreshTokens {
+		if refreshToken.HashedToken == hashedToken {
+			delete(s.refreshTokens, id)
+			return refreshToken, nil
+		}
+	}
+	return db.OAuthRefreshToken{}, db.ErrRecordNotFound
+}
+
+func (s *Store) UpdateUserRole(ctx context.Context, arg db.UpdateUserRoleParams) (db.User, error) {
+	if err := s.lock(ctx); err != nil {
+		return db.User{}, err
+	}
+	defer s.mu.Unlock()
+
+	user, ok := s.users[arg.Username]
+	if !ok {
+		return db.User{}, db.ErrRecordNotFound
+	}
+	user.Role = arg.Role
+	s.users[user.Username] = user
+	return user, nil
+}
+
+func (s *Store) RecordFailedLogin(ctx context.Context, arg db.RecordFailedLoginParams) (db.User, error) {
+	if err := s.lock(ctx); err != nil {
+		return db.User{}, err
+	}
+	defer s.mu.Unlock()
+
+	user, ok := s.users[arg.Username]
+	if !ok {
+		return db.User{}, db.ErrRecordNotFound
+	}
+	user.FailedLoginAttempts++
+	if user.FailedLoginAttempts >= arg.MaxAttempts {
+		exponent := math.Min(float64(user.FailedLoginAttempts-arg.MaxAttempts), 32)
+		seconds := math.Min(arg.MaxLockoutSeconds, arg.LockoutSeconds*math.Pow(2, exponent))
+		user.LockedUntil = arg.Now.Add(time.Duration(seconds * float64(time.Second))).Truncate(time.Microsecond)
+	}
+	s.users[user.Username] = user
+	return user, nil
+}
+
+func (s *Store) ResetFailedLogins(ctx context.Context, username string) error {
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	if user, ok := s.users[username]; ok {
+		user.FailedLoginAttempts = 0
+		s.users[username] = user
+	}
+	return nil
+}
+
+func (s *Store) CreateLoginAttempt(ctx context.Context, arg db.CreateLoginAttemptParams) (db.LoginAttempt, error) {
+	if err := s.lock(ctx); err != nil {
+		return db.LoginAttempt{}, err
+	}
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[arg.Username]; !ok {
+		return db.LoginAttempt{}, constraintError("login_attempts_username_fkey", db.ErrForeignKey)
+	}
+	s.lastAttemptID++
+	attempt := db.LoginAttempt{
+		ID:        s.lastAttemptID,
+		Username:  arg.Username,
+		IpAddress: arg.IpAddress,
+		UserAgent: arg.UserAgent,
+		Success:   arg.Success,
+		CreatedAt: s.timestamp(),
+	}
+	s.loginAttempts = append(s.loginAttempts, attempt)
+	return attempt, nil
+}
+
+func (s *Store) ListLoginAttempts(ctx context.Context, arg db.ListLoginAttemptsParams) ([]db.LoginAttempt, error) {
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	attempts := []db.LoginAttempt{}
+	for i := len(s.loginAttempts) - 1; i >= 0; i-- {
+		if s.loginAttempts[i].Username == arg.Username {
+			attempts = append(attempts, s.loginAttempts[i])
+		}
+	}
+	return page(attempts, arg.Limit, arg.Offset), nil
+}
+
+func (s *Store) SetTOTPSecret(ctx context.Context, arg db.SetTOTPSecretParams) (db.User, error) {
+	if err := s.lock(ctx); err != nil {
+		return db.User{}, err
+	}
+	defer s.mu.Unlock()
+
+	user, ok := s.users[arg.Username]
+	if !ok || user.TotpEnabled {
+		return db.User{}, db.ErrRecordNotFound
+	}
+	user.TotpSecret = arg.TotpSecret
+	s.users[user.Username] = user
+	return user, nil
+}
+
+func (s *Store) EnableTOTP(ctx context.Context, arg db.EnableTOTPParams) (db.User, error) {
+	if err := s.lock(ctx); err != nil {
+		return db.User{}, err
+	}
+	defer s.mu.Unlock()
+
+	return s.enableTOTP(arg)
+}
+
+func (s *Store) enableTOTP(arg db.EnableTOTPParams) (db.User, error) {
+	user, ok := s.users[arg.Username]
+	if !ok || user.TotpEnabled || user.TotpSecret == "" {
+		return db.User{}, db.ErrRecordNotFound
+	}
+	user.TotpEnabled = true
+	user.TotpLastStep = arg.TotpLastStep
+	s.users[user.Username] = user
+	return user, nil
+}
+
+func (s *Store) UseTOTPStep(ctx context.Context, arg db.UseTOTPStepParams) (int64, error) {
+	if err := s.lock(ctx); err != nil {
+		return 0, err
+	}
+	defer s.mu.Unlock()
+
+	user, ok := s.users[arg.Username]
+	if !ok || !user.TotpEnabled || user.TotpLastStep >= arg.TotpLastStep {
+		return 0, nil
+	}
+	user.TotpLastStep = arg.TotpLastStep
+	s.users[user.Username] = user
+	return 1, nil
+}
+
+func (s *Store) CreateRecoveryCode(ctx context.Context, arg db.CreateRecoveryCodeParams) (db.RecoveryCode, error) {
+	if err := s.lock(ctx); err != nil {
+		return db.RecoveryCode{}, err
+	}
+	defer s.mu.Unlock()
+
+	return s.createRecoveryCode(arg)
+}
+
+func (s *Store) createRecoveryCode(arg db.CreateRecoveryCodeParams) (db.RecoveryCode, error) {
+	if _, ok := s.users[arg.Username]; !ok {
+		return db.RecoveryCode{}, constraintError("recovery_codes_username_fkey", db.ErrForeignKey)
+	}
+	s.lastCodeID++
+	code := db.RecoveryCode{
+		ID:         s.lastCodeID,
+		Username:   arg.Username,
+		HashedCode: arg.HashedCode,
+		CreatedAt:  s.timestamp(),
+	}
+	s.recoveryCodes[code.ID] = code
+	return code, nil
+}
+
+func (s *Store) ListRecoveryCodes(ctx context.Context, username string) ([]db.RecoveryCode, error) {
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	codes := []db.RecoveryCode{}
+	for _, code := range s.recoveryCodes {
+		if code.Username == username {
+			codes = append(codes, code)
+		}
+	}
+	sort.Slice(codes, func(i, j int) bool { return codes[i].ID < codes[j].ID })
+	return codes, nil
+}
+
+func (s *Store) DeleteRecoveryCode(ctx context.Context, id int64) (int64, error) {
+	if err := s.lock(ctx); err != nil {
+		return 0, err
+	}
+	defer s.mu.Unlock()
+
+	if _, ok := s.recoveryCodes[id]; !ok {
+		return 0, nil
+	}
+	delete(s.recoveryCodes, id)
+	return 1, nil
+}
+
+func (s *Store) DeleteRecoveryCodes(ctx context.Context, username string) error {
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	s.deleteRecoveryCodes(username)
+	return nil
+}
+
+func (s *Store) deleteRecoveryCodes(username string) {
+	for id, code := range s.recoveryCodes {
+		if code.Username == username {
+			delete(s.recoveryCodes, id)
+		}
+	}
+}
+
+// EnableTOTPTx enables the TOTP of the user and replaces their recovery
+// codes. The store is locked for the whole transaction, so it is applied
+// atomically.
+func (s *Store) EnableTOTPTx(ctx context.Context, arg db.EnableTOTPTxParams) (db.EnableTOTPTxResult, error) {
+	if err := s.lock(ctx); err != nil {
+		return db.EnableTOTPTxResult{}, err
+	}
+	defer s.mu.Unlock()
+
+	var r db.EnableTOTPTxResult
+	var err error
+	r.User, err = s.enableTOTP(db.EnableTOTPParams{Username: arg.Username, TotpLastStep: arg.LastStep})
+	if err != nil {
+		return db.EnableTOTPTxResult{}, err
+	}
+	// nothing below fails, as the user exists
+	s.deleteRecoveryCodes(arg.Username)
+	r.RecoveryCodes = make([]db.RecoveryCode, 0, len(arg.HashedRecoveryCodes))
+	for _, hashedCode := range arg.HashedRecoveryCodes {
+		code, _ := s.createRecoveryCode(db.CreateRecoveryCodeParams{Username: arg.Username, HashedCode: hashedCode})
+		r.RecoveryCodes = append(r.RecoveryCodes, code)
+	}
+	return r, nil
+}
+
+func (s *Store) CreateLoginChallenge(ctx context.Context, arg db.CreateLoginChallengeParams) (db.LoginChallenge, error) {
+	if err := s.lock(ctx); err != nil {
+		return db.LoginChallenge{}, err
+	}
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[arg.Username]; !ok {
+		return db.LoginChallenge{}, constraintError("login_challenges_username_fkey", db.ErrForeignKey)
+	}
+	if _, ok := s.loginChallenges[arg.ID]; ok {
+		return db.LoginChallenge{}, constraintError("login_challenges_pkey", db.ErrUniqueViolation)
+	}
+	challenge := db.LoginChallenge{
+		ID:        arg.ID,
+		Username:  arg.Username,
+		ExpiresAt: arg.ExpiresAt.Truncate(time.Microsecond),
+		CreatedAt: s.timestamp(),
+	}
+	s.loginChallenges[challenge.ID] = challenge
+	return challenge, nil
+}
+
+func (s *Store) DeleteLoginChallenge(ctx context.Context, id uuid.UUID) (db.LoginChallenge, error) {
+	if err := s.lock(ctx); err != nil {
+		return db.LoginChallenge{}, err
+	}
+	defer s.mu.Unlock()
+
+	challenge, ok := s.loginChallenges[id]
+	if !ok {
+		return db.LoginChallenge{}, db.ErrRecordNotFound
+	}
+	delete(s.loginChallenges, id)
+	return challenge, nil
+}
+
+func (s *Store) DeleteExpiredLoginChallenges(ctx context.Context, username string) error {
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	now := s.timestamp()
+	for id, challenge := range s.loginChallenges {
+		if challenge.Username == username && challenge.ExpiresAt.Before(now) {
+			delete(s.loginChallenges, id)
+		}
+	}
+	return nil
+}
+
+func (s *Store) CreateAccount(ctx context.Context, arg db.CreateAccountParams) (db.Account, error) {
+	if err := s.lock(ctx); err != nil {
+		return db.Account{}, err
+	}
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[arg.Owner]; !ok {
+		return db.Account{}, constraintError("accounts_owner_fkey", db.ErrForeignKey)
+	}
+	for _, account := range s.accounts {
+		if account.Owner == arg.Owner && account.Currency == arg.Currency {
+			return db.Account{}, constraintError("owner_currency_key", db.ErrOwnerCurrencyExists)
+		}
+	}
+	s.lastAccountID++
+	account := db.Account{
+		ID:        s.lastAccountID,
+		Owner:     arg.Owner,
+		Balance:   arg.Balance,
+		Currency:  arg.Currency,
+		CreatedAt: s.timestamp(),
+	}
+	s.accounts[account.ID] = account
+	return account, nil
+}
+
+func (s *Store) GetAccount(ctx context.Context, id int64) (db.Account, error) {
+	if err := s.lock(ctx); err != nil {
+		return db.Account{}, err
+	}
+	defer s.mu.Unlock()
+
+	account, ok := s.accounts[id]
+	if !ok {
+		return db.Account{}, db.ErrRecordNotFound
+	}
+	return account, nil
+}
+
+// GetAccountForUpdate is GetAccount, as every method holds the store lock
+func (s *Store) GetAccountForUpdate(ctx context.Context, id int64) (db.Account, error) {
+	return s.GetAccount(ctx, id)
+}
+
+func (s *Store) ListAccounts(ctx context.Context, arg db.ListAccountsParams) ([]db.Account, error) {
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	var accounts []db.Account
+	for _, account := range s.accounts {
+		if account.Owner == arg.Owner {
+			accounts = append(accounts, account)
+		}
+	}
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].ID < accounts[j].ID })
+	return page(accounts, arg.Limit, arg.Offset), nil
+}
+
+func (s *Store) UpdateAccount(ctx context.Context, arg db.UpdateAccountParams) (db.Account, error) {
+	if err := s.lock(ctx); err != nil {
+		return db.Account{}, err
+	}
+	defer s.mu.Unlock()
+
+	account, ok := s.accounts[arg.ID]
+	if !ok {
+		return db.Account{}, db.ErrRecordNotFound
+	}
+	account.Balance = arg.Balance
+	s.accounts[account.ID] = account
+	return account, nil
+}
+
+func (s *Store) AddAccountBalance(ctx context.Context, arg db.AddAccountBalanceParams) (db.Account, error) {
+	if err := s.lock(ctx); err != nil {
+		return db.Account{}, err
+	}
+	defer s.mu.Unlock()
+
+	return s.addAccountBalance(arg.ID, arg.Amount)
+}
+
+func (s *Store) addAccountBalance(id int64, amount int64) (db.Account, error) {
+	account, ok := s.accounts[id]
+	if !ok {
+		return db.Account{}, db.ErrRecordNotFound
+	}
+	balance, err := addBalance(account.Balance, amount)
+	if err != nil {
+		return db.Account{}, err
+	}
+	account.Balance = balance
+	s.accounts[account.ID] = account
+	return account, nil
+}
+
+// addBalance adds amount to balance, failing like a bigint column when the
+// result overflows
+func addBalance(balance, amount int64) (int64, error) {
+	if (amount > 0 && balance > math.MaxInt64-amount) || (amount < 0 && balance < math.MinInt64-amount) {
+		return 0, fmt.Errorf("%w: bigint out of range", db.ErrOutOfRange)
+	}
+	return balance + amount, nil
+}
+
+func (s *Store) SetAccountFrozen(ctx context.Context, arg db.SetAccountFrozenParams) (db.Account, error) {
+	if err := s.lock(ctx); err != nil {
+		return db.Account{}, err
+	}
+	defer s.mu.Unlock()
+
+	account, ok := s.accounts[arg.ID]
+	if !ok {
+		return db.Account{}, db.ErrRecordNotFound
+	}
+	account.Frozen = arg.Frozen
+	s.accounts[account.ID] = account
+	return account, nil
+}
+
+func (s *Store) DeleteAccount(ctx context.Context, id int64) error {
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	for _, entry := range s.entries {
+		if entry.AccountID == id {
+			return constraintError("entries_account_id_fkey", db.ErrForeignKey)
+		}
+	}
+	for _, transfer := range s.transfers {
+		if transfer.FromAccountID == id {
+			return constraintError("transfers_from_account_id_fkey", db.ErrForeignKey)
+		}
+		if transfer.ToAccountID == id {
+			return constraintError("transfers_to_account_id_fkey", db.ErrForeignKey)
+		}
+	}
+	delete(s.accounts, id)
+	return nil
+}
+
+func (s *Store) CreateEntry(ctx context.Context, arg db.CreateEntryParams) (db.Entry, error) {
+	if err := s.lock(ctx); err != nil {
+		return db.Entry{}, err
+	}
+	defer s.mu.Unlock()
+
+	return s.createEntry(arg)
+}
+
+func (s *Store) createEntry(arg db.CreateEntryParams) (db.Entry, error) {
+	if _, ok := s.accounts[arg.AccountID]; !ok {
+		return db.Entry{}, constraintError("entries_account_id_fkey", db.ErrForeignKey)
+	}
+	s.lastEntryID++
+	entry := db.Entry{
+		ID:        s.lastEntryID,
+		AccountID: arg.AccountID,
+		Amount:    arg.Amount,
+		CreatedAt: s.timestamp(),
+	}
+	s.entries[entry.ID] = entry
+	return entry, nil
+}
+
+func (s *Store) GetEntry(ctx context.Context, id int64) (db.Entry, error) {
+	if err := s.lock(ctx); err != nil {
+		return db.Entry{}, err
+	}
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[id]
+	if !ok {
+		return db.Entry{}, db.ErrRecordNotFound
+	}
+	return entry, nil
+}
+
+func (s *Store) ListEntries(ctx context.Context, arg db.ListEntriesParams) ([]db.Entry, error) {
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	var entries []db.Entry
+	for _, entry := range s.entries {
+		if entry.AccountID == arg.AccountID {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ID < entries[j].ID })
+	return page(entries, arg.Limit, arg.Offset), nil
+}
+
+func (s *Store) CreateTransfer(ctx context.Context, arg db.CreateTransferParams) (db.Transfer, error) {
+	if err := s.lock(ctx); err != nil {
+		return db.Transfer{}, err
+	}
+	defer s.mu.Unlock()
+
+	return s.createTransfer(arg)
+}
+
+func (s *Store) createTransfer(arg db.CreateTransferParams) (db.Transfer, error) {
+	if _, ok := s.accounts[arg.FromAccountID]; !ok {
+		return db.Transfer{}, constraintError("transfers_from_account_id_fkey", db.ErrForeignKey)
+	}
+	if _, ok := s.accounts[arg.ToAccountID]; !ok {
+		return db.Transfer{}, constraintError("transfers_to_account_id_fkey", db.ErrForeignKey)
+	}
+	s.lastTransferID++
+	transfer := db.Transfer{
+		ID:            s.lastTransferID,
+		FromAccountID: arg.FromAccountID,
+		ToAccountID:   arg.ToAccountID,
+		Amount:        arg.Amount,
+		CreatedAt:     s.timestamp(),
+	}
+	s.transfers[transfer.ID] = transfer
+	return transfer, nil
+}
+
+func (s *Store) GetTransfer(ctx context.Context, id int64) (db.Transfer, error) {
+	if err := s.lock(ctx); err != nil {
+		return db.Transfer{}, err
+	}
+	defer s.mu.Unlock()
+
+	transfer, ok := s.transfers[id]
+	if !ok {
+		return db.Transfer{}, db.ErrRecordNotFound
+	}
+	return transfer, nil
+}
+
+func (s *Store) ListTransfers(ctx context.Context, arg db.ListTransfersParams) ([]db.Transfer, error) {
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	var transfers []db.Transfer
+	for _, transfer := range s.transfers {
+		if transfer.FromAccountID == arg.FromAccountID || transfer.ToAccountID == arg.ToAccountID {
+			transfers = append(transfers, transfer)
+		}
+	}
+	sort.Slice(transfers, func(i, j int) bool { return transfers[i].ID < transfers[j].ID })
+	return page(transfers, arg.Limit, arg.Offset), nil
+}
+
+// TransferTx performs a money transfer from one account to the other. The
+// store is locked for the whole transfer, so it is applied atomically: a
+// transfer that fails leaves no trace.
+func (s *Store) TransferTx(ctx context.Context, arg db.TransferTxParams) (db.TransferTxResult, error) {
+	if err := s.lock(ctx); err != nil {
+		return db.TransferTxResult{}, err
+	}
+	defer s.mu.Unlock()
+
+	if arg.Amount <= 0 {
+		return db.TransferTxResult{}, db.ErrInvalidAmount
+	}
+	from, ok := s.accounts[arg.FromAccountID]
+	if !ok {
+		return db.TransferTxResult{}, constraintError("transfers_from_account_id_fkey", db.ErrForeignKey)
+	}
+	to, ok := s.accounts[arg.ToAccountID]
+	if !ok {
+		return db.TransferTxResult{}, constraintError("transfers_to_account_id_fkey", db.ErrForeignKey)
+	}
+	// check the balances in the order SQLStore updates them, as a transfer
+	// to the same account overflows if the first update does
+	first, second := -arg.Amount, arg.Amount
+	if arg.FromAccountID > arg.ToAccountID {
+		first, second = second, first
+	}
+	if from.ID == to.ID {
+		balance, err := addBalance(from.Balance, first)
+		if err != nil {
+			return db.TransferTxResult{}, err
+		}
+		if _, err := addBalance(balance, second); err != nil {
+			return db.TransferTxResult{}, err
+		}
+	} else {
+		if _, err := addBalance(from.Balance, -arg.Amount); err != nil {
+			return db.TransferTxResult{}, err
+		}
+		if _, err := addBalance(to.Balance, arg.Amount); err != nil {
+			return db.TransferTxResult{}, err
+		}
+	}
+
+	// nothing below fails, as the accounts exist and the balances fit
+	var r db.TransferTxResult
+	r.Transfer, _ = s.createTransfer(db.CreateTransferParams(arg))
+	r.FromEntry, _ = s.createEntry(db.CreateEntryParams{AccountID: arg.FromAccountID, Amount: -arg.Amount})
+	r.ToEntry, _ = s.createEntry(db.CreateEntryParams{AccountID: arg.ToAccountID, Amount: arg.Amount})
+	if arg.FromAccountID < arg.ToAccountID {
+		r.FromAccount, _ = s.addAccountBalance(arg.FromAccountID, -arg.Amount)
+		r.ToAccount, _ = s.addAccountBalance(arg.ToAccountID, arg.Amount)
+	} else {
+		r.ToAccount, _ = s.addAccountBalance(arg.ToAccountID, arg.Amount)
+		r.FromAccount, _ = s.addAccountBalance(arg.FromAccountID, -arg.Amount)
+	}
+	return r, nil
+}
+
+func (s *Store) CreateIdempotencyKey(ctx context.Context, arg db.CreateIdempotencyKeyParams) (db.IdempotencyKey, error) {
+	if err := s.lock(ctx); err != nil {
+		return db.IdempotencyKey{}, err
+	}
+	defer s.mu.Unlock()
+
+	id := idempotencyKeyID{scope: arg.Scope, key: arg.Key}
+	now := s.timestamp()
+	if key, ok := s.idempotencyKeys[id]; ok && !key.CreatedAt.Before(now.Add(-idempotencyKeyTTL)) {
+		return db.IdempotencyKey{}, db.ErrRecordNotFound
+	}
+	key := db.IdempotencyKey{
+		Scope:       arg.Scope,
+		Key:         arg.Key,
+		RequestHash: arg.RequestHash,
+		CreatedAt:   now,
+	}
+	s.idempotencyKeys[id] = key
+	return key, nil
+}
+
+func (s *Store) GetIdempotencyKey(ctx context.Context, arg db.GetIdempotencyKeyParams) (db.IdempotencyKey, error) {
+	if err := s.lock(ctx); err != nil {
+		return db.IdempotencyKey{}, err
+	}
+	defer s.mu.Unlock()
+
+	key, ok := s.idempotencyKeys[idempotencyKeyID{scope: arg.Scope, key: arg.Key}]
+	if !ok {
+		return db.IdempotencyKey{}, db.ErrRecordNotFound
+	}
+	key.ResponseBody = copyBytes(key.ResponseBody)
+	return key, nil
+}
+
+func (s *Store) SetIdempotencyKeyResponse(ctx context.Context, arg db.SetIdempotencyKeyResponseParams) error {
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	id := idempotencyKeyID{scope: arg.Scope, key: arg.Key}
+	key, ok := s.idempotencyKeys[id]
+	if !ok {
+		return nil
+	}
+	key.ResponseStatus = arg.ResponseStatus
+	key.ResponseBody = copyBytes(arg.ResponseBody)
+	s.idempotencyKeys[id] = key
+	return nil
+}
+
+func (s *Store) DeleteIdempotencyKey(ctx context.Context, arg db.DeleteIdempotencyKeyParams) error {
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	delete(s.idempotencyKeys, idempotencyKeyID{scope: arg.Scope, key: arg.Key})
+	return nil
+}
+
+func (s *Store) TakeRateLimitToken(ctx context.Context, arg db.TakeRateLimitTokenParams) (db.RateLimitBucket, error) {
+	if err := s.lock(ctx); err != nil {
+		return db.RateLimitBucket{}, err
+	}
+	defer s.mu.Unlock()
+
+	now := s.timestamp()
+	bucket, ok := s.rateLimits[arg.Key]
+	if !ok {
+		bucket = db.RateLimitBucket{Key: arg.Key, Tokens: arg.Burst - 1, Allowed: true, UpdatedAt: now}
+		s.rateLimits[arg.Key] = bucket
+		return bucket, nil
+	}
+	tokens := math.Min(arg.Burst, bucket.Tokens+now.Sub(bucket.UpdatedAt).Seconds()*arg.Rate)
+	bucket.Allowed = tokens >= 1
+	if bucket.Allowed {
+		tokens--
+	}
+	bucket.Tokens = tokens
+	bucket.UpdatedAt = now
+	s.rateLimits[arg.Key] = bucket
+	return bucket, nil
+}
+
+func (s *Store) DeleteRateLimitBuckets(ctx context.Context, before time.Time) (int64, error) {
+	if err := s.lock(ctx); err != nil {
+		return 0, err
+	}
+	defer s.mu.Unlock()
+
+	var n int64
+	for key, bucket := range s.rateLimits {
+		if bucket.UpdatedAt.Before(before) {
+			delete(s.rateLimits, key)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// page applies LIMIT and OFFSET to rows
+func page[T any](rows []T, limit, offset int32) []T {
+	if int(offset) >= len(rows) {
+		return []T{}
+	}
+	rows = rows[offset:]
+	if int(limit) < len(rows) {
+		rows = rows[:limit]
+	}
+	return rows
+}
+
+// copyBytes keeps callers from sharing a bytea with the store
+func copyBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return append([]byte{}, b...)
+}
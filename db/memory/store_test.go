@@ -0,0 +1,51 @@
+package memdb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	db "github.com/dpsigor/cheatsheet-golang-postgres/db/sqlc"
+	"github.com/dpsigor/cheatsheet-golang-postgres/db/storetest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) db.Store {
+		return NewStore()
+	})
+}
+
+func TestIdempotencyKeyExpiry(t *testing.T) {
+	store := NewStore()
+	now := time.Now()
+	store.now = func() time.Time { return now }
+	arg := db.CreateIdempotencyKeyParams{Scope: "alice", Key: "key", RequestHash: "hash"}
+
+	_, err := store.CreateIdempotencyKey(context.Background(), arg)
+	require.NoError(t, err)
+
+	now = now.Add(idempotencyKeyTTL - time.Minute)
+	_, err = store.CreateIdempotencyKey(context.Background(), arg)
+	require.ErrorIs(t, err, db.ErrRecordNotFound)
+
+	now = now.Add(2 * time.Minute)
+	key, err := store.CreateIdempotencyKey(context.Background(), arg)
+	require.NoError(t, err)
+	require.Equal(t, now.Truncate(time.Microsecond), key.CreatedAt)
+}
+
+func TestResponseBodyIsCopied(t *testing.T) {
+	store := NewStore()
+	ctx := context.Background()
+	_, err := store.CreateIdempotencyKey(ctx, db.CreateIdempotencyKeyParams{Key: "key"})
+	require.NoError(t, err)
+	body := []byte("body")
+	err = store.SetIdempotencyKeyResponse(ctx, db.SetIdempotencyKeyResponseParams{Key: "key", ResponseStatus: 200, ResponseBody: body})
+	require.NoError(t, err)
+	body[0] = 'B'
+
+	key, err := store.GetIdempotencyKey(ctx, db.GetIdempotencyKeyParams{Key: "key"})
+	require.NoError(t, err)
+	require.Equal(t, []byte("body"), key.ResponseBody)
+}
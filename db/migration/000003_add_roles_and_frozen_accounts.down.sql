@@ -0,0 +1,3 @@
+ALTER TABLE IF EXISTS "accounts" DROP COLUMN IF EXISTS "frozen";
+
+ALTER TABLE IF EXISTS "users" DROP COLUMN IF EXISTS "role";
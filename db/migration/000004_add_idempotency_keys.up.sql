@@ -0,0 +1,13 @@
+CREATE TABLE "idempotency_keys" (
+  "scope" varchar NOT NULL,
+  "key" varchar NOT NULL,
+  "request_hash" varchar NOT NULL,
+  "response_status" int NOT NULL DEFAULT 0,
+  "response_body" bytea,
+  "created_at" timestamptz NOT NULL DEFAULT (now()),
+  PRIMARY KEY ("scope", "key")
+);
+
+COMMENT ON COLUMN "idempotency_keys"."scope" IS 'username of the client, empty for unauthenticated requests';
+
+COMMENT ON COLUMN "idempotency_keys"."response_status" IS '0 while the request is in progress';
@@ -0,0 +1,18 @@
+ALTER TABLE "users" ADD COLUMN "failed_login_attempts" int NOT NULL DEFAULT 0;
+
+ALTER TABLE "users" ADD COLUMN "locked_until" timestamptz NOT NULL DEFAULT '0001-01-01 00:00:00Z';
+
+CREATE TABLE "login_attempts" (
+  "id" bigserial PRIMARY KEY,
+  "username" varchar NOT NULL,
+  "ip_address" varchar NOT NULL,
+  "user_agent" varchar NOT NULL,
+  "success" boolean NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+ALTER TABLE "login_attempts" ADD FOREIGN KEY ("username") REFERENCES "users" ("username");
+
+CREATE INDEX ON "login_attempts" ("username", "id");
+
+COMMENT ON COLUMN "users"."failed_login_attempts" IS 'failed logins since the last successful one';
@@ -0,0 +1,13 @@
+CREATE TABLE "password_reset_tokens" (
+  "id" bigserial PRIMARY KEY,
+  "username" varchar NOT NULL,
+  "hashed_token" varchar UNIQUE NOT NULL,
+  "expires_at" timestamptz NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+ALTER TABLE "password_reset_tokens" ADD FOREIGN KEY ("username") REFERENCES "users" ("username");
+
+CREATE INDEX ON "password_reset_tokens" ("username");
+
+COMMENT ON COLUMN "password_reset_tokens"."hashed_token" IS 'SHA-256 of the token sent to the user, who is the only one to know the token';
@@ -0,0 +1,25 @@
+CREATE TABLE "api_keys" (
+  "id" bigserial PRIMARY KEY,
+  "username" varchar NOT NULL,
+  "name" varchar NOT NULL,
+  "prefix" varchar UNIQUE NOT NULL,
+  "hashed_secret" varchar NOT NULL,
+  "scopes" varchar[] NOT NULL DEFAULT '{}',
+  "expires_at" timestamptz NOT NULL DEFAULT '0001-01-01 00:00:00Z',
+  "last_used_at" timestamptz NOT NULL DEFAULT '0001-01-01 00:00:00Z',
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+ALTER TABLE "api_keys" ADD FOREIGN KEY ("username") REFERENCES "users" ("username");
+
+CREATE INDEX ON "api_keys" ("username");
+
+COMMENT ON COLUMN "api_keys"."prefix" IS 'public part of the key, which identifies it in the keys and the logs';
+
+COMMENT ON COLUMN "api_keys"."hashed_secret" IS 'SHA-256 of the secret part of the key, which only the user knows';
+
+COMMENT ON COLUMN "api_keys"."scopes" IS 'scopes the key is restricted to, all of the user''s access if empty';
+
+COMMENT ON COLUMN "api_keys"."expires_at" IS 'the key never expires if zero';
+
+COMMENT ON COLUMN "api_keys"."last_used_at" IS 'zero until the key is first used';
@@ -0,0 +1,66 @@
+CREATE TABLE "oauth_clients" (
+  "id" varchar PRIMARY KEY,
+  "owner" varchar NOT NULL,
+  "name" varchar NOT NULL,
+  "hashed_secret" varchar NOT NULL,
+  "redirect_uris" varchar[] NOT NULL,
+  "scopes" varchar[] NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE TABLE "oauth_authorization_codes" (
+  "id" bigserial PRIMARY KEY,
+  "hashed_code" varchar UNIQUE NOT NULL,
+  "client_id" varchar NOT NULL,
+  "username" varchar NOT NULL,
+  "redirect_uri" varchar NOT NULL,
+  "redirect_uri_given" boolean NOT NULL,
+  "scopes" varchar[] NOT NULL,
+  "code_challenge" varchar NOT NULL,
+  "issued_at" timestamptz NOT NULL,
+  "expires_at" timestamptz NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE TABLE "oauth_refresh_tokens" (
+  "id" bigserial PRIMARY KEY,
+  "hashed_token" varchar UNIQUE NOT NULL,
+  "client_id" varchar NOT NULL,
+  "username" varchar NOT NULL,
+  "scopes" varchar[] NOT NULL,
+  "issued_at" timestamptz NOT NULL,
+  "expires_at" timestamptz NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+ALTER TABLE "oauth_clients" ADD FOREIGN KEY ("owner") REFERENCES "users" ("username");
+
+ALTER TABLE "oauth_authorization_codes" ADD FOREIGN KEY ("client_id") REFERENCES "oauth_clients" ("id");
+
+ALTER TABLE "oauth_authorization_codes" ADD FOREIGN KEY ("username") REFERENCES "users" ("username");
+
+ALTER TABLE "oauth_refresh_tokens" ADD FOREIGN KEY ("client_id") REFERENCES "oauth_clients" ("id");
+
+ALTER TABLE "oauth_refresh_tokens" ADD FOREIGN KEY ("username") REFERENCES "users" ("username");
+
+CREATE INDEX ON "oauth_clients" ("owner");
+
+CREATE INDEX ON "oauth_refresh_tokens" ("username");
+
+COMMENT ON COLUMN "oauth_clients"."owner" IS 'user who registered the client';
+
+COMMENT ON COLUMN "oauth_clients"."hashed_secret" IS 'SHA-256 of the client secret, which only the owner knows';
+
+COMMENT ON COLUMN "oauth_clients"."scopes" IS 'scopes the client may ask the users for';
+
+COMMENT ON COLUMN "oauth_authorization_codes"."hashed_code" IS 'SHA-256 of the code sent to the client through the redirect URI';
+
+COMMENT ON COLUMN "oauth_authorization_codes"."redirect_uri_given" IS 'whether the authorization request had the redirect URI, which the token request must then repeat';
+
+COMMENT ON COLUMN "oauth_authorization_codes"."issued_at" IS 'issue time by the clock of the application, which password changes are compared with';
+
+COMMENT ON COLUMN "oauth_authorization_codes"."code_challenge" IS 'PKCE S256 challenge, which the code verifier sent with the code must match';
+
+COMMENT ON COLUMN "oauth_refresh_tokens"."hashed_token" IS 'SHA-256 of the refresh token, which only the client knows';
+
+COMMENT ON COLUMN "oauth_refresh_tokens"."issued_at" IS 'issue time by the clock of the application, which password changes are compared with';
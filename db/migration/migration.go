@@ -0,0 +1,134 @@
+// Package migration embeds the SQL migrations of the database and applies
+// them with golang-migrate.
+package migration
+
+import (
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+)
+
+//go:embed *.sql
+var files embed.FS
+
+// Status is the migration state of a database
+type Status struct {
+	// Version is the last applied migration, 0 if none was applied
+	Version uint
+	// Dirty is set when the last migration failed halfway and must be fixed
+	// by hand before migrating again
+	Dirty bool
+	// Latest is the last migration embedded in the binary
+	Latest uint
+}
+
+// Migrator applies the embedded migrations. Postgres advisory locks
+// serialize the migrators of all replicas, so a migration runs only once.
+type Migrator struct {
+	db *sql.DB
+	m  *migrate.Migrate
+}
+
+// NewMigrator connects to the database with its own connection pool
+func NewMigrator(driver, source string) (*Migrator, error) {
+	db, err := sql.Open(driver, source)
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to db: %w", err)
+	}
+	dbDriver, err := postgres.WithInstance(db, &postgres.Config{})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("cannot create migration driver: %w", err)
+	}
+	src, err := iofs.New(files, ".")
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("cannot read migrations: %w", err)
+	}
+	m, err := migrate.NewWithInstance("iofs", src, "postgres", dbDriver)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("cannot create migrator: %w", err)
+	}
+	return &Migrator{db: db, m: m}, nil
+}
+
+// Up applies all the pending migrations
+func (m *Migrator) Up() error {
+	return ignoreNoChange(m.m.Up())
+}
+
+// Down rolls back the last applied migration
+func (m *Migrator) Down() error {
+	return ignoreNoChange(m.m.Steps(-1))
+}
+
+// Goto migrates up or down to version
+func (m *Migrator) Goto(version uint) error {
+	return ignoreNoChange(m.m.Migrate(version))
+}
+
+// Status returns the migration state of the database
+func (m *Migrator) Status() (Status, error) {
+	latest, err := LatestVersion()
+	if err != nil {
+		return Status{}, err
+	}
+	version, dirty, err := m.m.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		return Status{Latest: latest}, nil
+	}
+	if err != nil {
+		return Status{}, err
+	}
+	return Status{Version: version, Dirty: dirty, Latest: latest}, nil
+}
+
+// Close releases the connections of the migrator
+func (m *Migrator) Close() error {
+	srcErr, dbErr := m.m.Close()
+	if srcErr != nil {
+		return srcErr
+	}
+	if dbErr != nil {
+		return dbErr
+	}
+	return m.db.Close()
+}
+
+// LatestVersion returns the version of the last embedded migration
+func LatestVersion() (uint, error) {
+	src, err := iofs.New(files, ".")
+	if err != nil {
+		return 0, fmt.Errorf("cannot read migrations: %w", err)
+	}
+	defer src.Close()
+
+	version, err := src.First()
+	if err != nil {
+		return 0, fmt.Errorf("cannot read migrations: %w", err)
+	}
+	for {
+		next, err := src.Next(version)
+		if errors.Is(err, fs.ErrNotExist) {
+			return version, nil
+		}
+		if err != nil {
+			return 0, fmt.Errorf("cannot read migrations: %w", err)
+		}
+		version = next
+	}
+}
+
+func ignoreNoChange(err error) error {
+	if errors.Is(err, migrate.ErrNoChange) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,17 @@
+package migration
+
+import (
+	"io/fs"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLatestVersion(t *testing.T) {
+	latest, err := LatestVersion()
+	require.NoError(t, err)
+
+	names, err := fs.Glob(files, "*.up.sql")
+	require.NoError(t, err)
+	require.Len(t, names, int(latest))
+}
@@ -37,3 +37,9 @@ RETURNING *;
 -- name: DeleteAccount :exec
 DELETE FROM accounts
 WHERE id = $1;
+
+-- name: SetAccountFrozen :one
+UPDATE accounts
+SET frozen = $2
+WHERE id = $1
+RETURNING *;
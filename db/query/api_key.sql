@@ -0,0 +1,27 @@
+-- name: CreateAPIKey :one
+INSERT INTO api_keys (
+  username, name, prefix, hashed_secret, scopes, expires_at
+) VALUES (
+  sqlc.arg(username), sqlc.arg(name), sqlc.arg(prefix), sqlc.arg(hashed_secret),
+  COALESCE(sqlc.arg(scopes)::varchar[], '{}'), sqlc.arg(expires_at)
+)
+RETURNING *;
+
+-- name: GetAPIKeyByPrefix :one
+SELECT * FROM api_keys
+WHERE prefix = $1 LIMIT 1;
+
+-- name: ListAPIKeys :many
+SELECT * FROM api_keys
+WHERE username = $1
+ORDER BY id;
+
+-- name: DeleteAPIKey :one
+DELETE FROM api_keys
+WHERE id = $1 AND username = $2
+RETURNING *;
+
+-- name: TouchAPIKey :exec
+UPDATE api_keys
+SET last_used_at = $2
+WHERE id = $1;
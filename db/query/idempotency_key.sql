@@ -0,0 +1,28 @@
+-- name: CreateIdempotencyKey :one
+-- Claims the key for a new request. Keys older than a day are reclaimed, and
+-- no row is returned when the key is already in use.
+INSERT INTO idempotency_keys (
+  scope, key, request_hash
+) VALUES (
+  $1, $2, $3
+)
+ON CONFLICT (scope, key) DO UPDATE
+SET request_hash = EXCLUDED.request_hash,
+  response_status = 0,
+  response_body = NULL,
+  created_at = now()
+WHERE idempotency_keys.created_at < now() - interval '1 day'
+RETURNING *;
+
+-- name: GetIdempotencyKey :one
+SELECT * FROM idempotency_keys
+WHERE scope = $1 AND key = $2 LIMIT 1;
+
+-- name: SetIdempotencyKeyResponse :exec
+UPDATE idempotency_keys
+SET response_status = $3, response_body = $4
+WHERE scope = $1 AND key = $2;
+
+-- name: DeleteIdempotencyKey :exec
+DELETE FROM idempotency_keys
+WHERE scope = $1 AND key = $2;
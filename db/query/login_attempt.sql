@@ -0,0 +1,14 @@
+-- name: CreateLoginAttempt :one
+INSERT INTO login_attempts (
+  username, ip_address, user_agent, success
+) VALUES (
+  $1, $2, $3, $4
+)
+RETURNING *;
+
+-- name: ListLoginAttempts :many
+SELECT * FROM login_attempts
+WHERE username = $1
+ORDER BY id DESC
+LIMIT $2
+OFFSET $3;
@@ -0,0 +1,17 @@
+-- name: CreateLoginChallenge :one
+INSERT INTO login_challenges (
+  id, username, expires_at
+) VALUES (
+  $1, $2, $3
+)
+RETURNING *;
+
+-- name: DeleteLoginChallenge :one
+-- Claims the challenge, so that it is answered only once
+DELETE FROM login_challenges
+WHERE id = $1
+RETURNING *;
+
+-- name: DeleteExpiredLoginChallenges :exec
+DELETE FROM login_challenges
+WHERE username = $1 AND expires_at < now();
@@ -0,0 +1,39 @@
+-- name: CreateOAuthClient :one
+INSERT INTO oauth_clients (
+  id, owner, name, hashed_secret, redirect_uris, scopes
+) VALUES (
+  $1, $2, $3, $4, $5, $6
+)
+RETURNING *;
+
+-- name: GetOAuthClient :one
+SELECT * FROM oauth_clients
+WHERE id = $1 LIMIT 1;
+
+-- name: CreateOAuthAuthorizationCode :one
+INSERT INTO oauth_authorization_codes (
+  hashed_code, client_id, username, redirect_uri, redirect_uri_given, scopes, code_challenge, issued_at, expires_at
+) VALUES (
+  $1, $2, $3, $4, $5, $6, $7, $8, $9
+)
+RETURNING *;
+
+-- name: DeleteOAuthAuthorizationCode :one
+-- Claims the code, so that it is exchanged only once
+DELETE FROM oauth_authorization_codes
+WHERE hashed_code = $1
+RETURNING *;
+
+-- name: CreateOAuthRefreshToken :one
+INSERT INTO oauth_refresh_tokens (
+  hashed_token, client_id, username, scopes, issued_at, expires_at
+) VALUES (
+  $1, $2, $3, $4, $5, $6
+)
+RETURNING *;
+
+-- name: DeleteOAuthRefreshToken :one
+-- Claims the refresh token, which is replaced by a new one on every refresh
+DELETE FROM oauth_refresh_tokens
+WHERE hashed_token = $1
+RETURNING *;
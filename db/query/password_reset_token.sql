@@ -0,0 +1,17 @@
+-- name: CreatePasswordResetToken :one
+INSERT INTO password_reset_tokens (
+  username, hashed_token, expires_at
+) VALUES (
+  $1, $2, $3
+)
+RETURNING *;
+
+-- name: DeletePasswordResetToken :one
+-- Claims the token, so that it is used only once
+DELETE FROM password_reset_tokens
+WHERE hashed_token = $1
+RETURNING *;
+
+-- name: DeletePasswordResetTokens :exec
+DELETE FROM password_reset_tokens
+WHERE username = $1;
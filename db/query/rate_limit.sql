@@ -0,0 +1,24 @@
+-- name: TakeRateLimitToken :one
+-- Refills the bucket of key for the time elapsed since its last update, up
+-- to burst, and takes a token from it if one is left. A missing bucket is
+-- created full.
+INSERT INTO rate_limit_buckets (
+  key, tokens, allowed, updated_at
+) VALUES (
+  sqlc.arg(key), sqlc.arg(burst)::float8 - 1, true, now()
+)
+ON CONFLICT (key) DO UPDATE
+SET tokens = CASE
+    WHEN LEAST(sqlc.arg(burst)::float8, rate_limit_buckets.tokens + EXTRACT(EPOCH FROM now() - rate_limit_buckets.updated_at)::float8 * sqlc.arg(rate)::float8) >= 1
+    THEN LEAST(sqlc.arg(burst)::float8, rate_limit_buckets.tokens + EXTRACT(EPOCH FROM now() - rate_limit_buckets.updated_at)::float8 * sqlc.arg(rate)::float8) - 1
+    ELSE LEAST(sqlc.arg(burst)::float8, rate_limit_buckets.tokens + EXTRACT(EPOCH FROM now() - rate_limit_buckets.updated_at)::float8 * sqlc.arg(rate)::float8)
+  END,
+  allowed = LEAST(sqlc.arg(burst)::float8, rate_limit_buckets.tokens + EXTRACT(EPOCH FROM now() - rate_limit_buckets.updated_at)::float8 * sqlc.arg(rate)::float8) >= 1,
+  updated_at = now()
+RETURNING *;
+
+-- name: DeleteRateLimitBuckets :execrows
+-- Deletes the buckets not used since before, which are full by then and
+-- would be created again as they were
+DELETE FROM rate_limit_buckets
+WHERE updated_at < sqlc.arg(before);
@@ -0,0 +1,20 @@
+-- name: CreateRecoveryCode :one
+INSERT INTO recovery_codes (
+  username, hashed_code
+) VALUES (
+  $1, $2
+)
+RETURNING *;
+
+-- name: ListRecoveryCodes :many
+SELECT * FROM recovery_codes
+WHERE username = $1
+ORDER BY id;
+
+-- name: DeleteRecoveryCode :execrows
+DELETE FROM recovery_codes
+WHERE id = $1;
+
+-- name: DeleteRecoveryCodes :exec
+DELETE FROM recovery_codes
+WHERE username = $1;
@@ -8,4 +8,103 @@ RETURNING *;
 
 -- name: GetUser :one
 SELECT * FROM users
-WHERE username = $1 LIMIT 1;
\ No newline at end of file
+WHERE username = $1 LIMIT 1;
+
+-- name: GetUserByEmail :one
+SELECT * FROM users
+WHERE email = $1 LIMIT 1;
+
+-- name: GetPasswordChangedAt :one
+-- Checked on every authenticated request, to reject the access tokens issued
+-- before the password of the user changed
+SELECT password_changed_at FROM users
+WHERE username = $1 LIMIT 1;
+
+-- name: IsEmailVerified :one
+-- Checked before the actions that need a verified email
+SELECT is_email_verified FROM users
+WHERE username = $1 LIMIT 1;
+
+-- name: VerifyUserEmail :one
+-- Verifies the email of the user, unless it changed since the link was sent
+UPDATE users
+SET is_email_verified = true
+WHERE username = $1 AND email = $2
+RETURNING *;
+
+-- name: UpdateUser :one
+-- Updates the profile fields that are not null. Changing the email resets
+-- its verification, the new one has to be verified again.
+UPDATE users
+SET full_name = COALESCE(sqlc.narg(full_name), full_name),
+  email = COALESCE(sqlc.narg(email), email),
+  is_email_verified = is_email_verified AND COALESCE(sqlc.narg(email) = email, true)
+WHERE username = sqlc.arg(username)
+RETURNING *;
+
+-- name: UpdateUserPassword :one
+-- The change time comes from the clock of the application, which also sets
+-- the issue time of the access tokens it is compared with
+UPDATE users
+SET hashed_password = $2, password_changed_at = $3
+WHERE username = $1
+RETURNING *;
+
+-- name: RehashUserPassword :exec
+-- Replaces the hash of the password of the user by one of the current
+-- algorithm, keeping password_changed_at so that their access tokens stay
+-- valid. Nothing is updated if the password changed since old_hashed_password
+-- was checked.
+UPDATE users
+SET hashed_password = sqlc.arg(hashed_password)
+WHERE username = sqlc.arg(username) AND hashed_password = sqlc.arg(old_hashed_password);
+
+-- name: UpdateUserRole :one
+UPDATE users
+SET role = $2
+WHERE username = $1
+RETURNING *;
+
+-- name: RecordFailedLogin :one
+-- Counts a failed login of the user. Once max_attempts logins failed in a
+-- row, the user is locked for lockout_seconds, doubled on every further
+-- failure up to max_lockout_seconds. The lockout starts at now, from the
+-- clock of the application, which also checks it.
+UPDATE users
+SET failed_login_attempts = failed_login_attempts + 1,
+  locked_until = CASE
+    WHEN failed_login_attempts + 1 >= sqlc.arg(max_attempts)::int
+    THEN sqlc.arg(now)::timestamptz + make_interval(secs => LEAST(
+      sqlc.arg(max_lockout_seconds)::float8,
+      sqlc.arg(lockout_seconds)::float8 * power(2, LEAST(failed_login_attempts + 1 - sqlc.arg(max_attempts)::int, 32))
+    ))
+    ELSE locked_until
+  END
+WHERE username = sqlc.arg(username)
+RETURNING *;
+
+-- name: ResetFailedLogins :exec
+UPDATE users
+SET failed_login_attempts = 0
+WHERE username = $1;
+
+-- name: SetTOTPSecret :one
+-- Starts the TOTP enrollment of the user. No row is returned once TOTP is
+-- enabled, so that enrolling again does not replace the secret in use.
+UPDATE users
+SET totp_secret = $2
+WHERE username = $1 AND NOT totp_enabled
+RETURNING *;
+
+-- name: EnableTOTP :one
+UPDATE users
+SET totp_enabled = true, totp_last_step = $2
+WHERE username = $1 AND NOT totp_enabled AND totp_secret <> ''
+RETURNING *;
+
+-- name: UseTOTPStep :execrows
+-- Accepts a TOTP code of the given time step. No row is updated when a code
+-- of this step or a later one was already accepted.
+UPDATE users
+SET totp_last_step = $2
+WHERE username = $1 AND totp_enabled AND totp_last_step < $2;
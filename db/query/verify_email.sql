@@ -0,0 +1,15 @@
+-- name: CreateVerifyEmail :one
+INSERT INTO verify_emails (
+  username, email, hashed_token, expires_at
+) VALUES (
+  $1, $2, $3, $4
+)
+RETURNING *;
+
+-- name: UseVerifyEmail :one
+-- Claims the token, so that it is used only once. No row is returned once
+-- the token was used or has expired.
+UPDATE verify_emails
+SET is_used = true
+WHERE hashed_token = $1 AND NOT is_used AND expires_at > now()
+RETURNING *;
@@ -26,6 +26,7 @@ func createRandomAccount(t *testing.T) Account {
 	require.Equal(t, arg.Balance, account.Balance)
 	require.Equal(t, arg.Currency, account.Currency)
 	require.NotZero(t, account.ID)
+	require.False(t, account.Frozen)
 	require.NotZero(t, account.CreatedAt)
 	return account
 }
@@ -90,3 +91,21 @@ func TestListAccounts(t *testing.T) {
 		require.Equal(t, lastAccount.Owner, acc.Owner)
 	}
 }
+
+func TestSetAccountFrozen(t *testing.T) {
+	account1 := createRandomAccount(t)
+	account2, err := testQueries.SetAccountFrozen(context.Background(), SetAccountFrozenParams{
+		ID:     account1.ID,
+		Frozen: true,
+	})
+	require.NoError(t, err)
+	require.True(t, account2.Frozen)
+	require.Equal(t, account1.Balance, account2.Balance)
+
+	account3, err := testQueries.SetAccountFrozen(context.Background(), SetAccountFrozenParams{
+		ID:     account1.ID,
+		Frozen: false,
+	})
+	require.NoError(t, err)
+	require.False(t, account3.Frozen)
+}
@@ -0,0 +1,161 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.14.0
+// source: api_key.sql
+
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const createAPIKey = `-- name: CreateAPIKey :one
+INSERT INTO api_keys (
+  username, name, prefix, hashed_secret, scopes, expires_at
+) VALUES (
+  $1, $2, $3, $4,
+  COALESCE($5::varchar[], '{}'), $6
+)
+RETURNING id, username, name, prefix, hashed_secret, scopes, expires_at, last_used_at, created_at
+`
+
+type CreateAPIKeyParams struct {
+	Username     string    `json:"username"`
+	Name         string    `json:"name"`
+	Prefix       string    `json:"prefix"`
+	HashedSecret string    `json:"hashed_secret"`
+	Scopes       []string  `json:"scopes"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+func (q *Queries) CreateAPIKey(ctx context.Context, arg CreateAPIKeyParams) (APIKey, error) {
+	row := q.db.QueryRowContext(ctx, createAPIKey,
+		arg.Username,
+		arg.Name,
+		arg.Prefix,
+		arg.HashedSecret,
+		pq.Array(arg.Scopes),
+		arg.ExpiresAt,
+	)
+	var i APIKey
+	err := row.Scan(
+		&i.ID,
+		&i.Username,
+		&i.Name,
+		&i.Prefix,
+		&i.HashedSecret,
+		pq.Array(&i.Scopes),
+		&i.ExpiresAt,
+		&i.LastUsedAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const deleteAPIKey = `-- name: DeleteAPIKey :one
+DELETE FROM api_keys
+WHERE id = $1 AND username = $2
+RETURNING id, username, name, prefix, hashed_secret, scopes, expires_at, last_used_at, created_at
+`
+
+type DeleteAPIKeyParams struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+}
+
+func (q *Queries) DeleteAPIKey(ctx context.Context, arg DeleteAPIKeyParams) (APIKey, error) {
+	row := q.db.QueryRowContext(ctx, deleteAPIKey, arg.ID, arg.Username)
+	var i APIKey
+	err := row.Scan(
+		&i.ID,
+		&i.Username,
+		&i.Name,
+		&i.Prefix,
+		&i.HashedSecret,
+		pq.Array(&i.Scopes),
+		&i.ExpiresAt,
+		&i.LastUsedAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getAPIKeyByPrefix = `-- name: GetAPIKeyByPrefix :one
+SELECT id, username, name, prefix, hashed_secret, scopes, expires_at, last_used_at, created_at FROM api_keys
+WHERE prefix = $1 LIMIT 1
+`
+
+func (q *Queries) GetAPIKeyByPrefix(ctx context.Context, prefix string) (APIKey, error) {
+	row := q.db.QueryRowContext(ctx, getAPIKeyByPrefix, prefix)
+	var i APIKey
+	err := row.Scan(
+		&i.ID,
+		&i.Username,
+		&i.Name,
+		&i.Prefix,
+		&i.HashedSecret,
+		pq.Array(&i.Scopes),
+		&i.ExpiresAt,
+		&i.LastUsedAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const listAPIKeys = `-- name: ListAPIKeys :many
+SELECT id, username, name, prefix, hashed_secret, scopes, expires_at, last_used_at, created_at FROM api_keys
+WHERE username = $1
+ORDER BY id
+`
+
+func (q *Queries) ListAPIKeys(ctx context.Context, username string) ([]APIKey, error) {
+	rows, err := q.db.QueryContext(ctx, listAPIKeys, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []APIKey{}
+	for rows.Next() {
+		var i APIKey
+		if err := rows.Scan(
+			&i.ID,
+			&i.Username,
+			&i.Name,
+			&i.Prefix,
+			&i.HashedSecret,
+			pq.Array(&i.Scopes),
+			&i.ExpiresAt,
+			&i.LastUsedAt,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const touchAPIKey = `-- name: TouchAPIKey :exec
+UPDATE api_keys
+SET last_used_at = $2
+WHERE id = $1
+`
+
+type TouchAPIKeyParams struct {
+	ID         int64     `json:"id"`
+	LastUsedAt time.Time `json:"last_used_at"`
+}
+
+func (q *Queries) TouchAPIKey(ctx context.Context, arg TouchAPIKeyParams) error {
+	_, err := q.db.ExecContext(ctx, touchAPIKey, arg.ID, arg.LastUsedAt)
+	return err
+}
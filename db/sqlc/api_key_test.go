@@ -0,0 +1,44 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dpsigor/cheatsheet-golang-postgres/util"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateAPIKey(t *testing.T) {
+	store := NewStore(testDB, zerolog.Nop())
+	user := createRandomUser(t)
+	arg := CreateAPIKeyParams{
+		Username:     user.Username,
+		Name:         "batch",
+		Prefix:       util.RandomString(12),
+		HashedSecret: util.RandomString(64),
+		Scopes:       []string{"accounts:read"},
+		ExpiresAt:    time.Now().Add(time.Hour),
+	}
+	apiKey, err := store.CreateAPIKey(context.Background(), arg)
+	require.NoError(t, err)
+	require.Equal(t, arg.Prefix, apiKey.Prefix)
+	require.Equal(t, arg.Scopes, apiKey.Scopes)
+	require.True(t, apiKey.LastUsedAt.IsZero())
+
+	_, err = store.CreateAPIKey(context.Background(), arg)
+	require.ErrorIs(t, err, ErrUniqueViolation)
+
+	// nil scopes are stored as an empty array, rather than violating NOT NULL
+	arg.Prefix = util.RandomString(12)
+	arg.Scopes = nil
+	apiKey, err = store.CreateAPIKey(context.Background(), arg)
+	require.NoError(t, err)
+	require.Empty(t, apiKey.Scopes)
+
+	arg.Prefix = util.RandomString(12)
+	arg.Username = user.Username + "x"
+	_, err = store.CreateAPIKey(context.Background(), arg)
+	require.ErrorIs(t, err, ErrForeignKey)
+}
@@ -0,0 +1,15 @@
+package db_test
+
+import (
+	"testing"
+
+	db "github.com/dpsigor/cheatsheet-golang-postgres/db/sqlc"
+	"github.com/dpsigor/cheatsheet-golang-postgres/db/storetest"
+	"github.com/rs/zerolog"
+)
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) db.Store {
+		return db.NewStore(*db.SharedTestDB, zerolog.Nop())
+	})
+}
@@ -0,0 +1,81 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// Postgres error codes translated to domain errors
+const (
+	foreignKeyViolation    = "23503"
+	uniqueViolation        = "23505"
+	serializationFailure   = "40001"
+	deadlockDetected       = "40P01"
+	numericValueOutOfRange = "22003"
+)
+
+// ErrRecordNotFound is returned when a query yields no rows
+var ErrRecordNotFound = sql.ErrNoRows
+
+// Domain errors returned by the Store instead of driver errors. The specific
+// errors wrap the generic ones, so errors.Is(ErrDuplicateEmail, ErrUniqueViolation)
+// holds.
+var (
+	ErrUniqueViolation     = errors.New("record already exists")
+	ErrForeignKey          = errors.New("referenced record does not exist")
+	ErrTxConflict          = errors.New("transaction aborted by a concurrent transaction")
+	ErrOutOfRange          = errors.New("value out of range")
+	ErrInvalidAmount       = errors.New("amount must be positive")
+	ErrDuplicateUsername   = fmt.Errorf("username already exists: %w", ErrUniqueViolation)
+	ErrDuplicateEmail      = fmt.Errorf("email already exists: %w", ErrUniqueViolation)
+	ErrOwnerCurrencyExists = fmt.Errorf("owner already has an account in this currency: %w", ErrUniqueViolation)
+)
+
+// constraintErrors maps constraint names from db/migration to domain errors
+var constraintErrors = map[string]error{
+	"users_pkey":         ErrDuplicateUsername,
+	"users_email_key":    ErrDuplicateEmail,
+	"owner_currency_key": ErrOwnerCurrencyExists,
+}
+
+// ConstraintError is a constraint violation reported by Postgres. It
+// unwraps to the matching domain error.
+type ConstraintError struct {
+	Constraint string
+	Err        error
+}
+
+func (e *ConstraintError) Error() string {
+	return fmt.Sprintf("%s (constraint %s)", e.Err, e.Constraint)
+}
+
+func (e *ConstraintError) Unwrap() error {
+	return e.Err
+}
+
+// translateError converts constraint violations reported by the driver into
+// domain errors and returns any other error unchanged
+func translateError(err error) error {
+	var pgErr *pq.Error
+	if !errors.As(err, &pgErr) {
+		return err
+	}
+
+	if domainErr, ok := constraintErrors[pgErr.Constraint]; ok {
+		return &ConstraintError{Constraint: pgErr.Constraint, Err: domainErr}
+	}
+	switch string(pgErr.Code) {
+	case uniqueViolation:
+		return &ConstraintError{Constraint: pgErr.Constraint, Err: ErrUniqueViolation}
+	case foreignKeyViolation:
+		return &ConstraintError{Constraint: pgErr.Constraint, Err: ErrForeignKey}
+	case serializationFailure, deadlockDetected:
+		return fmt.Errorf("%w: %v", ErrTxConflict, err)
+	case numericValueOutOfRange:
+		return fmt.Errorf("%w: %v", ErrOutOfRange, err)
+	}
+	return err
+}
@@ -0,0 +1,40 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTranslateError(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		target error
+	}{
+		{"DuplicateUsername", &pq.Error{Code: uniqueViolation, Constraint: "users_pkey"}, ErrDuplicateUsername},
+		{"DuplicateEmail", &pq.Error{Code: uniqueViolation, Constraint: "users_email_key"}, ErrDuplicateEmail},
+		{"OwnerCurrencyExists", &pq.Error{Code: uniqueViolation, Constraint: "owner_currency_key"}, ErrOwnerCurrencyExists},
+		{"UnknownUniqueConstraint", &pq.Error{Code: uniqueViolation, Constraint: "unknown_key"}, ErrUniqueViolation},
+		{"ForeignKey", &pq.Error{Code: foreignKeyViolation, Constraint: "accounts_owner_fkey"}, ErrForeignKey},
+		{"Deadlock", &pq.Error{Code: deadlockDetected}, ErrTxConflict},
+		{"OutOfRange", &pq.Error{Code: numericValueOutOfRange}, ErrOutOfRange},
+		{"NotFound", sql.ErrNoRows, ErrRecordNotFound},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			err := translateError(tc.err)
+			require.ErrorIs(t, err, tc.target)
+
+			var pgErr *pq.Error
+			require.False(t, errors.As(err, &pgErr), "driver error leaked")
+		})
+	}
+
+	require.ErrorIs(t, ErrDuplicateEmail, ErrUniqueViolation)
+	require.NoError(t, translateError(nil))
+}
@@ -0,0 +1,5 @@
+package db
+
+// SharedTestDB is the connection opened by TestMain, shared with the tests of
+// package db_test
+var SharedTestDB = &testDB
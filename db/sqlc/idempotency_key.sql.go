@@ -0,0 +1,109 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.14.0
+// source: idempotency_key.sql
+
+package db
+
+import (
+	"context"
+)
+
+const createIdempotencyKey = `-- name: CreateIdempotencyKey :one
+INSERT INTO idempotency_keys (
+  scope, key, request_hash
+) VALUES (
+  $1, $2, $3
+)
+ON CONFLICT (scope, key) DO UPDATE
+SET request_hash = EXCLUDED.request_hash,
+  response_status = 0,
+  response_body = NULL,
+  created_at = now()
+WHERE idempotency_keys.created_at < now() - interval '1 day'
+RETURNING scope, key, request_hash, response_status, response_body, created_at
+`
+
+type CreateIdempotencyKeyParams struct {
+	Scope       string `json:"scope"`
+	Key         string `json:"key"`
+	RequestHash string `json:"request_hash"`
+}
+
+// Claims the key for a new request. Keys older than a day are reclaimed, and
+// no row is returned when the key is already in use.
+func (q *Queries) CreateIdempotencyKey(ctx context.Context, arg CreateIdempotencyKeyParams) (IdempotencyKey, error) {
+	row := q.db.QueryRowContext(ctx, createIdempotencyKey, arg.Scope, arg.Key, arg.RequestHash)
+	var i IdempotencyKey
+	err := row.Scan(
+		&i.Scope,
+		&i.Key,
+		&i.RequestHash,
+		&i.ResponseStatus,
+		&i.ResponseBody,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const deleteIdempotencyKey = `-- name: DeleteIdempotencyKey :exec
+DELETE FROM idempotency_keys
+WHERE scope = $1 AND key = $2
+`
+
+type DeleteIdempotencyKeyParams struct {
+	Scope string `json:"scope"`
+	Key   string `json:"key"`
+}
+
+func (q *Queries) DeleteIdempotencyKey(ctx context.Context, arg DeleteIdempotencyKeyParams) error {
+	_, err := q.db.ExecContext(ctx, deleteIdempotencyKey, arg.Scope, arg.Key)
+	return err
+}
+
+const getIdempotencyKey = `-- name: GetIdempotencyKey :one
+SELECT scope, key, request_hash, response_status, response_body, created_at FROM idempotency_keys
+WHERE scope = $1 AND key = $2 LIMIT 1
+`
+
+type GetIdempotencyKeyParams struct {
+	Scope string `json:"scope"`
+	Key   string `json:"key"`
+}
+
+func (q *Queries) GetIdempotencyKey(ctx context.Context, arg GetIdempotencyKeyParams) (IdempotencyKey, error) {
+	row := q.db.QueryRowContext(ctx, getIdempotencyKey, arg.Scope, arg.Key)
+	var i IdempotencyKey
+	err := row.Scan(
+		&i.Scope,
+		&i.Key,
+		&i.RequestHash,
+		&i.ResponseStatus,
+		&i.ResponseBody,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const setIdempotencyKeyResponse = `-- name: SetIdempotencyKeyResponse :exec
+UPDATE idempotency_keys
+SET response_status = $3, response_body = $4
+WHERE scope = $1 AND key = $2
+`
+
+type SetIdempotencyKeyResponseParams struct {
+	Scope          string `json:"scope"`
+	Key            string `json:"key"`
+	ResponseStatus int32  `json:"response_status"`
+	ResponseBody   []byte `json:"response_body"`
+}
+
+func (q *Queries) SetIdempotencyKeyResponse(ctx context.Context, arg SetIdempotencyKeyResponseParams) error {
+	_, err := q.db.ExecContext(ctx, setIdempotencyKeyResponse,
+		arg.Scope,
+		arg.Key,
+		arg.ResponseStatus,
+		arg.ResponseBody,
+	)
+	return err
+}
@@ -0,0 +1,83 @@
+package db
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/dpsigor/cheatsheet-golang-postgres/util"
+	"github.com/stretchr/testify/require"
+)
+
+func createRandomIdempotencyKey(t *testing.T) IdempotencyKey {
+	arg := CreateIdempotencyKeyParams{
+		Scope:       util.RandomOwner(),
+		Key:         util.RandomString(16),
+		RequestHash: util.RandomString(32),
+	}
+	key, err := testQueries.CreateIdempotencyKey(context.Background(), arg)
+	require.NoError(t, err)
+	require.Equal(t, arg.Scope, key.Scope)
+	require.Equal(t, arg.Key, key.Key)
+	require.Equal(t, arg.RequestHash, key.RequestHash)
+	require.Zero(t, key.ResponseStatus)
+	require.Nil(t, key.ResponseBody)
+	require.NotZero(t, key.CreatedAt)
+	return key
+}
+
+func TestCreateIdempotencyKey(t *testing.T) {
+	key := createRandomIdempotencyKey(t)
+
+	// a key in use cannot be claimed again
+	_, err := testQueries.CreateIdempotencyKey(context.Background(), CreateIdempotencyKeyParams{
+		Scope:       key.Scope,
+		Key:         key.Key,
+		RequestHash: util.RandomString(32),
+	})
+	require.ErrorIs(t, err, ErrRecordNotFound)
+
+	// the same key in another scope is a different key
+	other, err := testQueries.CreateIdempotencyKey(context.Background(), CreateIdempotencyKeyParams{
+		Scope:       util.RandomOwner(),
+		Key:         key.Key,
+		RequestHash: key.RequestHash,
+	})
+	require.NoError(t, err)
+	require.Equal(t, key.Key, other.Key)
+}
+
+func TestSetIdempotencyKeyResponse(t *testing.T) {
+	key1 := createRandomIdempotencyKey(t)
+	body := []byte(`{"id":1}`)
+	err := testQueries.SetIdempotencyKeyResponse(context.Background(), SetIdempotencyKeyResponseParams{
+		Scope:          key1.Scope,
+		Key:            key1.Key,
+		ResponseStatus: http.StatusOK,
+		ResponseBody:   body,
+	})
+	require.NoError(t, err)
+
+	key2, err := testQueries.GetIdempotencyKey(context.Background(), GetIdempotencyKeyParams{Scope: key1.Scope, Key: key1.Key})
+	require.NoError(t, err)
+	require.Equal(t, key1.RequestHash, key2.RequestHash)
+	require.Equal(t, int32(http.StatusOK), key2.ResponseStatus)
+	require.Equal(t, body, key2.ResponseBody)
+}
+
+func TestDeleteIdempotencyKey(t *testing.T) {
+	key := createRandomIdempotencyKey(t)
+	err := testQueries.DeleteIdempotencyKey(context.Background(), DeleteIdempotencyKeyParams{Scope: key.Scope, Key: key.Key})
+	require.NoError(t, err)
+
+	_, err = testQueries.GetIdempotencyKey(context.Background(), GetIdempotencyKeyParams{Scope: key.Scope, Key: key.Key})
+	require.ErrorIs(t, err, ErrRecordNotFound)
+
+	// a released key can be claimed again
+	_, err = testQueries.CreateIdempotencyKey(context.Background(), CreateIdempotencyKeyParams{
+		Scope:       key.Scope,
+		Key:         key.Key,
+		RequestHash: key.RequestHash,
+	})
+	require.NoError(t, err)
+}
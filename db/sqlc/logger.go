@@ -0,0 +1,76 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/dpsigor/cheatsheet-golang-postgres/util"
+	"github.com/lib/pq"
+	"github.com/rs/zerolog"
+)
+
+// loggedDB logs the statements that fail, tagged with the request ID found
+// in the context. Arguments are never logged, as they may hold secrets.
+type loggedDB struct {
+	DBTX
+	logger zerolog.Logger
+}
+
+func (l loggedDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	res, err := l.DBTX.ExecContext(ctx, query, args...)
+	l.logError(ctx, query, err)
+	return res, err
+}
+
+func (l loggedDB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	stmt, err := l.DBTX.PrepareContext(ctx, query)
+	l.logError(ctx, query, err)
+	return stmt, err
+}
+
+func (l loggedDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	rows, err := l.DBTX.QueryContext(ctx, query, args...)
+	l.logError(ctx, query, err)
+	return rows, err
+}
+
+func (l loggedDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	row := l.DBTX.QueryRowContext(ctx, query, args...)
+	l.logError(ctx, query, row.Err())
+	return row
+}
+
+func (l loggedDB) logError(ctx context.Context, query string, err error) {
+	if err == nil || errors.Is(err, sql.ErrNoRows) || errors.Is(err, context.Canceled) {
+		return
+	}
+
+	event := l.logger.Error()
+	var pgErr *pq.Error
+	if errors.As(err, &pgErr) {
+		// constraint violations are expected and answered to the client
+		if pgErr.Code.Class() == "23" {
+			event = l.logger.Warn()
+		}
+		event = event.Str("pg_code", string(pgErr.Code)).Str("constraint", pgErr.Constraint)
+	}
+	if requestID := util.RequestIDFromContext(ctx); requestID != "" {
+		event = event.Str("request_id", requestID)
+	}
+	if traceID := util.TraceIDFromContext(ctx); traceID != "" {
+		event = event.Str("trace_id", traceID)
+	}
+	event.Err(err).Str("query", QueryName(query)).Msg("sql statement failed")
+}
+
+// QueryName extracts the sqlc query name from its "-- name: GetUser :one"
+// header, falling back to the first line of the query
+func QueryName(query string) string {
+	line := strings.TrimSpace(strings.SplitN(strings.TrimSpace(query), "\n", 2)[0])
+	if fields := strings.Fields(strings.TrimPrefix(line, "-- name:")); len(fields) > 0 && strings.HasPrefix(line, "-- name:") {
+		return fields[0]
+	}
+	return line
+}
@@ -0,0 +1,37 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/dpsigor/cheatsheet-golang-postgres/util"
+	"github.com/lib/pq"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryName(t *testing.T) {
+	require.Equal(t, "CreateUser", QueryName(createUser))
+	require.Equal(t, "SELECT 1", QueryName("SELECT 1"))
+}
+
+func TestLogError(t *testing.T) {
+	var buf bytes.Buffer
+	l := loggedDB{logger: zerolog.New(&buf)}
+	ctx := util.ContextWithRequestID(context.Background(), "my-request-id")
+
+	l.logError(ctx, createUser, &pq.Error{Code: uniqueViolation, Constraint: "users_email_key"})
+
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	require.Equal(t, "warn", entry["level"])
+	require.Equal(t, "my-request-id", entry["request_id"])
+	require.Equal(t, "CreateUser", entry["query"])
+	require.Equal(t, "users_email_key", entry["constraint"])
+
+	buf.Reset()
+	l.logError(ctx, createUser, ErrRecordNotFound)
+	require.Zero(t, buf.Len())
+}
@@ -0,0 +1,89 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.14.0
+// source: login_attempt.sql
+
+package db
+
+import (
+	"context"
+)
+
+const createLoginAttempt = `-- name: CreateLoginAttempt :one
+INSERT INTO login_attempts (
+  username, ip_address, user_agent, success
+) VALUES (
+  $1, $2, $3, $4
+)
+RETURNING id, username, ip_address, user_agent, success, created_at
+`
+
+type CreateLoginAttemptParams struct {
+	Username  string `json:"username"`
+	IpAddress string `json:"ip_address"`
+	UserAgent string `json:"user_agent"`
+	Success   bool   `json:"success"`
+}
+
+func (q *Queries) CreateLoginAttempt(ctx context.Context, arg CreateLoginAttemptParams) (LoginAttempt, error) {
+	row := q.db.QueryRowContext(ctx, createLoginAttempt,
+		arg.Username,
+		arg.IpAddress,
+		arg.UserAgent,
+		arg.Success,
+	)
+	var i LoginAttempt
+	err := row.Scan(
+		&i.ID,
+		&i.Username,
+		&i.IpAddress,
+		&i.UserAgent,
+		&i.Success,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const listLoginAttempts = `-- name: ListLoginAttempts :many
+SELECT id, username, ip_address, user_agent, success, created_at FROM login_attempts
+WHERE username = $1
+ORDER BY id DESC
+LIMIT $2
+OFFSET $3
+`
+
+type ListLoginAttemptsParams struct {
+	Username string `json:"username"`
+	Limit    int32  `json:"limit"`
+	Offset   int32  `json:"offset"`
+}
+
+func (q *Queries) ListLoginAttempts(ctx context.Context, arg ListLoginAttemptsParams) ([]LoginAttempt, error) {
+	rows, err := q.db.QueryContext(ctx, listLoginAttempts, arg.Username, arg.Limit, arg.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []LoginAttempt{}
+	for rows.Next() {
+		var i LoginAttempt
+		if err := rows.Scan(
+			&i.ID,
+			&i.Username,
+			&i.IpAddress,
+			&i.UserAgent,
+			&i.Success,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -0,0 +1,48 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateLoginAttempt(t *testing.T) {
+	store := NewStore(testDB, zerolog.Nop())
+	user := createRandomUser(t)
+	arg := CreateLoginAttemptParams{
+		Username:  user.Username,
+		IpAddress: "192.0.2.1",
+		UserAgent: "Go-http-client/1.1",
+		Success:   true,
+	}
+	attempt, err := store.CreateLoginAttempt(context.Background(), arg)
+	require.NoError(t, err)
+	require.NotZero(t, attempt.ID)
+	require.Equal(t, arg.Username, attempt.Username)
+	require.Equal(t, arg.IpAddress, attempt.IpAddress)
+	require.Equal(t, arg.UserAgent, attempt.UserAgent)
+	require.True(t, attempt.Success)
+	require.NotZero(t, attempt.CreatedAt)
+
+	arg.Username = user.Username + "x"
+	_, err = store.CreateLoginAttempt(context.Background(), arg)
+	require.ErrorIs(t, err, ErrForeignKey)
+}
+
+func TestListLoginAttempts(t *testing.T) {
+	user := createRandomUser(t)
+	for i := 0; i < 3; i++ {
+		_, err := testQueries.CreateLoginAttempt(context.Background(), CreateLoginAttemptParams{Username: user.Username})
+		require.NoError(t, err)
+	}
+
+	attempts, err := testQueries.ListLoginAttempts(context.Background(), ListLoginAttemptsParams{
+		Username: user.Username,
+		Limit:    5,
+	})
+	require.NoError(t, err)
+	require.Len(t, attempts, 3)
+	require.Greater(t, attempts[0].ID, attempts[1].ID)
+}
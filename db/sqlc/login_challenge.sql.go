@@ -0,0 +1,69 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.14.0
+// source: login_challenge.sql
+
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const createLoginChallenge = `-- name: CreateLoginChallenge :one
+INSERT INTO login_challenges (
+  id, username, expires_at
+) VALUES (
+  $1, $2, $3
+)
+RETURNING id, username, expires_at, created_at
+`
+
+type CreateLoginChallengeParams struct {
+	ID        uuid.UUID `json:"id"`
+	Username  string    `json:"username"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (q *Queries) CreateLoginChallenge(ctx context.Context, arg CreateLoginChallengeParams) (LoginChallenge, error) {
+	row := q.db.QueryRowContext(ctx, createLoginChallenge, arg.ID, arg.Username, arg.ExpiresAt)
+	var i LoginChallenge
+	err := row.Scan(
+		&i.ID,
+		&i.Username,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const deleteExpiredLoginChallenges = `-- name: DeleteExpiredLoginChallenges :exec
+DELETE FROM login_challenges
+WHERE username = $1 AND expires_at < now()
+`
+
+func (q *Queries) DeleteExpiredLoginChallenges(ctx context.Context, username string) error {
+	_, err := q.db.ExecContext(ctx, deleteExpiredLoginChallenges, username)
+	return err
+}
+
+const deleteLoginChallenge = `-- name: DeleteLoginChallenge :one
+DELETE FROM login_challenges
+WHERE id = $1
+RETURNING id, username, expires_at, created_at
+`
+
+// Claims the challenge, so that it is answered only once
+func (q *Queries) DeleteLoginChallenge(ctx context.Context, id uuid.UUID) (LoginChallenge, error) {
+	row := q.db.QueryRowContext(ctx, deleteLoginChallenge, id)
+	var i LoginChallenge
+	err := row.Scan(
+		&i.ID,
+		&i.Username,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
@@ -0,0 +1,46 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateLoginChallenge(t *testing.T) {
+	store := NewStore(testDB, zerolog.Nop())
+	user := createRandomUser(t)
+	arg := CreateLoginChallengeParams{
+		ID:        uuid.New(),
+		Username:  user.Username,
+		ExpiresAt: time.Now().Add(time.Minute),
+	}
+	challenge, err := store.CreateLoginChallenge(context.Background(), arg)
+	require.NoError(t, err)
+	require.Equal(t, arg.ID, challenge.ID)
+	require.Equal(t, arg.Username, challenge.Username)
+	require.WithinDuration(t, arg.ExpiresAt, challenge.ExpiresAt, time.Millisecond)
+
+	arg.ID = uuid.New()
+	arg.Username = user.Username + "x"
+	_, err = store.CreateLoginChallenge(context.Background(), arg)
+	require.ErrorIs(t, err, ErrForeignKey)
+}
+
+func TestDeleteLoginChallenge(t *testing.T) {
+	user := createRandomUser(t)
+	challenge, err := testQueries.CreateLoginChallenge(context.Background(), CreateLoginChallengeParams{
+		ID:        uuid.New(),
+		Username:  user.Username,
+		ExpiresAt: time.Now().Add(-time.Minute),
+	})
+	require.NoError(t, err)
+
+	err = testQueries.DeleteExpiredLoginChallenges(context.Background(), user.Username)
+	require.NoError(t, err)
+	_, err = testQueries.DeleteLoginChallenge(context.Background(), challenge.ID)
+	require.ErrorIs(t, err, ErrRecordNotFound)
+}
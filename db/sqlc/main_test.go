@@ -6,6 +6,7 @@ import (
 	"os"
 	"testing"
 
+	"github.com/dpsigor/cheatsheet-golang-postgres/password"
 	"github.com/dpsigor/cheatsheet-golang-postgres/util"
 	_ "github.com/lib/pq"
 )
@@ -13,6 +14,8 @@ import (
 var testQueries *Queries
 var testDB *sql.DB
 
+var testHasher = password.NewTestHasher()
+
 func TestMain(m *testing.M) {
 	cfg, err := util.LoadConfig("../..")
 	if err != nil {
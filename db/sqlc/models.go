@@ -6,14 +6,34 @@ package db
 
 import (
 	"time"
+
+	"github.com/google/uuid"
 )
 
+type APIKey struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+	Name     string `json:"name"`
+	// public part of the key, which identifies it in the keys and the logs
+	Prefix string `json:"prefix"`
+	// SHA-256 of the secret part of the key, which only the user knows
+	HashedSecret string `json:"hashed_secret"`
+	// scopes the key is restricted to, all of the user's access if empty
+	Scopes []string `json:"scopes"`
+	// the key never expires if zero
+	ExpiresAt time.Time `json:"expires_at"`
+	// zero until the key is first used
+	LastUsedAt time.Time `json:"last_used_at"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
 type Account struct {
 	ID        int64     `json:"id"`
 	Owner     string    `json:"owner"`
 	Balance   int64     `json:"balance"`
 	Currency  string    `json:"currency"`
 	CreatedAt time.Time `json:"created_at"`
+	Frozen    bool      `json:"frozen"`
 }
 
 type Entry struct {
@@ -24,6 +44,102 @@ type Entry struct {
 	CreatedAt time.Time `json:"created_at"`
 }
 
+type IdempotencyKey struct {
+	// username of the client, empty for unauthenticated requests
+	Scope       string `json:"scope"`
+	Key         string `json:"key"`
+	RequestHash string `json:"request_hash"`
+	// 0 while the request is in progress
+	ResponseStatus int32     `json:"response_status"`
+	ResponseBody   []byte    `json:"response_body"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+type LoginAttempt struct {
+	ID        int64     `json:"id"`
+	Username  string    `json:"username"`
+	IpAddress string    `json:"ip_address"`
+	UserAgent string    `json:"user_agent"`
+	Success   bool      `json:"success"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type LoginChallenge struct {
+	ID        uuid.UUID `json:"id"`
+	Username  string    `json:"username"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type OAuthAuthorizationCode struct {
+	ID int64 `json:"id"`
+	// SHA-256 of the code sent to the client through the redirect URI
+	HashedCode  string `json:"hashed_code"`
+	ClientID    string `json:"client_id"`
+	Username    string `json:"username"`
+	RedirectURI string `json:"redirect_uri"`
+	// whether the authorization request had the redirect URI, which the token request must then repeat
+	RedirectURIGiven bool     `json:"redirect_uri_given"`
+	Scopes           []string `json:"scopes"`
+	// PKCE S256 challenge, which the code verifier sent with the code must match
+	CodeChallenge string `json:"code_challenge"`
+	// issue time by the clock of the application, which password changes are compared with
+	IssuedAt  time.Time `json:"issued_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type OAuthClient struct {
+	ID string `json:"id"`
+	// user who registered the client
+	Owner string `json:"owner"`
+	Name  string `json:"name"`
+	// SHA-256 of the client secret, which only the owner knows
+	HashedSecret string   `json:"hashed_secret"`
+	RedirectURIs []string `json:"redirect_uris"`
+	// scopes the client may ask the users for
+	Scopes    []string  `json:"scopes"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type OAuthRefreshToken struct {
+	ID int64 `json:"id"`
+	// SHA-256 of the refresh token, which only the client knows
+	HashedToken string   `json:"hashed_token"`
+	ClientID    string   `json:"client_id"`
+	Username    string   `json:"username"`
+	Scopes      []string `json:"scopes"`
+	// issue time by the clock of the application, which password changes are compared with
+	IssuedAt  time.Time `json:"issued_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type PasswordResetToken struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+	// SHA-256 of the token sent to the user, who is the only one to know the token
+	HashedToken string    `json:"hashed_token"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type RateLimitBucket struct {
+	Key string `json:"key"`
+	// tokens left in the bucket at updated_at
+	Tokens float64 `json:"tokens"`
+	// whether the last request took a token
+	Allowed   bool      `json:"allowed"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type RecoveryCode struct {
+	ID         int64     `json:"id"`
+	Username   string    `json:"username"`
+	HashedCode string    `json:"hashed_code"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
 type Transfer struct {
 	ID            int64 `json:"id"`
 	FromAccountID int64 `json:"from_account_id"`
@@ -40,4 +156,26 @@ type User struct {
 	Email             string    `json:"email"`
 	PasswordChangedAt time.Time `json:"password_changed_at"`
 	CreatedAt         time.Time `json:"created_at"`
+	Role              string    `json:"role"`
+	// failed logins since the last successful one
+	FailedLoginAttempts int32     `json:"failed_login_attempts"`
+	LockedUntil         time.Time `json:"locked_until"`
+	// base32 TOTP secret, set on enrollment and used once totp_enabled
+	TotpSecret  string `json:"totp_secret"`
+	TotpEnabled bool   `json:"totp_enabled"`
+	// last TOTP time step accepted, so that a code is used only once
+	TotpLastStep    int64 `json:"totp_last_step"`
+	IsEmailVerified bool  `json:"is_email_verified"`
+}
+
+type VerifyEmail struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+	// email the link was sent to, which is verified only if the user still has it
+	Email string `json:"email"`
+	// SHA-256 of the token sent to the user, who is the only one to know the token
+	HashedToken string    `json:"hashed_token"`
+	IsUsed      bool      `json:"is_used"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	CreatedAt   time.Time `json:"created_at"`
 }
@@ -0,0 +1,213 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.14.0
+// source: oauth.sql
+
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const createOAuthAuthorizationCode = `-- name: CreateOAuthAuthorizationCode :one
+INSERT INTO oauth_authorization_codes (
+  hashed_code, client_id, username, redirect_uri, redirect_uri_given, scopes, code_challenge, issued_at, expires_at
+) VALUES (
+  $1, $2, $3, $4, $5, $6, $7, $8, $9
+)
+RETURNING id, hashed_code, client_id, username, redirect_uri, redirect_uri_given, scopes, code_challenge, issued_at, expires_at, created_at
+`
+
+type CreateOAuthAuthorizationCodeParams struct {
+	HashedCode       string    `json:"hashed_code"`
+	ClientID         string    `json:"client_id"`
+	Username         string    `json:"username"`
+	RedirectURI      string    `json:"redirect_uri"`
+	RedirectURIGiven bool      `json:"redirect_uri_given"`
+	Scopes           []string  `json:"scopes"`
+	CodeChallenge    string    `json:"code_challenge"`
+	IssuedAt         time.Time `json:"issued_at"`
+	ExpiresAt        time.Time `json:"expires_at"`
+}
+
+func (q *Queries) CreateOAuthAuthorizationCode(ctx context.Context, arg CreateOAuthAuthorizationCodeParams) (OAuthAuthorizationCode, error) {
+	row := q.db.QueryRowContext(ctx, createOAuthAuthorizationCode,
+		arg.HashedCode,
+		arg.ClientID,
+		arg.Username,
+		arg.RedirectURI,
+		arg.RedirectURIGiven,
+		pq.Array(arg.Scopes),
+		arg.CodeChallenge,
+		arg.IssuedAt,
+		arg.ExpiresAt,
+	)
+	var i OAuthAuthorizationCode
+	err := row.Scan(
+		&i.ID,
+		&i.HashedCode,
+		&i.ClientID,
+		&i.Username,
+		&i.RedirectURI,
+		&i.RedirectURIGiven,
+		pq.Array(&i.Scopes),
+		&i.CodeChallenge,
+		&i.IssuedAt,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const createOAuthClient = `-- name: CreateOAuthClient :one
+INSERT INTO oauth_clients (
+  id, owner, name, hashed_secret, redirect_uris, scopes
+) VALUES (
+  $1, $2, $3, $4, $5, $6
+)
+RETURNING id, owner, name, hashed_secret, redirect_uris, scopes, created_at
+`
+
+type CreateOAuthClientParams struct {
+	ID           string   `json:"id"`
+	Owner        string   `json:"owner"`
+	Name         string   `json:"name"`
+	HashedSecret string   `json:"hashed_secret"`
+	RedirectURIs []string `json:"redirect_uris"`
+	Scopes       []string `json:"scopes"`
+}
+
+func (q *Queries) CreateOAuthClient(ctx context.Context, arg CreateOAuthClientParams) (OAuthClient, error) {
+	row := q.db.QueryRowContext(ctx, createOAuthClient,
+		arg.ID,
+		arg.Owner,
+		arg.Name,
+		arg.HashedSecret,
+		pq.Array(arg.RedirectURIs),
+		pq.Array(arg.Scopes),
+	)
+	var i OAuthClient
+	err := row.Scan(
+		&i.ID,
+		&i.Owner,
+		&i.Name,
+		&i.HashedSecret,
+		pq.Array(&i.RedirectURIs),
+		pq.Array(&i.Scopes),
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const createOAuthRefreshToken = `-- name: CreateOAuthRefreshToken :one
+INSERT INTO oauth_refresh_tokens (
+  hashed_token, client_id, username, scopes, issued_at, expires_at
+) VALUES (
+  $1, $2, $3, $4, $5, $6
+)
+RETURNING id, hashed_token, client_id, username, scopes, issued_at, expires_at, created_at
+`
+
+type CreateOAuthRefreshTokenParams struct {
+	HashedToken string    `json:"hashed_token"`
+	ClientID    string    `json:"client_id"`
+	Username    string    `json:"username"`
+	Scopes      []string  `json:"scopes"`
+	IssuedAt    time.Time `json:"issued_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+func (q *Queries) CreateOAuthRefreshToken(ctx context.Context, arg CreateOAuthRefreshTokenParams) (OAuthRefreshToken, error) {
+	row := q.db.QueryRowContext(ctx, createOAuthRefreshToken,
+		arg.HashedToken,
+		arg.ClientID,
+		arg.Username,
+		pq.Array(arg.Scopes),
+		arg.IssuedAt,
+		arg.ExpiresAt,
+	)
+	var i OAuthRefreshToken
+	err := row.Scan(
+		&i.ID,
+		&i.HashedToken,
+		&i.ClientID,
+		&i.Username,
+		pq.Array(&i.Scopes),
+		&i.IssuedAt,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const deleteOAuthAuthorizationCode = `-- name: DeleteOAuthAuthorizationCode :one
+DELETE FROM oauth_authorization_codes
+WHERE hashed_code = $1
+RETURNING id, hashed_code, client_id, username, redirect_uri, redirect_uri_given, scopes, code_challenge, issued_at, expires_at, created_at
+`
+
+// Claims the code, so that it is exchanged only once
+func (q *Queries) DeleteOAuthAuthorizationCode(ctx context.Context, hashedCode string) (OAuthAuthorizationCode, error) {
+	row := q.db.QueryRowContext(ctx, deleteOAuthAuthorizationCode, hashedCode)
+	var i OAuthAuthorizationCode
+	err := row.Scan(
+		&i.ID,
+		&i.HashedCode,
+		&i.ClientID,
+		&i.Username,
+		&i.RedirectURI,
+		&i.RedirectURIGiven,
+		pq.Array(&i.Scopes),
+		&i.CodeChallenge,
+		&i.IssuedAt,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const deleteOAuthRefreshToken = `-- name: DeleteOAuthRefreshToken :one
+DELETE FROM oauth_refresh_tokens
+WHERE hashed_token = $1
+RETURNING id, hashed_token, client_id, username, scopes, issued_at, expires_at, created_at
+`
+
+// Claims the refresh token, which is replaced by a new one on every refresh
+func (q *Queries) DeleteOAuthRefreshToken(ctx context.Context, hashedToken string) (OAuthRefreshToken, error) {
+	row := q.db.QueryRowContext(ctx, deleteOAuthRefreshToken, hashedToken)
+	var i OAuthRefreshToken
+	err := row.Scan(
+		&i.ID,
+		&i.HashedToken,
+		&i.ClientID,
+		&i.Username,
+		pq.Array(&i.Scopes),
+		&i.IssuedAt,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getOAuthClient = `-- name: GetOAuthClient :one
+SELECT id, owner, name, hashed_secret, redirect_uris, scopes, created_at FROM oauth_clients
+WHERE id = $1 LIMIT 1
+`
+
+func (q *Queries) GetOAuthClient(ctx context.Context, id string) (OAuthClient, error) {
+	row := q.db.QueryRowContext(ctx, getOAuthClient, id)
+	var i OAuthClient
+	err := row.Scan(
+		&i.ID,
+		&i.Owner,
+		&i.Name,
+		&i.HashedSecret,
+		pq.Array(&i.RedirectURIs),
+		pq.Array(&i.Scopes),
+		&i.CreatedAt,
+	)
+	return i, err
+}
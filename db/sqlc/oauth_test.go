@@ -0,0 +1,54 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dpsigor/cheatsheet-golang-postgres/util"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateOAuthClient(t *testing.T) {
+	store := NewStore(testDB, zerolog.Nop())
+	owner := createRandomUser(t)
+	arg := CreateOAuthClientParams{
+		ID:           util.RandomString(16),
+		Owner:        owner.Username,
+		Name:         "budget app",
+		HashedSecret: util.RandomString(64),
+		RedirectURIs: []string{"https://budget.example.com/callback"},
+		Scopes:       []string{"accounts:read"},
+	}
+	client, err := store.CreateOAuthClient(context.Background(), arg)
+	require.NoError(t, err)
+	require.Equal(t, arg.RedirectURIs, client.RedirectURIs)
+	require.Equal(t, arg.Scopes, client.Scopes)
+
+	_, err = store.CreateOAuthClient(context.Background(), arg)
+	require.ErrorIs(t, err, ErrUniqueViolation)
+
+	user := createRandomUser(t)
+	code, err := store.CreateOAuthAuthorizationCode(context.Background(), CreateOAuthAuthorizationCodeParams{
+		HashedCode:       util.RandomString(64),
+		ClientID:         client.ID,
+		Username:         user.Username,
+		RedirectURI:      client.RedirectURIs[0],
+		RedirectURIGiven: true,
+		Scopes:           client.Scopes,
+		CodeChallenge:    util.RandomString(43),
+		IssuedAt:         time.Now(),
+		ExpiresAt:        time.Now().Add(time.Minute),
+	})
+	require.NoError(t, err)
+	require.True(t, code.RedirectURIGiven)
+	claimed, err := store.DeleteOAuthAuthorizationCode(context.Background(), code.HashedCode)
+	require.NoError(t, err)
+	require.Equal(t, code.ID, claimed.ID)
+
+	arg.ID = util.RandomString(16)
+	arg.Owner = owner.Username + "x"
+	_, err = store.CreateOAuthClient(context.Background(), arg)
+	require.ErrorIs(t, err, ErrForeignKey)
+}
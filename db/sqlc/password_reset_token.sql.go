@@ -0,0 +1,69 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.14.0
+// source: password_reset_token.sql
+
+package db
+
+import (
+	"context"
+	"time"
+)
+
+const createPasswordResetToken = `-- name: CreatePasswordResetToken :one
+INSERT INTO password_reset_tokens (
+  username, hashed_token, expires_at
+) VALUES (
+  $1, $2, $3
+)
+RETURNING id, username, hashed_token, expires_at, created_at
+`
+
+type CreatePasswordResetTokenParams struct {
+	Username    string    `json:"username"`
+	HashedToken string    `json:"hashed_token"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+func (q *Queries) CreatePasswordResetToken(ctx context.Context, arg CreatePasswordResetTokenParams) (PasswordResetToken, error) {
+	row := q.db.QueryRowContext(ctx, createPasswordResetToken, arg.Username, arg.HashedToken, arg.ExpiresAt)
+	var i PasswordResetToken
+	err := row.Scan(
+		&i.ID,
+		&i.Username,
+		&i.HashedToken,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const deletePasswordResetToken = `-- name: DeletePasswordResetToken :one
+DELETE FROM password_reset_tokens
+WHERE hashed_token = $1
+RETURNING id, username, hashed_token, expires_at, created_at
+`
+
+// Claims the token, so that it is used only once
+func (q *Queries) DeletePasswordResetToken(ctx context.Context, hashedToken string) (PasswordResetToken, error) {
+	row := q.db.QueryRowContext(ctx, deletePasswordResetToken, hashedToken)
+	var i PasswordResetToken
+	err := row.Scan(
+		&i.ID,
+		&i.Username,
+		&i.HashedToken,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const deletePasswordResetTokens = `-- name: DeletePasswordResetTokens :exec
+DELETE FROM password_reset_tokens
+WHERE username = $1
+`
+
+func (q *Queries) DeletePasswordResetTokens(ctx context.Context, username string) error {
+	_, err := q.db.ExecContext(ctx, deletePasswordResetTokens, username)
+	return err
+}
@@ -0,0 +1,59 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dpsigor/cheatsheet-golang-postgres/util"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreatePasswordResetToken(t *testing.T) {
+	store := NewStore(testDB, zerolog.Nop())
+	user := createRandomUser(t)
+	arg := CreatePasswordResetTokenParams{
+		Username:    user.Username,
+		HashedToken: util.RandomString(64),
+		ExpiresAt:   time.Now().Add(time.Hour),
+	}
+	resetToken, err := store.CreatePasswordResetToken(context.Background(), arg)
+	require.NoError(t, err)
+	require.Equal(t, arg.Username, resetToken.Username)
+	require.Equal(t, arg.HashedToken, resetToken.HashedToken)
+	require.WithinDuration(t, arg.ExpiresAt, resetToken.ExpiresAt, time.Millisecond)
+
+	_, err = store.CreatePasswordResetToken(context.Background(), arg)
+	require.ErrorIs(t, err, ErrUniqueViolation)
+
+	arg.HashedToken = util.RandomString(64)
+	arg.Username = user.Username + "x"
+	_, err = store.CreatePasswordResetToken(context.Background(), arg)
+	require.ErrorIs(t, err, ErrForeignKey)
+}
+
+func TestChangePasswordTx(t *testing.T) {
+	store := NewStore(testDB, zerolog.Nop())
+	user := createRandomUser(t)
+	resetToken, err := testQueries.CreatePasswordResetToken(context.Background(), CreatePasswordResetTokenParams{
+		Username:    user.Username,
+		HashedToken: util.RandomString(64),
+		ExpiresAt:   time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+
+	hashedPassword, err := testHasher.Hash(util.RandomString(6))
+	require.NoError(t, err)
+	updated, err := store.ChangePasswordTx(context.Background(), ChangePasswordTxParams{
+		Username:          user.Username,
+		HashedPassword:    hashedPassword,
+		PasswordChangedAt: time.Now(),
+	})
+	require.NoError(t, err)
+	require.Equal(t, hashedPassword, updated.HashedPassword)
+	require.WithinDuration(t, time.Now(), updated.PasswordChangedAt, time.Second)
+
+	_, err = testQueries.DeletePasswordResetToken(context.Background(), resetToken.HashedToken)
+	require.ErrorIs(t, err, ErrRecordNotFound)
+}
@@ -6,24 +6,105 @@ package db
 
 import (
 	"context"
+	"time"
+
+	"github.com/google/uuid"
 )
 
 type Querier interface {
 	AddAccountBalance(ctx context.Context, arg AddAccountBalanceParams) (Account, error)
+	CreateAPIKey(ctx context.Context, arg CreateAPIKeyParams) (APIKey, error)
 	CreateAccount(ctx context.Context, arg CreateAccountParams) (Account, error)
 	CreateEntry(ctx context.Context, arg CreateEntryParams) (Entry, error)
+	// Claims the key for a new request. Keys older than a day are reclaimed, and
+	// no row is returned when the key is already in use.
+	CreateIdempotencyKey(ctx context.Context, arg CreateIdempotencyKeyParams) (IdempotencyKey, error)
+	CreateLoginAttempt(ctx context.Context, arg CreateLoginAttemptParams) (LoginAttempt, error)
+	CreateLoginChallenge(ctx context.Context, arg CreateLoginChallengeParams) (LoginChallenge, error)
+	CreateOAuthAuthorizationCode(ctx context.Context, arg CreateOAuthAuthorizationCodeParams) (OAuthAuthorizationCode, error)
+	CreateOAuthClient(ctx context.Context, arg CreateOAuthClientParams) (OAuthClient, error)
+	CreateOAuthRefreshToken(ctx context.Context, arg CreateOAuthRefreshTokenParams) (OAuthRefreshToken, error)
+	CreatePasswordResetToken(ctx context.Context, arg CreatePasswordResetTokenParams) (PasswordResetToken, error)
+	CreateRecoveryCode(ctx context.Context, arg CreateRecoveryCodeParams) (RecoveryCode, error)
 	CreateTransfer(ctx context.Context, arg CreateTransferParams) (Transfer, error)
 	CreateUser(ctx context.Context, arg CreateUserParams) (User, error)
+	CreateVerifyEmail(ctx context.Context, arg CreateVerifyEmailParams) (VerifyEmail, error)
+	DeleteAPIKey(ctx context.Context, arg DeleteAPIKeyParams) (APIKey, error)
 	DeleteAccount(ctx context.Context, id int64) error
+	DeleteExpiredLoginChallenges(ctx context.Context, username string) error
+	DeleteIdempotencyKey(ctx context.Context, arg DeleteIdempotencyKeyParams) error
+	// Claims the challenge, so that it is answered only once
+	DeleteLoginChallenge(ctx context.Context, id uuid.UUID) (LoginChallenge, error)
+	// Claims the code, so that it is exchanged only once
+	DeleteOAuthAuthorizationCode(ctx context.Context, hashedCode string) (OAuthAuthorizationCode, error)
+	// Claims the refresh token, which is replaced by a new one on every refresh
+	DeleteOAuthRefreshToken(ctx context.Context, hashedToken string) (OAuthRefreshToken, error)
+	// Claims the token, so that it is used only once
+	DeletePasswordResetToken(ctx context.Context, hashedToken string) (PasswordResetToken, error)
+	DeletePasswordResetTokens(ctx context.Context, username string) error
+	// Deletes the buckets not used since before, which are full by then and
+	// would be created again as they were
+	DeleteRateLimitBuckets(ctx context.Context, before time.Time) (int64, error)
+	DeleteRecoveryCode(ctx context.Context, id int64) (int64, error)
+	DeleteRecoveryCodes(ctx context.Context, username string) error
+	EnableTOTP(ctx context.Context, arg EnableTOTPParams) (User, error)
+	GetAPIKeyByPrefix(ctx context.Context, prefix string) (APIKey, error)
 	GetAccount(ctx context.Context, id int64) (Account, error)
 	GetAccountForUpdate(ctx context.Context, id int64) (Account, error)
 	GetEntry(ctx context.Context, id int64) (Entry, error)
+	GetIdempotencyKey(ctx context.Context, arg GetIdempotencyKeyParams) (IdempotencyKey, error)
+	GetOAuthClient(ctx context.Context, id string) (OAuthClient, error)
+	// Checked on every authenticated request, to reject the access tokens issued
+	// before the password of the user changed
+	GetPasswordChangedAt(ctx context.Context, username string) (time.Time, error)
 	GetTransfer(ctx context.Context, id int64) (Transfer, error)
 	GetUser(ctx context.Context, username string) (User, error)
+	GetUserByEmail(ctx context.Context, email string) (User, error)
+	// Checked before the actions that need a verified email
+	IsEmailVerified(ctx context.Context, username string) (bool, error)
+	ListAPIKeys(ctx context.Context, username string) ([]APIKey, error)
 	ListAccounts(ctx context.Context, arg ListAccountsParams) ([]Account, error)
 	ListEntries(ctx context.Context, arg ListEntriesParams) ([]Entry, error)
+	ListLoginAttempts(ctx context.Context, arg ListLoginAttemptsParams) ([]LoginAttempt, error)
+	ListRecoveryCodes(ctx context.Context, username string) ([]RecoveryCode, error)
 	ListTransfers(ctx context.Context, arg ListTransfersParams) ([]Transfer, error)
+	// Counts a failed login of the user. Once max_attempts logins failed in a
+	// row, the user is locked for lockout_seconds, doubled on every further
+	// failure up to max_lockout_seconds. The lockout starts at now, from the
+	// clock of the application, which also checks it.
+	RecordFailedLogin(ctx context.Context, arg RecordFailedLoginParams) (User, error)
+	// Replaces the hash of the password of the user by one of the current
+	// algorithm, keeping password_changed_at so that their access tokens stay
+	// valid. Nothing is updated if the password changed since old_hashed_password
+	// was checked.
+	RehashUserPassword(ctx context.Context, arg RehashUserPasswordParams) error
+	ResetFailedLogins(ctx context.Context, username string) error
+	SetAccountFrozen(ctx context.Context, arg SetAccountFrozenParams) (Account, error)
+	SetIdempotencyKeyResponse(ctx context.Context, arg SetIdempotencyKeyResponseParams) error
+	// Starts the TOTP enrollment of the user. No row is returned once TOTP is
+	// enabled, so that enrolling again does not replace the secret in use.
+	SetTOTPSecret(ctx context.Context, arg SetTOTPSecretParams) (User, error)
+	// Refills the bucket of key for the time elapsed since its last update, up
+	// to burst, and takes a token from it if one is left. A missing bucket is
+	// created full.
+	TakeRateLimitToken(ctx context.Context, arg TakeRateLimitTokenParams) (RateLimitBucket, error)
+	TouchAPIKey(ctx context.Context, arg TouchAPIKeyParams) error
 	UpdateAccount(ctx context.Context, arg UpdateAccountParams) (Account, error)
+	// Updates the profile fields that are not null. Changing the email resets
+	// its verification, the new one has to be verified again.
+	UpdateUser(ctx context.Context, arg UpdateUserParams) (User, error)
+	// The change time comes from the clock of the application, which also sets
+	// the issue time of the access tokens it is compared with
+	UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) (User, error)
+	UpdateUserRole(ctx context.Context, arg UpdateUserRoleParams) (User, error)
+	// Accepts a TOTP code of the given time step. No row is updated when a code
+	// of this step or a later one was already accepted.
+	UseTOTPStep(ctx context.Context, arg UseTOTPStepParams) (int64, error)
+	// Claims the token, so that it is used only once. No row is returned once
+	// the token was used or has expired.
+	UseVerifyEmail(ctx context.Context, hashedToken string) (VerifyEmail, error)
+	// Verifies the email of the user, unless it changed since the link was sent
+	VerifyUserEmail(ctx context.Context, arg VerifyUserEmailParams) (User, error)
 }
 
 var _ Querier = (*Queries)(nil)
@@ -0,0 +1,64 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.14.0
+// source: rate_limit.sql
+
+package db
+
+import (
+	"context"
+	"time"
+)
+
+const deleteRateLimitBuckets = `-- name: DeleteRateLimitBuckets :execrows
+DELETE FROM rate_limit_buckets
+WHERE updated_at < $1
+`
+
+// Deletes the buckets not used since before, which are full by then and
+// would be created again as they were
+func (q *Queries) DeleteRateLimitBuckets(ctx context.Context, before time.Time) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteRateLimitBuckets, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const takeRateLimitToken = `-- name: TakeRateLimitToken :one
+INSERT INTO rate_limit_buckets (
+  key, tokens, allowed, updated_at
+) VALUES (
+  $1, $2::float8 - 1, true, now()
+)
+ON CONFLICT (key) DO UPDATE
+SET tokens = CASE
+    WHEN LEAST($2::float8, rate_limit_buckets.tokens + EXTRACT(EPOCH FROM now() - rate_limit_buckets.updated_at)::float8 * $3::float8) >= 1
+    THEN LEAST($2::float8, rate_limit_buckets.tokens + EXTRACT(EPOCH FROM now() - rate_limit_buckets.updated_at)::float8 * $3::float8) - 1
+    ELSE LEAST($2::float8, rate_limit_buckets.tokens + EXTRACT(EPOCH FROM now() - rate_limit_buckets.updated_at)::float8 * $3::float8)
+  END,
+  allowed = LEAST($2::float8, rate_limit_buckets.tokens + EXTRACT(EPOCH FROM now() - rate_limit_buckets.updated_at)::float8 * $3::float8) >= 1,
+  updated_at = now()
+RETURNING key, tokens, allowed, updated_at
+`
+
+type TakeRateLimitTokenParams struct {
+	Key   string  `json:"key"`
+	Burst float64 `json:"burst"`
+	Rate  float64 `json:"rate"`
+}
+
+// Refills the bucket of key for the time elapsed since its last update, up
+// to burst, and takes a token from it if one is left. A missing bucket is
+// created full.
+func (q *Queries) TakeRateLimitToken(ctx context.Context, arg TakeRateLimitTokenParams) (RateLimitBucket, error) {
+	row := q.db.QueryRowContext(ctx, takeRateLimitToken, arg.Key, arg.Burst, arg.Rate)
+	var i RateLimitBucket
+	err := row.Scan(
+		&i.Key,
+		&i.Tokens,
+		&i.Allowed,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
@@ -0,0 +1,49 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dpsigor/cheatsheet-golang-postgres/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTakeRateLimitToken(t *testing.T) {
+	arg := TakeRateLimitTokenParams{Key: util.RandomString(16), Burst: 1, Rate: 0}
+
+	bucket, err := testQueries.TakeRateLimitToken(context.Background(), arg)
+	require.NoError(t, err)
+	require.Equal(t, arg.Key, bucket.Key)
+	require.True(t, bucket.Allowed)
+	require.Zero(t, bucket.Tokens)
+
+	// the empty bucket is not refilled at a rate of zero
+	bucket, err = testQueries.TakeRateLimitToken(context.Background(), arg)
+	require.NoError(t, err)
+	require.False(t, bucket.Allowed)
+	require.Zero(t, bucket.Tokens)
+
+	// a slow refill leaves a fraction of a token, which is not enough
+	time.Sleep(10 * time.Millisecond)
+	arg.Rate = 1
+	bucket, err = testQueries.TakeRateLimitToken(context.Background(), arg)
+	require.NoError(t, err)
+	require.False(t, bucket.Allowed)
+	require.Greater(t, bucket.Tokens, 0.0)
+	require.Less(t, bucket.Tokens, 1.0)
+}
+
+func TestDeleteRateLimitBuckets(t *testing.T) {
+	arg := TakeRateLimitTokenParams{Key: util.RandomString(16), Burst: 1, Rate: 0}
+	_, err := testQueries.TakeRateLimitToken(context.Background(), arg)
+	require.NoError(t, err)
+
+	n, err := testQueries.DeleteRateLimitBuckets(context.Background(), time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, n, int64(1))
+
+	bucket, err := testQueries.TakeRateLimitToken(context.Background(), arg)
+	require.NoError(t, err)
+	require.True(t, bucket.Allowed)
+}
@@ -0,0 +1,93 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.14.0
+// source: recovery_code.sql
+
+package db
+
+import (
+	"context"
+)
+
+const createRecoveryCode = `-- name: CreateRecoveryCode :one
+INSERT INTO recovery_codes (
+  username, hashed_code
+) VALUES (
+  $1, $2
+)
+RETURNING id, username, hashed_code, created_at
+`
+
+type CreateRecoveryCodeParams struct {
+	Username   string `json:"username"`
+	HashedCode string `json:"hashed_code"`
+}
+
+func (q *Queries) CreateRecoveryCode(ctx context.Context, arg CreateRecoveryCodeParams) (RecoveryCode, error) {
+	row := q.db.QueryRowContext(ctx, createRecoveryCode, arg.Username, arg.HashedCode)
+	var i RecoveryCode
+	err := row.Scan(
+		&i.ID,
+		&i.Username,
+		&i.HashedCode,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const deleteRecoveryCode = `-- name: DeleteRecoveryCode :execrows
+DELETE FROM recovery_codes
+WHERE id = $1
+`
+
+func (q *Queries) DeleteRecoveryCode(ctx context.Context, id int64) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteRecoveryCode, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteRecoveryCodes = `-- name: DeleteRecoveryCodes :exec
+DELETE FROM recovery_codes
+WHERE username = $1
+`
+
+func (q *Queries) DeleteRecoveryCodes(ctx context.Context, username string) error {
+	_, err := q.db.ExecContext(ctx, deleteRecoveryCodes, username)
+	return err
+}
+
+const listRecoveryCodes = `-- name: ListRecoveryCodes :many
+SELECT id, username, hashed_code, created_at FROM recovery_codes
+WHERE username = $1
+ORDER BY id
+`
+
+func (q *Queries) ListRecoveryCodes(ctx context.Context, username string) ([]RecoveryCode, error) {
+	rows, err := q.db.QueryContext(ctx, listRecoveryCodes, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []RecoveryCode{}
+	for rows.Next() {
+		var i RecoveryCode
+		if err := rows.Scan(
+			&i.ID,
+			&i.Username,
+			&i.HashedCode,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -0,0 +1,49 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dpsigor/cheatsheet-golang-postgres/util"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateRecoveryCode(t *testing.T) {
+	store := NewStore(testDB, zerolog.Nop())
+	user := createRandomUser(t)
+	arg := CreateRecoveryCodeParams{
+		Username:   user.Username,
+		HashedCode: util.RandomString(32),
+	}
+	code, err := store.CreateRecoveryCode(context.Background(), arg)
+	require.NoError(t, err)
+	require.NotZero(t, code.ID)
+	require.Equal(t, arg.Username, code.Username)
+	require.Equal(t, arg.HashedCode, code.HashedCode)
+	require.NotZero(t, code.CreatedAt)
+
+	arg.Username = user.Username + "x"
+	_, err = store.CreateRecoveryCode(context.Background(), arg)
+	require.ErrorIs(t, err, ErrForeignKey)
+}
+
+func TestDeleteRecoveryCode(t *testing.T) {
+	user := createRandomUser(t)
+	code, err := testQueries.CreateRecoveryCode(context.Background(), CreateRecoveryCodeParams{
+		Username:   user.Username,
+		HashedCode: util.RandomString(32),
+	})
+	require.NoError(t, err)
+
+	n, err := testQueries.DeleteRecoveryCode(context.Background(), code.ID)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), n)
+	n, err = testQueries.DeleteRecoveryCode(context.Background(), code.ID)
+	require.NoError(t, err)
+	require.Zero(t, n)
+
+	codes, err := testQueries.ListRecoveryCodes(context.Background(), user.Username)
+	require.NoError(t, err)
+	require.Empty(t, codes)
+}
@@ -0,0 +1,35 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// SchemaVersion is the version of the latest migration in db/migration, the
+// schema the queries of this package are generated from
+const SchemaVersion = 11
+
+// ErrSchemaVersion is returned when the database is not migrated to
+// SchemaVersion
+var ErrSchemaVersion = errors.New("database schema version mismatch")
+
+// CheckSchemaVersion returns ErrSchemaVersion unless the last migration
+// applied by golang-migrate is SchemaVersion and it completed
+func CheckSchemaVersion(ctx context.Context, db DBTX) error {
+	var (
+		version int64
+		dirty   bool
+	)
+	err := db.QueryRowContext(ctx, "SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&version, &dirty)
+	if err != nil {
+		return fmt.Errorf("cannot read schema version: %w", err)
+	}
+	if dirty {
+		return fmt.Errorf("%w: migration %d did not complete", ErrSchemaVersion, version)
+	}
+	if version != SchemaVersion {
+		return fmt.Errorf("%w: database is at %d, expected %d", ErrSchemaVersion, version, SchemaVersion)
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/dpsigor/cheatsheet-golang-postgres/db/migration"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSchemaVersion fails when a migration is added without bumping
+// SchemaVersion
+func TestSchemaVersion(t *testing.T) {
+	latest, err := migration.LatestVersion()
+	require.NoError(t, err)
+	require.Equal(t, uint(SchemaVersion), latest)
+}
@@ -4,25 +4,33 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"time"
+
+	"github.com/rs/zerolog"
 )
 
 // Store provides all functions to execute db queries and transactions
 type Store interface {
 	Querier
 	TransferTx(ctx context.Context, arg TransferTxParams) (TransferTxResult, error)
+	EnableTOTPTx(ctx context.Context, arg EnableTOTPTxParams) (EnableTOTPTxResult, error)
+	ChangePasswordTx(ctx context.Context, arg ChangePasswordTxParams) (User, error)
+	VerifyEmailTx(ctx context.Context, arg VerifyEmailTxParams) (VerifyEmailTxResult, error)
 }
 
 // SQLStore provides all functions to execute SQL queries and transactions
 type SQLStore struct {
 	*Queries
-	db *sql.DB
+	db     *sql.DB
+	logger zerolog.Logger
 }
 
-// NewStore creates a new Store
-func NewStore(db *sql.DB) *SQLStore {
+// NewStore creates a new Store. Failed statements are logged with logger.
+func NewStore(db *sql.DB, logger zerolog.Logger) *SQLStore {
 	return &SQLStore{
 		db:      db,
-		Queries: New(db),
+		Queries: New(loggedDB{DBTX: db, logger: logger}),
+		logger:  logger,
 	}
 }
 
@@ -32,17 +40,132 @@ func (s *SQLStore) execTx(ctx context.Context, fn func(*Queries) error) error {
 	if err != nil {
 		return err
 	}
-	q := New(tx)
+	q := New(loggedDB{DBTX: tx, logger: s.logger})
 	err = fn(q)
 	if err != nil {
 		if rbErr := tx.Rollback(); rbErr != nil {
-			return fmt.Errorf("tx err: %v, rb err: %v", err, rbErr)
+			return fmt.Errorf("tx err: %v, rb err: %v", translateError(err), rbErr)
 		}
-		return err
+		return translateError(err)
 	}
 	return tx.Commit()
 }
 
+// The queries below may violate constraints, so their driver errors are
+// translated into domain errors
+
+// CreateUser creates a user, returning ErrDuplicateUsername or
+// ErrDuplicateEmail when they are already taken
+func (s *SQLStore) CreateUser(ctx context.Context, arg CreateUserParams) (User, error) {
+	user, err := s.Queries.CreateUser(ctx, arg)
+	return user, translateError(err)
+}
+
+// UpdateUser updates the profile of a user, returning ErrDuplicateEmail when
+// the new email is already taken
+func (s *SQLStore) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, error) {
+	user, err := s.Queries.UpdateUser(ctx, arg)
+	return user, translateError(err)
+}
+
+// CreateAccount creates an account, returning ErrOwnerCurrencyExists when the
+// owner already has an account in the currency and ErrForeignKey when the
+// owner does not exist
+func (s *SQLStore) CreateAccount(ctx context.Context, arg CreateAccountParams) (Account, error) {
+	account, err := s.Queries.CreateAccount(ctx, arg)
+	return account, translateError(err)
+}
+
+// CreateEntry creates an entry, returning ErrForeignKey when the account does
+// not exist
+func (s *SQLStore) CreateEntry(ctx context.Context, arg CreateEntryParams) (Entry, error) {
+	entry, err := s.Queries.CreateEntry(ctx, arg)
+	return entry, translateError(err)
+}
+
+// CreateTransfer creates a transfer, returning ErrForeignKey when one of the
+// accounts does not exist
+func (s *SQLStore) CreateTransfer(ctx context.Context, arg CreateTransferParams) (Transfer, error) {
+	transfer, err := s.Queries.CreateTransfer(ctx, arg)
+	return transfer, translateError(err)
+}
+
+// CreateLoginAttempt records a login attempt, returning ErrForeignKey when
+// the user does not exist
+func (s *SQLStore) CreateLoginAttempt(ctx context.Context, arg CreateLoginAttemptParams) (LoginAttempt, error) {
+	attempt, err := s.Queries.CreateLoginAttempt(ctx, arg)
+	return attempt, translateError(err)
+}
+
+// CreateRecoveryCode creates a recovery code, returning ErrForeignKey when
+// the user does not exist
+func (s *SQLStore) CreateRecoveryCode(ctx context.Context, arg CreateRecoveryCodeParams) (RecoveryCode, error) {
+	code, err := s.Queries.CreateRecoveryCode(ctx, arg)
+	return code, translateError(err)
+}
+
+// CreateLoginChallenge creates a login challenge, returning ErrForeignKey
+// when the user does not exist
+func (s *SQLStore) CreateLoginChallenge(ctx context.Context, arg CreateLoginChallengeParams) (LoginChallenge, error) {
+	challenge, err := s.Queries.CreateLoginChallenge(ctx, arg)
+	return challenge, translateError(err)
+}
+
+// CreatePasswordResetToken creates a password reset token, returning
+// ErrForeignKey when the user does not exist
+func (s *SQLStore) CreatePasswordResetToken(ctx context.Context, arg CreatePasswordResetTokenParams) (PasswordResetToken, error) {
+	resetToken, err := s.Queries.CreatePasswordResetToken(ctx, arg)
+	return resetToken, translateError(err)
+}
+
+// CreateAPIKey creates an API key, returning ErrForeignKey when the user does
+// not exist and ErrUniqueViolation when the prefix is taken
+func (s *SQLStore) CreateAPIKey(ctx context.Context, arg CreateAPIKeyParams) (APIKey, error) {
+	apiKey, err := s.Queries.CreateAPIKey(ctx, arg)
+	return apiKey, translateError(err)
+}
+
+// CreateOAuthClient registers an OAuth client, returning ErrForeignKey when
+// the owner does not exist and ErrUniqueViolation when the ID is taken
+func (s *SQLStore) CreateOAuthClient(ctx context.Context, arg CreateOAuthClientParams) (OAuthClient, error) {
+	client, err := s.Queries.CreateOAuthClient(ctx, arg)
+	return client, translateError(err)
+}
+
+// CreateOAuthAuthorizationCode creates an authorization code, returning
+// ErrForeignKey when the client or the user does not exist
+func (s *SQLStore) CreateOAuthAuthorizationCode(ctx context.Context, arg CreateOAuthAuthorizationCodeParams) (OAuthAuthorizationCode, error) {
+	code, err := s.Queries.CreateOAuthAuthorizationCode(ctx, arg)
+	return code, translateError(err)
+}
+
+// CreateOAuthRefreshToken creates a refresh token, returning ErrForeignKey
+// when the client or the user does not exist
+func (s *SQLStore) CreateOAuthRefreshToken(ctx context.Context, arg CreateOAuthRefreshTokenParams) (OAuthRefreshToken, error) {
+	refreshToken, err := s.Queries.CreateOAuthRefreshToken(ctx, arg)
+	return refreshToken, translateError(err)
+}
+
+// CreateVerifyEmail creates an email verification token, returning
+// ErrForeignKey when the user does not exist
+func (s *SQLStore) CreateVerifyEmail(ctx context.Context, arg CreateVerifyEmailParams) (VerifyEmail, error) {
+	verifyEmail, err := s.Queries.CreateVerifyEmail(ctx, arg)
+	return verifyEmail, translateError(err)
+}
+
+// AddAccountBalance adds amount to the balance of an account, returning
+// ErrOutOfRange when the balance would overflow
+func (s *SQLStore) AddAccountBalance(ctx context.Context, arg AddAccountBalanceParams) (Account, error) {
+	account, err := s.Queries.AddAccountBalance(ctx, arg)
+	return account, translateError(err)
+}
+
+// DeleteAccount deletes an account, returning ErrForeignKey when it still has
+// entries or transfers
+func (s *SQLStore) DeleteAccount(ctx context.Context, id int64) error {
+	return translateError(s.Queries.DeleteAccount(ctx, id))
+}
+
 // TransferTxParams contains the input parameters of the transfer transaction
 type TransferTxParams struct {
 	FromAccountID int64 `json:"from_account_id"`
@@ -62,8 +185,15 @@ type TransferTxResult struct {
 // TransferTx performs a money transfer from one account to the other.
 // It creates a transfer record, add account entries, and update
 // accounts' balance within a single database transaction.
+// It returns ErrInvalidAmount unless the amount is positive, and
+// ErrOutOfRange when a balance would overflow.
 func (s *SQLStore) TransferTx(ctx context.Context, arg TransferTxParams) (TransferTxResult, error) {
 	var r TransferTxResult
+	// the amount is negated for the entry of the sender, which overflows for
+	// math.MinInt64
+	if arg.Amount <= 0 {
+		return r, ErrInvalidAmount
+	}
 	err := s.execTx(ctx, func(q *Queries) error {
 		var err error
 
@@ -106,6 +236,90 @@ func (s *SQLStore) TransferTx(ctx context.Context, arg TransferTxParams) (Transf
 	return r, err
 }
 
+// EnableTOTPTxParams contains the input parameters of the TOTP enabling
+// transaction
+type EnableTOTPTxParams struct {
+	Username string `json:"username"`
+	// LastStep is the time step of the code confirming the enrollment
+	LastStep            int64    `json:"last_step"`
+	HashedRecoveryCodes []string `json:"hashed_recovery_codes"`
+}
+
+// EnableTOTPTxResult is the result of the TOTP enabling transaction
+type EnableTOTPTxResult struct {
+	User          User           `json:"user"`
+	RecoveryCodes []RecoveryCode `json:"recovery_codes"`
+}
+
+// EnableTOTPTx enables the TOTP enrolled by the user and replaces their
+// recovery codes within a single database transaction. It returns
+// ErrRecordNotFound when the user is not enrolled or TOTP is already enabled.
+func (s *SQLStore) EnableTOTPTx(ctx context.Context, arg EnableTOTPTxParams) (EnableTOTPTxResult, error) {
+	var r EnableTOTPTxResult
+	err := s.execTx(ctx, func(q *Queries) error {
+		var err error
+
+		r.User, err = q.EnableTOTP(ctx, EnableTOTPParams{
+			Username:     arg.Username,
+			TotpLastStep: arg.LastStep,
+		})
+		if err != nil {
+			return err
+		}
+
+		if err := q.DeleteRecoveryCodes(ctx, arg.Username); err != nil {
+			return err
+		}
+
+		r.RecoveryCodes = make([]RecoveryCode, 0, len(arg.HashedRecoveryCodes))
+		for _, hashedCode := range arg.HashedRecoveryCodes {
+			code, err := q.CreateRecoveryCode(ctx, CreateRecoveryCodeParams{
+				Username:   arg.Username,
+				HashedCode: hashedCode,
+			})
+			if err != nil {
+				return err
+			}
+			r.RecoveryCodes = append(r.RecoveryCodes, code)
+		}
+
+		return nil
+	})
+
+	return r, err
+}
+
+// ChangePasswordTxParams contains the input parameters of the password
+// change transaction
+type ChangePasswordTxParams struct {
+	Username          string    `json:"username"`
+	HashedPassword    string    `json:"hashed_password"`
+	PasswordChangedAt time.Time `json:"password_changed_at"`
+}
+
+// ChangePasswordTx sets the password of the user and deletes their password
+// reset tokens within a single database transaction. It returns
+// ErrRecordNotFound when the user does not exist.
+func (s *SQLStore) ChangePasswordTx(ctx context.Context, arg ChangePasswordTxParams) (User, error) {
+	var user User
+	err := s.execTx(ctx, func(q *Queries) error {
+		var err error
+
+		user, err = q.UpdateUserPassword(ctx, UpdateUserPasswordParams{
+			Username:          arg.Username,
+			HashedPassword:    arg.HashedPassword,
+			PasswordChangedAt: arg.PasswordChangedAt,
+		})
+		if err != nil {
+			return err
+		}
+
+		return q.DeletePasswordResetTokens(ctx, arg.Username)
+	})
+
+	return user, err
+}
+
 func addMoney(
 	ctx context.Context,
 	q *Queries,
@@ -127,3 +341,39 @@ func addMoney(
 	})
 	return account1, account2, err
 }
+
+// VerifyEmailTxParams contains the input parameters of the email verification
+// transaction
+type VerifyEmailTxParams struct {
+	HashedToken string `json:"hashed_token"`
+}
+
+// VerifyEmailTxResult is the result of the email verification transaction
+type VerifyEmailTxResult struct {
+	VerifyEmail VerifyEmail `json:"verify_email"`
+	User        User        `json:"user"`
+}
+
+// VerifyEmailTx claims an email verification token and verifies the email of
+// its user within a single database transaction. It returns
+// ErrRecordNotFound when the token is unknown, used or expired, or the user
+// changed their email since it was sent.
+func (s *SQLStore) VerifyEmailTx(ctx context.Context, arg VerifyEmailTxParams) (VerifyEmailTxResult, error) {
+	var r VerifyEmailTxResult
+	err := s.execTx(ctx, func(q *Queries) error {
+		var err error
+
+		r.VerifyEmail, err = q.UseVerifyEmail(ctx, arg.HashedToken)
+		if err != nil {
+			return err
+		}
+
+		r.User, err = q.VerifyUserEmail(ctx, VerifyUserEmailParams{
+			Username: r.VerifyEmail.Username,
+			Email:    r.VerifyEmail.Email,
+		})
+		return err
+	})
+
+	return r, err
+}
@@ -4,11 +4,12 @@ import (
 	"context"
 	"testing"
 
+	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/require"
 )
 
 func TestTransferTx(t *testing.T) {
-	s := NewStore(testDB)
+	s := NewStore(testDB, zerolog.Nop())
 	a1 := createRandomAccount(t)
 	a2 := createRandomAccount(t)
 
@@ -104,7 +105,7 @@ func TestTransferTx(t *testing.T) {
 }
 
 func TestTransferTxDeadlock(t *testing.T) {
-	s := NewStore(testDB)
+	s := NewStore(testDB, zerolog.Nop())
 	a1 := createRandomAccount(t)
 	a2 := createRandomAccount(t)
 
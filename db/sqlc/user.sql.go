@@ -7,6 +7,8 @@ package db
 
 import (
 	"context"
+	"database/sql"
+	"time"
 )
 
 const createUser = `-- name: CreateUser :one
@@ -15,7 +17,7 @@ INSERT INTO users (
 ) VALUES (
   $1, $2, $3, $4
 )
-RETURNING username, hashed_password, full_name, email, password_changed_at, created_at
+RETURNING username, hashed_password, full_name, email, password_changed_at, created_at, role, failed_login_attempts, locked_until, totp_secret, totp_enabled, totp_last_step, is_email_verified
 `
 
 type CreateUserParams struct {
@@ -40,12 +42,66 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.Email,
 		&i.PasswordChangedAt,
 		&i.CreatedAt,
+		&i.Role,
+		&i.FailedLoginAttempts,
+		&i.LockedUntil,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastStep,
+		&i.IsEmailVerified,
 	)
 	return i, err
 }
 
+const enableTOTP = `-- name: EnableTOTP :one
+UPDATE users
+SET totp_enabled = true, totp_last_step = $2
+WHERE username = $1 AND NOT totp_enabled AND totp_secret <> ''
+RETURNING username, hashed_password, full_name, email, password_changed_at, created_at, role, failed_login_attempts, locked_until, totp_secret, totp_enabled, totp_last_step, is_email_verified
+`
+
+type EnableTOTPParams struct {
+	Username     string `json:"username"`
+	TotpLastStep int64  `json:"totp_last_step"`
+}
+
+func (q *Queries) EnableTOTP(ctx context.Context, arg EnableTOTPParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, enableTOTP, arg.Username, arg.TotpLastStep)
+	var i User
+	err := row.Scan(
+		&i.Username,
+		&i.HashedPassword,
+		&i.FullName,
+		&i.Email,
+		&i.PasswordChangedAt,
+		&i.CreatedAt,
+		&i.Role,
+		&i.FailedLoginAttempts,
+		&i.LockedUntil,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastStep,
+		&i.IsEmailVerified,
+	)
+	return i, err
+}
+
+const getPasswordChangedAt = `-- name: GetPasswordChangedAt :one
+SELECT password_changed_at FROM users
+WHERE username = $1 LIMIT 1
+`
+
+// Checked on every authenticated request, to reject the access tokens issued
+// before the password of the user changed
+func (q *Queries) GetPasswordChangedAt(ctx context.Context, username string) (time.Time, error) {
+	row := q.db.QueryRowContext(ctx, getPasswordChangedAt, username)
+	var password_changed_at time.Time
+	err := row.Scan(&password_changed_at)
+	return password_changed_at, err
+}
+
 const getUser = `-- name: GetUser :one
-SELECT username, hashed_password, full_name, email, password_changed_at, created_at FROM users
+SELECT username, hashed_password, full_name, email, password_changed_at, created_at, role, failed_login_attempts, locked_until, totp_secret, totp_enabled, totp_last_step, is_email_verified FROM users
 WHERE username = $1 LIMIT 1
 `
 
@@ -59,6 +115,335 @@ func (q *Queries) GetUser(ctx context.Context, username string) (User, error) {
 		&i.Email,
 		&i.PasswordChangedAt,
 		&i.CreatedAt,
+		&i.Role,
+		&i.FailedLoginAttempts,
+		&i.LockedUntil,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastStep,
+		&i.IsEmailVerified,
+	)
+	return i, err
+}
+
+const getUserByEmail = `-- name: GetUserByEmail :one
+SELECT username, hashed_password, full_name, email, password_changed_at, created_at, role, failed_login_attempts, locked_until, totp_secret, totp_enabled, totp_last_step, is_email_verified FROM users
+WHERE email = $1 LIMIT 1
+`
+
+func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByEmail, email)
+	var i User
+	err := row.Scan(
+		&i.Username,
+		&i.HashedPassword,
+		&i.FullName,
+		&i.Email,
+		&i.PasswordChangedAt,
+		&i.CreatedAt,
+		&i.Role,
+		&i.FailedLoginAttempts,
+		&i.LockedUntil,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastStep,
+		&i.IsEmailVerified,
+	)
+	return i, err
+}
+
+const isEmailVerified = `-- name: IsEmailVerified :one
+SELECT is_email_verified FROM users
+WHERE username = $1 LIMIT 1
+`
+
+// Checked before the actions that need a verified email
+func (q *Queries) IsEmailVerified(ctx context.Context, username string) (bool, error) {
+	row := q.db.QueryRowContext(ctx, isEmailVerified, username)
+	var is_email_verified bool
+	err := row.Scan(&is_email_verified)
+	return is_email_verified, err
+}
+
+const recordFailedLogin = `-- name: RecordFailedLogin :one
+UPDATE users
+SET failed_login_attempts = failed_login_attempts + 1,
+  locked_until = CASE
+    WHEN failed_login_attempts + 1 >= $1::int
+    THEN $2::timestamptz + make_interval(secs => LEAST(
+      $3::float8,
+      $4::float8 * power(2, LEAST(failed_login_attempts + 1 - $1::int, 32))
+    ))
+    ELSE locked_until
+  END
+WHERE username = $5
+RETURNING username, hashed_password, full_name, email, password_changed_at, created_at, role, failed_login_attempts, locked_until, totp_secret, totp_enabled, totp_last_step, is_email_verified
+`
+
+type RecordFailedLoginParams struct {
+	MaxAttempts       int32     `json:"max_attempts"`
+	Now               time.Time `json:"now"`
+	MaxLockoutSeconds float64   `json:"max_lockout_seconds"`
+	LockoutSeconds    float64   `json:"lockout_seconds"`
+	Username          string    `json:"username"`
+}
+
+// Counts a failed login of the user. Once max_attempts logins failed in a
+// row, the user is locked for lockout_seconds, doubled on every further
+// failure up to max_lockout_seconds. The lockout starts at now, from the
+// clock of the application, which also checks it.
+func (q *Queries) RecordFailedLogin(ctx context.Context, arg RecordFailedLoginParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, recordFailedLogin,
+		arg.MaxAttempts,
+		arg.Now,
+		arg.MaxLockoutSeconds,
+		arg.LockoutSeconds,
+		arg.Username,
+	)
+	var i User
+	err := row.Scan(
+		&i.Username,
+		&i.HashedPassword,
+		&i.FullName,
+		&i.Email,
+		&i.PasswordChangedAt,
+		&i.CreatedAt,
+		&i.Role,
+		&i.FailedLoginAttempts,
+		&i.LockedUntil,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastStep,
+		&i.IsEmailVerified,
+	)
+	return i, err
+}
+
+const rehashUserPassword = `-- name: RehashUserPassword :exec
+UPDATE users
+SET hashed_password = $1
+WHERE username = $2 AND hashed_password = $3
+`
+
+type RehashUserPasswordParams struct {
+	HashedPassword    string `json:"hashed_password"`
+	Username          string `json:"username"`
+	OldHashedPassword string `json:"old_hashed_password"`
+}
+
+// Replaces the hash of the password of the user by one of the current
+// algorithm, keeping password_changed_at so that their access tokens stay
+// valid. Nothing is updated if the password changed since old_hashed_password
+// was checked.
+func (q *Queries) RehashUserPassword(ctx context.Context, arg RehashUserPasswordParams) error {
+	_, err := q.db.ExecContext(ctx, rehashUserPassword, arg.HashedPassword, arg.Username, arg.OldHashedPassword)
+	return err
+}
+
+const resetFailedLogins = `-- name: ResetFailedLogins :exec
+UPDATE users
+SET failed_login_attempts = 0
+WHERE username = $1
+`
+
+func (q *Queries) ResetFailedLogins(ctx context.Context, username string) error {
+	_, err := q.db.ExecContext(ctx, resetFailedLogins, username)
+	return err
+}
+
+const setTOTPSecret = `-- name: SetTOTPSecret :one
+UPDATE users
+SET totp_secret = $2
+WHERE username = $1 AND NOT totp_enabled
+RETURNING username, hashed_password, full_name, email, password_changed_at, created_at, role, failed_login_attempts, locked_until, totp_secret, totp_enabled, totp_last_step, is_email_verified
+`
+
+type SetTOTPSecretParams struct {
+	Username   string `json:"username"`
+	TotpSecret string `json:"totp_secret"`
+}
+
+// Starts the TOTP enrollment of the user. No row is returned once TOTP is
+// enabled, so that enrolling again does not replace the secret in use.
+func (q *Queries) SetTOTPSecret(ctx context.Context, arg SetTOTPSecretParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setTOTPSecret, arg.Username, arg.TotpSecret)
+	var i User
+	err := row.Scan(
+		&i.Username,
+		&i.HashedPassword,
+		&i.FullName,
+		&i.Email,
+		&i.PasswordChangedAt,
+		&i.CreatedAt,
+		&i.Role,
+		&i.FailedLoginAttempts,
+		&i.LockedUntil,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastStep,
+		&i.IsEmailVerified,
+	)
+	return i, err
+}
+
+const updateUser = `-- name: UpdateUser :one
+UPDATE users
+SET full_name = COALESCE($1, full_name),
+  email = COALESCE($2, email),
+  is_email_verified = is_email_verified AND COALESCE($2 = email, true)
+WHERE username = $3
+RETURNING username, hashed_password, full_name, email, password_changed_at, created_at, role, failed_login_attempts, locked_until, totp_secret, totp_enabled, totp_last_step, is_email_verified
+`
+
+type UpdateUserParams struct {
+	FullName sql.NullString `json:"full_name"`
+	Email    sql.NullString `json:"email"`
+	Username string         `json:"username"`
+}
+
+// Updates the profile fields that are not null. Changing the email resets
+// its verification, the new one has to be verified again.
+func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUser, arg.FullName, arg.Email, arg.Username)
+	var i User
+	err := row.Scan(
+		&i.Username,
+		&i.HashedPassword,
+		&i.FullName,
+		&i.Email,
+		&i.PasswordChangedAt,
+		&i.CreatedAt,
+		&i.Role,
+		&i.FailedLoginAttempts,
+		&i.LockedUntil,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastStep,
+		&i.IsEmailVerified,
+	)
+	return i, err
+}
+
+const updateUserPassword = `-- name: UpdateUserPassword :one
+UPDATE users
+SET hashed_password = $2, password_changed_at = $3
+WHERE username = $1
+RETURNING username, hashed_password, full_name, email, password_changed_at, created_at, role, failed_login_attempts, locked_until, totp_secret, totp_enabled, totp_last_step, is_email_verified
+`
+
+type UpdateUserPasswordParams struct {
+	Username          string    `json:"username"`
+	HashedPassword    string    `json:"hashed_password"`
+	PasswordChangedAt time.Time `json:"password_changed_at"`
+}
+
+// The change time comes from the clock of the application, which also sets
+// the issue time of the access tokens it is compared with
+func (q *Queries) UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUserPassword, arg.Username, arg.HashedPassword, arg.PasswordChangedAt)
+	var i User
+	err := row.Scan(
+		&i.Username,
+		&i.HashedPassword,
+		&i.FullName,
+		&i.Email,
+		&i.PasswordChangedAt,
+		&i.CreatedAt,
+		&i.Role,
+		&i.FailedLoginAttempts,
+		&i.LockedUntil,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastStep,
+		&i.IsEmailVerified,
+	)
+	return i, err
+}
+
+const updateUserRole = `-- name: UpdateUserRole :one
+UPDATE users
+SET role = $2
+WHERE username = $1
+RETURNING username, hashed_password, full_name, email, password_changed_at, created_at, role, failed_login_attempts, locked_until, totp_secret, totp_enabled, totp_last_step, is_email_verified
+`
+
+type UpdateUserRoleParams struct {
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
+
+func (q *Queries) UpdateUserRole(ctx context.Context, arg UpdateUserRoleParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUserRole, arg.Username, arg.Role)
+	var i User
+	err := row.Scan(
+		&i.Username,
+		&i.HashedPassword,
+		&i.FullName,
+		&i.Email,
+		&i.PasswordChangedAt,
+		&i.CreatedAt,
+		&i.Role,
+		&i.FailedLoginAttempts,
+		&i.LockedUntil,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastStep,
+		&i.IsEmailVerified,
+	)
+	return i, err
+}
+
+const useTOTPStep = `-- name: UseTOTPStep :execrows
+UPDATE users
+SET totp_last_step = $2
+WHERE username = $1 AND totp_enabled AND totp_last_step < $2
+`
+
+type UseTOTPStepParams struct {
+	Username     string `json:"username"`
+	TotpLastStep int64  `json:"totp_last_step"`
+}
+
+// Accepts a TOTP code of the given time step. No row is updated when a code
+// of this step or a later one was already accepted.
+func (q *Queries) UseTOTPStep(ctx context.Context, arg UseTOTPStepParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, useTOTPStep, arg.Username, arg.TotpLastStep)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const verifyUserEmail = `-- name: VerifyUserEmail :one
+UPDATE users
+SET is_email_verified = true
+WHERE username = $1 AND email = $2
+RETURNING username, hashed_password, full_name, email, password_changed_at, created_at, role, failed_login_attempts, locked_until, totp_secret, totp_enabled, totp_last_step, is_email_verified
+`
+
+type VerifyUserEmailParams struct {
+	Username string `json:"username"`
+	Email    string `json:"email"`
+}
+
+// Verifies the email of the user, unless it changed since the link was sent
+func (q *Queries) VerifyUserEmail(ctx context.Context, arg VerifyUserEmailParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, verifyUserEmail, arg.Username, arg.Email)
+	var i User
+	err := row.Scan(
+		&i.Username,
+		&i.HashedPassword,
+		&i.FullName,
+		&i.Email,
+		&i.PasswordChangedAt,
+		&i.CreatedAt,
+		&i.Role,
+		&i.FailedLoginAttempts,
+		&i.LockedUntil,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastStep,
+		&i.IsEmailVerified,
 	)
 	return i, err
 }
@@ -2,14 +2,17 @@ package db
 
 import (
 	"context"
+	"database/sql"
 	"testing"
+	"time"
 
 	"github.com/dpsigor/cheatsheet-golang-postgres/util"
+	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/require"
 )
 
 func createRandomUser(t *testing.T) User {
-	hashedPw, err := util.HashPassword(util.RandomString(6))
+	hashedPw, err := testHasher.Hash(util.RandomString(6))
 	require.NoError(t, err)
 	arg := CreateUserParams{
 		Username:       util.RandomOwner(),
@@ -27,6 +30,7 @@ func createRandomUser(t *testing.T) User {
 	require.Equal(t, arg.HashedPassword, user.HashedPassword)
 	require.Equal(t, arg.FullName, user.FullName)
 	require.Equal(t, arg.Email, user.Email)
+	require.Equal(t, util.DepositorRole, user.Role)
 	require.True(t, user.PasswordChangedAt.IsZero())
 	require.NotZero(t, user.CreatedAt)
 	return user
@@ -49,6 +53,154 @@ func TestGetUser(t *testing.T) {
 	require.Equal(t, user1.CreatedAt, user2.CreatedAt)
 }
 
+func TestUpdateUserPassword(t *testing.T) {
+	user1 := createRandomUser(t)
+	hashedPw, err := testHasher.Hash(util.RandomString(6))
+	require.NoError(t, err)
+
+	changedAt := time.Now().Add(-time.Minute)
+	user2, err := testQueries.UpdateUserPassword(context.Background(), UpdateUserPasswordParams{
+		Username:          user1.Username,
+		HashedPassword:    hashedPw,
+		PasswordChangedAt: changedAt,
+	})
+	require.NoError(t, err)
+	require.Equal(t, hashedPw, user2.HashedPassword)
+	require.WithinDuration(t, changedAt, user2.PasswordChangedAt, time.Microsecond)
+	require.Equal(t, user1.Email, user2.Email)
+
+	changedAt, err = testQueries.GetPasswordChangedAt(context.Background(), user1.Username)
+	require.NoError(t, err)
+	require.Equal(t, user2.PasswordChangedAt, changedAt)
+}
+
+func TestUpdateUser(t *testing.T) {
+	store := NewStore(testDB, zerolog.Nop())
+	user1 := createRandomUser(t)
+	user1, err := store.VerifyUserEmail(context.Background(), VerifyUserEmailParams{Username: user1.Username, Email: user1.Email})
+	require.NoError(t, err)
+
+	fullName := util.RandomOwner()
+	user2, err := store.UpdateUser(context.Background(), UpdateUserParams{
+		Username: user1.Username,
+		FullName: sql.NullString{String: fullName, Valid: true},
+	})
+	require.NoError(t, err)
+	require.Equal(t, fullName, user2.FullName)
+	require.Equal(t, user1.Email, user2.Email)
+	require.True(t, user2.IsEmailVerified)
+
+	email := util.RandomEmail()
+	user2, err = store.UpdateUser(context.Background(), UpdateUserParams{
+		Username: user1.Username,
+		Email:    sql.NullString{String: email, Valid: true},
+	})
+	require.NoError(t, err)
+	require.Equal(t, email, user2.Email)
+	require.Equal(t, fullName, user2.FullName)
+	require.False(t, user2.IsEmailVerified)
+
+	user3 := createRandomUser(t)
+	_, err = store.UpdateUser(context.Background(), UpdateUserParams{
+		Username: user1.Username,
+		Email:    sql.NullString{String: user3.Email, Valid: true},
+	})
+	require.ErrorIs(t, err, ErrDuplicateEmail)
+}
+
+func TestRehashUserPassword(t *testing.T) {
+	user1 := createRandomUser(t)
+	hashedPw := util.RandomString(32)
+
+	err := testQueries.RehashUserPassword(context.Background(), RehashUserPasswordParams{
+		Username:          user1.Username,
+		HashedPassword:    hashedPw,
+		OldHashedPassword: user1.HashedPassword,
+	})
+	require.NoError(t, err)
+	user2, err := testQueries.GetUser(context.Background(), user1.Username)
+	require.NoError(t, err)
+	require.Equal(t, hashedPw, user2.HashedPassword)
+	require.Equal(t, user1.PasswordChangedAt, user2.PasswordChangedAt)
+}
+
+func TestGetUserByEmail(t *testing.T) {
+	user1 := createRandomUser(t)
+	user2, err := testQueries.GetUserByEmail(context.Background(), user1.Email)
+	require.NoError(t, err)
+	require.Equal(t, user1.Username, user2.Username)
+
+	_, err = testQueries.GetUserByEmail(context.Background(), "x"+user1.Email)
+	require.ErrorIs(t, err, ErrRecordNotFound)
+}
+
+func TestUpdateUserRole(t *testing.T) {
+	user1 := createRandomUser(t)
+	user2, err := testQueries.UpdateUserRole(context.Background(), UpdateUserRoleParams{
+		Username: user1.Username,
+		Role:     util.BankerRole,
+	})
+	require.NoError(t, err)
+	require.Equal(t, util.BankerRole, user2.Role)
+	require.Equal(t, user1.HashedPassword, user2.HashedPassword)
+}
+
+func TestRecordFailedLogin(t *testing.T) {
+	user1 := createRandomUser(t)
+	now := time.Now().Add(time.Hour).Truncate(time.Microsecond)
+	arg := RecordFailedLoginParams{
+		Username:          user1.Username,
+		MaxAttempts:       1,
+		LockoutSeconds:    30,
+		MaxLockoutSeconds: 60,
+		Now:               now,
+	}
+	user2, err := testQueries.RecordFailedLogin(context.Background(), arg)
+	require.NoError(t, err)
+	require.Equal(t, int32(1), user2.FailedLoginAttempts)
+	require.True(t, now.Add(30*time.Second).Equal(user2.LockedUntil))
+
+	err = testQueries.ResetFailedLogins(context.Background(), user1.Username)
+	require.NoError(t, err)
+	user3, err := testQueries.GetUser(context.Background(), user1.Username)
+	require.NoError(t, err)
+	require.Zero(t, user3.FailedLoginAttempts)
+	// the lockout is not lifted
+	require.Equal(t, user2.LockedUntil, user3.LockedUntil)
+}
+
+func TestEnableTOTP(t *testing.T) {
+	store := NewStore(testDB, zerolog.Nop())
+	user1 := createRandomUser(t)
+
+	user2, err := testQueries.SetTOTPSecret(context.Background(), SetTOTPSecretParams{
+		Username:   user1.Username,
+		TotpSecret: util.RandomString(32),
+	})
+	require.NoError(t, err)
+	require.False(t, user2.TotpEnabled)
+
+	result, err := store.EnableTOTPTx(context.Background(), EnableTOTPTxParams{
+		Username:            user1.Username,
+		LastStep:            100,
+		HashedRecoveryCodes: []string{util.RandomString(32), util.RandomString(32)},
+	})
+	require.NoError(t, err)
+	require.True(t, result.User.TotpEnabled)
+	require.Equal(t, user2.TotpSecret, result.User.TotpSecret)
+	require.Len(t, result.RecoveryCodes, 2)
+
+	n, err := testQueries.UseTOTPStep(context.Background(), UseTOTPStepParams{Username: user1.Username, TotpLastStep: 100})
+	require.NoError(t, err)
+	require.Zero(t, n)
+	n, err = testQueries.UseTOTPStep(context.Background(), UseTOTPStepParams{Username: user1.Username, TotpLastStep: 101})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), n)
+
+	_, err = testQueries.SetTOTPSecret(context.Background(), SetTOTPSecretParams{Username: user1.Username, TotpSecret: "x"})
+	require.ErrorIs(t, err, ErrRecordNotFound)
+}
+
 // func TestUpdateAccount(t *testing.T) {
 // 	account1 := createRandomAccount(t)
 // 	arg := UpdateAccountParams{
@@ -0,0 +1,71 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.14.0
+// source: verify_email.sql
+
+package db
+
+import (
+	"context"
+	"time"
+)
+
+const createVerifyEmail = `-- name: CreateVerifyEmail :one
+INSERT INTO verify_emails (
+  username, email, hashed_token, expires_at
+) VALUES (
+  $1, $2, $3, $4
+)
+RETURNING id, username, email, hashed_token, is_used, expires_at, created_at
+`
+
+type CreateVerifyEmailParams struct {
+	Username    string    `json:"username"`
+	Email       string    `json:"email"`
+	HashedToken string    `json:"hashed_token"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+func (q *Queries) CreateVerifyEmail(ctx context.Context, arg CreateVerifyEmailParams) (VerifyEmail, error) {
+	row := q.db.QueryRowContext(ctx, createVerifyEmail,
+		arg.Username,
+		arg.Email,
+		arg.HashedToken,
+		arg.ExpiresAt,
+	)
+	var i VerifyEmail
+	err := row.Scan(
+		&i.ID,
+		&i.Username,
+		&i.Email,
+		&i.HashedToken,
+		&i.IsUsed,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const useVerifyEmail = `-- name: UseVerifyEmail :one
+UPDATE verify_emails
+SET is_used = true
+WHERE hashed_token = $1 AND NOT is_used AND expires_at > now()
+RETURNING id, username, email, hashed_token, is_used, expires_at, created_at
+`
+
+// Claims the token, so that it is used only once. No row is returned once
+// the token was used or has expired.
+func (q *Queries) UseVerifyEmail(ctx context.Context, hashedToken string) (VerifyEmail, error) {
+	row := q.db.QueryRowContext(ctx, useVerifyEmail, hashedToken)
+	var i VerifyEmail
+	err := row.Scan(
+		&i.ID,
+		&i.Username,
+		&i.Email,
+		&i.HashedToken,
+		&i.IsUsed,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
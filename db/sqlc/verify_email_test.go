@@ -0,0 +1,61 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dpsigor/cheatsheet-golang-postgres/util"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateVerifyEmail(t *testing.T) {
+	store := NewStore(testDB, zerolog.Nop())
+	user := createRandomUser(t)
+	require.False(t, user.IsEmailVerified)
+	arg := CreateVerifyEmailParams{
+		Username:    user.Username,
+		Email:       user.Email,
+		HashedToken: util.RandomString(64),
+		ExpiresAt:   time.Now().Add(time.Hour),
+	}
+	verifyEmail, err := store.CreateVerifyEmail(context.Background(), arg)
+	require.NoError(t, err)
+	require.Equal(t, arg.Username, verifyEmail.Username)
+	require.Equal(t, arg.Email, verifyEmail.Email)
+	require.Equal(t, arg.HashedToken, verifyEmail.HashedToken)
+	require.False(t, verifyEmail.IsUsed)
+	require.WithinDuration(t, arg.ExpiresAt, verifyEmail.ExpiresAt, time.Millisecond)
+
+	_, err = store.CreateVerifyEmail(context.Background(), arg)
+	require.ErrorIs(t, err, ErrUniqueViolation)
+
+	arg.HashedToken = util.RandomString(64)
+	arg.Username = user.Username + "x"
+	_, err = store.CreateVerifyEmail(context.Background(), arg)
+	require.ErrorIs(t, err, ErrForeignKey)
+}
+
+func TestVerifyEmailTx(t *testing.T) {
+	store := NewStore(testDB, zerolog.Nop())
+	user := createRandomUser(t)
+	verifyEmail, err := testQueries.CreateVerifyEmail(context.Background(), CreateVerifyEmailParams{
+		Username:    user.Username,
+		Email:       user.Email,
+		HashedToken: util.RandomString(64),
+		ExpiresAt:   time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+
+	result, err := store.VerifyEmailTx(context.Background(), VerifyEmailTxParams{HashedToken: verifyEmail.HashedToken})
+	require.NoError(t, err)
+	require.True(t, result.VerifyEmail.IsUsed)
+	require.True(t, result.User.IsEmailVerified)
+	verified, err := testQueries.IsEmailVerified(context.Background(), user.Username)
+	require.NoError(t, err)
+	require.True(t, verified)
+
+	_, err = store.VerifyEmailTx(context.Background(), VerifyEmailTxParams{HashedToken: verifyEmail.HashedToken})
+	require.ErrorIs(t, err, ErrRecordNotFound)
+}
@@ -0,0 +1,1244 @@
+// Package storetest is a conformance suite for implementations of db.Store.
+// It runs against db.SQLStore and the in-memory store of db/memory, so that
+// tests using the latter exercise the behaviour of the database.
+//
+// The suite does not assume an empty store: it creates its own users and
+// accounts and only looks at those.
+package storetest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	db "github.com/dpsigor/cheatsheet-golang-postgres/db/sqlc"
+	"github.com/dpsigor/cheatsheet-golang-postgres/util"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+// Run runs the suite against the stores returned by newStore, which is
+// called once per subtest
+func Run(t *testing.T, newStore func(t *testing.T) db.Store) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, store db.Store)
+	}{
+		{"Users", testUsers},
+		{"DuplicateUser", testDuplicateUser},
+		{"UpdateUser", testUpdateUser},
+		{"RehashUserPassword", testRehashUserPassword},
+		{"FailedLogins", testFailedLogins},
+		{"LoginAttempts", testLoginAttempts},
+		{"TOTP", testTOTP},
+		{"RecoveryCodes", testRecoveryCodes},
+		{"LoginChallenges", testLoginChallenges},
+		{"PasswordResetTokens", testPasswordResetTokens},
+		{"ChangePasswordTx", testChangePasswordTx},
+		{"VerifyEmails", testVerifyEmails},
+		{"VerifyEmailTx", testVerifyEmailTx},
+		{"APIKeys", testAPIKeys},
+		{"OAuth", testOAuth},
+		{"Accounts", testAccounts},
+		{"AccountConstraints", testAccountConstraints},
+		{"ListAccounts", testListAccounts},
+		{"DeleteAccount", testDeleteAccount},
+		{"Entries", testEntries},
+		{"Transfers", testTransfers},
+		{"TransferTx", testTransferTx},
+		{"TransferTxConcurrent", testTransferTxConcurrent},
+		{"TransferTxMissingAccount", testTransferTxMissingAccount},
+		{"TransferTxInvalidAmount", testTransferTxInvalidAmount},
+		{"TransferTxOutOfRange", testTransferTxOutOfRange},
+		{"TransferTxProperties", testTransferTxProperties},
+		{"IdempotencyKeys", testIdempotencyKeys},
+		{"RateLimitBuckets", testRateLimitBuckets},
+		{"CanceledContext", testCanceledContext},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			tc.test(t, newStore(t))
+		})
+	}
+}
+
+func createUser(t *testing.T, store db.Store) db.User {
+	arg := db.CreateUserParams{
+		Username:       util.RandomOwner() + util.RandomString(6),
+		HashedPassword: util.RandomString(32),
+		FullName:       util.RandomOwner(),
+		Email:          util.RandomString(12) + "@email.com",
+	}
+	user, err := store.CreateUser(context.Background(), arg)
+	require.NoError(t, err)
+	return user
+}
+
+func createAccount(t *testing.T, store db.Store, owner string, currency string) db.Account {
+	arg := db.CreateAccountParams{
+		Owner:    owner,
+		Balance:  util.RandomMoney(),
+		Currency: currency,
+	}
+	account, err := store.CreateAccount(context.Background(), arg)
+	require.NoError(t, err)
+	return account
+}
+
+func testUsers(t *testing.T, store db.Store) {
+	ctx := context.Background()
+	arg := db.CreateUserParams{
+		Username:       util.RandomOwner() + util.RandomString(6),
+		HashedPassword: util.RandomString(32),
+		FullName:       util.RandomOwner(),
+		Email:          util.RandomString(12) + "@email.com",
+	}
+	user, err := store.CreateUser(ctx, arg)
+	require.NoError(t, err)
+	require.Equal(t, arg.Username, user.Username)
+	require.Equal(t, arg.HashedPassword, user.HashedPassword)
+	require.Equal(t, arg.FullName, user.FullName)
+	require.Equal(t, arg.Email, user.Email)
+	require.Equal(t, util.DepositorRole, user.Role)
+	require.True(t, user.PasswordChangedAt.IsZero())
+	require.WithinDuration(t, time.Now(), user.CreatedAt, time.Second)
+
+	got, err := store.GetUser(ctx, user.Username)
+	require.NoError(t, err)
+	require.Equal(t, user.HashedPassword, got.HashedPassword)
+	require.True(t, user.CreatedAt.Equal(got.CreatedAt))
+	got, err = store.GetUserByEmail(ctx, user.Email)
+	require.NoError(t, err)
+	require.Equal(t, user.Username, got.Username)
+
+	changedAt := time.Now().Add(-time.Minute)
+	updated, err := store.UpdateUserPassword(ctx, db.UpdateUserPasswordParams{
+		Username:          user.Username,
+		HashedPassword:    util.RandomString(32),
+		PasswordChangedAt: changedAt,
+	})
+	require.NoError(t, err)
+	require.NotEqual(t, user.HashedPassword, updated.HashedPassword)
+	require.WithinDuration(t, changedAt, updated.PasswordChangedAt, time.Microsecond)
+	changedAt, err = store.GetPasswordChangedAt(ctx, user.Username)
+	require.NoError(t, err)
+	require.True(t, updated.PasswordChangedAt.Equal(changedAt))
+
+	updated, err = store.UpdateUserRole(ctx, db.UpdateUserRoleParams{Username: user.Username, Role: util.BankerRole})
+	require.NoError(t, err)
+	require.Equal(t, util.BankerRole, updated.Role)
+
+	missing := util.RandomString(20)
+	_, err = store.GetUser(ctx, missing)
+	require.ErrorIs(t, err, db.ErrRecordNotFound)
+	_, err = store.GetUserByEmail(ctx, missing+"@email.com")
+	require.ErrorIs(t, err, db.ErrRecordNotFound)
+	_, err = store.GetPasswordChangedAt(ctx, missing)
+	require.ErrorIs(t, err, db.ErrRecordNotFound)
+	_, err = store.UpdateUserPassword(ctx, db.UpdateUserPasswordParams{Username: missing, HashedPassword: "x"})
+	require.ErrorIs(t, err, db.ErrRecordNotFound)
+	_, err = store.UpdateUserRole(ctx, db.UpdateUserRoleParams{Username: missing, Role: util.BankerRole})
+	require.ErrorIs(t, err, db.ErrRecordNotFound)
+}
+
+func testDuplicateUser(t *testing.T, store db.Store) {
+	ctx := context.Background()
+	user := createUser(t, store)
+
+	_, err := store.CreateUser(ctx, db.CreateUserParams{
+		Username:       user.Username,
+		HashedPassword: util.RandomString(32),
+		FullName:       util.RandomOwner(),
+		Email:          util.RandomString(12) + "@email.com",
+	})
+	require.ErrorIs(t, err, db.ErrDuplicateUsername)
+	require.ErrorIs(t, err, db.ErrUniqueViolation)
+
+	_, err = store.CreateUser(ctx, db.CreateUserParams{
+		Username:       util.RandomOwner() + util.RandomString(6),
+		HashedPassword: util.RandomString(32),
+		FullName:       util.RandomOwner(),
+		Email:          user.Email,
+	})
+	require.ErrorIs(t, err, db.ErrDuplicateEmail)
+	require.ErrorIs(t, err, db.ErrUniqueViolation)
+}
+
+func testUpdateUser(t *testing.T, store db.Store) {
+	ctx := context.Background()
+	user := createUser(t, store)
+	user, err := store.VerifyUserEmail(ctx, db.VerifyUserEmailParams{Username: user.Username, Email: user.Email})
+	require.NoError(t, err)
+
+	// the fields left null are kept
+	fullName := util.RandomOwner()
+	updated, err := store.UpdateUser(ctx, db.UpdateUserParams{
+		Username: user.Username,
+		FullName: sql.NullString{String: fullName, Valid: true},
+	})
+	require.NoError(t, err)
+	require.Equal(t, fullName, updated.FullName)
+	require.Equal(t, user.Email, updated.Email)
+	require.True(t, updated.IsEmailVerified)
+
+	// the same email stays verified, and a new one is not
+	updated, err = store.UpdateUser(ctx, db.UpdateUserParams{
+		Username: user.Username,
+		Email:    sql.NullString{String: user.Email, Valid: true},
+	})
+	require.NoError(t, err)
+	require.True(t, updated.IsEmailVerified)
+	email := util.RandomEmail()
+	updated, err = store.UpdateUser(ctx, db.UpdateUserParams{
+		Username: user.Username,
+		Email:    sql.NullString{String: email, Valid: true},
+	})
+	require.NoError(t, err)
+	require.Equal(t, email, updated.Email)
+	require.Equal(t, fullName, updated.FullName)
+	require.False(t, updated.IsEmailVerified)
+
+	other := createUser(t, store)
+	_, err = store.UpdateUser(ctx, db.UpdateUserParams{
+		Username: user.Username,
+		Email:    sql.NullString{String: other.Email, Valid: true},
+	})
+	require.ErrorIs(t, err, db.ErrDuplicateEmail)
+
+	_, err = store.UpdateUser(ctx, db.UpdateUserParams{
+		Username: "missing" + util.RandomString(6),
+		FullName: sql.NullString{String: fullName, Valid: true},
+	})
+	require.ErrorIs(t, err, db.ErrRecordNotFound)
+}
+
+func testRehashUserPassword(t *testing.T, store db.Store) {
+	ctx := context.Background()
+	user := createUser(t, store)
+
+	// a hash replaced since it was checked is kept
+	err := store.RehashUserPassword(ctx, db.RehashUserPasswordParams{
+		Username:          user.Username,
+		HashedPassword:    util.RandomString(32),
+		OldHashedPassword: "other" + user.HashedPassword,
+	})
+	require.NoError(t, err)
+	got, err := store.GetUser(ctx, user.Username)
+	require.NoError(t, err)
+	require.Equal(t, user.HashedPassword, got.HashedPassword)
+
+	hashedPassword := util.RandomString(32)
+	err = store.RehashUserPassword(ctx, db.RehashUserPasswordParams{
+		Username:          user.Username,
+		HashedPassword:    hashedPassword,
+		OldHashedPassword: user.HashedPassword,
+	})
+	require.NoError(t, err)
+	got, err = store.GetUser(ctx, user.Username)
+	require.NoError(t, err)
+	require.Equal(t, hashedPassword, got.HashedPassword)
+	// the access tokens of the user stay valid
+	require.True(t, user.PasswordChangedAt.Equal(got.PasswordChangedAt))
+}
+
+func testFailedLogins(t *testing.T, store db.Store) {
+	ctx := context.Background()
+	user := createUser(t, store)
+	require.Zero(t, user.FailedLoginAttempts)
+	require.True(t, user.LockedUntil.Before(time.Now()))
+	// the lockout starts at the time given, not at the clock of the store
+	now := time.Now().Add(time.Hour).Truncate(time.Microsecond)
+	arg := db.RecordFailedLoginParams{
+		Username:          user.Username,
+		MaxAttempts:       2,
+		LockoutSeconds:    60,
+		MaxLockoutSeconds: 150,
+		Now:               now,
+	}
+
+	user, err := store.RecordFailedLogin(ctx, arg)
+	require.NoError(t, err)
+	require.Equal(t, int32(1), user.FailedLoginAttempts)
+	require.True(t, user.LockedUntil.Before(now))
+
+	// locked once MaxAttempts is reached, then for twice as long on every
+	// failure, up to MaxLockoutSeconds
+	for i, lockout := range []time.Duration{time.Minute, 2 * time.Minute, 150 * time.Second, 150 * time.Second} {
+		user, err = store.RecordFailedLogin(ctx, arg)
+		require.NoError(t, err)
+		require.Equal(t, int32(i+2), user.FailedLoginAttempts)
+		require.True(t, now.Add(lockout).Equal(user.LockedUntil), "locked until %v", user.LockedUntil)
+	}
+
+	require.NoError(t, store.ResetFailedLogins(ctx, user.Username))
+	got, err := store.GetUser(ctx, user.Username)
+	require.NoError(t, err)
+	require.Zero(t, got.FailedLoginAttempts)
+
+	_, err = store.RecordFailedLogin(ctx, db.RecordFailedLoginParams{Username: "missing" + util.RandomString(6), MaxAttempts: 1})
+	require.ErrorIs(t, err, db.ErrRecordNotFound)
+}
+
+func testLoginAttempts(t *testing.T, store db.Store) {
+	ctx := context.Background()
+	user := createUser(t, store)
+	other := createUser(t, store)
+
+	var created []db.LoginAttempt
+	for _, success := range []bool{false, false, true} {
+		attempt, err := store.CreateLoginAttempt(ctx, db.CreateLoginAttemptParams{
+			Username:  user.Username,
+			IpAddress: "192.0.2.1",
+			UserAgent: "storetest",
+			Success:   success,
+		})
+		require.NoError(t, err)
+		require.NotZero(t, attempt.ID)
+		require.Equal(t, success, attempt.Success)
+		require.WithinDuration(t, time.Now(), attempt.CreatedAt, time.Second)
+		created = append(created, attempt)
+	}
+	_, err := store.CreateLoginAttempt(ctx, db.CreateLoginAttemptParams{Username: other.Username})
+	require.NoError(t, err)
+
+	// most recent first
+	attempts, err := store.ListLoginAttempts(ctx, db.ListLoginAttemptsParams{Username: user.Username, Limit: 2, Offset: 0})
+	require.NoError(t, err)
+	require.Equal(t, []db.LoginAttempt{created[2], created[1]}, attempts)
+	attempts, err = store.ListLoginAttempts(ctx, db.ListLoginAttemptsParams{Username: user.Username, Limit: 2, Offset: 2})
+	require.NoError(t, err)
+	require.Equal(t, []db.LoginAttempt{created[0]}, attempts)
+
+	_, err = store.CreateLoginAttempt(ctx, db.CreateLoginAttemptParams{Username: "missing" + util.RandomString(6)})
+	require.ErrorIs(t, err, db.ErrForeignKey)
+}
+
+func testTOTP(t *testing.T, store db.Store) {
+	ctx := context.Background()
+	user := createUser(t, store)
+	require.Empty(t, user.TotpSecret)
+	require.False(t, user.TotpEnabled)
+
+	// TOTP cannot be enabled before enrollment
+	_, err := store.EnableTOTPTx(ctx, db.EnableTOTPTxParams{Username: user.Username, LastStep: 10})
+	require.ErrorIs(t, err, db.ErrRecordNotFound)
+	n, err := store.UseTOTPStep(ctx, db.UseTOTPStepParams{Username: user.Username, TotpLastStep: 10})
+	require.NoError(t, err)
+	require.Zero(t, n)
+
+	// enrolling again replaces the secret
+	_, err = store.SetTOTPSecret(ctx, db.SetTOTPSecretParams{Username: user.Username, TotpSecret: "first"})
+	require.NoError(t, err)
+	user, err = store.SetTOTPSecret(ctx, db.SetTOTPSecretParams{Username: user.Username, TotpSecret: "second"})
+	require.NoError(t, err)
+	require.Equal(t, "second", user.TotpSecret)
+	require.False(t, user.TotpEnabled)
+
+	result, err := store.EnableTOTPTx(ctx, db.EnableTOTPTxParams{
+		Username:            user.Username,
+		LastStep:            10,
+		HashedRecoveryCodes: []string{"a", "b"},
+	})
+	require.NoError(t, err)
+	require.True(t, result.User.TotpEnabled)
+	require.Equal(t, "second", result.User.TotpSecret)
+	require.Equal(t, int64(10), result.User.TotpLastStep)
+	require.Len(t, result.RecoveryCodes, 2)
+	require.Equal(t, "a", result.RecoveryCodes[0].HashedCode)
+
+	// once enabled, the secret is kept
+	_, err = store.SetTOTPSecret(ctx, db.SetTOTPSecretParams{Username: user.Username, TotpSecret: "third"})
+	require.ErrorIs(t, err, db.ErrRecordNotFound)
+	_, err = store.EnableTOTPTx(ctx, db.EnableTOTPTxParams{Username: user.Username, LastStep: 20})
+	require.ErrorIs(t, err, db.ErrRecordNotFound)
+	codes, err := store.ListRecoveryCodes(ctx, user.Username)
+	require.NoError(t, err)
+	require.Equal(t, result.RecoveryCodes, codes)
+
+	// a step is accepted once, and never after a later one
+	for _, tc := range []struct {
+		step int64
+		n    int64
+	}{{10, 0}, {12, 1}, {12, 0}, {11, 0}, {13, 1}} {
+		n, err := store.UseTOTPStep(ctx, db.UseTOTPStepParams{Username: user.Username, TotpLastStep: tc.step})
+		require.NoError(t, err)
+		require.Equal(t, tc.n, n, "step %d", tc.step)
+	}
+
+	_, err = store.SetTOTPSecret(ctx, db.SetTOTPSecretParams{Username: "missing" + util.RandomString(6), TotpSecret: "secret"})
+	require.ErrorIs(t, err, db.ErrRecordNotFound)
+}
+
+func testRecoveryCodes(t *testing.T, store db.Store) {
+	ctx := context.Background()
+	user := createUser(t, store)
+	other := createUser(t, store)
+
+	var created []db.RecoveryCode
+	for i := 0; i < 3; i++ {
+		code, err := store.CreateRecoveryCode(ctx, db.CreateRecoveryCodeParams{
+			Username:   user.Username,
+			HashedCode: util.RandomString(32),
+		})
+		require.NoError(t, err)
+		require.NotZero(t, code.ID)
+		require.WithinDuration(t, time.Now(), code.CreatedAt, time.Second)
+		created = append(created, code)
+	}
+	otherCode, err := store.CreateRecoveryCode(ctx, db.CreateRecoveryCodeParams{Username: other.Username, HashedCode: "x"})
+	require.NoError(t, err)
+
+	codes, err := store.ListRecoveryCodes(ctx, user.Username)
+	require.NoError(t, err)
+	require.Equal(t, created, codes)
+
+	// a code is deleted once
+	n, err := store.DeleteRecoveryCode(ctx, created[1].ID)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), n)
+	n, err = store.DeleteRecoveryCode(ctx, created[1].ID)
+	require.NoError(t, err)
+	require.Zero(t, n)
+	codes, err = store.ListRecoveryCodes(ctx, user.Username)
+	require.NoError(t, err)
+	require.Equal(t, []db.RecoveryCode{created[0], created[2]}, codes)
+
+	require.NoError(t, store.DeleteRecoveryCodes(ctx, user.Username))
+	codes, err = store.ListRecoveryCodes(ctx, user.Username)
+	require.NoError(t, err)
+	require.Empty(t, codes)
+	codes, err = store.ListRecoveryCodes(ctx, other.Username)
+	require.NoError(t, err)
+	require.Equal(t, []db.RecoveryCode{otherCode}, codes)
+
+	_, err = store.CreateRecoveryCode(ctx, db.CreateRecoveryCodeParams{Username: "missing" + util.RandomString(6), HashedCode: "x"})
+	require.ErrorIs(t, err, db.ErrForeignKey)
+}
+
+func testLoginChallenges(t *testing.T, store db.Store) {
+	ctx := context.Background()
+	user := createUser(t, store)
+
+	arg := db.CreateLoginChallengeParams{
+		ID:        uuid.New(),
+		Username:  user.Username,
+		ExpiresAt: time.Now().Add(time.Minute),
+	}
+	challenge, err := store.CreateLoginChallenge(ctx, arg)
+	require.NoError(t, err)
+	require.Equal(t, arg.ID, challenge.ID)
+	require.Equal(t, user.Username, challenge.Username)
+	require.WithinDuration(t, arg.ExpiresAt, challenge.ExpiresAt, time.Millisecond)
+
+	_, err = store.CreateLoginChallenge(ctx, arg)
+	require.ErrorIs(t, err, db.ErrUniqueViolation)
+
+	expired, err := store.CreateLoginChallenge(ctx, db.CreateLoginChallengeParams{
+		ID:        uuid.New(),
+		Username:  user.Username,
+		ExpiresAt: time.Now().Add(-time.Minute),
+	})
+	require.NoError(t, err)
+
+	// only the expired challenges are deleted
+	require.NoError(t, store.DeleteExpiredLoginChallenges(ctx, user.Username))
+	_, err = store.DeleteLoginChallenge(ctx, expired.ID)
+	require.ErrorIs(t, err, db.ErrRecordNotFound)
+
+	// a challenge is claimed once
+	got, err := store.DeleteLoginChallenge(ctx, challenge.ID)
+	require.NoError(t, err)
+	require.Equal(t, challenge, got)
+	_, err = store.DeleteLoginChallenge(ctx, challenge.ID)
+	require.ErrorIs(t, err, db.ErrRecordNotFound)
+
+	_, err = store.CreateLoginChallenge(ctx, db.CreateLoginChallengeParams{ID: uuid.New(), Username: "missing" + util.RandomString(6)})
+	require.ErrorIs(t, err, db.ErrForeignKey)
+}
+
+func testPasswordResetTokens(t *testing.T, store db.Store) {
+	ctx := context.Background()
+	user := createUser(t, store)
+
+	arg := db.CreatePasswordResetTokenParams{
+		Username:    user.Username,
+		HashedToken: util.RandomString(64),
+		ExpiresAt:   time.Now().Add(time.Hour),
+	}
+	resetToken, err := store.CreatePasswordResetToken(ctx, arg)
+	require.NoError(t, err)
+	require.NotZero(t, resetToken.ID)
+	require.Equal(t, user.Username, resetToken.Username)
+	require.Equal(t, arg.HashedToken, resetToken.HashedToken)
+	require.WithinDuration(t, arg.ExpiresAt, resetToken.ExpiresAt, time.Millisecond)
+
+	_, err = store.CreatePasswordResetToken(ctx, arg)
+	require.ErrorIs(t, err, db.ErrUniqueViolation)
+	other, err := store.CreatePasswordResetToken(ctx, db.CreatePasswordResetTokenParams{
+		Username:    user.Username,
+		HashedToken: util.RandomString(64),
+		ExpiresAt:   time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+
+	// a token is claimed once
+	got, err := store.DeletePasswordResetToken(ctx, resetToken.HashedToken)
+	require.NoError(t, err)
+	require.Equal(t, resetToken, got)
+	_, err = store.DeletePasswordResetToken(ctx, resetToken.HashedToken)
+	require.ErrorIs(t, err, db.ErrRecordNotFound)
+
+	require.NoError(t, store.DeletePasswordResetTokens(ctx, user.Username))
+	_, err = store.DeletePasswordResetToken(ctx, other.HashedToken)
+	require.ErrorIs(t, err, db.ErrRecordNotFound)
+
+	_, err = store.CreatePasswordResetToken(ctx, db.CreatePasswordResetTokenParams{
+		Username:    "missing" + util.RandomString(6),
+		HashedToken: util.RandomString(64),
+	})
+	require.ErrorIs(t, err, db.ErrForeignKey)
+}
+
+func testChangePasswordTx(t *testing.T, store db.Store) {
+	ctx := context.Background()
+	user := createUser(t, store)
+	resetToken, err := store.CreatePasswordResetToken(ctx, db.CreatePasswordResetTokenParams{
+		Username:    user.Username,
+		HashedToken: util.RandomString(64),
+		ExpiresAt:   time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+
+	arg := db.ChangePasswordTxParams{Username: user.Username, HashedPassword: util.RandomString(32), PasswordChangedAt: time.Now()}
+	updated, err := store.ChangePasswordTx(ctx, arg)
+	require.NoError(t, err)
+	require.Equal(t, arg.HashedPassword, updated.HashedPassword)
+	require.WithinDuration(t, arg.PasswordChangedAt, updated.PasswordChangedAt, time.Microsecond)
+
+	// the reset tokens sent before the change are no longer valid
+	_, err = store.DeletePasswordResetToken(ctx, resetToken.HashedToken)
+	require.ErrorIs(t, err, db.ErrRecordNotFound)
+
+	_, err = store.ChangePasswordTx(ctx, db.ChangePasswordTxParams{Username: "missing" + util.RandomString(6), HashedPassword: "x"})
+	require.ErrorIs(t, err, db.ErrRecordNotFound)
+}
+
+func testAPIKeys(t *testing.T, store db.Store) {
+	ctx := context.Background()
+	user := createUser(t, store)
+
+	arg := db.CreateAPIKeyParams{
+		Username:     user.Username,
+		Name:         "batch",
+		Prefix:       util.RandomString(12),
+		HashedSecret: util.RandomString(64),
+		Scopes:       []string{"accounts:read", "transfers:write"},
+		ExpiresAt:    time.Now().Add(time.Hour),
+	}
+	apiKey, err := store.CreateAPIKey(ctx, arg)
+	require.NoError(t, err)
+	require.NotZero(t, apiKey.ID)
+	require.Equal(t, arg.Username, apiKey.Username)
+	require.Equal(t, arg.Name, apiKey.Name)
+	require.Equal(t, arg.Prefix, apiKey.Prefix)
+	require.Equal(t, arg.HashedSecret, apiKey.HashedSecret)
+	require.Equal(t, arg.Scopes, apiKey.Scopes)
+	require.WithinDuration(t, arg.ExpiresAt, apiKey.ExpiresAt, time.Millisecond)
+	require.True(t, apiKey.LastUsedAt.IsZero())
+	require.NotZero(t, apiKey.CreatedAt)
+	_, err = store.CreateAPIKey(ctx, arg)
+	require.ErrorIs(t, err, db.ErrUniqueViolation)
+
+	// a key without scopes nor expiry
+	unrestricted, err := store.CreateAPIKey(ctx, db.CreateAPIKeyParams{
+		Username:     user.Username,
+		Name:         "dashboard",
+		Prefix:       util.RandomString(12),
+		HashedSecret: util.RandomString(64),
+	})
+	require.NoError(t, err)
+	require.Empty(t, unrestricted.Scopes)
+	require.True(t, unrestricted.ExpiresAt.IsZero())
+
+	got, err := store.GetAPIKeyByPrefix(ctx, apiKey.Prefix)
+	require.NoError(t, err)
+	require.Equal(t, apiKey.ID, got.ID)
+	require.Equal(t, apiKey.Scopes, got.Scopes)
+	_, err = store.GetAPIKeyByPrefix(ctx, "missing"+util.RandomString(6))
+	require.ErrorIs(t, err, db.ErrRecordNotFound)
+
+	usedAt := time.Now()
+	require.NoError(t, store.TouchAPIKey(ctx, db.TouchAPIKeyParams{ID: apiKey.ID, LastUsedAt: usedAt}))
+	got, err = store.GetAPIKeyByPrefix(ctx, apiKey.Prefix)
+	require.NoError(t, err)
+	require.WithinDuration(t, usedAt, got.LastUsedAt, time.Millisecond)
+
+	apiKeys, err := store.ListAPIKeys(ctx, user.Username)
+	require.NoError(t, err)
+	require.Len(t, apiKeys, 2)
+	require.Equal(t, apiKey.ID, apiKeys[0].ID)
+	require.Equal(t, unrestricted.ID, apiKeys[1].ID)
+
+	// a key is deleted only by its user
+	other := createUser(t, store)
+	_, err = store.DeleteAPIKey(ctx, db.DeleteAPIKeyParams{ID: apiKey.ID, Username: other.Username})
+	require.ErrorIs(t, err, db.ErrRecordNotFound)
+	deleted, err := store.DeleteAPIKey(ctx, db.DeleteAPIKeyParams{ID: apiKey.ID, Username: user.Username})
+	require.NoError(t, err)
+	require.Equal(t, apiKey.ID, deleted.ID)
+	_, err = store.GetAPIKeyByPrefix(ctx, apiKey.Prefix)
+	require.ErrorIs(t, err, db.ErrRecordNotFound)
+	apiKeys, err = store.ListAPIKeys(ctx, other.Username)
+	require.NoError(t, err)
+	require.Empty(t, apiKeys)
+
+	_, err = store.CreateAPIKey(ctx, db.CreateAPIKeyParams{
+		Username:     "missing" + util.RandomString(6),
+		Name:         "batch",
+		Prefix:       util.RandomString(12),
+		HashedSecret: util.RandomString(64),
+	})
+	require.ErrorIs(t, err, db.ErrForeignKey)
+}
+
+func testOAuth(t *testing.T, store db.Store) {
+	ctx := context.Background()
+	owner := createUser(t, store)
+	user := createUser(t, store)
+
+	clientArg := db.CreateOAuthClientParams{
+		ID:           util.RandomString(16),
+		Owner:        owner.Username,
+		Name:         "budget app",
+		HashedSecret: util.RandomString(64),
+		RedirectURIs: []string{"https://budget.example.com/callback"},
+		Scopes:       []string{"accounts:read"},
+	}
+	client, err := store.CreateOAuthClient(ctx, clientArg)
+	require.NoError(t, err)
+	require.Equal(t, clientArg.ID, client.ID)
+	require.Equal(t, clientArg.RedirectURIs, client.RedirectURIs)
+	require.Equal(t, clientArg.Scopes, client.Scopes)
+	require.NotZero(t, client.CreatedAt)
+	_, err = store.CreateOAuthClient(ctx, clientArg)
+	require.ErrorIs(t, err, db.ErrUniqueViolation)
+	got, err := store.GetOAuthClient(ctx, client.ID)
+	require.NoError(t, err)
+	require.Equal(t, client.HashedSecret, got.HashedSecret)
+	_, err = store.GetOAuthClient(ctx, "missing"+util.RandomString(6))
+	require.ErrorIs(t, err, db.ErrRecordNotFound)
+
+	codeArg := db.CreateOAuthAuthorizationCodeParams{
+		HashedCode:       util.RandomString(64),
+		ClientID:         client.ID,
+		Username:         user.Username,
+		RedirectURI:      client.RedirectURIs[0],
+		RedirectURIGiven: true,
+		Scopes:           client.Scopes,
+		CodeChallenge:    util.RandomString(43),
+		IssuedAt:         time.Now().Add(-time.Hour),
+		ExpiresAt:        time.Now().Add(time.Minute),
+	}
+	code, err := store.CreateOAuthAuthorizationCode(ctx, codeArg)
+	require.NoError(t, err)
+	require.Equal(t, codeArg.CodeChallenge, code.CodeChallenge)
+	require.True(t, code.RedirectURIGiven)
+	// issued_at is the one of the application, not the time of the insert
+	require.WithinDuration(t, codeArg.IssuedAt, code.IssuedAt, time.Millisecond)
+	require.WithinDuration(t, codeArg.ExpiresAt, code.ExpiresAt, time.Millisecond)
+	// a code is claimed once
+	claimed, err := store.DeleteOAuthAuthorizationCode(ctx, codeArg.HashedCode)
+	require.NoError(t, err)
+	require.Equal(t, code.ID, claimed.ID)
+	require.Equal(t, user.Username, claimed.Username)
+	_, err = store.DeleteOAuthAuthorizationCode(ctx, codeArg.HashedCode)
+	require.ErrorIs(t, err, db.ErrRecordNotFound)
+
+	refreshArg := db.CreateOAuthRefreshTokenParams{
+		HashedToken: util.RandomString(64),
+		ClientID:    client.ID,
+		Username:    user.Username,
+		Scopes:      client.Scopes,
+		IssuedAt:    time.Now().Add(-time.Hour),
+		ExpiresAt:   time.Now().Add(time.Hour),
+	}
+	refreshToken, err := store.CreateOAuthRefreshToken(ctx, refreshArg)
+	require.NoError(t, err)
+	require.Equal(t, refreshArg.Scopes, refreshToken.Scopes)
+	require.WithinDuration(t, refreshArg.IssuedAt, refreshToken.IssuedAt, time.Millisecond)
+	claimedToken, err := store.DeleteOAuthRefreshToken(ctx, refreshArg.HashedToken)
+	require.NoError(t, err)
+	require.Equal(t, refreshToken.ID, claimedToken.ID)
+	_, err = store.DeleteOAuthRefreshToken(ctx, refreshArg.HashedToken)
+	require.ErrorIs(t, err, db.ErrRecordNotFound)
+
+	clientArg.ID = util.RandomString(16)
+	clientArg.Owner = "missing" + util.RandomString(6)
+	_, err = store.CreateOAuthClient(ctx, clientArg)
+	require.ErrorIs(t, err, db.ErrForeignKey)
+	codeArg.HashedCode = util.RandomString(64)
+	codeArg.ClientID = "missing" + util.RandomString(6)
+	_, err = store.CreateOAuthAuthorizationCode(ctx, codeArg)
+	require.ErrorIs(t, err, db.ErrForeignKey)
+	refreshArg.HashedToken = util.RandomString(64)
+	refreshArg.Username = "missing" + util.RandomString(6)
+	_, err = store.CreateOAuthRefreshToken(ctx, refreshArg)
+	require.ErrorIs(t, err, db.ErrForeignKey)
+}
+
+func testVerifyEmails(t *testing.T, store db.Store) {
+	ctx := context.Background()
+	user := createUser(t, store)
+	verified, err := store.IsEmailVerified(ctx, user.Username)
+	require.NoError(t, err)
+	require.False(t, verified)
+	_, err = store.IsEmailVerified(ctx, "missing"+util.RandomString(6))
+	require.ErrorIs(t, err, db.ErrRecordNotFound)
+
+	arg := db.CreateVerifyEmailParams{
+		Username:    user.Username,
+		Email:       user.Email,
+		HashedToken: util.RandomString(64),
+		ExpiresAt:   time.Now().Add(time.Hour),
+	}
+	verifyEmail, err := store.CreateVerifyEmail(ctx, arg)
+	require.NoError(t, err)
+	require.NotZero(t, verifyEmail.ID)
+	require.Equal(t, user.Username, verifyEmail.Username)
+	require.Equal(t, user.Email, verifyEmail.Email)
+	require.False(t, verifyEmail.IsUsed)
+	require.WithinDuration(t, arg.ExpiresAt, verifyEmail.ExpiresAt, time.Millisecond)
+	_, err = store.CreateVerifyEmail(ctx, arg)
+	require.ErrorIs(t, err, db.ErrUniqueViolation)
+
+	// a token is claimed once
+	got, err := store.UseVerifyEmail(ctx, verifyEmail.HashedToken)
+	require.NoError(t, err)
+	require.Equal(t, verifyEmail.ID, got.ID)
+	require.True(t, got.IsUsed)
+	_, err = store.UseVerifyEmail(ctx, verifyEmail.HashedToken)
+	require.ErrorIs(t, err, db.ErrRecordNotFound)
+
+	expired, err := store.CreateVerifyEmail(ctx, db.CreateVerifyEmailParams{
+		Username:    user.Username,
+		Email:       user.Email,
+		HashedToken: util.RandomString(64),
+		ExpiresAt:   time.Now().Add(-time.Second),
+	})
+	require.NoError(t, err)
+	_, err = store.UseVerifyEmail(ctx, expired.HashedToken)
+	require.ErrorIs(t, err, db.ErrRecordNotFound)
+
+	_, err = store.VerifyUserEmail(ctx, db.VerifyUserEmailParams{Username: user.Username, Email: "other" + user.Email})
+	require.ErrorIs(t, err, db.ErrRecordNotFound)
+	updated, err := store.VerifyUserEmail(ctx, db.VerifyUserEmailParams{Username: user.Username, Email: user.Email})
+	require.NoError(t, err)
+	require.True(t, updated.IsEmailVerified)
+	verified, err = store.IsEmailVerified(ctx, user.Username)
+	require.NoError(t, err)
+	require.True(t, verified)
+
+	_, err = store.CreateVerifyEmail(ctx, db.CreateVerifyEmailParams{
+		Username:    "missing" + util.RandomString(6),
+		Email:       user.Email,
+		HashedToken: util.RandomString(64),
+		ExpiresAt:   time.Now().Add(time.Hour),
+	})
+	require.ErrorIs(t, err, db.ErrForeignKey)
+}
+
+func testVerifyEmailTx(t *testing.T, store db.Store) {
+	ctx := context.Background()
+	user := createUser(t, store)
+
+	// the link of another email does not verify the email of the user, and
+	// is left unused
+	stale, err := store.CreateVerifyEmail(ctx, db.CreateVerifyEmailParams{
+		Username:    user.Username,
+		Email:       "old" + user.Email,
+		HashedToken: util.RandomString(64),
+		ExpiresAt:   time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+	_, err = store.VerifyEmailTx(ctx, db.VerifyEmailTxParams{HashedToken: stale.HashedToken})
+	require.ErrorIs(t, err, db.ErrRecordNotFound)
+	got, err := store.UseVerifyEmail(ctx, stale.HashedToken)
+	require.NoError(t, err)
+	require.Equal(t, stale.ID, got.ID)
+
+	verifyEmail, err := store.CreateVerifyEmail(ctx, db.CreateVerifyEmailParams{
+		Username:    user.Username,
+		Email:       user.Email,
+		HashedToken: util.RandomString(64),
+		ExpiresAt:   time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+	result, err := store.VerifyEmailTx(ctx, db.VerifyEmailTxParams{HashedToken: verifyEmail.HashedToken})
+	require.NoError(t, err)
+	require.Equal(t, verifyEmail.ID, result.VerifyEmail.ID)
+	require.True(t, result.VerifyEmail.IsUsed)
+	require.Equal(t, user.Username, result.User.Username)
+	require.True(t, result.User.IsEmailVerified)
+
+	_, err = store.VerifyEmailTx(ctx, db.VerifyEmailTxParams{HashedToken: verifyEmail.HashedToken})
+	require.ErrorIs(t, err, db.ErrRecordNotFound)
+}
+
+func testAccounts(t *testing.T, store db.Store) {
+	ctx := context.Background()
+	user := createUser(t, store)
+	arg := db.CreateAccountParams{
+		Owner:    user.Username,
+		Balance:  util.RandomMoney(),
+		Currency: util.USD,
+	}
+	account, err := store.CreateAccount(ctx, arg)
+	require.NoError(t, err)
+	require.NotZero(t, account.ID)
+	require.Equal(t, arg.Owner, account.Owner)
+	require.Equal(t, arg.Balance, account.Balance)
+	require.Equal(t, arg.Currency, account.Currency)
+	require.False(t, account.Frozen)
+	require.WithinDuration(t, time.Now(), account.CreatedAt, time.Second)
+
+	got, err := store.GetAccount(ctx, account.ID)
+	require.NoError(t, err)
+	require.Equal(t, account.Balance, got.Balance)
+	require.True(t, account.CreatedAt.Equal(got.CreatedAt))
+
+	got, err = store.GetAccountForUpdate(ctx, account.ID)
+	require.NoError(t, err)
+	require.Equal(t, account.ID, got.ID)
+
+	updated, err := store.UpdateAccount(ctx, db.UpdateAccountParams{ID: account.ID, Balance: 42})
+	require.NoError(t, err)
+	require.Equal(t, int64(42), updated.Balance)
+
+	updated, err = store.AddAccountBalance(ctx, db.AddAccountBalanceParams{ID: account.ID, Amount: -50})
+	require.NoError(t, err)
+	require.Equal(t, int64(-8), updated.Balance)
+
+	updated, err = store.SetAccountFrozen(ctx, db.SetAccountFrozenParams{ID: account.ID, Frozen: true})
+	require.NoError(t, err)
+	require.True(t, updated.Frozen)
+	require.Equal(t, int64(-8), updated.Balance)
+
+	missing := account.ID + 1_000_000
+	_, err = store.GetAccount(ctx, missing)
+	require.ErrorIs(t, err, db.ErrRecordNotFound)
+	_, err = store.UpdateAccount(ctx, db.UpdateAccountParams{ID: missing, Balance: 1})
+	require.ErrorIs(t, err, db.ErrRecordNotFound)
+	_, err = store.AddAccountBalance(ctx, db.AddAccountBalanceParams{ID: missing, Amount: 1})
+	require.ErrorIs(t, err, db.ErrRecordNotFound)
+	_, err = store.SetAccountFrozen(ctx, db.SetAccountFrozenParams{ID: missing, Frozen: true})
+	require.ErrorIs(t, err, db.ErrRecordNotFound)
+}
+
+func testAccountConstraints(t *testing.T, store db.Store) {
+	ctx := context.Background()
+	user := createUser(t, store)
+	createAccount(t, store, user.Username, util.EUR)
+
+	_, err := store.CreateAccount(ctx, db.CreateAccountParams{Owner: user.Username, Currency: util.EUR})
+	require.ErrorIs(t, err, db.ErrOwnerCurrencyExists)
+	require.ErrorIs(t, err, db.ErrUniqueViolation)
+
+	// another currency is fine
+	createAccount(t, store, user.Username, util.USD)
+
+	_, err = store.CreateAccount(ctx, db.CreateAccountParams{Owner: util.RandomString(20), Currency: util.EUR})
+	require.ErrorIs(t, err, db.ErrForeignKey)
+}
+
+func testListAccounts(t *testing.T, store db.Store) {
+	ctx := context.Background()
+	user := createUser(t, store)
+	var accounts []db.Account
+	for _, currency := range []string{util.USD, util.EUR, util.CAD} {
+		accounts = append(accounts, createAccount(t, store, user.Username, currency))
+	}
+	// accounts of other owners are not listed
+	createAccount(t, store, createUser(t, store).Username, util.USD)
+
+	got, err := store.ListAccounts(ctx, db.ListAccountsParams{Owner: user.Username, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, got, 3)
+	for i := range accounts {
+		require.Equal(t, accounts[i].ID, got[i].ID)
+	}
+
+	got, err = store.ListAccounts(ctx, db.ListAccountsParams{Owner: user.Username, Limit: 1, Offset: 1})
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	require.Equal(t, accounts[1].ID, got[0].ID)
+
+	got, err = store.ListAccounts(ctx, db.ListAccountsParams{Owner: user.Username, Limit: 10, Offset: 3})
+	require.NoError(t, err)
+	require.NotNil(t, got)
+	require.Empty(t, got)
+}
+
+func testDeleteAccount(t *testing.T, store db.Store) {
+	ctx := context.Background()
+	user := createUser(t, store)
+	account := createAccount(t, store, user.Username, util.USD)
+	used := createAccount(t, store, user.Username, util.EUR)
+	_, err := store.CreateEntry(ctx, db.CreateEntryParams{AccountID: used.ID, Amount: 10})
+	require.NoError(t, err)
+
+	require.NoError(t, store.DeleteAccount(ctx, account.ID))
+	_, err = store.GetAccount(ctx, account.ID)
+	require.ErrorIs(t, err, db.ErrRecordNotFound)
+
+	// deleting a missing account is not an error
+	require.NoError(t, store.DeleteAccount(ctx, account.ID))
+
+	err = store.DeleteAccount(ctx, used.ID)
+	require.ErrorIs(t, err, db.ErrForeignKey)
+	_, err = store.GetAccount(ctx, used.ID)
+	require.NoError(t, err)
+}
+
+func testEntries(t *testing.T, store db.Store) {
+	ctx := context.Background()
+	account := createAccount(t, store, createUser(t, store).Username, util.USD)
+	other := createAccount(t, store, createUser(t, store).Username, util.USD)
+
+	var entries []db.Entry
+	for _, amount := range []int64{10, -5, 7} {
+		entry, err := store.CreateEntry(ctx, db.CreateEntryParams{AccountID: account.ID, Amount: amount})
+		require.NoError(t, err)
+		require.NotZero(t, entry.ID)
+		require.Equal(t, account.ID, entry.AccountID)
+		require.Equal(t, amount, entry.Amount)
+		require.WithinDuration(t, time.Now(), entry.CreatedAt, time.Second)
+		entries = append(entries, entry)
+	}
+	_, err := store.CreateEntry(ctx, db.CreateEntryParams{AccountID: other.ID, Amount: 1})
+	require.NoError(t, err)
+
+	got, err := store.GetEntry(ctx, entries[1].ID)
+	require.NoError(t, err)
+	require.Equal(t, entries[1].Amount, got.Amount)
+
+	list, err := store.ListEntries(ctx, db.ListEntriesParams{AccountID: account.ID, Limit: 2, Offset: 1})
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	require.Equal(t, entries[1].ID, list[0].ID)
+	require.Equal(t, entries[2].ID, list[1].ID)
+
+	_, err = store.GetEntry(ctx, entries[2].ID+1_000_000)
+	require.ErrorIs(t, err, db.ErrRecordNotFound)
+	_, err = store.CreateEntry(ctx, db.CreateEntryParams{AccountID: other.ID + 1_000_000, Amount: 1})
+	require.ErrorIs(t, err, db.ErrForeignKey)
+}
+
+func testTransfers(t *testing.T, store db.Store) {
+	ctx := context.Background()
+	account1 := createAccount(t, store, createUser(t, store).Username, util.USD)
+	account2 := createAccount(t, store, createUser(t, store).Username, util.USD)
+	account3 := createAccount(t, store, createUser(t, store).Username, util.USD)
+
+	transfer1, err := store.CreateTransfer(ctx, db.CreateTransferParams{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: 10})
+	require.NoError(t, err)
+	require.NotZero(t, transfer1.ID)
+	require.Equal(t, account1.ID, transfer1.FromAccountID)
+	require.Equal(t, account2.ID, transfer1.ToAccountID)
+	require.Equal(t, int64(10), transfer1.Amount)
+	require.WithinDuration(t, time.Now(), transfer1.CreatedAt, time.Second)
+	transfer2, err := store.CreateTransfer(ctx, db.CreateTransferParams{FromAccountID: account3.ID, ToAccountID: account1.ID, Amount: 5})
+	require.NoError(t, err)
+	_, err = store.CreateTransfer(ctx, db.CreateTransferParams{FromAccountID: account2.ID, ToAccountID: account3.ID, Amount: 5})
+	require.NoError(t, err)
+
+	got, err := store.GetTransfer(ctx, transfer1.ID)
+	require.NoError(t, err)
+	require.Equal(t, transfer1.Amount, got.Amount)
+
+	// transfers from or to account1
+	list, err := store.ListTransfers(ctx, db.ListTransfersParams{FromAccountID: account1.ID, ToAccountID: account1.ID, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	require.Equal(t, transfer1.ID, list[0].ID)
+	require.Equal(t, transfer2.ID, list[1].ID)
+
+	_, err = store.GetTransfer(ctx, transfer2.ID+1_000_000)
+	require.ErrorIs(t, err, db.ErrRecordNotFound)
+	_, err = store.CreateTransfer(ctx, db.CreateTransferParams{FromAccountID: account1.ID, ToAccountID: account3.ID + 1_000_000, Amount: 1})
+	require.ErrorIs(t, err, db.ErrForeignKey)
+}
+
+func testTransferTx(t *testing.T, store db.Store) {
+	ctx := context.Background()
+	account1 := createAccount(t, store, createUser(t, store).Username, util.USD)
+	account2 := createAccount(t, store, createUser(t, store).Username, util.USD)
+
+	result, err := store.TransferTx(ctx, db.TransferTxParams{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: 10})
+	require.NoError(t, err)
+
+	require.NotZero(t, result.Transfer.ID)
+	require.Equal(t, account1.ID, result.Transfer.FromAccountID)
+	require.Equal(t, account2.ID, result.Transfer.ToAccountID)
+	require.Equal(t, int64(10), result.Transfer.Amount)
+	_, err = store.GetTransfer(ctx, result.Transfer.ID)
+	require.NoError(t, err)
+
+	require.Equal(t, account1.ID, result.FromEntry.AccountID)
+	require.Equal(t, int64(-10), result.FromEntry.Amount)
+	require.Equal(t, account2.ID, result.ToEntry.AccountID)
+	require.Equal(t, int64(10), result.ToEntry.Amount)
+	_, err = store.GetEntry(ctx, result.FromEntry.ID)
+	require.NoError(t, err)
+	_, err = store.GetEntry(ctx, result.ToEntry.ID)
+	require.NoError(t, err)
+
+	require.Equal(t, account1.Balance-10, result.FromAccount.Balance)
+	require.Equal(t, account2.Balance+10, result.ToAccount.Balance)
+	got, err := store.GetAccount(ctx, account1.ID)
+	require.NoError(t, err)
+	require.Equal(t, account1.Balance-10, got.Balance)
+	got, err = store.GetAccount(ctx, account2.ID)
+	require.NoError(t, err)
+	require.Equal(t, account2.Balance+10, got.Balance)
+}
+
+// testTransferTxConcurrent moves money both ways between two accounts at the
+// same time. The balances end where they started.
+func testTransferTxConcurrent(t *testing.T, store db.Store) {
+	ctx := context.Background()
+	account1 := createAccount(t, store, createUser(t, store).Username, util.USD)
+	account2 := createAccount(t, store, createUser(t, store).Username, util.USD)
+
+	n := 10
+	errs := make(chan error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		arg := db.TransferTxParams{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: 10}
+		if i%2 == 1 {
+			arg.FromAccountID, arg.ToAccountID = arg.ToAccountID, arg.FromAccountID
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := store.TransferTx(ctx, arg)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	got, err := store.GetAccount(ctx, account1.ID)
+	require.NoError(t, err)
+	require.Equal(t, account1.Balance, got.Balance)
+	got, err = store.GetAccount(ctx, account2.ID)
+	require.NoError(t, err)
+	require.Equal(t, account2.Balance, got.Balance)
+
+	entries, err := store.ListEntries(ctx, db.ListEntriesParams{AccountID: account1.ID, Limit: int32(2 * n)})
+	require.NoError(t, err)
+	require.Len(t, entries, n)
+}
+
+// testTransferTxMissingAccount checks that a failed transfer is rolled back
+func testTransferTxMissingAccount(t *testing.T, store db.Store) {
+	ctx := context.Background()
+	account := createAccount(t, store, createUser(t, store).Username, util.USD)
+
+	_, err := store.TransferTx(ctx, db.TransferTxParams{FromAccountID: account.ID, ToAccountID: account.ID + 1_000_000, Amount: 10})
+	require.ErrorIs(t, err, db.ErrForeignKey)
+
+	got, err := store.GetAccount(ctx, account.ID)
+	require.NoError(t, err)
+	require.Equal(t, account.Balance, got.Balance)
+	entries, err := store.ListEntries(ctx, db.ListEntriesParams{AccountID: account.ID, Limit: 10})
+	require.NoError(t, err)
+	require.Empty(t, entries)
+	transfers, err := store.ListTransfers(ctx, db.ListTransfersParams{FromAccountID: account.ID, ToAccountID: account.ID, Limit: 10})
+	require.NoError(t, err)
+	require.Empty(t, transfers)
+}
+
+func testTransferTxInvalidAmount(t *testing.T, store db.Store) {
+	ctx := context.Background()
+	account1 := createAccount(t, store, createUser(t, store).Username, util.USD)
+	account2 := createAccount(t, store, createUser(t, store).Username, util.USD)
+
+	for _, amount := range []int64{0, -10, math.MinInt64} {
+		_, err := store.TransferTx(ctx, db.TransferTxParams{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: amount})
+		require.ErrorIs(t, err, db.ErrInvalidAmount, "amount %d", amount)
+	}
+
+	got, err := store.GetAccount(ctx, account1.ID)
+	require.NoError(t, err)
+	require.Equal(t, account1.Balance, got.Balance)
+}
+
+// testTransferTxOutOfRange checks that a balance never wraps around
+func testTransferTxOutOfRange(t *testing.T, store db.Store) {
+	ctx := context.Background()
+	poor := createAccount(t, store, createUser(t, store).Username, util.USD)
+	rich := createAccount(t, store, createUser(t, store).Username, util.USD)
+	_, err := store.UpdateAccount(ctx, db.UpdateAccountParams{ID: poor.ID, Balance: math.MinInt64 + 5})
+	require.NoError(t, err)
+	_, err = store.UpdateAccount(ctx, db.UpdateAccountParams{ID: rich.ID, Balance: math.MaxInt64 - 5})
+	require.NoError(t, err)
+
+	_, err = store.AddAccountBalance(ctx, db.AddAccountBalanceParams{ID: rich.ID, Amount: 10})
+	require.ErrorIs(t, err, db.ErrOutOfRange)
+	_, err = store.AddAccountBalance(ctx, db.AddAccountBalanceParams{ID: poor.ID, Amount: -10})
+	require.ErrorIs(t, err, db.ErrOutOfRange)
+
+	// the sender overflows
+	_, err = store.TransferTx(ctx, db.TransferTxParams{FromAccountID: poor.ID, ToAccountID: rich.ID, Amount: 10})
+	require.ErrorIs(t, err, db.ErrOutOfRange)
+	// the receiver overflows
+	other := createAccount(t, store, createUser(t, store).Username, util.USD)
+	_, err = store.TransferTx(ctx, db.TransferTxParams{FromAccountID: other.ID, ToAccountID: rich.ID, Amount: 10})
+	require.ErrorIs(t, err, db.ErrOutOfRange)
+	got, err := store.GetAccount(ctx, other.ID)
+	require.NoError(t, err)
+	require.Equal(t, other.Balance, got.Balance)
+
+	// the failed transfers were rolled back
+	got, err = store.GetAccount(ctx, poor.ID)
+	require.NoError(t, err)
+	require.Equal(t, int64(math.MinInt64+5), got.Balance)
+	got, err = store.GetAccount(ctx, rich.ID)
+	require.NoError(t, err)
+	require.Equal(t, int64(math.MaxInt64-5), got.Balance)
+	entries, err := store.ListEntries(ctx, db.ListEntriesParams{AccountID: poor.ID, Limit: 10})
+	require.NoError(t, err)
+	require.Empty(t, entries)
+
+	// up to the limit is fine
+	result, err := store.TransferTx(ctx, db.TransferTxParams{FromAccountID: poor.ID, ToAccountID: rich.ID, Amount: 5})
+	require.NoError(t, err)
+	require.Equal(t, int64(math.MinInt64), result.FromAccount.Balance)
+	require.Equal(t, int64(math.MaxInt64), result.ToAccount.Balance)
+}
+
+func testTransferTxProperties(t *testing.T, store db.Store) {
+	cfg := DefaultTransferConfig
+	if testing.Short() {
+		cfg.Transfers = 200
+	}
+	RunTransferProperties(t, store, cfg)
+}
+
+func testIdempotencyKeys(t *testing.T, store db.Store) {
+	ctx := context.Background()
+	arg := db.CreateIdempotencyKeyParams{
+		Scope:       util.RandomOwner(),
+		Key:         util.RandomString(16),
+		RequestHash: util.RandomString(32),
+	}
+	id := db.GetIdempotencyKeyParams{Scope: arg.Scope, Key: arg.Key}
+
+	key, err := store.CreateIdempotencyKey(ctx, arg)
+	require.NoError(t, err)
+	require.Equal(t, arg.RequestHash, key.RequestHash)
+	require.Zero(t, key.ResponseStatus)
+	require.Nil(t, key.ResponseBody)
+	require.WithinDuration(t, time.Now(), key.CreatedAt, time.Second)
+
+	// the key is in use
+	_, err = store.CreateIdempotencyKey(ctx, arg)
+	require.ErrorIs(t, err, db.ErrRecordNotFound)
+	// in its scope only
+	_, err = store.CreateIdempotencyKey(ctx, db.CreateIdempotencyKeyParams{Scope: arg.Scope + "x", Key: arg.Key, RequestHash: arg.RequestHash})
+	require.NoError(t, err)
+
+	body := []byte(`{"id":1}`)
+	err = store.SetIdempotencyKeyResponse(ctx, db.SetIdempotencyKeyResponseParams{
+		Scope:          arg.Scope,
+		Key:            arg.Key,
+		ResponseStatus: http.StatusOK,
+		ResponseBody:   body,
+	})
+	require.NoError(t, err)
+	got, err := store.GetIdempotencyKey(ctx, id)
+	require.NoError(t, err)
+	require.Equal(t, int32(http.StatusOK), got.ResponseStatus)
+	require.Equal(t, body, got.ResponseBody)
+
+	require.NoError(t, store.DeleteIdempotencyKey(ctx, db.DeleteIdempotencyKeyParams(id)))
+	_, err = store.GetIdempotencyKey(ctx, id)
+	require.ErrorIs(t, err, db.ErrRecordNotFound)
+	// a released key can be claimed again
+	_, err = store.CreateIdempotencyKey(ctx, arg)
+	require.NoError(t, err)
+}
+
+func testRateLimitBuckets(t *testing.T, store db.Store) {
+	ctx := context.Background()
+	// the bucket is not refilled at a rate of zero
+	arg := db.TakeRateLimitTokenParams{Key: util.RandomString(16), Burst: 3}
+
+	for i := 2; i >= 0; i-- {
+		bucket, err := store.TakeRateLimitToken(ctx, arg)
+		require.NoError(t, err)
+		require.True(t, bucket.Allowed)
+		require.Equal(t, float64(i), bucket.Tokens)
+		require.WithinDuration(t, time.Now(), bucket.UpdatedAt, time.Second)
+	}
+	bucket, err := store.TakeRateLimitToken(ctx, arg)
+	require.NoError(t, err)
+	require.False(t, bucket.Allowed)
+	require.Zero(t, bucket.Tokens)
+
+	// other keys have their own bucket
+	bucket, err = store.TakeRateLimitToken(ctx, db.TakeRateLimitTokenParams{Key: arg.Key + "x", Burst: 3})
+	require.NoError(t, err)
+	require.True(t, bucket.Allowed)
+
+	// recent buckets are kept
+	_, err = store.DeleteRateLimitBuckets(ctx, time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	bucket, err = store.TakeRateLimitToken(ctx, arg)
+	require.NoError(t, err)
+	require.False(t, bucket.Allowed)
+
+	// the bucket is refilled up to burst, once some time elapsed
+	time.Sleep(time.Millisecond)
+	arg.Rate = 1e9
+	bucket, err = store.TakeRateLimitToken(ctx, arg)
+	require.NoError(t, err)
+	require.True(t, bucket.Allowed)
+	require.Equal(t, float64(2), bucket.Tokens)
+
+	n, err := store.DeleteRateLimitBuckets(ctx, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, n, int64(2))
+	// a deleted bucket is created again full
+	arg.Rate = 0
+	bucket, err = store.TakeRateLimitToken(ctx, arg)
+	require.NoError(t, err)
+	require.True(t, bucket.Allowed)
+	require.Equal(t, float64(2), bucket.Tokens)
+}
+
+func testCanceledContext(t *testing.T, store db.Store) {
+	user := createUser(t, store)
+	account1 := createAccount(t, store, user.Username, util.USD)
+	account2 := createAccount(t, store, user.Username, util.EUR)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := store.GetUser(ctx, user.Username)
+	require.True(t, errors.Is(err, context.Canceled), "got %v", err)
+	_, err = store.TransferTx(ctx, db.TransferTxParams{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: 10})
+	require.True(t, errors.Is(err, context.Canceled), "got %v", err)
+
+	got, err := store.GetAccount(context.Background(), account1.ID)
+	require.NoError(t, err)
+	require.Equal(t, account1.Balance, got.Balance)
+}
@@ -0,0 +1,206 @@
+package storetest
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	db "github.com/dpsigor/cheatsheet-golang-postgres/db/sqlc"
+	"github.com/dpsigor/cheatsheet-golang-postgres/util"
+	"github.com/stretchr/testify/require"
+)
+
+// TransferConfig sizes a run of RunTransferProperties
+type TransferConfig struct {
+	// AccountsPerCurrency is the number of accounts created in every
+	// supported currency
+	AccountsPerCurrency int
+	// Transfers is the number of transfers attempted
+	Transfers int
+	// Workers is the number of goroutines sending transfers concurrently
+	Workers int
+	// MaxAmount bounds the amount of every transfer
+	MaxAmount int64
+	// Seed seeds the generator of transfers. Zero picks a seed from the
+	// clock, which is logged so that a failure can be reproduced.
+	Seed int64
+	// Timeout bounds the whole run. A run that does not end in time is
+	// reported as a deadlock.
+	Timeout time.Duration
+}
+
+// DefaultTransferConfig runs thousands of transfers among a few accounts,
+// so that most of them contend for the same rows
+var DefaultTransferConfig = TransferConfig{
+	AccountsPerCurrency: 5,
+	Transfers:           2000,
+	Workers:             16,
+	MaxAmount:           100,
+	Timeout:             time.Minute,
+}
+
+// missingAccountID is an ID no test account has
+const missingAccountID = int64(1) << 60
+
+type transferOutcome struct {
+	arg    db.TransferTxParams
+	valid  bool
+	result db.TransferTxResult
+	err    error
+}
+
+// RunTransferProperties sends random transfers between random accounts of
+// the same currency concurrently, some of them to missing accounts, and then
+// checks that:
+//   - every transfer to existing accounts succeeds and every other one fails
+//     with db.ErrForeignKey, before cfg.Timeout, so no transfer deadlocked;
+//   - money is conserved in every currency;
+//   - the balance of every account is its initial balance plus its entries;
+//   - every successful transfer is stored with one matching entry on each
+//     side, and the failed ones leave no transfer nor entry behind.
+func RunTransferProperties(t *testing.T, store db.Store, cfg TransferConfig) {
+	seed := cfg.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	t.Logf("transfer seed: %d", seed)
+	rng := rand.New(rand.NewSource(seed))
+
+	// every user has an account in every currency
+	accounts := map[string][]db.Account{}
+	initial := map[int64]db.Account{}
+	for i := 0; i < cfg.AccountsPerCurrency; i++ {
+		user := createUser(t, store)
+		for _, currency := range util.SupportedCurrencies() {
+			account, err := store.CreateAccount(context.Background(), db.CreateAccountParams{
+				Owner:    user.Username,
+				Balance:  rng.Int63n(1000),
+				Currency: currency,
+			})
+			require.NoError(t, err)
+			accounts[currency] = append(accounts[currency], account)
+			initial[account.ID] = account
+		}
+	}
+
+	// the transfers are generated up front, so the seed determines them
+	// whatever the scheduling of the workers
+	outcomes := make([]transferOutcome, cfg.Transfers)
+	currencies := util.SupportedCurrencies()
+	for i := range outcomes {
+		candidates := accounts[currencies[rng.Intn(len(currencies))]]
+		arg := db.TransferTxParams{
+			FromAccountID: candidates[rng.Intn(len(candidates))].ID,
+			ToAccountID:   candidates[rng.Intn(len(candidates))].ID,
+			Amount:        1 + rng.Int63n(cfg.MaxAmount),
+		}
+		valid := rng.Intn(50) != 0
+		if !valid {
+			if rng.Intn(2) == 0 {
+				arg.FromAccountID = missingAccountID
+			} else {
+				arg.ToAccountID = missingAccountID
+			}
+		}
+		outcomes[i] = transferOutcome{arg: arg, valid: valid}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeout)
+	defer cancel()
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < cfg.Workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				outcomes[i].result, outcomes[i].err = store.TransferTx(ctx, outcomes[i].arg)
+			}
+		}()
+	}
+	for i := range outcomes {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	require.NoError(t, ctx.Err(), "transfers did not complete in %s, some may be deadlocked", cfg.Timeout)
+
+	expectedEntries := map[int64]int{}
+	expectedTransfers := map[int64]int{}
+	transferIDs := map[int64]bool{}
+	for _, o := range outcomes {
+		if !o.valid {
+			require.True(t, errors.Is(o.err, db.ErrForeignKey), "transfer %+v: got %v", o.arg, o.err)
+			continue
+		}
+		require.NoError(t, o.err, "transfer %+v", o.arg)
+		checkTransferResult(t, store, o.arg, o.result)
+		require.False(t, transferIDs[o.result.Transfer.ID], "transfer %d returned twice", o.result.Transfer.ID)
+		transferIDs[o.result.Transfer.ID] = true
+
+		expectedEntries[o.arg.FromAccountID]++
+		expectedEntries[o.arg.ToAccountID]++
+		expectedTransfers[o.arg.FromAccountID]++
+		if o.arg.ToAccountID != o.arg.FromAccountID {
+			expectedTransfers[o.arg.ToAccountID]++
+		}
+	}
+
+	for currency, currencyAccounts := range accounts {
+		var before, after int64
+		for _, account := range currencyAccounts {
+			got, err := store.GetAccount(context.Background(), account.ID)
+			require.NoError(t, err)
+			before += initial[account.ID].Balance
+			after += got.Balance
+
+			entries, err := store.ListEntries(context.Background(), db.ListEntriesParams{
+				AccountID: account.ID,
+				Limit:     int32(2*cfg.Transfers + 1),
+			})
+			require.NoError(t, err)
+			require.Len(t, entries, expectedEntries[account.ID], "entries of account %d", account.ID)
+			var sum int64
+			for _, entry := range entries {
+				sum += entry.Amount
+			}
+			require.Equal(t, initial[account.ID].Balance+sum, got.Balance, "balance of account %d does not match its entries", account.ID)
+
+			transfers, err := store.ListTransfers(context.Background(), db.ListTransfersParams{
+				FromAccountID: account.ID,
+				ToAccountID:   account.ID,
+				Limit:         int32(cfg.Transfers + 1),
+			})
+			require.NoError(t, err)
+			require.Len(t, transfers, expectedTransfers[account.ID], "transfers of account %d", account.ID)
+		}
+		require.Equal(t, before, after, "money was not conserved in %s", currency)
+	}
+}
+
+// checkTransferResult checks that a successful transfer returned and stored
+// what was asked
+func checkTransferResult(t *testing.T, store db.Store, arg db.TransferTxParams, r db.TransferTxResult) {
+	require.Equal(t, arg.FromAccountID, r.Transfer.FromAccountID)
+	require.Equal(t, arg.ToAccountID, r.Transfer.ToAccountID)
+	require.Equal(t, arg.Amount, r.Transfer.Amount)
+	require.Equal(t, arg.FromAccountID, r.FromEntry.AccountID)
+	require.Equal(t, -arg.Amount, r.FromEntry.Amount)
+	require.Equal(t, arg.ToAccountID, r.ToEntry.AccountID)
+	require.Equal(t, arg.Amount, r.ToEntry.Amount)
+	require.Equal(t, arg.FromAccountID, r.FromAccount.ID)
+	require.Equal(t, arg.ToAccountID, r.ToAccount.ID)
+
+	transfer, err := store.GetTransfer(context.Background(), r.Transfer.ID)
+	require.NoError(t, err)
+	require.Equal(t, r.Transfer.Amount, transfer.Amount)
+	for _, entry := range []db.Entry{r.FromEntry, r.ToEntry} {
+		got, err := store.GetEntry(context.Background(), entry.ID)
+		require.NoError(t, err)
+		require.Equal(t, entry.Amount, got.Amount)
+		require.Equal(t, entry.AccountID, got.AccountID)
+	}
+}
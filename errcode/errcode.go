@@ -0,0 +1,117 @@
+// Package errcode holds the stable codes of the errors answered to clients,
+// and maps the errors of the auth, db, password and token packages to them.
+// The HTTP and gRPC servers share the mapping, so that both answer an error
+// the same way, and neither answers the message of an unknown error, which
+// may hold driver details.
+package errcode
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/dpsigor/cheatsheet-golang-postgres/auth"
+	db "github.com/dpsigor/cheatsheet-golang-postgres/db/sqlc"
+	"github.com/dpsigor/cheatsheet-golang-postgres/password"
+	"github.com/dpsigor/cheatsheet-golang-postgres/token"
+)
+
+// Code is a stable, machine-readable identifier of an error. Clients should
+// branch on it instead of matching messages.
+type Code string
+
+// Codes of the errors answered to clients
+const (
+	InvalidRequest           Code = "invalid_request"
+	AuthorizationMissing     Code = "authorization_missing"
+	AuthorizationInvalid     Code = "authorization_invalid"
+	TokenExpired             Code = "token_expired"
+	TokenInvalid             Code = "token_invalid"
+	TokenRevoked             Code = "token_revoked"
+	InvalidCredentials       Code = "invalid_credentials"
+	Forbidden                Code = "forbidden"
+	InsufficientScope        Code = "insufficient_scope"
+	NotFound                 Code = "not_found"
+	UserNotFound             Code = "user_not_found"
+	AccountNotFound          Code = "account_not_found"
+	AlreadyExists            Code = "already_exists"
+	UsernameTaken            Code = "username_taken"
+	EmailTaken               Code = "email_taken"
+	AccountExists            Code = "account_exists"
+	InvalidReference         Code = "invalid_reference"
+	CurrencyMismatch         Code = "currency_mismatch"
+	AccountFrozen            Code = "account_frozen"
+	AmountOutOfRange         Code = "amount_out_of_range"
+	IdempotencyKeyReused     Code = "idempotency_key_reused"
+	IdempotencyKeyInProgress Code = "idempotency_key_in_progress"
+	RateLimited              Code = "rate_limited"
+	TOTPRequired             Code = "totp_required"
+	TOTPNotEnabled           Code = "totp_not_enabled"
+	InvalidTOTPCode          Code = "invalid_totp_code"
+	TOTPAlreadyEnabled       Code = "totp_already_enabled"
+	TOTPNotEnrolled          Code = "totp_not_enrolled"
+	InvalidResetToken        Code = "invalid_reset_token"
+	EmailNotVerified         Code = "email_not_verified"
+	EmailAlreadyVerified     Code = "email_already_verified"
+	InvalidVerificationToken Code = "invalid_verification_token"
+	APIKeyInvalid            Code = "api_key_invalid"
+	APIKeyNotFound           Code = "api_key_not_found"
+	InvalidOAuthClient       Code = "invalid_oauth_client"
+	InvalidRedirectURI       Code = "invalid_redirect_uri"
+	InvalidOAuthScope        Code = "invalid_oauth_scope"
+	InvalidCodeChallenge     Code = "invalid_code_challenge"
+	Internal                 Code = "internal"
+)
+
+// Error is how an error is answered to clients. Status is the HTTP status of
+// the error, which the gRPC server converts to a status code.
+type Error struct {
+	Status  int
+	Code    Code
+	Message string
+}
+
+// InternalError is answered for the errors Lookup does not know
+var InternalError = Error{Status: http.StatusInternalServerError, Code: Internal, Message: "internal server error"}
+
+// known maps the errors of the domain packages to how they are answered, in
+// the order they are checked
+var known = []struct {
+	target error
+	Error
+}{
+	{auth.ErrInvalidCredentials, Error{http.StatusUnauthorized, InvalidCredentials, "invalid username or password"}},
+	{auth.ErrTOTPCodeRequired, Error{http.StatusForbidden, TOTPRequired, "a two-factor authentication code is required"}},
+	{auth.ErrTOTPNotEnabled, Error{http.StatusForbidden, TOTPNotEnabled, "two-factor authentication must be enabled"}},
+	{auth.ErrInvalidTOTPCode, Error{http.StatusForbidden, InvalidTOTPCode, "invalid two-factor authentication code"}},
+	{auth.ErrTOTPAlreadyEnabled, Error{http.StatusConflict, TOTPAlreadyEnabled, "two-factor authentication is already enabled"}},
+	{auth.ErrTOTPNotEnrolled, Error{http.StatusConflict, TOTPNotEnrolled, "two-factor authentication enrollment was not started"}},
+	{auth.ErrTokenRevoked, Error{http.StatusUnauthorized, TokenRevoked, "access token was revoked by a password change"}},
+	{auth.ErrInvalidResetToken, Error{http.StatusBadRequest, InvalidResetToken, "password reset token is invalid or has expired"}},
+	{auth.ErrEmailNotVerified, Error{http.StatusForbidden, EmailNotVerified, "the email of the user must be verified"}},
+	{auth.ErrEmailAlreadyVerified, Error{http.StatusConflict, EmailAlreadyVerified, "the email of the user is already verified"}},
+	{auth.ErrInvalidVerificationToken, Error{http.StatusBadRequest, InvalidVerificationToken, "email verification token is invalid or has expired"}},
+	{auth.ErrInvalidAPIKey, Error{http.StatusUnauthorized, APIKeyInvalid, "API key is invalid, revoked or expired"}},
+	{auth.ErrInvalidOAuthClient, Error{http.StatusBadRequest, InvalidOAuthClient, "unknown OAuth client"}},
+	{auth.ErrInvalidRedirectURI, Error{http.StatusBadRequest, InvalidRedirectURI, "redirect_uri is not registered for the OAuth client"}},
+	{auth.ErrInvalidOAuthScope, Error{http.StatusBadRequest, InvalidOAuthScope, "scope is not allowed for the OAuth client"}},
+	{auth.ErrInvalidCodeChallenge, Error{http.StatusBadRequest, InvalidCodeChallenge, "code_challenge must be a PKCE S256 challenge"}},
+	{token.ErrExpiredToken, Error{http.StatusUnauthorized, TokenExpired, "access token has expired"}},
+	{token.ErrInvalidToken, Error{http.StatusUnauthorized, TokenInvalid, "access token is invalid"}},
+	{db.ErrRecordNotFound, Error{http.StatusNotFound, NotFound, "resource not found"}},
+	{db.ErrUniqueViolation, Error{http.StatusConflict, AlreadyExists, "resource already exists"}},
+	{db.ErrForeignKey, Error{http.StatusUnprocessableEntity, InvalidReference, "referenced resource does not exist"}},
+	{db.ErrOutOfRange, Error{http.StatusUnprocessableEntity, AmountOutOfRange, "amount would take a balance out of range"}},
+	{db.ErrInvalidAmount, Error{http.StatusBadRequest, InvalidRequest, "amount must be positive"}},
+	{password.ErrPasswordTooLong, Error{http.StatusBadRequest, InvalidRequest, "password is too long to be hashed"}},
+}
+
+// Lookup returns how err is answered to clients. It returns false, and
+// InternalError, if err is none of the errors of the domain packages.
+func Lookup(err error) (Error, bool) {
+	for _, k := range known {
+		if errors.Is(err, k.target) {
+			return k.Error, true
+		}
+	}
+	return InternalError, false
+}
@@ -0,0 +1,28 @@
+package errcode
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/dpsigor/cheatsheet-golang-postgres/auth"
+	db "github.com/dpsigor/cheatsheet-golang-postgres/db/sqlc"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLookup(t *testing.T) {
+	e, ok := Lookup(fmt.Errorf("cannot get user: %w", db.ErrRecordNotFound))
+	require.True(t, ok)
+	require.Equal(t, Error{http.StatusNotFound, NotFound, "resource not found"}, e)
+
+	e, ok = Lookup(auth.ErrInvalidCredentials)
+	require.True(t, ok)
+	require.Equal(t, http.StatusUnauthorized, e.Status)
+	require.Equal(t, InvalidCredentials, e.Code)
+
+	// the message of an unknown error is not answered
+	e, ok = Lookup(fmt.Errorf("cannot create user: %w", sql.ErrConnDone))
+	require.False(t, ok)
+	require.Equal(t, InternalError, e)
+}
@@ -0,0 +1,86 @@
+package gapi
+
+import (
+	"net/http"
+
+	"github.com/dpsigor/cheatsheet-golang-postgres/errcode"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func fieldViolation(field string, err error) *errdetails.BadRequest_FieldViolation {
+	return &errdetails.BadRequest_FieldViolation{
+		Field:       field,
+		Description: err.Error(),
+	}
+}
+
+func invalidArgumentError(violations []*errdetails.BadRequest_FieldViolation) error {
+	badRequest := &errdetails.BadRequest{FieldViolations: violations}
+	statusInvalid := status.New(codes.InvalidArgument, "invalid parameters")
+
+	statusDetails, err := statusInvalid.WithDetails(badRequest)
+	if err != nil {
+		return statusInvalid.Err()
+	}
+	return statusDetails.Err()
+}
+
+func unauthenticatedError(err error) error {
+	return status.Errorf(codes.Unauthenticated, "unauthorized: %s", err)
+}
+
+// toStatus maps err to the status answered to the client, with the mapping
+// the HTTP server shares. Unknown errors are answered as a bare internal
+// error, and their cause is logged by loggerInterceptor.
+func toStatus(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	e, ok := errcode.Lookup(err)
+	if !ok {
+		return internalError{cause: err}
+	}
+	return status.Error(grpcCode(e.Status), e.Message)
+}
+
+// grpcCode returns the status code matching the HTTP status of an error
+func grpcCode(httpStatus int) codes.Code {
+	switch httpStatus {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.AlreadyExists
+	case http.StatusUnprocessableEntity:
+		return codes.FailedPrecondition
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	}
+	return codes.Internal
+}
+
+// internalError is answered as an internal error without its cause, which
+// may hold driver details. Its Error method is the cause, for the logs.
+type internalError struct {
+	cause error
+}
+
+func (e internalError) Error() string {
+	return e.cause.Error()
+}
+
+func (e internalError) Unwrap() error {
+	return e.cause
+}
+
+// GRPCStatus is the status answered to the client
+func (e internalError) GRPCStatus() *status.Status {
+	return status.New(codes.Internal, "internal error")
+}
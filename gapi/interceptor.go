@@ -0,0 +1,90 @@
+package gapi
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/dpsigor/cheatsheet-golang-postgres/auth"
+	"github.com/dpsigor/cheatsheet-golang-postgres/pb"
+	"github.com/dpsigor/cheatsheet-golang-postgres/token"
+	"github.com/dpsigor/cheatsheet-golang-postgres/util"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	authorizationHeaderKey  = "authorization"
+	authorizationTypeBearer = "bearer"
+)
+
+type authPayloadKey struct{}
+
+// publicMethods can be called without an access token
+var publicMethods = map[string]bool{
+	pb.SimpleBank_CreateUser_FullMethodName:    true,
+	pb.SimpleBank_LoginUser_FullMethodName:     true,
+	pb.SimpleBank_LoginUserTOTP_FullMethodName: true,
+}
+
+// methodScopes are the scopes the token of the other methods must grant, as
+// requireScope checks on the HTTP routes
+var methodScopes = map[string]string{
+	pb.SimpleBank_CreateAccount_FullMethodName:  util.AccountsWriteScope,
+	pb.SimpleBank_GetAccount_FullMethodName:     util.AccountsReadScope,
+	pb.SimpleBank_ListAccounts_FullMethodName:   util.AccountsReadScope,
+	pb.SimpleBank_CreateTransfer_FullMethodName: util.TransfersWriteScope,
+}
+
+// authInterceptor is the gRPC counterpart of the HTTP authMiddleware: it
+// verifies the bearer token in the request metadata and stores its payload
+// in the context of the handler
+func authInterceptor(tokenMaker token.Maker, authenticator *auth.Authenticator) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if publicMethods[info.FullMethod] {
+			return handler(ctx, req)
+		}
+		payload, err := authorizeUser(ctx, tokenMaker)
+		if err != nil {
+			return nil, unauthenticatedError(err)
+		}
+		if err := authenticator.CheckToken(ctx, payload); err != nil {
+			return nil, toStatus(err)
+		}
+		if scope := methodScopes[info.FullMethod]; !payload.HasScope(scope) {
+			return nil, status.Errorf(codes.PermissionDenied, "this method requires the %s scope", scope)
+		}
+		return handler(context.WithValue(ctx, authPayloadKey{}, payload), req)
+	}
+}
+
+func authorizeUser(ctx context.Context, tokenMaker token.Maker) (*token.Payload, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return nil, fmt.Errorf("missing metadata")
+	}
+
+	values := md.Get(authorizationHeaderKey)
+	if len(values) == 0 {
+		return nil, fmt.Errorf("authorization header is not provided")
+	}
+
+	fields := strings.Fields(values[0])
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("invalid authorization header provided")
+	}
+
+	authType := strings.ToLower(fields[0])
+	if authType != authorizationTypeBearer {
+		return nil, fmt.Errorf("unsupported authorization type %s", authType)
+	}
+
+	return tokenMaker.VerifyToken(fields[1])
+}
+
+// authPayload returns the token payload stored by authInterceptor
+func authPayload(ctx context.Context) *token.Payload {
+	return ctx.Value(authPayloadKey{}).(*token.Payload)
+}
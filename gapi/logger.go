@@ -0,0 +1,62 @@
+package gapi
+
+import (
+	"context"
+	"time"
+
+	"github.com/dpsigor/cheatsheet-golang-postgres/util"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	requestIDHeaderKey = "x-request-id"
+	traceIDHeaderKey   = "x-trace-id"
+)
+
+// loggerInterceptor tags every call with a request ID, reusing the one sent
+// in the x-request-id metadata, and writes a structured log entry per call.
+// Traced calls also answer their trace ID in the x-trace-id header.
+func loggerInterceptor(logger zerolog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+
+		requestID := ""
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if values := md.Get(requestIDHeaderKey); len(values) > 0 && len(values[0]) <= 64 {
+				requestID = values[0]
+			}
+		}
+		if requestID == "" {
+			requestID = uuid.NewString()
+		}
+		header := metadata.Pairs(requestIDHeaderKey, requestID)
+		traceID := util.TraceIDFromContext(ctx)
+		if traceID != "" {
+			header.Set(traceIDHeaderKey, traceID)
+		}
+		grpc.SetHeader(ctx, header)
+		ctx = util.ContextWithRequestID(ctx, requestID)
+
+		res, err := handler(ctx, req)
+
+		code := status.Code(err)
+		event := logger.Info()
+		if err != nil {
+			event = logger.Error().Err(err)
+		}
+		if traceID != "" {
+			event = event.Str("trace_id", traceID)
+		}
+		event.
+			Str("request_id", requestID).
+			Str("method", info.FullMethod).
+			Str("status", code.String()).
+			Dur("latency", time.Since(start)).
+			Msg("request")
+		return res, err
+	}
+}
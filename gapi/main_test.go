@@ -0,0 +1,98 @@
+package gapi
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	db "github.com/dpsigor/cheatsheet-golang-postgres/db/sqlc"
+	"github.com/dpsigor/cheatsheet-golang-postgres/mail"
+	"github.com/dpsigor/cheatsheet-golang-postgres/password"
+	"github.com/dpsigor/cheatsheet-golang-postgres/pb"
+	"github.com/dpsigor/cheatsheet-golang-postgres/token"
+	"github.com/dpsigor/cheatsheet-golang-postgres/util"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+var testHasher = password.NewTestHasher()
+
+func newTestServer(t *testing.T, store db.Store) *Server {
+	config := util.Config{
+		TokenSymmetricKey:   util.RandomString(32),
+		AccessTokenDuration: time.Minute,
+	}
+	tokenMaker, err := token.NewPasetoMaker(config.TokenSymmetricKey)
+	require.NoError(t, err)
+	server, err := NewServer(config, store, tokenMaker, zerolog.Nop())
+	require.NoError(t, err)
+	server.mailer = &recordingMailer{}
+	t.Cleanup(func() {
+		require.NoError(t, server.Close(context.Background()))
+	})
+	return server
+}
+
+// recordingMailer keeps the messages sent instead of delivering them
+type recordingMailer struct {
+	mu       sync.Mutex
+	messages []mail.Message
+}
+
+func (m *recordingMailer) Send(ctx context.Context, msg mail.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// sentMessages returns the messages sent by server
+func sentMessages(server *Server) []mail.Message {
+	m := server.mailer.(*recordingMailer)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]mail.Message(nil), m.messages...)
+}
+
+// newTestClient serves the server over an in-memory connection, so requests
+// go through the same interceptors as in production
+func newTestClient(t *testing.T, server *Server) pb.SimpleBankClient {
+	listener := bufconn.Listen(1024 * 1024)
+	grpcServer := server.GRPCServer()
+	go grpcServer.Serve(listener)
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return pb.NewSimpleBankClient(conn)
+}
+
+func newContextWithBearerToken(t *testing.T, tokenMaker token.Maker, username string, duration time.Duration) context.Context {
+	return newContextWithScopedBearerToken(t, tokenMaker, username, nil, duration)
+}
+
+func newContextWithScopedBearerToken(t *testing.T, tokenMaker token.Maker, username string, scopes []string, duration time.Duration) context.Context {
+	accessToken, err := tokenMaker.CreateToken(username, scopes, duration)
+	require.NoError(t, err)
+
+	md := metadata.MD{
+		authorizationHeaderKey: []string{
+			fmt.Sprintf("%s %s", authorizationTypeBearer, accessToken),
+		},
+	}
+	return metadata.NewOutgoingContext(context.Background(), md)
+}
@@ -0,0 +1,52 @@
+package gapi
+
+import (
+	"context"
+	"errors"
+
+	db "github.com/dpsigor/cheatsheet-golang-postgres/db/sqlc"
+	"github.com/dpsigor/cheatsheet-golang-postgres/pb"
+	"github.com/dpsigor/cheatsheet-golang-postgres/val"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// CreateAccount creates a new account owned by the authenticated user
+func (server *Server) CreateAccount(ctx context.Context, req *pb.CreateAccountRequest) (*pb.CreateAccountResponse, error) {
+	if violations := validateCreateAccountRequest(req); violations != nil {
+		return nil, invalidArgumentError(violations)
+	}
+
+	payload := authPayload(ctx)
+	if err := server.authenticator.RequireVerifiedEmail(ctx, payload.Username); err != nil {
+		return nil, toStatus(err)
+	}
+	arg := db.CreateAccountParams{
+		Owner:    payload.Username,
+		Currency: req.GetCurrency(),
+	}
+
+	account, err := server.store.CreateAccount(ctx, arg)
+	if err != nil {
+		switch {
+		case errors.Is(err, db.ErrForeignKey):
+			return nil, status.Errorf(codes.PermissionDenied, "invalid owner")
+		case errors.Is(err, db.ErrOwnerCurrencyExists):
+			return nil, status.Errorf(codes.AlreadyExists, "owner already has a %s account", req.GetCurrency())
+		}
+		return nil, toStatus(err)
+	}
+
+	rsp := &pb.CreateAccountResponse{
+		Account: convertAccount(account),
+	}
+	return rsp, nil
+}
+
+func validateCreateAccountRequest(req *pb.CreateAccountRequest) (violations []*errdetails.BadRequest_FieldViolation) {
+	if err := val.ValidateCurrency(req.GetCurrency()); err != nil {
+		violations = append(violations, fieldViolation("currency", err))
+	}
+	return violations
+}
@@ -0,0 +1,85 @@
+package gapi
+
+import (
+	"context"
+	"errors"
+
+	db "github.com/dpsigor/cheatsheet-golang-postgres/db/sqlc"
+	"github.com/dpsigor/cheatsheet-golang-postgres/mail"
+	"github.com/dpsigor/cheatsheet-golang-postgres/pb"
+	"github.com/dpsigor/cheatsheet-golang-postgres/val"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// CreateUser creates a new user
+func (server *Server) CreateUser(ctx context.Context, req *pb.CreateUserRequest) (*pb.CreateUserResponse, error) {
+	if violations := validateCreateUserRequest(req, server.passwordPolicy); violations != nil {
+		return nil, invalidArgumentError(violations)
+	}
+
+	hashedPw, err := server.authenticator.HashPassword(req.GetPassword())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	arg := db.CreateUserParams{
+		Username:       req.GetUsername(),
+		FullName:       req.GetFullName(),
+		Email:          req.GetEmail(),
+		HashedPassword: hashedPw,
+	}
+
+	user, err := server.store.CreateUser(ctx, arg)
+	if err != nil {
+		switch {
+		case errors.Is(err, db.ErrDuplicateEmail):
+			return nil, status.Errorf(codes.AlreadyExists, "email '%s' already exists", req.GetEmail())
+		case errors.Is(err, db.ErrDuplicateUsername):
+			return nil, status.Errorf(codes.AlreadyExists, "username '%s' already exists", req.GetUsername())
+		}
+		return nil, toStatus(err)
+	}
+	// the user is created even if the email cannot be sent, and asks for
+	// another one over HTTP
+	if err := server.queueVerificationEmail(ctx, user); err != nil {
+		server.logger.Error().Err(err).Str("username", user.Username).Msg("cannot send verification email")
+	}
+
+	rsp := &pb.CreateUserResponse{
+		User: convertUser(user),
+	}
+	return rsp, nil
+}
+
+// queueVerificationEmail creates a verification token for the email of the
+// user and queues the email with its link, as the HTTP signup does
+func (server *Server) queueVerificationEmail(ctx context.Context, user db.User) error {
+	verification, err := server.authenticator.CreateEmailVerification(ctx, user)
+	if err != nil {
+		return err
+	}
+	return server.mailer.Send(ctx, mail.VerificationMessage(
+		server.config.MailFrom, user.Email, user.FullName,
+		mail.Link(server.config.EmailVerificationURL, verification.Token),
+	))
+}
+
+// validateCreateUserRequest reports a violation of the password field for
+// every rule of policy the password breaks
+func validateCreateUserRequest(req *pb.CreateUserRequest, policy val.PasswordPolicy) (violations []*errdetails.BadRequest_FieldViolation) {
+	if err := val.ValidateUsername(req.GetUsername()); err != nil {
+		violations = append(violations, fieldViolation("username", err))
+	}
+	for _, violation := range policy.Check(req.GetPassword(), val.PasswordUser{Username: req.GetUsername(), Email: req.GetEmail()}) {
+		violations = append(violations, fieldViolation("password", violation))
+	}
+	if err := val.ValidateFullName(req.GetFullName()); err != nil {
+		violations = append(violations, fieldViolation("full_name", err))
+	}
+	if err := val.ValidateEmail(req.GetEmail()); err != nil {
+		violations = append(violations, fieldViolation("email", err))
+	}
+	return violations
+}
@@ -0,0 +1,190 @@
+package gapi
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"testing"
+
+	mockdb "github.com/dpsigor/cheatsheet-golang-postgres/db/mock"
+	db "github.com/dpsigor/cheatsheet-golang-postgres/db/sqlc"
+	"github.com/dpsigor/cheatsheet-golang-postgres/mail"
+	"github.com/dpsigor/cheatsheet-golang-postgres/pb"
+	"github.com/dpsigor/cheatsheet-golang-postgres/util"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func randomUser(t *testing.T) (db.User, string) {
+	return db.User{
+		Username: util.RandomString(10),
+		FullName: util.RandomString(10),
+		Email:    util.RandomEmail(),
+	}, util.RandomString(10)
+}
+
+type eqCreateUserParamsMatcher struct {
+	arg      db.CreateUserParams
+	password string
+}
+
+func (e eqCreateUserParamsMatcher) Matches(x interface{}) bool {
+	arg, ok := x.(db.CreateUserParams)
+	if !ok {
+		return false
+	}
+	err := testHasher.Check(e.password, arg.HashedPassword)
+	if err != nil {
+		return false
+	}
+	e.arg.HashedPassword = arg.HashedPassword
+	return reflect.DeepEqual(e.arg, arg)
+}
+
+func (e eqCreateUserParamsMatcher) String() string {
+	return fmt.Sprintf("matches arg %v and password %v", e.arg, e.password)
+}
+
+func TestCreateUserAPI(t *testing.T) {
+	user, pw := randomUser(t)
+
+	tests := []struct {
+		name       string
+		req        *pb.CreateUserRequest
+		buildStubs func(store *mockdb.MockStore)
+		checkRes   func(t *testing.T, res *pb.CreateUserResponse, err error, sent []mail.Message)
+	}{
+		{
+			name: "OK",
+			req: &pb.CreateUserRequest{
+				Username: user.Username,
+				Password: pw,
+				FullName: user.FullName,
+				Email:    user.Email,
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				arg := db.CreateUserParams{
+					Username: user.Username,
+					FullName: user.FullName,
+					Email:    user.Email,
+				}
+				store.EXPECT().
+					CreateUser(gomock.Any(), eqCreateUserParamsMatcher{arg: arg, password: pw}).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().
+					CreateVerifyEmail(gomock.Any(), gomock.Any()).
+					Times(1)
+			},
+			checkRes: func(t *testing.T, res *pb.CreateUserResponse, err error, sent []mail.Message) {
+				require.NoError(t, err)
+				require.Equal(t, user.Username, res.GetUser().GetUsername())
+				require.Equal(t, user.FullName, res.GetUser().GetFullName())
+				require.Equal(t, user.Email, res.GetUser().GetEmail())
+				require.False(t, res.GetUser().GetIsEmailVerified())
+				require.Len(t, sent, 1)
+				require.Equal(t, user.Email, sent[0].To)
+			},
+		},
+		{
+			name: "DuplicateEmail",
+			req: &pb.CreateUserRequest{
+				Username: user.Username,
+				Password: pw,
+				FullName: user.FullName,
+				Email:    user.Email,
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					CreateUser(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.User{}, db.ErrDuplicateEmail)
+			},
+			checkRes: func(t *testing.T, res *pb.CreateUserResponse, err error, sent []mail.Message) {
+				require.Equal(t, codes.AlreadyExists, status.Code(err))
+			},
+		},
+		{
+			name: "InternalError",
+			req: &pb.CreateUserRequest{
+				Username: user.Username,
+				Password: pw,
+				FullName: user.FullName,
+				Email:    user.Email,
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					CreateUser(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.User{}, sql.ErrConnDone)
+			},
+			checkRes: func(t *testing.T, res *pb.CreateUserResponse, err error, sent []mail.Message) {
+				// the driver error is logged, not answered
+				require.Equal(t, codes.Internal, status.Code(err))
+				require.Equal(t, "internal error", status.Convert(err).Message())
+			},
+		},
+		{
+			name: "InvalidArguments",
+			req: &pb.CreateUserRequest{
+				Username: "invalid-user#",
+				Password: "123",
+				FullName: user.FullName,
+				Email:    "invalid-email",
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					CreateUser(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkRes: func(t *testing.T, res *pb.CreateUserResponse, err error, sent []mail.Message) {
+				st, ok := status.FromError(err)
+				require.True(t, ok)
+				require.Equal(t, codes.InvalidArgument, st.Code())
+				require.Len(t, st.Details(), 1)
+			},
+		},
+		{
+			name: "WeakPassword",
+			req: &pb.CreateUserRequest{
+				Username: user.Username,
+				Password: "qwerty123",
+				FullName: user.FullName,
+				Email:    user.Email,
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					CreateUser(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkRes: func(t *testing.T, res *pb.CreateUserResponse, err error, sent []mail.Message) {
+				st, ok := status.FromError(err)
+				require.True(t, ok)
+				require.Equal(t, codes.InvalidArgument, st.Code())
+				require.Len(t, st.Details(), 1)
+				badRequest, ok := st.Details()[0].(*errdetails.BadRequest)
+				require.True(t, ok)
+				require.Len(t, badRequest.GetFieldViolations(), 1)
+				require.Equal(t, "password", badRequest.GetFieldViolations()[0].GetField())
+				require.Equal(t, "is too common, having been found in data breaches", badRequest.GetFieldViolations()[0].GetDescription())
+			},
+		},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			client := newTestClient(t, server)
+			res, err := client.CreateUser(context.Background(), tc.req)
+			tc.checkRes(t, res, err, sentMessages(server))
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package gapi
+
+import (
+	"context"
+	"net"
+	"strings"
+
+	"github.com/dpsigor/cheatsheet-golang-postgres/auth"
+	db "github.com/dpsigor/cheatsheet-golang-postgres/db/sqlc"
+	"github.com/dpsigor/cheatsheet-golang-postgres/pb"
+	"github.com/dpsigor/cheatsheet-golang-postgres/val"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// LoginUser checks the user credentials and returns an access token
+func (server *Server) LoginUser(ctx context.Context, req *pb.LoginUserRequest) (*pb.LoginUserResponse, error) {
+	if violations := validateLoginUserRequest(req); violations != nil {
+		return nil, invalidArgumentError(violations)
+	}
+
+	result, err := server.authenticator.Login(ctx, req.GetUsername(), req.GetPassword(), clientOf(ctx))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	if result.Challenge != nil {
+		rsp := &pb.LoginUserResponse{
+			TotpChallengeId:        result.Challenge.ID.String(),
+			TotpChallengeExpiresAt: timestamppb.New(result.Challenge.ExpiresAt),
+		}
+		return rsp, nil
+	}
+
+	return server.newLoginUserResponse(result.User, req.GetScopes())
+}
+
+// newLoginUserResponse creates an access token for the user, restricted to
+// the scopes, if any
+func (server *Server) newLoginUserResponse(user db.User, scopes []string) (*pb.LoginUserResponse, error) {
+	accessToken, err := server.tokenMaker.CreateToken(user.Username, scopes, server.config.AccessTokenDuration)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	rsp := &pb.LoginUserResponse{
+		AccessToken: accessToken,
+		User:        convertUser(user),
+		Scopes:      scopes,
+	}
+	return rsp, nil
+}
+
+func validateLoginUserRequest(req *pb.LoginUserRequest) (violations []*errdetails.BadRequest_FieldViolation) {
+	if err := val.ValidateUsername(req.GetUsername()); err != nil {
+		violations = append(violations, fieldViolation("username", err))
+	}
+	if err := val.ValidatePassword(req.GetPassword()); err != nil {
+		violations = append(violations, fieldViolation("password", err))
+	}
+	return append(violations, validateScopes(req.GetScopes())...)
+}
+
+// validateScopes checks the scopes requested for an access token
+func validateScopes(scopes []string) (violations []*errdetails.BadRequest_FieldViolation) {
+	for _, scope := range scopes {
+		if err := val.ValidateScope(scope); err != nil {
+			violations = append(violations, fieldViolation("scopes", err))
+		}
+	}
+	return violations
+}
+
+// clientOf describes the client of a call for the login audit log. gRPC
+// clients send their user agent in the user-agent metadata.
+func clientOf(ctx context.Context) auth.Client {
+	var client auth.Client
+	if p, ok := peer.FromContext(ctx); ok {
+		if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
+			client.IP = host
+		} else {
+			client.IP = p.Addr.String()
+		}
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		client.UserAgent = strings.Join(md.Get("user-agent"), " ")
+	}
+	return client
+}
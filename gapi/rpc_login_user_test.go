@@ -0,0 +1,58 @@
+package gapi
+
+import (
+	"context"
+	"testing"
+
+	memdb "github.com/dpsigor/cheatsheet-golang-postgres/db/memory"
+	db "github.com/dpsigor/cheatsheet-golang-postgres/db/sqlc"
+	"github.com/dpsigor/cheatsheet-golang-postgres/pb"
+	"github.com/dpsigor/cheatsheet-golang-postgres/util"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestLoginUserAPI(t *testing.T) {
+	store := memdb.NewStore()
+	password := util.RandomString(10)
+	hashedPassword, err := testHasher.Hash(password)
+	require.NoError(t, err)
+	user, err := store.CreateUser(context.Background(), db.CreateUserParams{
+		Username:       util.RandomOwner() + util.RandomString(6),
+		HashedPassword: hashedPassword,
+		FullName:       util.RandomOwner(),
+		Email:          util.RandomEmail(),
+	})
+	require.NoError(t, err)
+	client := newTestClient(t, newTestServer(t, store))
+
+	rsp, err := client.LoginUser(context.Background(), &pb.LoginUserRequest{Username: user.Username, Password: password})
+	require.NoError(t, err)
+	require.NotEmpty(t, rsp.GetAccessToken())
+	require.Equal(t, user.Username, rsp.GetUser().GetUsername())
+
+	// unknown users and wrong passwords get the same answer
+	_, err = client.LoginUser(context.Background(), &pb.LoginUserRequest{Username: "unknown" + util.RandomString(6), Password: password})
+	unknown, ok := status.FromError(err)
+	require.True(t, ok)
+	require.Equal(t, codes.Unauthenticated, unknown.Code())
+	_, err = client.LoginUser(context.Background(), &pb.LoginUserRequest{Username: user.Username, Password: "wrong-password"})
+	wrong, ok := status.FromError(err)
+	require.True(t, ok)
+	require.Equal(t, unknown.Code(), wrong.Code())
+	require.Equal(t, unknown.Message(), wrong.Message())
+
+	attempts, err := store.ListLoginAttempts(context.Background(), db.ListLoginAttemptsParams{Username: user.Username, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, attempts, 2)
+	require.False(t, attempts[0].Success)
+	require.True(t, attempts[1].Success)
+	require.Contains(t, attempts[1].UserAgent, "grpc-go")
+
+	rsp, err = client.LoginUser(context.Background(), &pb.LoginUserRequest{Username: user.Username, Password: password, Scopes: []string{util.AccountsReadScope}})
+	require.NoError(t, err)
+	require.Equal(t, []string{util.AccountsReadScope}, rsp.GetScopes())
+	_, err = client.LoginUser(context.Background(), &pb.LoginUserRequest{Username: user.Username, Password: password, Scopes: []string{"accounts:admin"}})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
@@ -0,0 +1,34 @@
+package gapi
+
+import (
+	"context"
+
+	"github.com/dpsigor/cheatsheet-golang-postgres/pb"
+	"github.com/dpsigor/cheatsheet-golang-postgres/val"
+	"github.com/google/uuid"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+)
+
+// LoginUserTOTP answers the challenge returned by LoginUser to the users with
+// two-factor authentication enabled, and returns an access token
+func (server *Server) LoginUserTOTP(ctx context.Context, req *pb.LoginUserTOTPRequest) (*pb.LoginUserResponse, error) {
+	if violations := validateLoginUserTOTPRequest(req); violations != nil {
+		return nil, invalidArgumentError(violations)
+	}
+
+	user, err := server.authenticator.LoginTOTP(ctx, uuid.MustParse(req.GetChallengeId()), req.GetCode(), clientOf(ctx))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return server.newLoginUserResponse(user, req.GetScopes())
+}
+
+func validateLoginUserTOTPRequest(req *pb.LoginUserTOTPRequest) (violations []*errdetails.BadRequest_FieldViolation) {
+	if _, err := uuid.Parse(req.GetChallengeId()); err != nil {
+		violations = append(violations, fieldViolation("challenge_id", err))
+	}
+	if err := val.ValidateLoginCode(req.GetCode()); err != nil {
+		violations = append(violations, fieldViolation("code", err))
+	}
+	return append(violations, validateScopes(req.GetScopes())...)
+}
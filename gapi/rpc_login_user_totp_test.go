@@ -0,0 +1,60 @@
+package gapi
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dpsigor/cheatsheet-golang-postgres/auth"
+	memdb "github.com/dpsigor/cheatsheet-golang-postgres/db/memory"
+	db "github.com/dpsigor/cheatsheet-golang-postgres/db/sqlc"
+	"github.com/dpsigor/cheatsheet-golang-postgres/pb"
+	"github.com/dpsigor/cheatsheet-golang-postgres/util"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestLoginUserTOTPAPI(t *testing.T) {
+	store := memdb.NewStore()
+	ctx := context.Background()
+	password := util.RandomString(10)
+	hashedPassword, err := testHasher.Hash(password)
+	require.NoError(t, err)
+	user, err := store.CreateUser(ctx, db.CreateUserParams{
+		Username:       util.RandomOwner() + util.RandomString(6),
+		HashedPassword: hashedPassword,
+		FullName:       util.RandomOwner(),
+		Email:          util.RandomEmail(),
+	})
+	require.NoError(t, err)
+	const secret = "JBSWY3DPEHPK3PXP"
+	_, err = store.SetTOTPSecret(ctx, db.SetTOTPSecretParams{Username: user.Username, TotpSecret: secret})
+	require.NoError(t, err)
+	_, err = store.EnableTOTPTx(ctx, db.EnableTOTPTxParams{Username: user.Username})
+	require.NoError(t, err)
+	client := newTestClient(t, newTestServer(t, store))
+
+	rsp, err := client.LoginUser(ctx, &pb.LoginUserRequest{Username: user.Username, Password: password})
+	require.NoError(t, err)
+	require.Empty(t, rsp.GetAccessToken())
+	require.Nil(t, rsp.GetUser())
+	require.NotEmpty(t, rsp.GetTotpChallengeId())
+	require.True(t, rsp.GetTotpChallengeExpiresAt().AsTime().After(time.Now()))
+
+	_, err = client.LoginUserTOTP(ctx, &pb.LoginUserTOTPRequest{ChallengeId: "not a uuid", Code: "123456"})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	code, err := auth.GenerateTOTPCode(secret, time.Now())
+	require.NoError(t, err)
+	rsp, err = client.LoginUserTOTP(ctx, &pb.LoginUserTOTPRequest{ChallengeId: rsp.GetTotpChallengeId(), Code: code})
+	require.NoError(t, err)
+	require.NotEmpty(t, rsp.GetAccessToken())
+	require.Equal(t, user.Username, rsp.GetUser().GetUsername())
+
+	// a used code is refused
+	rsp, err = client.LoginUser(ctx, &pb.LoginUserRequest{Username: user.Username, Password: password})
+	require.NoError(t, err)
+	_, err = client.LoginUserTOTP(ctx, &pb.LoginUserTOTPRequest{ChallengeId: rsp.GetTotpChallengeId(), Code: code})
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+}
@@ -0,0 +1,78 @@
+package gapi
+
+import (
+	"context"
+
+	"github.com/dpsigor/cheatsheet-golang-postgres/auth"
+	db "github.com/dpsigor/cheatsheet-golang-postgres/db/sqlc"
+	"github.com/dpsigor/cheatsheet-golang-postgres/mail"
+	"github.com/dpsigor/cheatsheet-golang-postgres/password"
+	"github.com/dpsigor/cheatsheet-golang-postgres/pb"
+	"github.com/dpsigor/cheatsheet-golang-postgres/token"
+	"github.com/dpsigor/cheatsheet-golang-postgres/util"
+	"github.com/dpsigor/cheatsheet-golang-postgres/val"
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
+)
+
+// Server serves gRPC requests for our banking service
+type Server struct {
+	pb.UnimplementedSimpleBankServer
+	config        util.Config
+	store         db.Store
+	tokenMaker    token.Maker
+	authenticator *auth.Authenticator
+	// passwordPolicy is the policy of the passwords users choose
+	passwordPolicy val.PasswordPolicy
+	mailer         mail.Mailer
+	mailQueue      *mail.Queue
+	logger         zerolog.Logger
+}
+
+// NewServer creates a new gRPC server checking the access tokens with
+// tokenMaker, which the HTTP server shares
+func NewServer(config util.Config, store db.Store, tokenMaker token.Maker, logger zerolog.Logger) (*Server, error) {
+	hasher, err := password.NewHasherFromConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	mailer, err := mail.New(config.MailBackend, config.MailDir)
+	if err != nil {
+		return nil, err
+	}
+	mailQueue := mail.NewQueue(mailer, logger, mail.DefaultQueueSize)
+	server := &Server{
+		config:         config,
+		store:          store,
+		tokenMaker:     tokenMaker,
+		authenticator:  auth.NewAuthenticator(store, auth.LockoutPolicyFromConfig(config), hasher),
+		passwordPolicy: val.PasswordPolicyFromConfig(config),
+		mailer:         mailQueue,
+		mailQueue:      mailQueue,
+		logger:         logger,
+	}
+	return server, nil
+}
+
+// Close waits for the emails queued by the calls to be sent, or for ctx to
+// be done. It is called once the gRPC server is stopped.
+func (server *Server) Close(ctx context.Context) error {
+	return server.mailQueue.Close(ctx)
+}
+
+// GRPCServer returns a grpc.Server with the bank service and the tracing,
+// logger and auth interceptors registered, ready to be served on a listener
+func (server *Server) GRPCServer() *grpc.Server {
+	grpcServer := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(
+			otelgrpc.UnaryServerInterceptor(),
+			loggerInterceptor(server.logger),
+			authInterceptor(server.tokenMaker, server.authenticator),
+		),
+	)
+	pb.RegisterSimpleBankServer(grpcServer, server)
+	reflection.Register(grpcServer)
+	return grpcServer
+}
@@ -0,0 +1,44 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChecker(t *testing.T) {
+	checker := NewChecker(50 * time.Millisecond)
+	require.Equal(t, StatusOK, checker.Run(context.Background()).Status)
+
+	checker.Add("ok", func(ctx context.Context) error { return nil })
+	report := checker.Run(context.Background())
+	require.Equal(t, StatusOK, report.Status)
+	require.Equal(t, StatusOK, report.Checks["ok"].Status)
+
+	checker.Add("failing", func(ctx context.Context) error { return errors.New("connection refused") })
+	checker.Add("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	report = checker.Run(context.Background())
+	require.Equal(t, StatusFail, report.Status)
+	require.Equal(t, StatusOK, report.Checks["ok"].Status)
+	require.Equal(t, Result{Status: StatusFail, Error: "connection refused", Latency: report.Checks["failing"].Latency}, report.Checks["failing"])
+	require.Equal(t, context.DeadlineExceeded.Error(), report.Checks["slow"].Error)
+}
+
+func TestWorker(t *testing.T) {
+	var worker Worker
+	require.ErrorIs(t, worker.Check(context.Background()), ErrWorkerNotRunning)
+
+	worker.Start()
+	require.NoError(t, worker.Check(context.Background()))
+
+	worker.Stop(errors.New("listener closed"))
+	err := worker.Check(context.Background())
+	require.ErrorIs(t, err, ErrWorkerNotRunning)
+	require.Contains(t, err.Error(), "listener closed")
+}
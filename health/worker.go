@@ -0,0 +1,49 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrWorkerNotRunning is reported by the check of a worker that is not
+// running
+var ErrWorkerNotRunning = errors.New("worker is not running")
+
+// Worker tracks the status of a long-running goroutine, such as a server or
+// a background job, so readiness fails once it stops
+type Worker struct {
+	mu      sync.Mutex
+	running bool
+	err     error
+}
+
+// Start marks the worker as running
+func (w *Worker) Start() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.running = true
+	w.err = nil
+}
+
+// Stop marks the worker as stopped, because of err if not nil
+func (w *Worker) Stop(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.running = false
+	w.err = err
+}
+
+// Check is the readiness check of the worker
+func (w *Worker) Check(ctx context.Context) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.running {
+		return nil
+	}
+	if w.err != nil {
+		return fmt.Errorf("%w: %v", ErrWorkerNotRunning, w.err)
+	}
+	return ErrWorkerNotRunning
+}
@@ -0,0 +1,60 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DefaultDir is where FileMailer writes the messages when no directory is set
+const DefaultDir = "outbox"
+
+// FileMailer writes every message to a .eml file, which mail clients open.
+// The messages carry secrets such as reset links, so the files are only
+// readable by their owner.
+type FileMailer struct {
+	dir string
+	now func() time.Time
+}
+
+var _ Mailer = (*FileMailer)(nil)
+
+// NewFileMailer creates a FileMailer writing to dir, created on the first
+// message
+func NewFileMailer(dir string) *FileMailer {
+	if dir == "" {
+		dir = DefaultDir
+	}
+	return &FileMailer{dir: dir, now: time.Now}
+}
+
+// Send writes msg to a new file, named after the time it was sent so that
+// the files sort in order
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(m.dir, 0o700); err != nil {
+		return fmt.Errorf("cannot create mail directory: %w", err)
+	}
+
+	now := m.now()
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", msg.From)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(msg.Body)
+
+	name := fmt.Sprintf("%s-%s.eml", now.UTC().Format("20060102T150405.000000000"), uuid.NewString()[:8])
+	if err := os.WriteFile(filepath.Join(m.dir, name), b.Bytes(), 0o600); err != nil {
+		return fmt.Errorf("cannot write message: %w", err)
+	}
+	return nil
+}
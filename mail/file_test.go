@@ -0,0 +1,51 @@
+package mail
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileMailer(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+	mailer := NewFileMailer(dir)
+	msg := Message{
+		From:    "bank@example.com",
+		To:      "alice@example.com",
+		Subject: "Hello",
+		Body:    "Hello, Alice\n",
+	}
+	for i := 0; i < 2; i++ {
+		require.NoError(t, mailer.Send(context.Background(), msg))
+	}
+
+	files, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+	info, err := files[0].Info()
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+	require.Equal(t, ".eml", filepath.Ext(files[0].Name()))
+
+	data, err := os.ReadFile(filepath.Join(dir, files[0].Name()))
+	require.NoError(t, err)
+	require.Contains(t, string(data), "To: alice@example.com\r\n")
+	require.Contains(t, string(data), "Subject: Hello\r\n")
+	require.Contains(t, string(data), "\r\n\r\nHello, Alice\n")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.ErrorIs(t, mailer.Send(ctx, msg), context.Canceled)
+}
+
+func TestNew(t *testing.T) {
+	mailer, err := New("", "")
+	require.NoError(t, err)
+	require.Equal(t, DefaultDir, mailer.(*FileMailer).dir)
+
+	_, err = New("smtp", "")
+	require.Error(t, err)
+}
@@ -0,0 +1,35 @@
+// Package mail sends emails to the users, such as their password reset links
+package mail
+
+import (
+	"context"
+	"fmt"
+)
+
+// Backends of the mailer, selected by MAIL_BACKEND
+const (
+	BackendFile = "file"
+)
+
+// Message is a plain text email
+type Message struct {
+	From    string
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers messages
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// New creates the Mailer of backend. The file backend writes the messages in
+// dir, for local development.
+func New(backend, dir string) (Mailer, error) {
+	switch backend {
+	case "", BackendFile:
+		return NewFileMailer(dir), nil
+	}
+	return nil, fmt.Errorf("unsupported mail backend %q", backend)
+}
@@ -0,0 +1,40 @@
+package mail
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// Link returns the link opening baseURL with token in the query, as sent in
+// the emails below
+func Link(baseURL, token string) string {
+	return baseURL + "?" + url.Values{"token": {token}}.Encode()
+}
+
+// PasswordResetMessage is the email carrying the password reset link of a
+// user
+func PasswordResetMessage(from, to, name, link string) Message {
+	return Message{
+		From:    from,
+		To:      to,
+		Subject: "Reset your Simple Bank password",
+		Body: fmt.Sprintf("Hello %s,\n\n"+
+			"Follow this link within the next hour to choose a new password:\n\n%s\n\n"+
+			"If you did not ask for a new password, you can ignore this email.\n",
+			name, link),
+	}
+}
+
+// VerificationMessage is the email carrying the email verification link of a
+// user
+func VerificationMessage(from, to, name, link string) Message {
+	return Message{
+		From:    from,
+		To:      to,
+		Subject: "Verify your Simple Bank email",
+		Body: fmt.Sprintf("Hello %s,\n\n"+
+			"Follow this link within the next 24 hours to verify your email:\n\n%s\n\n"+
+			"You can open accounts and make transfers once your email is verified.\n",
+			name, link),
+	}
+}
@@ -0,0 +1,98 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	// DefaultQueueSize is the number of messages a Queue holds before Send
+	// fails
+	DefaultQueueSize = 100
+	// sendTimeout bounds the delivery of a message by a Queue
+	sendTimeout = 30 * time.Second
+)
+
+// Errors returned by Queue.Send
+var (
+	ErrQueueFull   = errors.New("mail queue is full")
+	ErrQueueClosed = errors.New("mail queue is closed")
+)
+
+// Queue delivers messages with a Mailer in the background, so that the
+// requests sending emails do not wait for them. Messages that cannot be
+// delivered are logged and dropped.
+type Queue struct {
+	mailer   Mailer
+	logger   zerolog.Logger
+	messages chan Message
+	done     chan struct{}
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+var _ Mailer = (*Queue)(nil)
+
+// NewQueue creates a Queue holding up to size messages and starts delivering
+// them with mailer until Close
+func NewQueue(mailer Mailer, logger zerolog.Logger, size int) *Queue {
+	q := &Queue{
+		mailer:   mailer,
+		logger:   logger,
+		messages: make(chan Message, size),
+		done:     make(chan struct{}),
+	}
+	go q.run()
+	return q
+}
+
+// Send queues msg for delivery. It returns ErrQueueFull rather than wait when
+// the queue holds size messages.
+func (q *Queue) Send(ctx context.Context, msg Message) error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		return ErrQueueClosed
+	}
+	select {
+	case q.messages <- msg:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Close stops accepting messages and waits for the queued ones to be
+// delivered, or for ctx to be done
+func (q *Queue) Close(ctx context.Context) error {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.messages)
+	}
+	q.mu.Unlock()
+
+	select {
+	case <-q.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (q *Queue) run() {
+	defer close(q.done)
+	for msg := range q.messages {
+		// the request that queued msg may be over, so its context is not used
+		ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+		if err := q.mailer.Send(ctx, msg); err != nil {
+			q.logger.Error().Err(err).Str("subject", msg.Subject).Msg("cannot send email")
+		}
+		cancel()
+	}
+}
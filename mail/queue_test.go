@@ -0,0 +1,49 @@
+package mail
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+// blockingMailer records the messages once unblock is closed
+type blockingMailer struct {
+	unblock chan struct{}
+
+	mu       sync.Mutex
+	messages []Message
+}
+
+func (m *blockingMailer) Send(ctx context.Context, msg Message) error {
+	<-m.unblock
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+func TestQueue(t *testing.T) {
+	mailer := &blockingMailer{unblock: make(chan struct{})}
+	q := NewQueue(mailer, zerolog.Nop(), 2)
+
+	// one message is being delivered, and two wait in the queue
+	require.NoError(t, q.Send(context.Background(), Message{Subject: "1"}))
+	require.Eventually(t, func() bool { return len(q.messages) == 0 }, time.Second, time.Millisecond)
+	require.NoError(t, q.Send(context.Background(), Message{Subject: "2"}))
+	require.NoError(t, q.Send(context.Background(), Message{Subject: "3"}))
+	require.ErrorIs(t, q.Send(context.Background(), Message{Subject: "4"}), ErrQueueFull)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, q.Close(ctx), context.DeadlineExceeded)
+	require.ErrorIs(t, q.Send(context.Background(), Message{Subject: "5"}), ErrQueueClosed)
+
+	// the queued messages are delivered before Close returns
+	close(mailer.unblock)
+	require.NoError(t, q.Close(context.Background()))
+	require.Equal(t, []Message{{Subject: "1"}, {Subject: "2"}, {Subject: "3"}}, mailer.messages)
+}
@@ -0,0 +1,110 @@
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "simple_bank"
+
+// Metrics holds the Prometheus collectors of the service
+type Metrics struct {
+	registry *prometheus.Registry
+
+	httpRequestDuration *prometheus.HistogramVec
+
+	storeCallDuration *prometheus.HistogramVec
+	storeCallErrors   *prometheus.CounterVec
+
+	transferTxDuration prometheus.Histogram
+	transferTxRetries  prometheus.Counter
+	transferTxFailures *prometheus.CounterVec
+
+	transfers      *prometheus.CounterVec
+	transferVolume *prometheus.CounterVec
+}
+
+// New creates the collectors and registers them, along with the Go runtime
+// and process collectors, in a new registry
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		httpRequestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Duration of HTTP requests by route, method and status.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method", "status"}),
+		storeCallDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "store_call_duration_seconds",
+			Help:      "Duration of Store calls by method.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method"}),
+		storeCallErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "store_call_errors_total",
+			Help:      "Store calls that returned an error, by method.",
+		}, []string{"method"}),
+		transferTxDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "transfer_tx_duration_seconds",
+			Help:      "Duration of transfer transactions.",
+			Buckets:   prometheus.DefBuckets,
+		}),
+		transferTxRetries: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "transfer_tx_retries_total",
+			Help:      "Transfer transactions aborted by a deadlock or serialization failure, which the client may retry.",
+		}),
+		transferTxFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "transfer_tx_failures_total",
+			Help:      "Transfer transactions that failed, by reason.",
+		}, []string{"reason"}),
+		transfers: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "transfers_total",
+			Help:      "Transfers completed, by currency.",
+		}, []string{"currency"}),
+		transferVolume: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "transfer_volume_total",
+			Help:      "Amount of money moved by transfers, by currency.",
+		}, []string{"currency"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.httpRequestDuration,
+		m.storeCallDuration,
+		m.storeCallErrors,
+		m.transferTxDuration,
+		m.transferTxRetries,
+		m.transferTxFailures,
+		m.transfers,
+		m.transferVolume,
+	)
+	return m
+}
+
+// RegisterDBStats exposes the connection pool statistics of db as gauges
+func (m *Metrics) RegisterDBStats(db *sql.DB) {
+	m.registry.MustRegister(collectors.NewDBStatsCollector(db, namespace))
+}
+
+// Handler serves the metrics in the Prometheus exposition format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// ObserveHTTPRequest records the duration of an HTTP request
+func (m *Metrics) ObserveHTTPRequest(route, method, status string, duration time.Duration) {
+	m.httpRequestDuration.WithLabelValues(route, method, status).Observe(duration.Seconds())
+}
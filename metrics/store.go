@@ -0,0 +1,331 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	db "github.com/dpsigor/cheatsheet-golang-postgres/db/sqlc"
+	"github.com/google/uuid"
+)
+
+// Store is a db.Store decorator recording the duration and errors of every
+// call, and the business metrics of transfers
+type Store struct {
+	store   db.Store
+	metrics *Metrics
+}
+
+var _ db.Store = (*Store)(nil)
+
+// NewStore instruments store with m
+func NewStore(store db.Store, m *Metrics) *Store {
+	return &Store{store: store, metrics: m}
+}
+
+func observe[T any](s *Store, method string, fn func() (T, error)) (T, error) {
+	start := time.Now()
+	result, err := fn()
+	s.metrics.storeCallDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	if err != nil && !errors.Is(err, db.ErrRecordNotFound) {
+		s.metrics.storeCallErrors.WithLabelValues(method).Inc()
+	}
+	return result, err
+}
+
+func (s *Store) AddAccountBalance(ctx context.Context, arg db.AddAccountBalanceParams) (db.Account, error) {
+	return observe(s, "AddAccountBalance", func() (db.Account, error) { return s.store.AddAccountBalance(ctx, arg) })
+}
+
+func (s *Store) CreateAPIKey(ctx context.Context, arg db.CreateAPIKeyParams) (db.APIKey, error) {
+	return observe(s, "CreateAPIKey", func() (db.APIKey, error) { return s.store.CreateAPIKey(ctx, arg) })
+}
+
+func (s *Store) CreateAccount(ctx context.Context, arg db.CreateAccountParams) (db.Account, error) {
+	return observe(s, "CreateAccount", func() (db.Account, error) { return s.store.CreateAccount(ctx, arg) })
+}
+
+func (s *Store) CreateEntry(ctx context.Context, arg db.CreateEntryParams) (db.Entry, error) {
+	return observe(s, "CreateEntry", func() (db.Entry, error) { return s.store.CreateEntry(ctx, arg) })
+}
+
+func (s *Store) CreateIdempotencyKey(ctx context.Context, arg db.CreateIdempotencyKeyParams) (db.IdempotencyKey, error) {
+	return observe(s, "CreateIdempotencyKey", func() (db.IdempotencyKey, error) { return s.store.CreateIdempotencyKey(ctx, arg) })
+}
+
+func (s *Store) CreateLoginAttempt(ctx context.Context, arg db.CreateLoginAttemptParams) (db.LoginAttempt, error) {
+	return observe(s, "CreateLoginAttempt", func() (db.LoginAttempt, error) { return s.store.CreateLoginAttempt(ctx, arg) })
+}
+
+func (s *Store) CreateLoginChallenge(ctx context.Context, arg db.CreateLoginChallengeParams) (db.LoginChallenge, error) {
+	return observe(s, "CreateLoginChallenge", func() (db.LoginChallenge, error) { return s.store.CreateLoginChallenge(ctx, arg) })
+}
+
+func (s *Store) CreateOAuthAuthorizationCode(ctx context.Context, arg db.CreateOAuthAuthorizationCodeParams) (db.OAuthAuthorizationCode, error) {
+	return observe(s, "CreateOAuthAuthorizationCode", func() (db.OAuthAuthorizationCode, error) { return s.store.CreateOAuthAuthorizationCode(ctx, arg) })
+}
+
+func (s *Store) CreateOAuthClient(ctx context.Context, arg db.CreateOAuthClientParams) (db.OAuthClient, error) {
+	return observe(s, "CreateOAuthClient", func() (db.OAuthClient, error) { return s.store.CreateOAuthClient(ctx, arg) })
+}
+
+func (s *Store) CreateOAuthRefreshToken(ctx context.Context, arg db.CreateOAuthRefreshTokenParams) (db.OAuthRefreshToken, error) {
+	return observe(s, "CreateOAuthRefreshToken", func() (db.OAuthRefreshToken, error) { return s.store.CreateOAuthRefreshToken(ctx, arg) })
+}
+
+func (s *Store) CreatePasswordResetToken(ctx context.Context, arg db.CreatePasswordResetTokenParams) (db.PasswordResetToken, error) {
+	return observe(s, "CreatePasswordResetToken", func() (db.PasswordResetToken, error) { return s.store.CreatePasswordResetToken(ctx, arg) })
+}
+
+func (s *Store) CreateRecoveryCode(ctx context.Context, arg db.CreateRecoveryCodeParams) (db.RecoveryCode, error) {
+	return observe(s, "CreateRecoveryCode", func() (db.RecoveryCode, error) { return s.store.CreateRecoveryCode(ctx, arg) })
+}
+
+func (s *Store) CreateTransfer(ctx context.Context, arg db.CreateTransferParams) (db.Transfer, error) {
+	return observe(s, "CreateTransfer", func() (db.Transfer, error) { return s.store.CreateTransfer(ctx, arg) })
+}
+
+func (s *Store) CreateUser(ctx context.Context, arg db.CreateUserParams) (db.User, error) {
+	return observe(s, "CreateUser", func() (db.User, error) { return s.store.CreateUser(ctx, arg) })
+}
+
+func (s *Store) CreateVerifyEmail(ctx context.Context, arg db.CreateVerifyEmailParams) (db.VerifyEmail, error) {
+	return observe(s, "CreateVerifyEmail", func() (db.VerifyEmail, error) { return s.store.CreateVerifyEmail(ctx, arg) })
+}
+
+func (s *Store) DeleteAPIKey(ctx context.Context, arg db.DeleteAPIKeyParams) (db.APIKey, error) {
+	return observe(s, "DeleteAPIKey", func() (db.APIKey, error) { return s.store.DeleteAPIKey(ctx, arg) })
+}
+
+func (s *Store) DeleteAccount(ctx context.Context, id int64) error {
+	_, err := observe(s, "DeleteAccount", func() (struct{}, error) { return struct{}{}, s.store.DeleteAccount(ctx, id) })
+	return err
+}
+
+func (s *Store) DeleteExpiredLoginChallenges(ctx context.Context, username string) error {
+	_, err := observe(s, "DeleteExpiredLoginChallenges", func() (struct{}, error) { return struct{}{}, s.store.DeleteExpiredLoginChallenges(ctx, username) })
+	return err
+}
+
+func (s *Store) DeleteIdempotencyKey(ctx context.Context, arg db.DeleteIdempotencyKeyParams) error {
+	_, err := observe(s, "DeleteIdempotencyKey", func() (struct{}, error) { return struct{}{}, s.store.DeleteIdempotencyKey(ctx, arg) })
+	return err
+}
+
+func (s *Store) DeleteLoginChallenge(ctx context.Context, id uuid.UUID) (db.LoginChallenge, error) {
+	return observe(s, "DeleteLoginChallenge", func() (db.LoginChallenge, error) { return s.store.DeleteLoginChallenge(ctx, id) })
+}
+
+func (s *Store) DeleteOAuthAuthorizationCode(ctx context.Context, hashedCode string) (db.OAuthAuthorizationCode, error) {
+	return observe(s, "DeleteOAuthAuthorizationCode", func() (db.OAuthAuthorizationCode, error) {
+		return s.store.DeleteOAuthAuthorizationCode(ctx, hashedCode)
+	})
+}
+
+func (s *Store) DeleteOAuthRefreshToken(ctx context.Context, hashedToken string) (db.OAuthRefreshToken, error) {
+	return observe(s, "DeleteOAuthRefreshToken", func() (db.OAuthRefreshToken, error) { return s.store.DeleteOAuthRefreshToken(ctx, hashedToken) })
+}
+
+func (s *Store) DeletePasswordResetToken(ctx context.Context, hashedToken string) (db.PasswordResetToken, error) {
+	return observe(s, "DeletePasswordResetToken", func() (db.PasswordResetToken, error) { return s.store.DeletePasswordResetToken(ctx, hashedToken) })
+}
+
+func (s *Store) DeletePasswordResetTokens(ctx context.Context, username string) error {
+	_, err := observe(s, "DeletePasswordResetTokens", func() (struct{}, error) { return struct{}{}, s.store.DeletePasswordResetTokens(ctx, username) })
+	return err
+}
+
+func (s *Store) DeleteRateLimitBuckets(ctx context.Context, before time.Time) (int64, error) {
+	return observe(s, "DeleteRateLimitBuckets", func() (int64, error) { return s.store.DeleteRateLimitBuckets(ctx, before) })
+}
+
+func (s *Store) DeleteRecoveryCode(ctx context.Context, id int64) (int64, error) {
+	return observe(s, "DeleteRecoveryCode", func() (int64, error) { return s.store.DeleteRecoveryCode(ctx, id) })
+}
+
+func (s *Store) DeleteRecoveryCodes(ctx context.Context, username string) error {
+	_, err := observe(s, "DeleteRecoveryCodes", func() (struct{}, error) { return struct{}{}, s.store.DeleteRecoveryCodes(ctx, username) })
+	return err
+}
+
+func (s *Store) EnableTOTP(ctx context.Context, arg db.EnableTOTPParams) (db.User, error) {
+	return observe(s, "EnableTOTP", func() (db.User, error) { return s.store.EnableTOTP(ctx, arg) })
+}
+
+func (s *Store) GetAPIKeyByPrefix(ctx context.Context, prefix string) (db.APIKey, error) {
+	return observe(s, "GetAPIKeyByPrefix", func() (db.APIKey, error) { return s.store.GetAPIKeyByPrefix(ctx, prefix) })
+}
+
+func (s *Store) GetAccount(ctx context.Context, id int64) (db.Account, error) {
+	return observe(s, "GetAccount", func() (db.Account, error) { return s.store.GetAccount(ctx, id) })
+}
+
+func (s *Store) GetAccountForUpdate(ctx context.Context, id int64) (db.Account, error) {
+	return observe(s, "GetAccountForUpdate", func() (db.Account, error) { return s.store.GetAccountForUpdate(ctx, id) })
+}
+
+func (s *Store) GetEntry(ctx context.Context, id int64) (db.Entry, error) {
+	return observe(s, "GetEntry", func() (db.Entry, error) { return s.store.GetEntry(ctx, id) })
+}
+
+func (s *Store) GetIdempotencyKey(ctx context.Context, arg db.GetIdempotencyKeyParams) (db.IdempotencyKey, error) {
+	return observe(s, "GetIdempotencyKey", func() (db.IdempotencyKey, error) { return s.store.GetIdempotencyKey(ctx, arg) })
+}
+
+func (s *Store) GetOAuthClient(ctx context.Context, id string) (db.OAuthClient, error) {
+	return observe(s, "GetOAuthClient", func() (db.OAuthClient, error) { return s.store.GetOAuthClient(ctx, id) })
+}
+
+func (s *Store) GetPasswordChangedAt(ctx context.Context, username string) (time.Time, error) {
+	return observe(s, "GetPasswordChangedAt", func() (time.Time, error) { return s.store.GetPasswordChangedAt(ctx, username) })
+}
+
+func (s *Store) GetTransfer(ctx context.Context, id int64) (db.Transfer, error) {
+	return observe(s, "GetTransfer", func() (db.Transfer, error) { return s.store.GetTransfer(ctx, id) })
+}
+
+func (s *Store) GetUser(ctx context.Context, username string) (db.User, error) {
+	return observe(s, "GetUser", func() (db.User, error) { return s.store.GetUser(ctx, username) })
+}
+
+func (s *Store) GetUserByEmail(ctx context.Context, email string) (db.User, error) {
+	return observe(s, "GetUserByEmail", func() (db.User, error) { return s.store.GetUserByEmail(ctx, email) })
+}
+
+func (s *Store) IsEmailVerified(ctx context.Context, username string) (bool, error) {
+	return observe(s, "IsEmailVerified", func() (bool, error) { return s.store.IsEmailVerified(ctx, username) })
+}
+
+func (s *Store) ListAPIKeys(ctx context.Context, username string) ([]db.APIKey, error) {
+	return observe(s, "ListAPIKeys", func() ([]db.APIKey, error) { return s.store.ListAPIKeys(ctx, username) })
+}
+
+func (s *Store) ListAccounts(ctx context.Context, arg db.ListAccountsParams) ([]db.Account, error) {
+	return observe(s, "ListAccounts", func() ([]db.Account, error) { return s.store.ListAccounts(ctx, arg) })
+}
+
+func (s *Store) ListEntries(ctx context.Context, arg db.ListEntriesParams) ([]db.Entry, error) {
+	return observe(s, "ListEntries", func() ([]db.Entry, error) { return s.store.ListEntries(ctx, arg) })
+}
+
+func (s *Store) ListLoginAttempts(ctx context.Context, arg db.ListLoginAttemptsParams) ([]db.LoginAttempt, error) {
+	return observe(s, "ListLoginAttempts", func() ([]db.LoginAttempt, error) { return s.store.ListLoginAttempts(ctx, arg) })
+}
+
+func (s *Store) ListRecoveryCodes(ctx context.Context, username string) ([]db.RecoveryCode, error) {
+	return observe(s, "ListRecoveryCodes", func() ([]db.RecoveryCode, error) { return s.store.ListRecoveryCodes(ctx, username) })
+}
+
+func (s *Store) ListTransfers(ctx context.Context, arg db.ListTransfersParams) ([]db.Transfer, error) {
+	return observe(s, "ListTransfers", func() ([]db.Transfer, error) { return s.store.ListTransfers(ctx, arg) })
+}
+
+func (s *Store) RecordFailedLogin(ctx context.Context, arg db.RecordFailedLoginParams) (db.User, error) {
+	return observe(s, "RecordFailedLogin", func() (db.User, error) { return s.store.RecordFailedLogin(ctx, arg) })
+}
+
+func (s *Store) RehashUserPassword(ctx context.Context, arg db.RehashUserPasswordParams) error {
+	_, err := observe(s, "RehashUserPassword", func() (struct{}, error) { return struct{}{}, s.store.RehashUserPassword(ctx, arg) })
+	return err
+}
+
+func (s *Store) ResetFailedLogins(ctx context.Context, username string) error {
+	_, err := observe(s, "ResetFailedLogins", func() (struct{}, error) { return struct{}{}, s.store.ResetFailedLogins(ctx, username) })
+	return err
+}
+
+func (s *Store) SetAccountFrozen(ctx context.Context, arg db.SetAccountFrozenParams) (db.Account, error) {
+	return observe(s, "SetAccountFrozen", func() (db.Account, error) { return s.store.SetAccountFrozen(ctx, arg) })
+}
+
+func (s *Store) SetIdempotencyKeyResponse(ctx context.Context, arg db.SetIdempotencyKeyResponseParams) error {
+	_, err := observe(s, "SetIdempotencyKeyResponse", func() (struct{}, error) { return struct{}{}, s.store.SetIdempotencyKeyResponse(ctx, arg) })
+	return err
+}
+
+func (s *Store) SetTOTPSecret(ctx context.Context, arg db.SetTOTPSecretParams) (db.User, error) {
+	return observe(s, "SetTOTPSecret", func() (db.User, error) { return s.store.SetTOTPSecret(ctx, arg) })
+}
+
+func (s *Store) TakeRateLimitToken(ctx context.Context, arg db.TakeRateLimitTokenParams) (db.RateLimitBucket, error) {
+	return observe(s, "TakeRateLimitToken", func() (db.RateLimitBucket, error) { return s.store.TakeRateLimitToken(ctx, arg) })
+}
+
+func (s *Store) TouchAPIKey(ctx context.Context, arg db.TouchAPIKeyParams) error {
+	_, err := observe(s, "TouchAPIKey", func() (struct{}, error) { return struct{}{}, s.store.TouchAPIKey(ctx, arg) })
+	return err
+}
+
+func (s *Store) UpdateAccount(ctx context.Context, arg db.UpdateAccountParams) (db.Account, error) {
+	return observe(s, "UpdateAccount", func() (db.Account, error) { return s.store.UpdateAccount(ctx, arg) })
+}
+
+func (s *Store) UpdateUser(ctx context.Context, arg db.UpdateUserParams) (db.User, error) {
+	return observe(s, "UpdateUser", func() (db.User, error) { return s.store.UpdateUser(ctx, arg) })
+}
+
+func (s *Store) UpdateUserPassword(ctx context.Context, arg db.UpdateUserPasswordParams) (db.User, error) {
+	return observe(s, "UpdateUserPassword", func() (db.User, error) { return s.store.UpdateUserPassword(ctx, arg) })
+}
+
+func (s *Store) UpdateUserRole(ctx context.Context, arg db.UpdateUserRoleParams) (db.User, error) {
+	return observe(s, "UpdateUserRole", func() (db.User, error) { return s.store.UpdateUserRole(ctx, arg) })
+}
+
+func (s *Store) UseTOTPStep(ctx context.Context, arg db.UseTOTPStepParams) (int64, error) {
+	return observe(s, "UseTOTPStep", func() (int64, error) { return s.store.UseTOTPStep(ctx, arg) })
+}
+
+// TransferTx records the duration and outcome of the transfer transaction,
+// and on success the transfer count and volume by currency
+func (s *Store) UseVerifyEmail(ctx context.Context, hashedToken string) (db.VerifyEmail, error) {
+	return observe(s, "UseVerifyEmail", func() (db.VerifyEmail, error) { return s.store.UseVerifyEmail(ctx, hashedToken) })
+}
+
+func (s *Store) VerifyUserEmail(ctx context.Context, arg db.VerifyUserEmailParams) (db.User, error) {
+	return observe(s, "VerifyUserEmail", func() (db.User, error) { return s.store.VerifyUserEmail(ctx, arg) })
+}
+
+func (s *Store) TransferTx(ctx context.Context, arg db.TransferTxParams) (db.TransferTxResult, error) {
+	start := time.Now()
+	result, err := observe(s, "TransferTx", func() (db.TransferTxResult, error) { return s.store.TransferTx(ctx, arg) })
+	s.metrics.transferTxDuration.Observe(time.Since(start).Seconds())
+	if err != nil {
+		if errors.Is(err, db.ErrTxConflict) {
+			s.metrics.transferTxRetries.Inc()
+		}
+		s.metrics.transferTxFailures.WithLabelValues(failureReason(err)).Inc()
+		return result, err
+	}
+
+	currency := result.FromAccount.Currency
+	s.metrics.transfers.WithLabelValues(currency).Inc()
+	s.metrics.transferVolume.WithLabelValues(currency).Add(float64(result.Transfer.Amount))
+	return result, nil
+}
+
+func (s *Store) EnableTOTPTx(ctx context.Context, arg db.EnableTOTPTxParams) (db.EnableTOTPTxResult, error) {
+	return observe(s, "EnableTOTPTx", func() (db.EnableTOTPTxResult, error) { return s.store.EnableTOTPTx(ctx, arg) })
+}
+
+func (s *Store) ChangePasswordTx(ctx context.Context, arg db.ChangePasswordTxParams) (db.User, error) {
+	return observe(s, "ChangePasswordTx", func() (db.User, error) { return s.store.ChangePasswordTx(ctx, arg) })
+}
+
+func (s *Store) VerifyEmailTx(ctx context.Context, arg db.VerifyEmailTxParams) (db.VerifyEmailTxResult, error) {
+	return observe(s, "VerifyEmailTx", func() (db.VerifyEmailTxResult, error) { return s.store.VerifyEmailTx(ctx, arg) })
+}
+
+func failureReason(err error) string {
+	switch {
+	case errors.Is(err, db.ErrTxConflict):
+		return "conflict"
+	case errors.Is(err, db.ErrForeignKey):
+		return "foreign_key"
+	case errors.Is(err, db.ErrOutOfRange):
+		return "out_of_range"
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return "canceled"
+	}
+	return "other"
+}
@@ -0,0 +1,58 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+
+	mockdb "github.com/dpsigor/cheatsheet-golang-postgres/db/mock"
+	db "github.com/dpsigor/cheatsheet-golang-postgres/db/sqlc"
+	"github.com/dpsigor/cheatsheet-golang-postgres/util"
+	"github.com/golang/mock/gomock"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoreTransferTx(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mock := mockdb.NewMockStore(ctrl)
+	m := New()
+	store := NewStore(mock, m)
+
+	result := db.TransferTxResult{
+		Transfer:    db.Transfer{Amount: 25},
+		FromAccount: db.Account{Currency: util.USD},
+	}
+	mock.EXPECT().TransferTx(gomock.Any(), gomock.Any()).Times(2).Return(result, nil)
+	mock.EXPECT().TransferTx(gomock.Any(), gomock.Any()).Times(1).Return(db.TransferTxResult{}, db.ErrTxConflict)
+
+	for i := 0; i < 3; i++ {
+		store.TransferTx(context.Background(), db.TransferTxParams{})
+	}
+
+	require.Equal(t, float64(2), testutil.ToFloat64(m.transfers.WithLabelValues(util.USD)))
+	require.Equal(t, float64(50), testutil.ToFloat64(m.transferVolume.WithLabelValues(util.USD)))
+	require.Equal(t, float64(1), testutil.ToFloat64(m.transferTxFailures.WithLabelValues("conflict")))
+	require.Equal(t, float64(1), testutil.ToFloat64(m.transferTxRetries))
+	require.Equal(t, float64(1), testutil.ToFloat64(m.storeCallErrors.WithLabelValues("TransferTx")))
+	require.Equal(t, 1, testutil.CollectAndCount(m.transferTxDuration))
+}
+
+func TestStoreErrors(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mock := mockdb.NewMockStore(ctrl)
+	m := New()
+	store := NewStore(mock, m)
+
+	mock.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(1).Return(db.Account{}, db.ErrRecordNotFound)
+	mock.EXPECT().CreateUser(gomock.Any(), gomock.Any()).Times(1).Return(db.User{}, db.ErrDuplicateEmail)
+
+	_, err := store.GetAccount(context.Background(), 1)
+	require.ErrorIs(t, err, db.ErrRecordNotFound)
+	_, err = store.CreateUser(context.Background(), db.CreateUserParams{})
+	require.ErrorIs(t, err, db.ErrDuplicateEmail)
+
+	// a missing record is an expected outcome, not a store failure
+	require.Equal(t, float64(0), testutil.ToFloat64(m.storeCallErrors.WithLabelValues("GetAccount")))
+	require.Equal(t, float64(1), testutil.ToFloat64(m.storeCallErrors.WithLabelValues("CreateUser")))
+	require.Equal(t, 2, testutil.CollectAndCount(m.storeCallDuration))
+}
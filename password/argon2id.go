@@ -0,0 +1,178 @@
+package password
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Argon2idParams are the costs of argon2id. Memory is in KiB.
+type Argon2idParams struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+}
+
+// DefaultArgon2idParams are the minimum recommended by OWASP, which take
+// tens of milliseconds per hash
+var DefaultArgon2idParams = Argon2idParams{
+	Memory:      19 * 1024,
+	Iterations:  2,
+	Parallelism: 1,
+}
+
+const (
+	argon2idSaltLength = 16
+	argon2idKeyLength  = 32
+)
+
+var b64 = base64.RawStdEncoding
+
+// Argon2idHasher hashes passwords with argon2id, in the PHC string format:
+//
+//	$argon2id$v=19$m=19456,t=2,p=1$<salt>$<hash>
+//
+// With a pepper, the password is first keyed with HMAC-SHA256, and the hash
+// records the keyid of the pepper, so that a hash is never checked with
+// another pepper. The hashes without a keyid are checked without it.
+type Argon2idHasher struct {
+	params Argon2idParams
+	pepper []byte
+	keyID  string
+}
+
+var _ Hasher = (*Argon2idHasher)(nil)
+
+// NewArgon2idHasher creates an Argon2idHasher with params, the ones left
+// zero taking their default, and an optional pepper
+func NewArgon2idHasher(params Argon2idParams, pepper string) *Argon2idHasher {
+	if params.Memory == 0 {
+		params.Memory = DefaultArgon2idParams.Memory
+	}
+	if params.Iterations == 0 {
+		params.Iterations = DefaultArgon2idParams.Iterations
+	}
+	if params.Parallelism == 0 {
+		params.Parallelism = DefaultArgon2idParams.Parallelism
+	}
+	h := &Argon2idHasher{params: params}
+	if pepper != "" {
+		h.pepper = []byte(pepper)
+		sum := sha256.Sum256(h.pepper)
+		h.keyID = b64.EncodeToString(sum[:6])
+	}
+	return h
+}
+
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, argon2idSaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("cannot generate salt: %w", err)
+	}
+	key := argon2.IDKey(h.input(password), salt, h.params.Iterations, h.params.Memory, h.params.Parallelism, argon2idKeyLength)
+
+	params := fmt.Sprintf("m=%d,t=%d,p=%d", h.params.Memory, h.params.Iterations, h.params.Parallelism)
+	if h.keyID != "" {
+		params += ",keyid=" + h.keyID
+	}
+	return fmt.Sprintf("$argon2id$v=%d$%s$%s$%s", argon2.Version, params, b64.EncodeToString(salt), b64.EncodeToString(key)), nil
+}
+
+func (h *Argon2idHasher) Check(password, hash string) error {
+	decoded, err := decodeArgon2id(hash)
+	if err != nil {
+		return err
+	}
+	// the hashes created before the pepper was set are checked without it
+	input := []byte(password)
+	if decoded.keyID != "" {
+		if decoded.keyID != h.keyID {
+			return ErrPepperMismatch
+		}
+		input = h.input(password)
+	}
+	key := argon2.IDKey(input, decoded.salt, decoded.params.Iterations, decoded.params.Memory, decoded.params.Parallelism, uint32(len(decoded.key)))
+	if subtle.ConstantTimeCompare(key, decoded.key) != 1 {
+		return ErrMismatchedPassword
+	}
+	return nil
+}
+
+func (h *Argon2idHasher) NeedsRehash(hash string) bool {
+	decoded, err := decodeArgon2id(hash)
+	return err != nil ||
+		decoded.params != h.params ||
+		decoded.keyID != h.keyID ||
+		len(decoded.salt) != argon2idSaltLength ||
+		len(decoded.key) != argon2idKeyLength
+}
+
+// input is what argon2id hashes: the password keyed with the pepper, if any
+func (h *Argon2idHasher) input(password string) []byte {
+	if h.pepper == nil {
+		return []byte(password)
+	}
+	mac := hmac.New(sha256.New, h.pepper)
+	mac.Write([]byte(password))
+	return mac.Sum(nil)
+}
+
+type argon2idHash struct {
+	params Argon2idParams
+	keyID  string
+	salt   []byte
+	key    []byte
+}
+
+func decodeArgon2id(hash string) (argon2idHash, error) {
+	// "", "argon2id", "v=19", params, salt, key
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != Argon2id {
+		return argon2idHash{}, ErrInvalidHash
+	}
+	if parts[2] != fmt.Sprintf("v=%d", argon2.Version) {
+		return argon2idHash{}, fmt.Errorf("%w: unsupported argon2 version %q", ErrInvalidHash, parts[2])
+	}
+
+	var decoded argon2idHash
+	for _, param := range strings.Split(parts[3], ",") {
+		name, value, _ := strings.Cut(param, "=")
+		var err error
+		switch name {
+		case "m":
+			_, err = fmt.Sscan(value, &decoded.params.Memory)
+		case "t":
+			_, err = fmt.Sscan(value, &decoded.params.Iterations)
+		case "p":
+			_, err = fmt.Sscan(value, &decoded.params.Parallelism)
+		case "keyid":
+			decoded.keyID = value
+		default:
+			err = fmt.Errorf("unknown parameter %q", name)
+		}
+		if err != nil {
+			return argon2idHash{}, fmt.Errorf("%w: %v", ErrInvalidHash, err)
+		}
+	}
+	if decoded.params.Memory == 0 || decoded.params.Iterations == 0 || decoded.params.Parallelism == 0 {
+		return argon2idHash{}, fmt.Errorf("%w: missing parameters", ErrInvalidHash)
+	}
+
+	var err error
+	if decoded.salt, err = b64.DecodeString(parts[4]); err != nil {
+		return argon2idHash{}, fmt.Errorf("%w: %v", ErrInvalidHash, err)
+	}
+	if decoded.key, err = b64.DecodeString(parts[5]); err != nil {
+		return argon2idHash{}, fmt.Errorf("%w: %v", ErrInvalidHash, err)
+	}
+	if len(decoded.key) == 0 {
+		return argon2idHash{}, fmt.Errorf("%w: empty key", ErrInvalidHash)
+	}
+	return decoded, nil
+}
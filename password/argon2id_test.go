@@ -0,0 +1,76 @@
+package password
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dpsigor/cheatsheet-golang-postgres/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArgon2idHasher(t *testing.T) {
+	hasher := NewArgon2idHasher(Argon2idParams{}, "")
+	pw := util.RandomString(10)
+
+	hs1, err := hasher.Hash(pw)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(hs1, "$argon2id$v=19$m=19456,t=2,p=1$"), hs1)
+	require.Equal(t, Argon2id, Algorithm(hs1))
+	require.NoError(t, hasher.Check(pw, hs1))
+	require.ErrorIs(t, hasher.Check(pw+"x", hs1), ErrMismatchedPassword)
+	require.False(t, hasher.NeedsRehash(hs1))
+
+	hs2, err := hasher.Hash(pw)
+	require.NoError(t, err)
+	require.NotEqual(t, hs1, hs2)
+
+	// passwords are not truncated, unlike with bcrypt
+	long := strings.Repeat("a", 100)
+	hs3, err := hasher.Hash(long)
+	require.NoError(t, err)
+	require.NoError(t, hasher.Check(long, hs3))
+	require.ErrorIs(t, hasher.Check(long[:72], hs3), ErrMismatchedPassword)
+
+	// the hashes are checked with the parameters they record
+	stronger := NewArgon2idHasher(Argon2idParams{Memory: 32 * 1024, Iterations: 3}, "")
+	require.NoError(t, stronger.Check(pw, hs1))
+	require.True(t, stronger.NeedsRehash(hs1))
+}
+
+func TestArgon2idHasherPepper(t *testing.T) {
+	hasher := NewArgon2idHasher(Argon2idParams{}, "pepper")
+	unpeppered := NewArgon2idHasher(Argon2idParams{}, "")
+	pw := util.RandomString(10)
+
+	hash, err := hasher.Hash(pw)
+	require.NoError(t, err)
+	require.Contains(t, hash, ",keyid=")
+	require.NoError(t, hasher.Check(pw, hash))
+	require.ErrorIs(t, unpeppered.Check(pw, hash), ErrPepperMismatch)
+	require.ErrorIs(t, NewArgon2idHasher(Argon2idParams{}, "other").Check(pw, hash), ErrPepperMismatch)
+
+	// the hashes created before the pepper was set are still checked, and
+	// rehashed with it
+	old, err := unpeppered.Hash(pw)
+	require.NoError(t, err)
+	require.NoError(t, hasher.Check(pw, old))
+	require.True(t, hasher.NeedsRehash(old))
+	require.False(t, hasher.NeedsRehash(hash))
+}
+
+func TestArgon2idInvalidHash(t *testing.T) {
+	hasher := NewArgon2idHasher(Argon2idParams{}, "")
+	for _, hash := range []string{
+		"",
+		"$argon2id$",
+		"$argon2i$v=19$m=19456,t=2,p=1$c2FsdA$a2V5",
+		"$argon2id$v=16$m=19456,t=2,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=19456,t=2$c2FsdA$a2V5",
+		"$argon2id$v=19$m=19456,t=2,p=1,x=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=19456,t=2,p=1$not base64!$a2V5",
+		"$argon2id$v=19$m=19456,t=2,p=1$c2FsdA$",
+	} {
+		require.ErrorIs(t, hasher.Check("password", hash), ErrInvalidHash, hash)
+		require.True(t, hasher.NeedsRehash(hash), hash)
+	}
+}
@@ -0,0 +1,59 @@
+package password
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// bcryptMaxLength is the number of bytes of a password bcrypt hashes; it
+// ignores the rest
+const bcryptMaxLength = 72
+
+// BcryptHasher hashes passwords with bcrypt. It is kept for the hashes of
+// older versions, which are rehashed with argon2id on login. The pepper is
+// not used, since those hashes were created without one.
+type BcryptHasher struct {
+	cost int
+}
+
+var _ Hasher = (*BcryptHasher)(nil)
+
+// NewBcryptHasher creates a BcryptHasher with cost, or bcrypt.DefaultCost if
+// zero
+func NewBcryptHasher(cost int) *BcryptHasher {
+	if cost == 0 {
+		cost = bcrypt.DefaultCost
+	}
+	return &BcryptHasher{cost: cost}
+}
+
+// Hash returns ErrPasswordTooLong for passwords over 72 bytes, instead of
+// hashing only their beginning
+func (h *BcryptHasher) Hash(password string) (string, error) {
+	if len(password) > bcryptMaxLength {
+		return "", ErrPasswordTooLong
+	}
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), h.cost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+	return string(hashed), nil
+}
+
+func (h *BcryptHasher) Check(password, hash string) error {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	switch {
+	case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
+		return ErrMismatchedPassword
+	case err != nil:
+		return fmt.Errorf("%w: %v", ErrInvalidHash, err)
+	}
+	return nil
+}
+
+func (h *BcryptHasher) NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost != h.cost
+}
@@ -0,0 +1,35 @@
+package password
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dpsigor/cheatsheet-golang-postgres/util"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestBcryptHasher(t *testing.T) {
+	hasher := NewBcryptHasher(bcrypt.MinCost)
+	pw := util.RandomString(6)
+
+	hs1, err := hasher.Hash(pw)
+	require.NoError(t, err)
+	require.NotEmpty(t, hs1)
+	require.Equal(t, Bcrypt, Algorithm(hs1))
+	require.NoError(t, hasher.Check(pw, hs1))
+	require.ErrorIs(t, hasher.Check(pw+"x", hs1), ErrMismatchedPassword)
+	require.ErrorIs(t, hasher.Check(pw, "not a hash"), ErrInvalidHash)
+
+	// The same pw creates different hashes, as the salt is randomized
+	hs2, err := hasher.Hash(pw)
+	require.NoError(t, err)
+	require.NotEqual(t, hs1, hs2)
+
+	require.False(t, hasher.NeedsRehash(hs1))
+	require.True(t, NewBcryptHasher(0).NeedsRehash(hs1))
+
+	// bcrypt would only hash the first 72 bytes
+	_, err = hasher.Hash(strings.Repeat("a", 73))
+	require.ErrorIs(t, err, ErrPasswordTooLong)
+}
@@ -0,0 +1,121 @@
+// Package password hashes the passwords of the users. New passwords are
+// hashed with argon2id by default, and the hashes record their algorithm and
+// parameters, so that the bcrypt hashes of older versions are still checked
+// and replaced once outdated.
+package password
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/dpsigor/cheatsheet-golang-postgres/util"
+)
+
+// Algorithms of the hashes, selected by PASSWORD_HASH_ALGORITHM
+const (
+	Argon2id = "argon2id"
+	Bcrypt   = "bcrypt"
+)
+
+var (
+	// ErrMismatchedPassword is returned when a password does not match a hash
+	ErrMismatchedPassword = errors.New("password does not match hash")
+	// ErrInvalidHash is returned for hashes that cannot be decoded, or were
+	// created by an unsupported algorithm
+	ErrInvalidHash = errors.New("invalid password hash")
+	// ErrPepperMismatch is returned for hashes created with another pepper
+	// than the one configured, which cannot be checked
+	ErrPepperMismatch = errors.New("password hash was created with another pepper")
+	// ErrPasswordTooLong is returned by bcrypt for passwords it would
+	// truncate
+	ErrPasswordTooLong = errors.New("password is too long")
+)
+
+// Hasher hashes passwords and checks them against their hashes
+type Hasher interface {
+	// Hash returns the hash of password, encoded with its algorithm and
+	// parameters
+	Hash(password string) (string, error)
+
+	// Check returns ErrMismatchedPassword unless hash is a hash of password
+	Check(password, hash string) error
+
+	// NeedsRehash reports whether hash was created by another algorithm or
+	// with other parameters than the ones of the hasher, so that it should
+	// be replaced once the password is known
+	NeedsRehash(hash string) bool
+}
+
+// Algorithm returns the algorithm of an encoded hash, or "" if it is not
+// supported
+func Algorithm(hash string) string {
+	switch {
+	case strings.HasPrefix(hash, "$argon2id$"):
+		return Argon2id
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		return Bcrypt
+	}
+	return ""
+}
+
+// multiHasher hashes passwords with the current algorithm and checks the
+// hashes of every algorithm
+type multiHasher struct {
+	current string
+	hashers map[string]Hasher
+}
+
+// NewHasher returns a Hasher creating hashes with the algorithm named, which
+// also checks the hashes of the other algorithms and reports that they need
+// to be rehashed
+func NewHasher(algorithm string, argon2id *Argon2idHasher, bcrypt *BcryptHasher) (Hasher, error) {
+	if algorithm == "" {
+		algorithm = Argon2id
+	}
+	h := &multiHasher{
+		current: algorithm,
+		hashers: map[string]Hasher{Argon2id: argon2id, Bcrypt: bcrypt},
+	}
+	if _, ok := h.hashers[algorithm]; !ok {
+		return nil, fmt.Errorf("unsupported password hash algorithm %q", algorithm)
+	}
+	return h, nil
+}
+
+// NewHasherFromConfig returns the Hasher set by the PASSWORD_* settings. The
+// parameters left unset take their defaults.
+func NewHasherFromConfig(config util.Config) (Hasher, error) {
+	argon2id := NewArgon2idHasher(Argon2idParams{
+		Memory:      config.PasswordArgon2Memory,
+		Iterations:  config.PasswordArgon2Iterations,
+		Parallelism: config.PasswordArgon2Parallelism,
+	}, config.PasswordPepper)
+	return NewHasher(config.PasswordHashAlgorithm, argon2id, NewBcryptHasher(config.PasswordBcryptCost))
+}
+
+// NewTestHasher returns the Hasher of the default settings, for the tests of
+// the packages hashing passwords. It panics if the hasher cannot be created.
+func NewTestHasher() Hasher {
+	h, err := NewHasherFromConfig(util.Config{})
+	if err != nil {
+		panic(fmt.Sprintf("cannot create password hasher: %v", err))
+	}
+	return h
+}
+
+func (h *multiHasher) Hash(password string) (string, error) {
+	return h.hashers[h.current].Hash(password)
+}
+
+func (h *multiHasher) Check(password, hash string) error {
+	hasher, ok := h.hashers[Algorithm(hash)]
+	if !ok {
+		return ErrInvalidHash
+	}
+	return hasher.Check(password, hash)
+}
+
+func (h *multiHasher) NeedsRehash(hash string) bool {
+	return Algorithm(hash) != h.current || h.hashers[h.current].NeedsRehash(hash)
+}
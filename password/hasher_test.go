@@ -0,0 +1,60 @@
+package password
+
+import (
+	"testing"
+
+	"github.com/dpsigor/cheatsheet-golang-postgres/util"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHasher(t *testing.T) {
+	hasher, err := NewHasherFromConfig(util.Config{})
+	require.NoError(t, err)
+	pw := util.RandomString(10)
+
+	hash, err := hasher.Hash(pw)
+	require.NoError(t, err)
+	require.Equal(t, Argon2id, Algorithm(hash))
+	require.NoError(t, hasher.Check(pw, hash))
+	require.False(t, hasher.NeedsRehash(hash))
+
+	// the bcrypt hashes of older versions are checked, and rehashed
+	legacy, err := NewBcryptHasher(bcrypt.MinCost).Hash(pw)
+	require.NoError(t, err)
+	require.NoError(t, hasher.Check(pw, legacy))
+	require.ErrorIs(t, hasher.Check(pw+"x", legacy), ErrMismatchedPassword)
+	require.True(t, hasher.NeedsRehash(legacy))
+
+	require.ErrorIs(t, hasher.Check(pw, "$unknown$hash"), ErrInvalidHash)
+	require.True(t, hasher.NeedsRehash("$unknown$hash"))
+}
+
+func TestHasherAlgorithm(t *testing.T) {
+	hasher, err := NewHasherFromConfig(util.Config{PasswordHashAlgorithm: Bcrypt, PasswordBcryptCost: bcrypt.MinCost})
+	require.NoError(t, err)
+	pw := util.RandomString(10)
+
+	hash, err := hasher.Hash(pw)
+	require.NoError(t, err)
+	require.Equal(t, Bcrypt, Algorithm(hash))
+	require.False(t, hasher.NeedsRehash(hash))
+
+	argon2idHash, err := NewArgon2idHasher(Argon2idParams{}, "").Hash(pw)
+	require.NoError(t, err)
+	require.NoError(t, hasher.Check(pw, argon2idHash))
+	require.True(t, hasher.NeedsRehash(argon2idHash))
+
+	_, err = NewHasherFromConfig(util.Config{PasswordHashAlgorithm: "md5"})
+	require.Error(t, err)
+}
+
+func TestNewTestHasher(t *testing.T) {
+	hasher := NewTestHasher()
+	pw := util.RandomString(10)
+
+	hash, err := hasher.Hash(pw)
+	require.NoError(t, err)
+	require.Equal(t, Argon2id, Algorithm(hash))
+	require.NoError(t, hasher.Check(pw, hash))
+}
@@ -0,0 +1,73 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+type bucket struct {
+	tokens    float64
+	updatedAt time.Time
+	// period is the period of the last policy applied to the bucket, after
+	// which the bucket is full again
+	period time.Duration
+}
+
+// MemoryLimiter keeps the buckets in memory. Each replica of the service
+// limits its own requests only.
+type MemoryLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+var _ Limiter = (*MemoryLimiter)(nil)
+
+// NewMemoryLimiter creates a MemoryLimiter with no bucket
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{
+		buckets: map[string]*bucket{},
+		now:     time.Now,
+	}
+}
+
+func (l *MemoryLimiter) Allow(ctx context.Context, key string, policy Policy) (Result, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(policy.Limit)}
+		l.buckets[key] = b
+	} else {
+		b.tokens = math.Min(float64(policy.Limit), b.tokens+now.Sub(b.updatedAt).Seconds()*policy.rate())
+	}
+	b.updatedAt = now
+	b.period = policy.Period
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	return newResult(policy, allowed, b.tokens), nil
+}
+
+// sweep deletes the buckets refilled since their last use, at most once per
+// sweepInterval
+func (l *MemoryLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if now.Sub(b.updatedAt) >= b.period {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// clock is a time source moved forward by tests
+type clock struct {
+	t time.Time
+}
+
+func (c *clock) now() time.Time { return c.t }
+
+func (c *clock) add(d time.Duration) { c.t = c.t.Add(d) }
+
+func TestMemoryLimiter(t *testing.T) {
+	c := &clock{t: time.Now()}
+	limiter := NewMemoryLimiter()
+	limiter.now = c.now
+	policy := Policy{Limit: 3, Period: time.Minute}
+	ctx := context.Background()
+
+	for remaining := 2; remaining >= 0; remaining-- {
+		r, err := limiter.Allow(ctx, "alice", policy)
+		require.NoError(t, err)
+		require.Equal(t, Result{Allowed: true, Remaining: remaining}, r)
+	}
+	r, err := limiter.Allow(ctx, "alice", policy)
+	require.NoError(t, err)
+	require.False(t, r.Allowed)
+	require.Equal(t, 20*time.Second, r.RetryAfter)
+
+	// other keys have their own bucket
+	r, err = limiter.Allow(ctx, "bob", policy)
+	require.NoError(t, err)
+	require.True(t, r.Allowed)
+
+	// a token is added every 20s
+	c.add(15 * time.Second)
+	r, err = limiter.Allow(ctx, "alice", policy)
+	require.NoError(t, err)
+	require.False(t, r.Allowed)
+	require.Equal(t, 5*time.Second, r.RetryAfter)
+	c.add(5 * time.Second)
+	r, err = limiter.Allow(ctx, "alice", policy)
+	require.NoError(t, err)
+	require.True(t, r.Allowed)
+	require.Zero(t, r.Remaining)
+
+	// the bucket holds no more than Limit tokens
+	c.add(time.Hour)
+	r, err = limiter.Allow(ctx, "alice", policy)
+	require.NoError(t, err)
+	require.Equal(t, Result{Allowed: true, Remaining: 2}, r)
+}
+
+func TestMemoryLimiterSweep(t *testing.T) {
+	c := &clock{t: time.Now()}
+	limiter := NewMemoryLimiter()
+	limiter.now = c.now
+	ctx := context.Background()
+
+	_, err := limiter.Allow(ctx, "short", Policy{Limit: 1, Period: time.Second})
+	require.NoError(t, err)
+	_, err = limiter.Allow(ctx, "long", Policy{Limit: 1, Period: time.Hour})
+	require.NoError(t, err)
+	require.Len(t, limiter.buckets, 2)
+
+	// the full buckets are deleted, the others are kept
+	c.add(sweepInterval)
+	_, err = limiter.Allow(ctx, "other", Policy{Limit: 1, Period: time.Second})
+	require.NoError(t, err)
+	require.Len(t, limiter.buckets, 2)
+	require.Contains(t, limiter.buckets, "long")
+	require.NotContains(t, limiter.buckets, "short")
+}
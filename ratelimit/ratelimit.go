@@ -0,0 +1,77 @@
+// Package ratelimit limits how often a key, such as a username or a client
+// IP, may be used, with a token bucket per key
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	db "github.com/dpsigor/cheatsheet-golang-postgres/db/sqlc"
+)
+
+// Backends of the limiter, selected by RATE_LIMIT_BACKEND
+const (
+	BackendMemory   = "memory"
+	BackendPostgres = "postgres"
+)
+
+// Policy allows Limit requests per Period. A key that was not used for a
+// while may send up to Limit requests at once.
+type Policy struct {
+	Limit  int
+	Period time.Duration
+}
+
+// Enabled reports whether the policy limits anything
+func (p Policy) Enabled() bool {
+	return p.Limit > 0 && p.Period > 0
+}
+
+// rate is the number of tokens added to a bucket per second
+func (p Policy) rate() float64 {
+	return float64(p.Limit) / p.Period.Seconds()
+}
+
+// Result is the outcome of a request to a Limiter
+type Result struct {
+	Allowed bool
+	// Remaining is the number of requests allowed right after this one
+	Remaining int
+	// RetryAfter is how long to wait before a token is available, when the
+	// request was not allowed
+	RetryAfter time.Duration
+}
+
+// newResult builds the Result of a bucket holding tokens after a request
+func newResult(p Policy, allowed bool, tokens float64) Result {
+	r := Result{Allowed: allowed, Remaining: int(math.Floor(tokens))}
+	if !allowed {
+		r.RetryAfter = time.Duration((1 - tokens) / p.rate() * float64(time.Second))
+	}
+	return r
+}
+
+// Limiter takes a token from the bucket of a key for every request
+type Limiter interface {
+	// Allow takes a token from the bucket of key, refilled according to
+	// policy, and reports whether there was one
+	Allow(ctx context.Context, key string, policy Policy) (Result, error)
+}
+
+// New creates the Limiter of backend. The postgres backend keeps its buckets
+// in store.
+func New(backend string, store db.Store) (Limiter, error) {
+	switch backend {
+	case "", BackendMemory:
+		return NewMemoryLimiter(), nil
+	case BackendPostgres:
+		return NewStoreLimiter(store), nil
+	}
+	return nil, fmt.Errorf("unsupported rate limit backend %q", backend)
+}
+
+// sweepInterval is how often the limiters delete the buckets that are full,
+// which do not need to be kept
+const sweepInterval = time.Minute
@@ -0,0 +1,67 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	db "github.com/dpsigor/cheatsheet-golang-postgres/db/sqlc"
+)
+
+// StoreLimiter keeps the buckets in the rate_limit_buckets table, so that
+// every replica of the service shares them
+type StoreLimiter struct {
+	store db.Store
+
+	mu        sync.Mutex
+	lastSweep time.Time
+	// maxPeriod is the longest period of the policies applied so far. A
+	// bucket not used for as long is full.
+	maxPeriod time.Duration
+	now       func() time.Time
+}
+
+var _ Limiter = (*StoreLimiter)(nil)
+
+// NewStoreLimiter creates a StoreLimiter keeping its buckets in store
+func NewStoreLimiter(store db.Store) *StoreLimiter {
+	return &StoreLimiter{store: store, now: time.Now}
+}
+
+func (l *StoreLimiter) Allow(ctx context.Context, key string, policy Policy) (Result, error) {
+	if err := l.sweep(ctx, policy); err != nil {
+		return Result{}, err
+	}
+	bucket, err := l.store.TakeRateLimitToken(ctx, db.TakeRateLimitTokenParams{
+		Key:   key,
+		Burst: float64(policy.Limit),
+		Rate:  policy.rate(),
+	})
+	if err != nil {
+		return Result{}, fmt.Errorf("cannot take rate limit token: %w", err)
+	}
+	return newResult(policy, bucket.Allowed, bucket.Tokens), nil
+}
+
+// sweep deletes the buckets not used for longer than the period of every
+// policy seen, at most once per sweepInterval
+func (l *StoreLimiter) sweep(ctx context.Context, policy Policy) error {
+	l.mu.Lock()
+	if policy.Period > l.maxPeriod {
+		l.maxPeriod = policy.Period
+	}
+	now := l.now()
+	if now.Sub(l.lastSweep) < sweepInterval {
+		l.mu.Unlock()
+		return nil
+	}
+	l.lastSweep = now
+	before := now.Add(-l.maxPeriod)
+	l.mu.Unlock()
+
+	if _, err := l.store.DeleteRateLimitBuckets(ctx, before); err != nil {
+		return fmt.Errorf("cannot delete rate limit buckets: %w", err)
+	}
+	return nil
+}
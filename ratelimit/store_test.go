@@ -0,0 +1,73 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	memdb "github.com/dpsigor/cheatsheet-golang-postgres/db/memory"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoreLimiter(t *testing.T) {
+	limiter := NewStoreLimiter(memdb.NewStore())
+	policy := Policy{Limit: 2, Period: time.Hour}
+	ctx := context.Background()
+
+	for remaining := 1; remaining >= 0; remaining-- {
+		r, err := limiter.Allow(ctx, "alice", policy)
+		require.NoError(t, err)
+		require.Equal(t, Result{Allowed: true, Remaining: remaining}, r)
+	}
+	r, err := limiter.Allow(ctx, "alice", policy)
+	require.NoError(t, err)
+	require.False(t, r.Allowed)
+	require.InDelta(t, 30*time.Minute, r.RetryAfter, float64(time.Second))
+
+	r, err = limiter.Allow(ctx, "bob", policy)
+	require.NoError(t, err)
+	require.True(t, r.Allowed)
+}
+
+func TestStoreLimiterSweep(t *testing.T) {
+	limiter := NewStoreLimiter(memdb.NewStore())
+	policy := Policy{Limit: 1, Period: time.Hour}
+	ctx := context.Background()
+
+	r, err := limiter.Allow(ctx, "alice", policy)
+	require.NoError(t, err)
+	require.True(t, r.Allowed)
+	r, err = limiter.Allow(ctx, "alice", policy)
+	require.NoError(t, err)
+	require.False(t, r.Allowed)
+
+	// once the period elapsed, the bucket is deleted rather than refilled
+	limiter.now = func() time.Time { return time.Now().Add(policy.Period + sweepInterval) }
+	r, err = limiter.Allow(ctx, "alice", Policy{Limit: 1, Period: time.Hour})
+	require.NoError(t, err)
+	require.True(t, r.Allowed)
+}
+
+func TestStoreLimiterCanceledContext(t *testing.T) {
+	limiter := NewStoreLimiter(memdb.NewStore())
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := limiter.Allow(ctx, "alice", Policy{Limit: 1, Period: time.Hour})
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestNew(t *testing.T) {
+	store := memdb.NewStore()
+	for _, backend := range []string{"", BackendMemory} {
+		limiter, err := New(backend, store)
+		require.NoError(t, err)
+		require.IsType(t, &MemoryLimiter{}, limiter)
+	}
+	limiter, err := New(BackendPostgres, store)
+	require.NoError(t, err)
+	require.IsType(t, &StoreLimiter{}, limiter)
+
+	_, err = New("redis", store)
+	require.EqualError(t, err, `unsupported rate limit backend "redis"`)
+}
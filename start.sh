@@ -1,10 +0,0 @@
-#!/bin/sh
-
-set -e
-
-echo "run db migration"
-/app/migrate -path /app/migration -database "$DB_SOURCE" -verbose up
-
-echo "start the app"
-
-exec "$@"
\ No newline at end of file
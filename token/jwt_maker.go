@@ -15,11 +15,12 @@ type JWTMaker struct {
 	secretKey string
 }
 
-// CreateToken creates a new token for a specific username and duration
-func (j *JWTMaker) CreateToken(username string, duration time.Duration) (string, error) {
+// CreateToken creates a new token for a specific username and duration,
+// restricted to the scopes, if any
+func (j *JWTMaker) CreateToken(username string, scopes []string, duration time.Duration) (string, error) {
 	var token string
 	var err error
-	payload, err := newPayload(username, duration)
+	payload, err := newPayload(username, scopes, duration)
 	if err != nil {
 		return token, err
 	}
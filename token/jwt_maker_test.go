@@ -13,6 +13,7 @@ func TestJWTToken(t *testing.T) {
 	var tests = []struct {
 		name        string
 		username    string
+		scopes      []string
 		duration    time.Duration
 		err         ErrToken
 		verifyToken func(t *testing.T, username string, issuedAt time.Time, expiresAt time.Time, duration time.Duration, payload *Payload, err error)
@@ -24,11 +25,23 @@ func TestJWTToken(t *testing.T) {
 			verifyToken: func(t *testing.T, username string, issuedAt time.Time, expiresAt time.Time, duration time.Duration, payload *Payload, err error) {
 				require.NoError(t, err)
 				require.Equal(t, username, payload.Username)
+				require.Empty(t, payload.Scopes)
 				require.NotEmpty(t, payload.ID)
 				require.WithinDuration(t, issuedAt, payload.IssuedAt, time.Millisecond)
 				require.WithinDuration(t, expiresAt, payload.ExpiresAt, time.Millisecond)
 			},
 		},
+		{
+			name:     "Scoped",
+			duration: time.Second,
+			username: util.RandomOwner(),
+			scopes:   []string{util.AccountsReadScope},
+			verifyToken: func(t *testing.T, username string, issuedAt time.Time, expiresAt time.Time, duration time.Duration, payload *Payload, err error) {
+				require.NoError(t, err)
+				require.Equal(t, username, payload.Username)
+				require.Equal(t, []string{util.AccountsReadScope}, payload.Scopes)
+			},
+		},
 		{
 			name:     "Expired",
 			duration: -time.Second,
@@ -44,7 +57,7 @@ func TestJWTToken(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			m, err := NewJWTMaker(util.RandomString(32))
 			require.NoError(t, err)
-			token, err := m.CreateToken(tt.username, tt.duration)
+			token, err := m.CreateToken(tt.username, tt.scopes, tt.duration)
 			require.NoError(t, err)
 
 			issuedAt := time.Now()
@@ -57,7 +70,7 @@ func TestJWTToken(t *testing.T) {
 }
 
 func TestInvalidJWTTokenAlgNone(t *testing.T) {
-	payload, err := newPayload(util.RandomOwner(), time.Minute)
+	payload, err := newPayload(util.RandomOwner(), nil, time.Minute)
 	require.NoError(t, err)
 
 	jwtToken := jwt.NewWithClaims(jwt.SigningMethodNone, payload)
@@ -11,13 +11,13 @@ import (
 
 // PasetoMaker is a PASETO Token maker
 type PasetoMaker struct {
-	key          paseto.V4SymmetricKey
-	symmetricKey []byte
+	key paseto.V4SymmetricKey
 }
 
-// CreateToken creates a new token for a specific username and duration
-func (p *PasetoMaker) CreateToken(username string, duration time.Duration) (string, error) {
-	payload, err := newPayload(username, duration)
+// CreateToken creates a new token for a specific username and duration,
+// restricted to the scopes, if any
+func (p *PasetoMaker) CreateToken(username string, scopes []string, duration time.Duration) (string, error) {
+	payload, err := newPayload(username, scopes, duration)
 	if err != nil {
 		return "", err
 	}
@@ -34,13 +34,18 @@ type pasetoClaim struct {
 
 // VerifyToken checks if the token is valid or not
 func (p *PasetoMaker) VerifyToken(token string) (*Payload, error) {
-	pasetoToken, err := paseto.NewParser().ParseV4Local(p.key, token, nil)
+	pasetoToken, err := paseto.NewParserWithoutExpiryCheck().ParseV4Local(p.key, token, nil)
 	if err != nil {
-		return nil, err
+		return nil, ErrInvalidToken
 	}
 	claim := pasetoClaim{}
 	err = json.Unmarshal(pasetoToken.ClaimsJSON(), &claim)
 	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	// expiration is checked on the payload so callers can tell an expired
+	// token apart from an invalid one
+	if err := claim.Payload.Valid(); err != nil {
 		return nil, err
 	}
 	return &claim.Payload, nil
@@ -51,9 +56,12 @@ func NewPasetoMaker(symmetricKey string) (Maker, error) {
 	if len(symmetricKey) != chacha20poly1305.KeySize {
 		return nil, fmt.Errorf("invalid key size: must be exactly %d characters", chacha20poly1305.KeySize)
 	}
-	maker := &PasetoMaker{
-		key:          paseto.NewV4SymmetricKey(),
-		symmetricKey: []byte(symmetricKey),
+	// the key is derived from the configured one, so tokens issued by the
+	// HTTP server are accepted by the gRPC server and every other process
+	// sharing the config
+	key, err := paseto.V4SymmetricKeyFromBytes([]byte(symmetricKey))
+	if err != nil {
+		return nil, fmt.Errorf("invalid key: %w", err)
 	}
-	return maker, nil
+	return &PasetoMaker{key: key}, nil
 }
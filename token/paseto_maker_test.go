@@ -13,10 +13,11 @@ func TestPaseto(t *testing.T) {
 	require.NoError(t, err)
 
 	username := util.RandomOwner()
+	scopes := []string{util.AccountsReadScope, util.UsersReadScope}
 	dur := time.Second
 	issuedAt := time.Now()
 	expiresAt := issuedAt.Add(dur)
-	token, err := m.CreateToken(username, dur)
+	token, err := m.CreateToken(username, scopes, dur)
 	require.NoError(t, err)
 	require.NotEmpty(t, token)
 
@@ -26,6 +27,47 @@ func TestPaseto(t *testing.T) {
 	require.NotEmpty(t, payload.ID)
 	require.NotEmpty(t, payload.ID)
 	require.Equal(t, username, payload.Username)
+	require.Equal(t, scopes, payload.Scopes)
 	require.WithinDuration(t, issuedAt, payload.IssuedAt, time.Millisecond)
 	require.WithinDuration(t, expiresAt, payload.ExpiresAt, time.Millisecond)
 }
+
+func TestExpiredPasetoToken(t *testing.T) {
+	m, err := NewPasetoMaker(util.RandomString(32))
+	require.NoError(t, err)
+
+	token, err := m.CreateToken(util.RandomOwner(), nil, -time.Minute)
+	require.NoError(t, err)
+	require.NotEmpty(t, token)
+
+	payload, err := m.VerifyToken(token)
+	require.EqualError(t, err, ErrExpiredToken.Error())
+	require.Nil(t, payload)
+}
+
+func TestInvalidPasetoToken(t *testing.T) {
+	m, err := NewPasetoMaker(util.RandomString(32))
+	require.NoError(t, err)
+
+	payload, err := m.VerifyToken("v4.local.invalid")
+	require.EqualError(t, err, ErrInvalidToken.Error())
+	require.Nil(t, payload)
+}
+
+func TestPasetoSharedKey(t *testing.T) {
+	key := util.RandomString(32)
+	issuer, err := NewPasetoMaker(key)
+	require.NoError(t, err)
+	verifier, err := NewPasetoMaker(key)
+	require.NoError(t, err)
+	other, err := NewPasetoMaker(util.RandomString(32))
+	require.NoError(t, err)
+
+	token, err := issuer.CreateToken(util.RandomOwner(), nil, time.Minute)
+	require.NoError(t, err)
+
+	_, err = verifier.VerifyToken(token)
+	require.NoError(t, err)
+	_, err = other.VerifyToken(token)
+	require.ErrorIs(t, err, ErrInvalidToken)
+}
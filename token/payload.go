@@ -18,14 +18,18 @@ var (
 
 // Payload contains the payload data of the token
 type Payload struct {
-	ID        uuid.UUID `json:"id"`
-	Username  string    `json:"username"`
+	ID       uuid.UUID `json:"id"`
+	Username string    `json:"username"`
+	// Scopes restrict the token to some of the permissions of the user. A
+	// token without scopes has all of them.
+	Scopes    []string  `json:"scopes,omitempty"`
 	IssuedAt  time.Time `json:"issued_at"`
 	ExpiresAt time.Time `json:"expires_at"`
 }
 
-// newPayload creates a new token payload with a specific username and duration
-func newPayload(username string, duration time.Duration) (*Payload, error) {
+// newPayload creates a new token payload with a specific username, scopes
+// and duration
+func newPayload(username string, scopes []string, duration time.Duration) (*Payload, error) {
 	tokenID, err := uuid.NewRandom()
 	if err != nil {
 		return nil, err
@@ -33,12 +37,27 @@ func newPayload(username string, duration time.Duration) (*Payload, error) {
 	payload := &Payload{
 		ID:        tokenID,
 		Username:  username,
+		Scopes:    scopes,
 		IssuedAt:  time.Now(),
 		ExpiresAt: time.Now().Add(duration),
 	}
 	return payload, nil
 }
 
+// HasScope returns true if the token grants the scope, which every token
+// without scopes does
+func (payload *Payload) HasScope(scope string) bool {
+	if len(payload.Scopes) == 0 {
+		return true
+	}
+	for _, s := range payload.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
 // Valid checks if the token payload is valid or not
 func (payload *Payload) Valid() error {
 	now := time.Now()
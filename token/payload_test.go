@@ -0,0 +1,20 @@
+package token
+
+import (
+	"testing"
+
+	"github.com/dpsigor/cheatsheet-golang-postgres/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPayloadHasScope(t *testing.T) {
+	unscoped := &Payload{}
+	for _, scope := range util.SupportedScopes() {
+		require.True(t, unscoped.HasScope(scope))
+	}
+
+	readOnly := &Payload{Scopes: []string{util.AccountsReadScope}}
+	require.True(t, readOnly.HasScope(util.AccountsReadScope))
+	require.False(t, readOnly.HasScope(util.TransfersWriteScope))
+	require.False(t, readOnly.HasScope(util.AccountsWriteScope))
+}
@@ -0,0 +1,435 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	db "github.com/dpsigor/cheatsheet-golang-postgres/db/sqlc"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/dpsigor/cheatsheet-golang-postgres/tracing")
+
+// Store is a db.Store decorator recording a span for every call. The spans
+// of the SQL statements run by the call are its children.
+type Store struct {
+	store db.Store
+}
+
+var _ db.Store = (*Store)(nil)
+
+// NewStore traces the calls to store
+func NewStore(store db.Store) *Store {
+	return &Store{store: store}
+}
+
+func traced[T any](ctx context.Context, method string, fn func(ctx context.Context) (T, error), attrs ...attribute.KeyValue) (T, error) {
+	ctx, span := tracer.Start(ctx, "Store."+method, trace.WithAttributes(attrs...))
+	defer span.End()
+
+	result, err := fn(ctx)
+	// a missing record is an expected outcome, answered to the client
+	if err != nil && !errors.Is(err, db.ErrRecordNotFound) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return result, err
+}
+
+func (s *Store) AddAccountBalance(ctx context.Context, arg db.AddAccountBalanceParams) (db.Account, error) {
+	return traced(ctx, "AddAccountBalance", func(ctx context.Context) (db.Account, error) {
+		return s.store.AddAccountBalance(ctx, arg)
+	}, attribute.Int64("account.id", arg.ID))
+}
+
+func (s *Store) CreateAPIKey(ctx context.Context, arg db.CreateAPIKeyParams) (db.APIKey, error) {
+	return traced(ctx, "CreateAPIKey", func(ctx context.Context) (db.APIKey, error) {
+		return s.store.CreateAPIKey(ctx, arg)
+	})
+}
+
+func (s *Store) CreateAccount(ctx context.Context, arg db.CreateAccountParams) (db.Account, error) {
+	return traced(ctx, "CreateAccount", func(ctx context.Context) (db.Account, error) {
+		return s.store.CreateAccount(ctx, arg)
+	}, attribute.String("account.currency", arg.Currency))
+}
+
+func (s *Store) CreateEntry(ctx context.Context, arg db.CreateEntryParams) (db.Entry, error) {
+	return traced(ctx, "CreateEntry", func(ctx context.Context) (db.Entry, error) {
+		return s.store.CreateEntry(ctx, arg)
+	}, attribute.Int64("account.id", arg.AccountID))
+}
+
+func (s *Store) CreateIdempotencyKey(ctx context.Context, arg db.CreateIdempotencyKeyParams) (db.IdempotencyKey, error) {
+	return traced(ctx, "CreateIdempotencyKey", func(ctx context.Context) (db.IdempotencyKey, error) {
+		return s.store.CreateIdempotencyKey(ctx, arg)
+	})
+}
+
+func (s *Store) CreateLoginAttempt(ctx context.Context, arg db.CreateLoginAttemptParams) (db.LoginAttempt, error) {
+	return traced(ctx, "CreateLoginAttempt", func(ctx context.Context) (db.LoginAttempt, error) {
+		return s.store.CreateLoginAttempt(ctx, arg)
+	}, attribute.Bool("login.success", arg.Success))
+}
+
+func (s *Store) CreateLoginChallenge(ctx context.Context, arg db.CreateLoginChallengeParams) (db.LoginChallenge, error) {
+	return traced(ctx, "CreateLoginChallenge", func(ctx context.Context) (db.LoginChallenge, error) {
+		return s.store.CreateLoginChallenge(ctx, arg)
+	})
+}
+
+func (s *Store) CreateOAuthAuthorizationCode(ctx context.Context, arg db.CreateOAuthAuthorizationCodeParams) (db.OAuthAuthorizationCode, error) {
+	return traced(ctx, "CreateOAuthAuthorizationCode", func(ctx context.Context) (db.OAuthAuthorizationCode, error) {
+		return s.store.CreateOAuthAuthorizationCode(ctx, arg)
+	})
+}
+
+func (s *Store) CreateOAuthClient(ctx context.Context, arg db.CreateOAuthClientParams) (db.OAuthClient, error) {
+	return traced(ctx, "CreateOAuthClient", func(ctx context.Context) (db.OAuthClient, error) {
+		return s.store.CreateOAuthClient(ctx, arg)
+	})
+}
+
+func (s *Store) CreateOAuthRefreshToken(ctx context.Context, arg db.CreateOAuthRefreshTokenParams) (db.OAuthRefreshToken, error) {
+	return traced(ctx, "CreateOAuthRefreshToken", func(ctx context.Context) (db.OAuthRefreshToken, error) {
+		return s.store.CreateOAuthRefreshToken(ctx, arg)
+	})
+}
+
+func (s *Store) CreatePasswordResetToken(ctx context.Context, arg db.CreatePasswordResetTokenParams) (db.PasswordResetToken, error) {
+	return traced(ctx, "CreatePasswordResetToken", func(ctx context.Context) (db.PasswordResetToken, error) {
+		return s.store.CreatePasswordResetToken(ctx, arg)
+	})
+}
+
+func (s *Store) CreateRecoveryCode(ctx context.Context, arg db.CreateRecoveryCodeParams) (db.RecoveryCode, error) {
+	return traced(ctx, "CreateRecoveryCode", func(ctx context.Context) (db.RecoveryCode, error) {
+		return s.store.CreateRecoveryCode(ctx, arg)
+	})
+}
+
+func (s *Store) CreateTransfer(ctx context.Context, arg db.CreateTransferParams) (db.Transfer, error) {
+	return traced(ctx, "CreateTransfer", func(ctx context.Context) (db.Transfer, error) {
+		return s.store.CreateTransfer(ctx, arg)
+	}, attribute.Int64("transfer.from_account_id", arg.FromAccountID), attribute.Int64("transfer.to_account_id", arg.ToAccountID))
+}
+
+func (s *Store) CreateUser(ctx context.Context, arg db.CreateUserParams) (db.User, error) {
+	return traced(ctx, "CreateUser", func(ctx context.Context) (db.User, error) {
+		return s.store.CreateUser(ctx, arg)
+	})
+}
+
+func (s *Store) CreateVerifyEmail(ctx context.Context, arg db.CreateVerifyEmailParams) (db.VerifyEmail, error) {
+	return traced(ctx, "CreateVerifyEmail", func(ctx context.Context) (db.VerifyEmail, error) {
+		return s.store.CreateVerifyEmail(ctx, arg)
+	})
+}
+
+func (s *Store) DeleteAPIKey(ctx context.Context, arg db.DeleteAPIKeyParams) (db.APIKey, error) {
+	return traced(ctx, "DeleteAPIKey", func(ctx context.Context) (db.APIKey, error) {
+		return s.store.DeleteAPIKey(ctx, arg)
+	})
+}
+
+func (s *Store) DeleteAccount(ctx context.Context, id int64) error {
+	_, err := traced(ctx, "DeleteAccount", func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, s.store.DeleteAccount(ctx, id)
+	}, attribute.Int64("account.id", id))
+	return err
+}
+
+func (s *Store) DeleteExpiredLoginChallenges(ctx context.Context, username string) error {
+	_, err := traced(ctx, "DeleteExpiredLoginChallenges", func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, s.store.DeleteExpiredLoginChallenges(ctx, username)
+	})
+	return err
+}
+
+func (s *Store) DeleteIdempotencyKey(ctx context.Context, arg db.DeleteIdempotencyKeyParams) error {
+	_, err := traced(ctx, "DeleteIdempotencyKey", func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, s.store.DeleteIdempotencyKey(ctx, arg)
+	})
+	return err
+}
+
+func (s *Store) DeleteLoginChallenge(ctx context.Context, id uuid.UUID) (db.LoginChallenge, error) {
+	return traced(ctx, "DeleteLoginChallenge", func(ctx context.Context) (db.LoginChallenge, error) {
+		return s.store.DeleteLoginChallenge(ctx, id)
+	})
+}
+
+func (s *Store) DeleteOAuthAuthorizationCode(ctx context.Context, hashedCode string) (db.OAuthAuthorizationCode, error) {
+	return traced(ctx, "DeleteOAuthAuthorizationCode", func(ctx context.Context) (db.OAuthAuthorizationCode, error) {
+		return s.store.DeleteOAuthAuthorizationCode(ctx, hashedCode)
+	})
+}
+
+func (s *Store) DeleteOAuthRefreshToken(ctx context.Context, hashedToken string) (db.OAuthRefreshToken, error) {
+	return traced(ctx, "DeleteOAuthRefreshToken", func(ctx context.Context) (db.OAuthRefreshToken, error) {
+		return s.store.DeleteOAuthRefreshToken(ctx, hashedToken)
+	})
+}
+
+func (s *Store) DeletePasswordResetToken(ctx context.Context, hashedToken string) (db.PasswordResetToken, error) {
+	return traced(ctx, "DeletePasswordResetToken", func(ctx context.Context) (db.PasswordResetToken, error) {
+		return s.store.DeletePasswordResetToken(ctx, hashedToken)
+	})
+}
+
+func (s *Store) DeletePasswordResetTokens(ctx context.Context, username string) error {
+	_, err := traced(ctx, "DeletePasswordResetTokens", func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, s.store.DeletePasswordResetTokens(ctx, username)
+	})
+	return err
+}
+
+func (s *Store) DeleteRateLimitBuckets(ctx context.Context, before time.Time) (int64, error) {
+	return traced(ctx, "DeleteRateLimitBuckets", func(ctx context.Context) (int64, error) {
+		return s.store.DeleteRateLimitBuckets(ctx, before)
+	})
+}
+
+func (s *Store) DeleteRecoveryCode(ctx context.Context, id int64) (int64, error) {
+	return traced(ctx, "DeleteRecoveryCode", func(ctx context.Context) (int64, error) {
+		return s.store.DeleteRecoveryCode(ctx, id)
+	})
+}
+
+func (s *Store) DeleteRecoveryCodes(ctx context.Context, username string) error {
+	_, err := traced(ctx, "DeleteRecoveryCodes", func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, s.store.DeleteRecoveryCodes(ctx, username)
+	})
+	return err
+}
+
+func (s *Store) EnableTOTP(ctx context.Context, arg db.EnableTOTPParams) (db.User, error) {
+	return traced(ctx, "EnableTOTP", func(ctx context.Context) (db.User, error) {
+		return s.store.EnableTOTP(ctx, arg)
+	})
+}
+
+func (s *Store) GetAPIKeyByPrefix(ctx context.Context, prefix string) (db.APIKey, error) {
+	return traced(ctx, "GetAPIKeyByPrefix", func(ctx context.Context) (db.APIKey, error) {
+		return s.store.GetAPIKeyByPrefix(ctx, prefix)
+	})
+}
+
+func (s *Store) GetAccount(ctx context.Context, id int64) (db.Account, error) {
+	return traced(ctx, "GetAccount", func(ctx context.Context) (db.Account, error) {
+		return s.store.GetAccount(ctx, id)
+	}, attribute.Int64("account.id", id))
+}
+
+func (s *Store) GetAccountForUpdate(ctx context.Context, id int64) (db.Account, error) {
+	return traced(ctx, "GetAccountForUpdate", func(ctx context.Context) (db.Account, error) {
+		return s.store.GetAccountForUpdate(ctx, id)
+	}, attribute.Int64("account.id", id))
+}
+
+func (s *Store) GetEntry(ctx context.Context, id int64) (db.Entry, error) {
+	return traced(ctx, "GetEntry", func(ctx context.Context) (db.Entry, error) {
+		return s.store.GetEntry(ctx, id)
+	}, attribute.Int64("entry.id", id))
+}
+
+func (s *Store) GetIdempotencyKey(ctx context.Context, arg db.GetIdempotencyKeyParams) (db.IdempotencyKey, error) {
+	return traced(ctx, "GetIdempotencyKey", func(ctx context.Context) (db.IdempotencyKey, error) {
+		return s.store.GetIdempotencyKey(ctx, arg)
+	})
+}
+
+func (s *Store) GetOAuthClient(ctx context.Context, id string) (db.OAuthClient, error) {
+	return traced(ctx, "GetOAuthClient", func(ctx context.Context) (db.OAuthClient, error) {
+		return s.store.GetOAuthClient(ctx, id)
+	})
+}
+
+func (s *Store) GetPasswordChangedAt(ctx context.Context, username string) (time.Time, error) {
+	return traced(ctx, "GetPasswordChangedAt", func(ctx context.Context) (time.Time, error) {
+		return s.store.GetPasswordChangedAt(ctx, username)
+	})
+}
+
+func (s *Store) GetTransfer(ctx context.Context, id int64) (db.Transfer, error) {
+	return traced(ctx, "GetTransfer", func(ctx context.Context) (db.Transfer, error) {
+		return s.store.GetTransfer(ctx, id)
+	}, attribute.Int64("transfer.id", id))
+}
+
+func (s *Store) GetUser(ctx context.Context, username string) (db.User, error) {
+	return traced(ctx, "GetUser", func(ctx context.Context) (db.User, error) {
+		return s.store.GetUser(ctx, username)
+	})
+}
+
+func (s *Store) GetUserByEmail(ctx context.Context, email string) (db.User, error) {
+	return traced(ctx, "GetUserByEmail", func(ctx context.Context) (db.User, error) {
+		return s.store.GetUserByEmail(ctx, email)
+	})
+}
+
+func (s *Store) IsEmailVerified(ctx context.Context, username string) (bool, error) {
+	return traced(ctx, "IsEmailVerified", func(ctx context.Context) (bool, error) {
+		return s.store.IsEmailVerified(ctx, username)
+	})
+}
+
+func (s *Store) ListAPIKeys(ctx context.Context, username string) ([]db.APIKey, error) {
+	return traced(ctx, "ListAPIKeys", func(ctx context.Context) ([]db.APIKey, error) {
+		return s.store.ListAPIKeys(ctx, username)
+	})
+}
+
+func (s *Store) ListAccounts(ctx context.Context, arg db.ListAccountsParams) ([]db.Account, error) {
+	return traced(ctx, "ListAccounts", func(ctx context.Context) ([]db.Account, error) {
+		return s.store.ListAccounts(ctx, arg)
+	})
+}
+
+func (s *Store) ListEntries(ctx context.Context, arg db.ListEntriesParams) ([]db.Entry, error) {
+	return traced(ctx, "ListEntries", func(ctx context.Context) ([]db.Entry, error) {
+		return s.store.ListEntries(ctx, arg)
+	}, attribute.Int64("account.id", arg.AccountID))
+}
+
+func (s *Store) ListLoginAttempts(ctx context.Context, arg db.ListLoginAttemptsParams) ([]db.LoginAttempt, error) {
+	return traced(ctx, "ListLoginAttempts", func(ctx context.Context) ([]db.LoginAttempt, error) {
+		return s.store.ListLoginAttempts(ctx, arg)
+	})
+}
+
+func (s *Store) ListRecoveryCodes(ctx context.Context, username string) ([]db.RecoveryCode, error) {
+	return traced(ctx, "ListRecoveryCodes", func(ctx context.Context) ([]db.RecoveryCode, error) {
+		return s.store.ListRecoveryCodes(ctx, username)
+	})
+}
+
+func (s *Store) ListTransfers(ctx context.Context, arg db.ListTransfersParams) ([]db.Transfer, error) {
+	return traced(ctx, "ListTransfers", func(ctx context.Context) ([]db.Transfer, error) {
+		return s.store.ListTransfers(ctx, arg)
+	}, attribute.Int64("transfer.from_account_id", arg.FromAccountID), attribute.Int64("transfer.to_account_id", arg.ToAccountID))
+}
+
+func (s *Store) RecordFailedLogin(ctx context.Context, arg db.RecordFailedLoginParams) (db.User, error) {
+	return traced(ctx, "RecordFailedLogin", func(ctx context.Context) (db.User, error) {
+		return s.store.RecordFailedLogin(ctx, arg)
+	})
+}
+
+func (s *Store) RehashUserPassword(ctx context.Context, arg db.RehashUserPasswordParams) error {
+	_, err := traced(ctx, "RehashUserPassword", func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, s.store.RehashUserPassword(ctx, arg)
+	})
+	return err
+}
+
+func (s *Store) ResetFailedLogins(ctx context.Context, username string) error {
+	_, err := traced(ctx, "ResetFailedLogins", func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, s.store.ResetFailedLogins(ctx, username)
+	})
+	return err
+}
+
+func (s *Store) SetAccountFrozen(ctx context.Context, arg db.SetAccountFrozenParams) (db.Account, error) {
+	return traced(ctx, "SetAccountFrozen", func(ctx context.Context) (db.Account, error) {
+		return s.store.SetAccountFrozen(ctx, arg)
+	}, attribute.Int64("account.id", arg.ID))
+}
+
+func (s *Store) SetIdempotencyKeyResponse(ctx context.Context, arg db.SetIdempotencyKeyResponseParams) error {
+	_, err := traced(ctx, "SetIdempotencyKeyResponse", func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, s.store.SetIdempotencyKeyResponse(ctx, arg)
+	})
+	return err
+}
+
+func (s *Store) SetTOTPSecret(ctx context.Context, arg db.SetTOTPSecretParams) (db.User, error) {
+	return traced(ctx, "SetTOTPSecret", func(ctx context.Context) (db.User, error) {
+		return s.store.SetTOTPSecret(ctx, arg)
+	})
+}
+
+func (s *Store) TakeRateLimitToken(ctx context.Context, arg db.TakeRateLimitTokenParams) (db.RateLimitBucket, error) {
+	return traced(ctx, "TakeRateLimitToken", func(ctx context.Context) (db.RateLimitBucket, error) {
+		return s.store.TakeRateLimitToken(ctx, arg)
+	})
+}
+
+func (s *Store) TouchAPIKey(ctx context.Context, arg db.TouchAPIKeyParams) error {
+	_, err := traced(ctx, "TouchAPIKey", func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, s.store.TouchAPIKey(ctx, arg)
+	})
+	return err
+}
+
+func (s *Store) UpdateAccount(ctx context.Context, arg db.UpdateAccountParams) (db.Account, error) {
+	return traced(ctx, "UpdateAccount", func(ctx context.Context) (db.Account, error) {
+		return s.store.UpdateAccount(ctx, arg)
+	}, attribute.Int64("account.id", arg.ID))
+}
+
+func (s *Store) UpdateUser(ctx context.Context, arg db.UpdateUserParams) (db.User, error) {
+	return traced(ctx, "UpdateUser", func(ctx context.Context) (db.User, error) {
+		return s.store.UpdateUser(ctx, arg)
+	})
+}
+
+func (s *Store) UpdateUserPassword(ctx context.Context, arg db.UpdateUserPasswordParams) (db.User, error) {
+	return traced(ctx, "UpdateUserPassword", func(ctx context.Context) (db.User, error) {
+		return s.store.UpdateUserPassword(ctx, arg)
+	})
+}
+
+func (s *Store) UpdateUserRole(ctx context.Context, arg db.UpdateUserRoleParams) (db.User, error) {
+	return traced(ctx, "UpdateUserRole", func(ctx context.Context) (db.User, error) {
+		return s.store.UpdateUserRole(ctx, arg)
+	})
+}
+
+func (s *Store) UseTOTPStep(ctx context.Context, arg db.UseTOTPStepParams) (int64, error) {
+	return traced(ctx, "UseTOTPStep", func(ctx context.Context) (int64, error) {
+		return s.store.UseTOTPStep(ctx, arg)
+	})
+}
+
+func (s *Store) UseVerifyEmail(ctx context.Context, hashedToken string) (db.VerifyEmail, error) {
+	return traced(ctx, "UseVerifyEmail", func(ctx context.Context) (db.VerifyEmail, error) {
+		return s.store.UseVerifyEmail(ctx, hashedToken)
+	})
+}
+
+func (s *Store) VerifyUserEmail(ctx context.Context, arg db.VerifyUserEmailParams) (db.User, error) {
+	return traced(ctx, "VerifyUserEmail", func(ctx context.Context) (db.User, error) {
+		return s.store.VerifyUserEmail(ctx, arg)
+	})
+}
+
+func (s *Store) TransferTx(ctx context.Context, arg db.TransferTxParams) (db.TransferTxResult, error) {
+	return traced(ctx, "TransferTx", func(ctx context.Context) (db.TransferTxResult, error) {
+		return s.store.TransferTx(ctx, arg)
+	}, attribute.Int64("transfer.from_account_id", arg.FromAccountID), attribute.Int64("transfer.to_account_id", arg.ToAccountID))
+}
+
+func (s *Store) EnableTOTPTx(ctx context.Context, arg db.EnableTOTPTxParams) (db.EnableTOTPTxResult, error) {
+	return traced(ctx, "EnableTOTPTx", func(ctx context.Context) (db.EnableTOTPTxResult, error) {
+		return s.store.EnableTOTPTx(ctx, arg)
+	})
+}
+
+func (s *Store) ChangePasswordTx(ctx context.Context, arg db.ChangePasswordTxParams) (db.User, error) {
+	return traced(ctx, "ChangePasswordTx", func(ctx context.Context) (db.User, error) {
+		return s.store.ChangePasswordTx(ctx, arg)
+	})
+}
+
+func (s *Store) VerifyEmailTx(ctx context.Context, arg db.VerifyEmailTxParams) (db.VerifyEmailTxResult, error) {
+	return traced(ctx, "VerifyEmailTx", func(ctx context.Context) (db.VerifyEmailTxResult, error) {
+		return s.store.VerifyEmailTx(ctx, arg)
+	})
+}
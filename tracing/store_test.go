@@ -0,0 +1,66 @@
+package tracing
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	mockdb "github.com/dpsigor/cheatsheet-golang-postgres/db/mock"
+	db "github.com/dpsigor/cheatsheet-golang-postgres/db/sqlc"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+var recorder = tracetest.NewSpanRecorder()
+
+func TestMain(m *testing.M) {
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	os.Exit(m.Run())
+}
+
+func TestStore(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mock := mockdb.NewMockStore(ctrl)
+	store := NewStore(mock)
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "parent")
+	mock.EXPECT().
+		GetAccount(gomock.Any(), int64(1)).
+		Times(1).
+		DoAndReturn(func(ctx context.Context, id int64) (db.Account, error) {
+			// the statements of the call are children of its span
+			_, child := otel.Tracer("test").Start(ctx, "sql GetAccount")
+			child.End()
+			return db.Account{}, db.ErrRecordNotFound
+		})
+	mock.EXPECT().
+		TransferTx(gomock.Any(), gomock.Any()).
+		Times(1).
+		Return(db.TransferTxResult{}, db.ErrTxConflict)
+
+	_, err := store.GetAccount(ctx, 1)
+	require.ErrorIs(t, err, db.ErrRecordNotFound)
+	_, err = store.TransferTx(ctx, db.TransferTxParams{FromAccountID: 1, ToAccountID: 2})
+	require.ErrorIs(t, err, db.ErrTxConflict)
+	parent.End()
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+
+	getAccount := spans["Store.GetAccount"]
+	require.NotNil(t, getAccount)
+	require.Equal(t, parent.SpanContext().SpanID(), getAccount.Parent().SpanID())
+	require.Equal(t, codes.Unset, getAccount.Status().Code)
+	require.Equal(t, getAccount.SpanContext().SpanID(), spans["sql GetAccount"].Parent().SpanID())
+
+	transferTx := spans["Store.TransferTx"]
+	require.NotNil(t, transferTx)
+	require.Equal(t, codes.Error, transferTx.Status().Code)
+	require.NotEmpty(t, transferTx.Events())
+}
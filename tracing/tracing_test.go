@@ -0,0 +1,31 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dpsigor/cheatsheet-golang-postgres/util"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+)
+
+func TestSetup(t *testing.T) {
+	// Setup replaces the global provider used by the other tests
+	provider := otel.GetTracerProvider()
+	t.Cleanup(func() { otel.SetTracerProvider(provider) })
+
+	for _, exporter := range []string{"", ExporterNone, ExporterStdout} {
+		shutdown, err := Setup(context.Background(), util.Config{TraceExporter: exporter})
+		require.NoError(t, err, exporter)
+		require.NoError(t, shutdown(context.Background()), exporter)
+	}
+
+	_, err := Setup(context.Background(), util.Config{TraceExporter: "jaeger"})
+	require.EqualError(t, err, `unsupported trace exporter "jaeger"`)
+}
+
+func TestQueryNameFormatter(t *testing.T) {
+	formatter := queryNameFormatter{}
+	require.Equal(t, "sql GetAccount", formatter.Format(context.Background(), "sql.conn.query", "-- name: GetAccount :one\nSELECT 1"))
+	require.Equal(t, "sql.conn.begin_tx", formatter.Format(context.Background(), "sql.conn.begin_tx", ""))
+}
@@ -9,11 +9,52 @@ import (
 // Config stores all configuration of the application
 // The values are read by viper from a config file or env variables
 type Config struct {
-	DBDriver            string        `mapstructure:"DB_DRIVER"`
-	DBSource            string        `mapstructure:"DB_SOURCE"`
-	ServerAddress       string        `mapstructure:"SERVER_ADDRESS"`
-	TokenSymmetricKey   string        `mapstructure:"TOKEN_SYMMETRIC_KEY"`
-	AccessTokenDuration time.Duration `mapstructure:"ACCESS_TOKEN_DURATION"`
+	DBDriver                     string        `mapstructure:"DB_DRIVER"`
+	DBSource                     string        `mapstructure:"DB_SOURCE"`
+	AutoMigrate                  bool          `mapstructure:"AUTO_MIGRATE"`
+	ServerAddress                string        `mapstructure:"SERVER_ADDRESS"`
+	GRPCServerAddress            string        `mapstructure:"GRPC_SERVER_ADDRESS"`
+	TokenSymmetricKey            string        `mapstructure:"TOKEN_SYMMETRIC_KEY"`
+	AccessTokenDuration          time.Duration `mapstructure:"ACCESS_TOKEN_DURATION"`
+	HTTPReadTimeout              time.Duration `mapstructure:"HTTP_READ_TIMEOUT"`
+	HTTPWriteTimeout             time.Duration `mapstructure:"HTTP_WRITE_TIMEOUT"`
+	HTTPIdleTimeout              time.Duration `mapstructure:"HTTP_IDLE_TIMEOUT"`
+	ShutdownTimeout              time.Duration `mapstructure:"SHUTDOWN_TIMEOUT"`
+	LogLevel                     string        `mapstructure:"LOG_LEVEL"`
+	TraceExporter                string        `mapstructure:"TRACE_EXPORTER"`
+	OTLPEndpoint                 string        `mapstructure:"OTLP_ENDPOINT"`
+	TrustedProxies               []string      `mapstructure:"TRUSTED_PROXIES"`
+	RateLimitBackend             string        `mapstructure:"RATE_LIMIT_BACKEND"`
+	LoginRateLimit               int           `mapstructure:"LOGIN_RATE_LIMIT"`
+	LoginRateLimitPeriod         time.Duration `mapstructure:"LOGIN_RATE_LIMIT_PERIOD"`
+	TransferRateLimit            int           `mapstructure:"TRANSFER_RATE_LIMIT"`
+	TransferRateLimitPeriod      time.Duration `mapstructure:"TRANSFER_RATE_LIMIT_PERIOD"`
+	PasswordResetRateLimit       int           `mapstructure:"PASSWORD_RESET_RATE_LIMIT"`
+	PasswordResetRateLimitPeriod time.Duration `mapstructure:"PASSWORD_RESET_RATE_LIMIT_PERIOD"`
+	VerifyEmailRateLimit         int           `mapstructure:"VERIFY_EMAIL_RATE_LIMIT"`
+	VerifyEmailRateLimitPeriod   time.Duration `mapstructure:"VERIFY_EMAIL_RATE_LIMIT_PERIOD"`
+	OAuthTokenRateLimit          int           `mapstructure:"OAUTH_TOKEN_RATE_LIMIT"`
+	OAuthTokenRateLimitPeriod    time.Duration `mapstructure:"OAUTH_TOKEN_RATE_LIMIT_PERIOD"`
+	LoginMaxFailedAttempts       int           `mapstructure:"LOGIN_MAX_FAILED_ATTEMPTS"`
+	LoginLockoutDuration         time.Duration `mapstructure:"LOGIN_LOCKOUT_DURATION"`
+	LoginMaxLockoutDuration      time.Duration `mapstructure:"LOGIN_MAX_LOCKOUT_DURATION"`
+	TransferStepUpAmount         int64         `mapstructure:"TRANSFER_STEP_UP_AMOUNT"`
+	MailBackend                  string        `mapstructure:"MAIL_BACKEND"`
+	MailDir                      string        `mapstructure:"MAIL_DIR"`
+	MailFrom                     string        `mapstructure:"MAIL_FROM"`
+	PasswordResetURL             string        `mapstructure:"PASSWORD_RESET_URL"`
+	EmailVerificationURL         string        `mapstructure:"EMAIL_VERIFICATION_URL"`
+	PasswordHashAlgorithm        string        `mapstructure:"PASSWORD_HASH_ALGORITHM"`
+	PasswordPepper               string        `mapstructure:"PASSWORD_PEPPER"`
+	PasswordArgon2Memory         uint32        `mapstructure:"PASSWORD_ARGON2_MEMORY"`
+	PasswordArgon2Iterations     uint32        `mapstructure:"PASSWORD_ARGON2_ITERATIONS"`
+	PasswordArgon2Parallelism    uint8         `mapstructure:"PASSWORD_ARGON2_PARALLELISM"`
+	PasswordBcryptCost           int           `mapstructure:"PASSWORD_BCRYPT_COST"`
+	PasswordMinLength            int           `mapstructure:"PASSWORD_MIN_LENGTH"`
+	PasswordMaxLength            int           `mapstructure:"PASSWORD_MAX_LENGTH"`
+	PasswordMinCharacterClasses  int           `mapstructure:"PASSWORD_MIN_CHARACTER_CLASSES"`
+	PasswordAllowUserInputs      bool          `mapstructure:"PASSWORD_ALLOW_USER_INPUTS"`
+	PasswordAllowCommon          bool          `mapstructure:"PASSWORD_ALLOW_COMMON"`
 }
 
 // LoadConfig reads configuration from file or environment variables
@@ -9,6 +9,11 @@ const (
 	CAD = "CAD"
 )
 
+// SupportedCurrencies returns all the currencies accepted by the bank
+func SupportedCurrencies() []string {
+	return []string{USD, EUR, CAD}
+}
+
 // IsSupportedCurrency returns true if the currency is supported
 func IsSupportedCurrency(currency string) bool {
 	switch currency {
@@ -40,7 +40,7 @@ func RandomMoney() int64 {
 
 // RandomCurrency generates a random currency
 func RandomCurrency() string {
-	currencies := []string{EUR, USD, CAD}
+	currencies := SupportedCurrencies()
 	return currencies[rand.Intn(len(currencies))]
 }
 
@@ -0,0 +1,22 @@
+package util
+
+const (
+	// DepositorRole is the role of the customers of the bank
+	DepositorRole = "depositor"
+	// BankerRole is the role of the staff of the bank
+	BankerRole = "banker"
+)
+
+// SupportedRoles returns all the roles a user can have
+func SupportedRoles() []string {
+	return []string{DepositorRole, BankerRole}
+}
+
+// IsSupportedRole returns true if the role is supported
+func IsSupportedRole(role string) bool {
+	switch role {
+	case DepositorRole, BankerRole:
+		return true
+	}
+	return false
+}
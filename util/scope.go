@@ -0,0 +1,44 @@
+package util
+
+// Scopes restrict a token or an API key to part of the permissions of its
+// user
+const (
+	// UsersReadScope reads the profile and the login attempts of the user
+	UsersReadScope = "users:read"
+	// UsersWriteScope changes the profile, password and credentials of the
+	// user
+	UsersWriteScope = "users:write"
+	// AccountsReadScope reads the accounts of the user
+	AccountsReadScope = "accounts:read"
+	// AccountsWriteScope creates accounts
+	AccountsWriteScope = "accounts:write"
+	// TransfersWriteScope moves money out of the accounts of the user
+	TransfersWriteScope = "transfers:write"
+)
+
+// SupportedScopes returns all the scopes of tokens and API keys
+func SupportedScopes() []string {
+	return []string{UsersReadScope, UsersWriteScope, AccountsReadScope, AccountsWriteScope, TransfersWriteScope}
+}
+
+// IsSupportedScope returns true if the scope is supported
+func IsSupportedScope(scope string) bool {
+	switch scope {
+	case UsersReadScope, UsersWriteScope, AccountsReadScope, AccountsWriteScope, TransfersWriteScope:
+		return true
+	}
+	return false
+}
+
+// OAuthScopes returns the scopes third-party OAuth clients may be granted.
+// UsersWriteScope is left out, so that a client cannot change the
+// credentials of the user nor consent in their name.
+func OAuthScopes() []string {
+	return []string{UsersReadScope, AccountsReadScope, AccountsWriteScope, TransfersWriteScope}
+}
+
+// IsOAuthScope returns true if third-party OAuth clients may be granted the
+// scope
+func IsOAuthScope(scope string) bool {
+	return scope != UsersWriteScope && IsSupportedScope(scope)
+}
@@ -0,0 +1,171 @@
+package val
+
+import (
+	_ "embed"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/dpsigor/cheatsheet-golang-postgres/util"
+)
+
+// Rules of a PasswordPolicy, reported by PasswordViolation.Rule
+const (
+	PasswordLengthRule           = "password_length"
+	PasswordMaxLengthRule        = "password_max_length"
+	PasswordCharacterClassesRule = "password_character_classes"
+	PasswordUserInputRule        = "password_user_input"
+	PasswordCommonRule           = "password_common"
+)
+
+// minUserInputLength is the length under which a username or email is not
+// searched in the password, since nearly every password would contain it
+const minUserInputLength = 3
+
+// DefaultPasswordPolicy follows NIST SP 800-63B: a minimum length and a
+// blocklist, rather than composition rules
+var DefaultPasswordPolicy = PasswordPolicy{
+	MinLength:        8,
+	MaxLength:        128,
+	RejectUserInputs: true,
+	RejectCommon:     true,
+}
+
+//go:embed common_passwords.txt
+var commonPasswordsFile string
+
+// commonPasswords are passwords found the most in breaches, in lowercase
+var commonPasswords = func() map[string]struct{} {
+	passwords := make(map[string]struct{})
+	for _, line := range strings.Split(commonPasswordsFile, "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			passwords[strings.ToLower(line)] = struct{}{}
+		}
+	}
+	return passwords
+}()
+
+// PasswordPolicy is the policy of the passwords users choose. It is not
+// applied to logins, so that users keep the passwords set under an older
+// policy.
+type PasswordPolicy struct {
+	MinLength int
+	// MaxLength is the number of bytes a password may have, which bounds
+	// the cost of hashing it. Zero sets no limit.
+	MaxLength int
+	// MinCharacterClasses is the number of classes, among lowercase letters,
+	// uppercase letters, digits and symbols, the password must mix
+	MinCharacterClasses int
+	// RejectUserInputs rejects passwords containing the username or the
+	// local part of the email of the user
+	RejectUserInputs bool
+	// RejectCommon rejects the passwords of a bundled list of the most
+	// common breached passwords
+	RejectCommon bool
+}
+
+// PasswordPolicyFromConfig returns the policy set by the PASSWORD_MIN_LENGTH,
+// PASSWORD_MAX_LENGTH, PASSWORD_MIN_CHARACTER_CLASSES,
+// PASSWORD_ALLOW_USER_INPUTS and PASSWORD_ALLOW_COMMON settings. The minimum
+// length is never lower than MinPasswordLength, which logins check.
+func PasswordPolicyFromConfig(config util.Config) PasswordPolicy {
+	policy := PasswordPolicy{
+		MinLength:           config.PasswordMinLength,
+		MaxLength:           config.PasswordMaxLength,
+		MinCharacterClasses: config.PasswordMinCharacterClasses,
+		RejectUserInputs:    !config.PasswordAllowUserInputs,
+		RejectCommon:        !config.PasswordAllowCommon,
+	}
+	if policy.MinLength == 0 {
+		policy.MinLength = DefaultPasswordPolicy.MinLength
+	}
+	if policy.MinLength < MinPasswordLength {
+		policy.MinLength = MinPasswordLength
+	}
+	if policy.MaxLength == 0 {
+		policy.MaxLength = DefaultPasswordPolicy.MaxLength
+	}
+	return policy
+}
+
+// PasswordUser is what is known of the user choosing a password, which the
+// password must not contain. Fields may be empty.
+type PasswordUser struct {
+	Username string
+	Email    string
+}
+
+// PasswordViolation is a rule of a PasswordPolicy a password breaks, with the
+// parameter of the rule, if any
+type PasswordViolation struct {
+	Rule  string
+	Param string
+}
+
+// Error describes the violation as the other validation errors of a field do
+func (v PasswordViolation) Error() string {
+	switch v.Rule {
+	case PasswordLengthRule:
+		return fmt.Sprintf("must contain at least %s characters", v.Param)
+	case PasswordMaxLengthRule:
+		return fmt.Sprintf("must contain at most %s bytes", v.Param)
+	case PasswordCharacterClassesRule:
+		return fmt.Sprintf("must mix at least %s of lowercase letters, uppercase letters, digits and symbols", v.Param)
+	case PasswordUserInputRule:
+		return fmt.Sprintf("must not contain the %s", v.Param)
+	case PasswordCommonRule:
+		return "is too common, having been found in data breaches"
+	}
+	return fmt.Sprintf("failed on the '%s' rule", v.Rule)
+}
+
+// Check returns every rule of the policy the password of user breaks, or nil
+func (p PasswordPolicy) Check(password string, user PasswordUser) (violations []PasswordViolation) {
+	if utf8.RuneCountInString(password) < p.MinLength {
+		violations = append(violations, PasswordViolation{Rule: PasswordLengthRule, Param: strconv.Itoa(p.MinLength)})
+	}
+	if p.MaxLength > 0 && len(password) > p.MaxLength {
+		violations = append(violations, PasswordViolation{Rule: PasswordMaxLengthRule, Param: strconv.Itoa(p.MaxLength)})
+	}
+	if characterClasses(password) < p.MinCharacterClasses {
+		violations = append(violations, PasswordViolation{Rule: PasswordCharacterClassesRule, Param: strconv.Itoa(p.MinCharacterClasses)})
+	}
+	if p.RejectUserInputs {
+		lower := strings.ToLower(password)
+		localPart, _, _ := strings.Cut(user.Email, "@")
+		for _, input := range []struct{ name, value string }{
+			{"username", user.Username},
+			{"email", localPart},
+		} {
+			if utf8.RuneCountInString(input.value) >= minUserInputLength && strings.Contains(lower, strings.ToLower(input.value)) {
+				violations = append(violations, PasswordViolation{Rule: PasswordUserInputRule, Param: input.name})
+			}
+		}
+	}
+	if p.RejectCommon {
+		if _, ok := commonPasswords[strings.ToLower(password)]; ok {
+			violations = append(violations, PasswordViolation{Rule: PasswordCommonRule})
+		}
+	}
+	return violations
+}
+
+// characterClasses counts the classes of characters the password mixes
+func characterClasses(password string) int {
+	var lower, upper, digit, symbol int
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			symbol = 1
+		}
+	}
+	return lower + upper + digit + symbol
+}
@@ -0,0 +1,65 @@
+package val
+
+import (
+	"testing"
+
+	"github.com/dpsigor/cheatsheet-golang-postgres/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPasswordPolicyCheck(t *testing.T) {
+	policy := PasswordPolicy{MinLength: 8, MaxLength: 32, MinCharacterClasses: 3, RejectUserInputs: true, RejectCommon: true}
+	user := PasswordUser{Username: "johndoe", Email: "jdoe1984@example.com"}
+
+	testCases := []struct {
+		name       string
+		password   string
+		violations []PasswordViolation
+	}{
+		{"OK", "Correct-Horse-Battery", nil},
+		{"TooShort", "Ab1-", []PasswordViolation{{Rule: PasswordLengthRule, Param: "8"}}},
+		{"TooLong", "Correct-Horse-Battery-Staple-1234", []PasswordViolation{{Rule: PasswordMaxLengthRule, Param: "32"}}},
+		// the maximum is in bytes, which hashes are bounded by
+		{"TooLongBytes", "Correct-Horse-Battery-Stäple-123", []PasswordViolation{{Rule: PasswordMaxLengthRule, Param: "32"}}},
+		{"TooFewClasses", "correcthorsebattery", []PasswordViolation{{Rule: PasswordCharacterClassesRule, Param: "3"}}},
+		{"Username", "My-JohnDoe-Pass", []PasswordViolation{{Rule: PasswordUserInputRule, Param: "username"}}},
+		{"Email", "Jdoe1984-Secure", []PasswordViolation{{Rule: PasswordUserInputRule, Param: "email"}}},
+		{"Common", "P@ssw0rd", []PasswordViolation{{Rule: PasswordCommonRule}}},
+		{"Several", "qwerty", []PasswordViolation{
+			{Rule: PasswordLengthRule, Param: "8"},
+			{Rule: PasswordCharacterClassesRule, Param: "3"},
+			{Rule: PasswordCommonRule},
+		}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.violations, policy.Check(tc.password, user))
+		})
+	}
+}
+
+func TestPasswordPolicyShortUserInputs(t *testing.T) {
+	policy := PasswordPolicy{RejectUserInputs: true}
+	require.Empty(t, policy.Check("bobsledding", PasswordUser{Username: "bo", Email: "b@example.com"}))
+}
+
+func TestPasswordPolicyFromConfig(t *testing.T) {
+	require.Equal(t, DefaultPasswordPolicy, PasswordPolicyFromConfig(util.Config{}))
+
+	policy := PasswordPolicyFromConfig(util.Config{
+		PasswordMinLength:           2,
+		PasswordMinCharacterClasses: 2,
+		PasswordAllowUserInputs:     true,
+		PasswordAllowCommon:         true,
+	})
+	require.Equal(t, PasswordPolicy{MinLength: MinPasswordLength, MaxLength: DefaultPasswordPolicy.MaxLength, MinCharacterClasses: 2}, policy)
+
+	policy = PasswordPolicyFromConfig(util.Config{PasswordMaxLength: 72})
+	require.Equal(t, 72, policy.MaxLength)
+}
+
+func TestPasswordViolationError(t *testing.T) {
+	require.EqualError(t, PasswordViolation{Rule: PasswordLengthRule, Param: "8"}, "must contain at least 8 characters")
+	require.EqualError(t, PasswordViolation{Rule: PasswordMaxLengthRule, Param: "128"}, "must contain at most 128 bytes")
+	require.EqualError(t, PasswordViolation{Rule: PasswordUserInputRule, Param: "username"}, "must not contain the username")
+}
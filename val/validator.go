@@ -0,0 +1,156 @@
+package val
+
+import (
+	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/dpsigor/cheatsheet-golang-postgres/util"
+)
+
+// Validation rules shared by the HTTP and gRPC servers
+const (
+	MinPasswordLength = 6
+	MinPageSize       = 5
+	MaxPageSize       = 10
+	TOTPCodeLength    = 6
+	MaxLoginCodeSize  = 32
+)
+
+var (
+	isValidUsername = regexp.MustCompile(`^[a-zA-Z0-9]+$`).MatchString
+	isValidTOTPCode = regexp.MustCompile(fmt.Sprintf(`^[0-9]{%d}$`, TOTPCodeLength)).MatchString
+)
+
+// ValidateUsername checks that the username is a non empty alphanumeric string
+func ValidateUsername(value string) error {
+	if !isValidUsername(value) {
+		return fmt.Errorf("must contain only letters or digits")
+	}
+	return nil
+}
+
+// ValidatePassword checks that the password is long enough
+func ValidatePassword(value string) error {
+	if utf8.RuneCountInString(value) < MinPasswordLength {
+		return fmt.Errorf("must contain at least %d characters", MinPasswordLength)
+	}
+	return nil
+}
+
+// ValidateFullName checks that the full name is not empty
+func ValidateFullName(value string) error {
+	if len(value) == 0 {
+		return fmt.Errorf("must not be empty")
+	}
+	return nil
+}
+
+// ValidateEmail checks that the email is a valid address
+func ValidateEmail(value string) error {
+	addr, err := mail.ParseAddress(value)
+	if err != nil || addr.Address != value {
+		return fmt.Errorf("is not a valid email address")
+	}
+	return nil
+}
+
+// ValidateCurrency checks that the currency is supported
+func ValidateCurrency(value string) error {
+	if !util.IsSupportedCurrency(value) {
+		return fmt.Errorf("unsupported currency %q", value)
+	}
+	return nil
+}
+
+// ValidateScope checks that the scope of a token or an API key is supported
+func ValidateScope(value string) error {
+	if !util.IsSupportedScope(value) {
+		return fmt.Errorf("unsupported scope %q", value)
+	}
+	return nil
+}
+
+// ValidateOAuthScope checks that third-party OAuth clients may be granted
+// the scope
+func ValidateOAuthScope(value string) error {
+	if !util.IsOAuthScope(value) {
+		return fmt.Errorf("scope %q cannot be granted to OAuth clients", value)
+	}
+	return nil
+}
+
+// ValidateRedirectURI checks that the redirect URI of an OAuth client is an
+// absolute URL without fragment, using HTTPS unless it is on the loopback
+// interface, where native apps receive the code
+func ValidateRedirectURI(value string) error {
+	u, err := url.Parse(value)
+	if err != nil || !u.IsAbs() || u.Host == "" {
+		return fmt.Errorf("must be an absolute URL")
+	}
+	if strings.Contains(value, "#") {
+		return fmt.Errorf("must not contain a fragment")
+	}
+	switch u.Scheme {
+	case "https":
+		return nil
+	case "http":
+		if host := u.Hostname(); host == "localhost" || net.ParseIP(host).IsLoopback() {
+			return nil
+		}
+	}
+	return fmt.Errorf("must use https, or http on the loopback interface")
+}
+
+// ValidateID checks that the id is a positive number
+func ValidateID(value int64) error {
+	if value < 1 {
+		return fmt.Errorf("must be at least 1")
+	}
+	return nil
+}
+
+// ValidateAmount checks that the amount of money is positive
+func ValidateAmount(value int64) error {
+	if value <= 0 {
+		return fmt.Errorf("must be greater than 0")
+	}
+	return nil
+}
+
+// ValidatePageID checks that the page number is positive
+func ValidatePageID(value int32) error {
+	if value < 1 {
+		return fmt.Errorf("must be at least 1")
+	}
+	return nil
+}
+
+// ValidatePageSize checks that the page size is within the allowed range
+func ValidatePageSize(value int32) error {
+	if value < MinPageSize || value > MaxPageSize {
+		return fmt.Errorf("must be between %d and %d", MinPageSize, MaxPageSize)
+	}
+	return nil
+}
+
+// ValidateTOTPCode checks that the code has the digits of a TOTP code
+func ValidateTOTPCode(value string) error {
+	if !isValidTOTPCode(value) {
+		return fmt.Errorf("must contain exactly %d digits", TOTPCodeLength)
+	}
+	return nil
+}
+
+// ValidateLoginCode checks that the code answering a login challenge, a TOTP
+// code or a recovery code, is not empty nor too long
+func ValidateLoginCode(value string) error {
+	if len(value) == 0 || len(value) > MaxLoginCodeSize {
+		return fmt.Errorf("must contain between 1 and %d characters", MaxLoginCodeSize)
+	}
+	return nil
+}
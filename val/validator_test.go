@@ -0,0 +1,55 @@
+package val
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateUsername(t *testing.T) {
+	require.NoError(t, ValidateUsername("doejohn2"))
+	require.Error(t, ValidateUsername(""))
+	require.Error(t, ValidateUsername("doe_john"))
+}
+
+func TestValidateEmail(t *testing.T) {
+	require.NoError(t, ValidateEmail("john@doe.com"))
+	require.Error(t, ValidateEmail("john"))
+	require.Error(t, ValidateEmail("John Doe <john@doe.com>"))
+}
+
+func TestValidatePageSize(t *testing.T) {
+	require.NoError(t, ValidatePageSize(MinPageSize))
+	require.NoError(t, ValidatePageSize(MaxPageSize))
+	require.Error(t, ValidatePageSize(MinPageSize-1))
+	require.Error(t, ValidatePageSize(MaxPageSize+1))
+}
+
+func TestValidateTOTPCode(t *testing.T) {
+	require.NoError(t, ValidateTOTPCode("012345"))
+	require.Error(t, ValidateTOTPCode("12345"))
+	require.Error(t, ValidateTOTPCode("-12345"))
+	require.Error(t, ValidateTOTPCode("1234567"))
+}
+
+func TestValidateScope(t *testing.T) {
+	require.NoError(t, ValidateScope("transfers:write"))
+	require.Error(t, ValidateScope(""))
+	require.Error(t, ValidateScope("transfers:admin"))
+}
+
+func TestValidateOAuthScope(t *testing.T) {
+	require.NoError(t, ValidateOAuthScope("accounts:read"))
+	require.Error(t, ValidateOAuthScope("users:write"))
+	require.Error(t, ValidateOAuthScope("accounts:admin"))
+}
+
+func TestValidateRedirectURI(t *testing.T) {
+	require.NoError(t, ValidateRedirectURI("https://budget.example.com/callback?source=bank"))
+	require.NoError(t, ValidateRedirectURI("http://127.0.0.1:8123/callback"))
+	require.NoError(t, ValidateRedirectURI("http://localhost/callback"))
+	require.Error(t, ValidateRedirectURI("http://budget.example.com/callback"))
+	require.Error(t, ValidateRedirectURI("https://budget.example.com/callback#token"))
+	require.Error(t, ValidateRedirectURI("/callback"))
+	require.Error(t, ValidateRedirectURI("budget://callback"))
+}